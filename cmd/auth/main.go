@@ -2,6 +2,7 @@ package main
 
 import (
 	_ "github.com/xiaohangshuhub/xiaohangshu/api/auths/docs" // swagger 一定要有这行,指向你的文档地址
+	"github.com/xiaohangshuhub/xiaohangshu/internal/infra"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi"
 
 	"github.com/xiaohangshuhub/go-workit/pkg/webapp"
@@ -12,6 +13,16 @@ func main() {
 	// 创建 Web 主机构建器
 	builder := webapp.NewBuilder()
 
+	// 配置数据库,未配置 database.driver 时不连接数据库
+	if builder.Config().GetString("database.driver") != "" {
+		builder.AddDbContext(infra.DbContext(builder.Config()))
+	}
+
+	// 配置 Redis,未配置 redis.addr 时不连接 Redis
+	if builder.Config().GetString("redis.addr") != "" {
+		builder.AddCacheContext(infra.CacheContext(builder.Config()))
+	}
+
 	// 配置依赖注入
 	builder.AddServices(webapi.DependencyInjection()...)
 
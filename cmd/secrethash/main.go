@@ -0,0 +1,58 @@
+// secrethash 生成客户端密钥与用户密码哈希
+//
+// 从标准输入读取明文密钥(每行一个),输出 argon2id 哈希,
+// 用于填写 oauth2.clients[].secret、oauth2.clients[].secrets[].hash 或 user.users[].password;
+// 使用 -generate 时生成一个随机密钥并同时输出明文与哈希。
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+)
+
+func main() {
+
+	generate := flag.Bool("generate", false, "生成随机密钥,输出明文与哈希")
+	flag.Parse()
+
+	if *generate {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			fail(err)
+		}
+		plain := base64.RawURLEncoding.EncodeToString(b)
+		fmt.Println("secret:", plain)
+		fmt.Println("hash:  ", hash(plain))
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			fmt.Println(hash(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fail(err)
+	}
+}
+
+// hash 计算 argon2id 哈希
+func hash(plain string) string {
+	h, err := password.Hash(plain)
+	if err != nil {
+		fail(err)
+	}
+	return h
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
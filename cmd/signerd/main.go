@@ -0,0 +1,115 @@
+// signerd 本地签名服务
+//
+// 在独立进程中持有并轮换签名私钥,通过 unix socket 向身份中心提供签名,
+// 身份中心配置 oauth2.keys.signer: socket 后私钥不再进入身份中心进程。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"go.uber.org/zap"
+)
+
+func main() {
+
+	socket := flag.String("socket", "/run/signerd/signer.sock", "监听的 unix socket 路径")
+	store := flag.String("store", "./data/signing_keys.json", "密钥文件路径,多个签名服务实例可共享")
+	kekFile := flag.String("kek-file", "", "密钥加密密钥文件,内容为 base64 编码的 32 字节;为空时私钥明文保存,仅靠文件权限 0600 保护")
+	alg := flag.String("alg", "RS256", "签名算法")
+	importKey := flag.String("import", "", "首次启动时导入的 PEM 私钥")
+	kid := flag.String("kid", "kid", "导入私钥的 kid 种子,与 oauth2.manager.kid 保持一致")
+	rotation := flag.Duration("rotation", time.Hour*24*30, "签名密钥轮换周期,0 表示不自动轮换")
+	check := flag.Duration("check", time.Minute, "检查轮换的间隔")
+	accessTokenExp := flag.Int("access-token-exp", 3600, "访问令牌有效期(秒),与授权服务配置中最长的访问令牌有效期保持一致,决定退役公钥的保留时长")
+	idTokenExp := flag.Int("id-token-exp", 3600, "ID Token 有效期(秒),与授权服务配置中最长的 ID Token 有效期保持一致")
+	flag.Parse()
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Sync()
+
+	var kek string
+	if *kekFile != "" {
+		data, err := os.ReadFile(*kekFile)
+		if err != nil {
+			logger.Fatal("read kek file failed", zap.Error(err))
+		}
+		kek = string(data)
+	} else {
+		logger.Warn("kek file is not configured, signing private keys are stored unencrypted", zap.String("store", *store))
+	}
+
+	cfg := &configs.OAuth2{
+		Manager: &configs.Manager{
+			AccessTokenExp: *accessTokenExp,
+			IDTokenExp:     *idTokenExp,
+			JWTPrivateKey:  *importKey,
+			SigningMethod:  *alg,
+			Kid:            *kid,
+		},
+		Keys: &configs.Keys{
+			Store:            "file",
+			Path:             *store,
+			RotationInterval: *rotation,
+			CheckInterval:    *check,
+			KEK:              kek,
+		},
+	}
+
+	kekBytes, err := cfg.Keys.KEKBytes()
+	if err != nil {
+		logger.Fatal("invalid kek", zap.Error(err))
+	}
+
+	m, err := keys.NewManager(cfg, keys.NewFileKeyStore(*store, kekBytes), logger)
+	if err != nil {
+		logger.Fatal("load signing keys failed", zap.Error(err))
+	}
+	m.Start()
+
+	// 清理上次异常退出残留的 socket 文件
+	if err := os.Remove(*socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Fatal("remove stale socket failed", zap.Error(err))
+	}
+
+	ln, err := net.Listen("unix", *socket)
+	if err != nil {
+		logger.Fatal("listen failed", zap.String("socket", *socket), zap.Error(err))
+	}
+
+	// 只允许同一用户的进程连接
+	if err := os.Chmod(*socket, 0o600); err != nil {
+		logger.Fatal("chmod socket failed", zap.Error(err))
+	}
+
+	srv := &http.Server{Handler: keys.NewSocketHandler(m, logger)}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("serve failed", zap.Error(err))
+		}
+	}()
+	logger.Info("signer listening", zap.String("socket", *socket))
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srv.Shutdown(ctx)
+	m.Stop(ctx)
+}
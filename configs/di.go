@@ -5,5 +5,9 @@ import "go.uber.org/fx"
 func DependencyInjection() []fx.Option {
 	return []fx.Option{
 		fx.Provide(NewOAuth2),
+		fx.Provide(NewSession),
+		fx.Provide(NewUser),
+		fx.Provide(NewMail),
+		fx.Provide(NewSMS),
 	}
 }
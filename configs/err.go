@@ -3,5 +3,20 @@ package configs
 import "errors"
 
 var (
-	ErrClientNotFound = errors.New("client not found") //客户端ID错误
+	ErrClientNotFound   = errors.New("client not found")         //客户端ID错误
+	ErrResourceNotFound = errors.New("resource not found")       //资源标识错误
+	ErrInvalidLifetime  = errors.New("invalid lifetime")         //令牌有效期配置错误
+	ErrRedirectURI      = errors.New("invalid redirect uri")     //跳转地址配置错误
+	ErrClientSecret     = errors.New("invalid client secret")    //客户端密钥配置错误
+	ErrAuthMethod       = errors.New("invalid auth method")      //客户端认证方式配置错误
+	ErrRequireVerified  = errors.New("invalid require verified") //客户端要求验证的联系方式配置错误
+	ErrSessionConfig    = errors.New("invalid session config")   //登录会话配置错误
+	ErrUserConfig       = errors.New("invalid user config")      //用户配置错误
+	ErrMailConfig       = errors.New("invalid mail config")      //邮件配置错误
+	ErrSMSConfig        = errors.New("invalid sms config")       //短信配置错误
+	ErrKeysConfig       = errors.New("invalid keys config")      //签名密钥配置错误
+	ErrEncryption       = errors.New("invalid encryption")       //客户端 ID Token 或用户信息加密配置错误
+
+	ErrDatabaseNotConfigured = errors.New("database driver is not configured") //使用数据库存储但未配置 database.driver
+	ErrRedisNotConfigured    = errors.New("redis is not configured")           //使用 Redis 存储但未配置 redis.addr
 )
@@ -0,0 +1,176 @@
+package configs
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxAuthorizationCodeLifetime 授权码有效期上限(RFC 6749 4.1.2 建议不超过 10 分钟)
+const MaxAuthorizationCodeLifetime = time.Minute * 10
+
+// GrantLifetimes 按授权类型覆盖的令牌有效期,未配置(0)的项沿用客户端配置
+type GrantLifetimes struct {
+	AccessToken          time.Duration `yaml:"access_token,omitempty" mapstructure:"access_token"`                     // 访问令牌有效期,如 15m
+	IDToken              time.Duration `yaml:"id_token,omitempty" mapstructure:"id_token"`                             // ID Token 有效期
+	RefreshTokenAbsolute time.Duration `yaml:"refresh_token_absolute,omitempty" mapstructure:"refresh_token_absolute"` // 刷新令牌绝对有效期
+}
+
+// AuthorizationCodeTTL 授权码有效期
+func (m *Manager) AuthorizationCodeTTL() time.Duration {
+	return time.Second * time.Duration(m.AuthorizationCodeExp)
+}
+
+// RefreshTokenTTL 刷新令牌绝对有效期
+func (m *Manager) RefreshTokenTTL() time.Duration {
+	return time.Second * time.Duration(m.RefreshTokenExp)
+}
+
+// AccessTokenLifetime 访问令牌有效期
+//
+// 按 授权类型覆盖 > 客户端配置 > 全局配置 的顺序取第一个非零值;
+// 刷新令牌换取的访问令牌按最初的授权类型计算
+//
+// 参数:
+//
+//	clientID: 客户端ID
+//	grantType: 最初的授权类型,如 authorization_code, client_credentials
+//
+// 返回值:
+//
+//	time.Duration: 有效期
+func (o *OAuth2) AccessTokenLifetime(clientID, grantType string) time.Duration {
+	if client, err := o.GetClient(clientID); err == nil {
+		if g := client.GrantLifetimes[grantType]; g != nil && g.AccessToken > 0 {
+			return g.AccessToken
+		}
+		if client.AccessTokenLifetime > 0 {
+			return client.AccessTokenLifetime
+		}
+	}
+	return o.Manager.AccessTokenTTL()
+}
+
+// IDTokenLifetime ID Token 有效期,取值顺序同 AccessTokenLifetime
+func (o *OAuth2) IDTokenLifetime(clientID, grantType string) time.Duration {
+	if client, err := o.GetClient(clientID); err == nil {
+		if g := client.GrantLifetimes[grantType]; g != nil && g.IDToken > 0 {
+			return g.IDToken
+		}
+		if client.IDTokenLifetime > 0 {
+			return client.IDTokenLifetime
+		}
+	}
+	return o.Manager.IDTokenTTL()
+}
+
+// RefreshTokenLifetime 刷新令牌绝对有效期,取值顺序同 AccessTokenLifetime
+func (o *OAuth2) RefreshTokenLifetime(clientID, grantType string) time.Duration {
+	client, _ := o.GetClient(clientID)
+	return o.refreshTokenLifetime(client, grantType)
+}
+
+// refreshTokenLifetime 按客户端配置计算刷新令牌绝对有效期,client 为空时使用全局配置
+func (o *OAuth2) refreshTokenLifetime(client *Client, grantType string) time.Duration {
+	if client != nil {
+		if g := client.GrantLifetimes[grantType]; g != nil && g.RefreshTokenAbsolute > 0 {
+			return g.RefreshTokenAbsolute
+		}
+		if client.RefreshTokenAbsoluteLifetime > 0 {
+			return client.RefreshTokenAbsoluteLifetime
+		}
+	}
+	return o.Manager.RefreshTokenTTL()
+}
+
+// AuthorizationCodeLifetime 授权码有效期,客户端未配置时使用全局配置
+func (o *OAuth2) AuthorizationCodeLifetime(clientID string) time.Duration {
+	if client, err := o.GetClient(clientID); err == nil && client.AuthorizationCodeLifetime > 0 {
+		return client.AuthorizationCodeLifetime
+	}
+	return o.Manager.AuthorizationCodeTTL()
+}
+
+// MaxSignedTokenLifetime 本服务签名的令牌(访问令牌与 ID Token)可能的最长有效期
+// 退役的签名公钥至少保留这么久,保证已签发的令牌仍可校验;
+// 按全局配置与配置文件中的客户端计算,数据库中的客户端不得超过该值,见 ValidateClient
+func (o *OAuth2) MaxSignedTokenLifetime() time.Duration {
+
+	lifetime := max(o.Manager.AccessTokenTTL(), o.Manager.IDTokenTTL())
+
+	for _, c := range o.Clients {
+		lifetime = max(lifetime, c.maxSignedTokenLifetime())
+	}
+
+	return lifetime
+}
+
+// maxSignedTokenLifetime 客户端单独配置的签名令牌最长有效期
+func (c *Client) maxSignedTokenLifetime() time.Duration {
+
+	lifetime := max(c.AccessTokenLifetime, c.IDTokenLifetime)
+	for _, g := range c.GrantLifetimes {
+		if g != nil {
+			lifetime = max(lifetime, g.AccessToken, g.IDToken)
+		}
+	}
+
+	return lifetime
+}
+
+// ValidateLifetimes 校验令牌有效期配置
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrInvalidLifetime: 有效期配置错误,错误信息中包含具体的客户端与配置项
+func (o *OAuth2) ValidateLifetimes() error {
+
+	m := o.Manager
+	if m.AccessTokenExp <= 0 || m.IDTokenExp <= 0 || m.RefreshTokenExp <= 0 || m.AuthorizationCodeExp <= 0 {
+		return fmt.Errorf("%w: manager access_token_exp, id_token_exp, refresh_token_exp and authorization_code_exp must be positive seconds", ErrInvalidLifetime)
+	}
+	if m.AuthorizationCodeTTL() > MaxAuthorizationCodeLifetime {
+		return fmt.Errorf("%w: manager authorization_code_exp must not exceed %s", ErrInvalidLifetime, MaxAuthorizationCodeLifetime)
+	}
+
+	for _, c := range o.Clients {
+		if err := o.validateClientLifetimes(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateClientLifetimes 校验单个客户端的有效期配置
+func (o *OAuth2) validateClientLifetimes(c *Client) error {
+
+	if c.AccessTokenLifetime < 0 || c.IDTokenLifetime < 0 || c.AuthorizationCodeLifetime < 0 ||
+		c.RefreshTokenAbsoluteLifetime < 0 || c.RefreshTokenIdleLifetime < 0 {
+		return fmt.Errorf("%w: client %s has a negative lifetime", ErrInvalidLifetime, c.ID)
+	}
+	if c.AuthorizationCodeLifetime > MaxAuthorizationCodeLifetime {
+		return fmt.Errorf("%w: client %s authorization_code_lifetime must not exceed %s", ErrInvalidLifetime, c.ID, MaxAuthorizationCodeLifetime)
+	}
+
+	for gt, g := range c.GrantLifetimes {
+		if gt == "refresh_token" || !c.ContainsGrantType(gt) {
+			return fmt.Errorf("%w: client %s grant_lifetimes has unregistered grant type %q", ErrInvalidLifetime, c.ID, gt)
+		}
+		if g != nil && (g.AccessToken < 0 || g.IDToken < 0 || g.RefreshTokenAbsolute < 0) {
+			return fmt.Errorf("%w: client %s grant %s has a negative lifetime", ErrInvalidLifetime, c.ID, gt)
+		}
+	}
+
+	// 空闲有效期超过绝对有效期时不会生效,视为配置错误
+	for _, gt := range c.GrantTypes {
+		if c.RefreshTokenIdleLifetime > o.refreshTokenLifetime(c, gt) {
+			return fmt.Errorf("%w: client %s refresh_token_idle_lifetime exceeds the absolute lifetime of grant %s", ErrInvalidLifetime, c.ID, gt)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package configs
+
+import (
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// 邮件发送方式
+const (
+	MailDriverSMTP   = "smtp"
+	MailDriverFile   = "file"
+	MailDriverMemory = "memory"
+)
+
+// Mail 邮件配置
+type Mail struct {
+	Driver string    `yaml:"driver" mapstructure:"driver"` // 发送方式: smtp, file(写入 dir 目录,用于测试), memory(只写入日志,用于本地联调)
+	From   string    `yaml:"from" mapstructure:"from"`     // 发件人,如 "Xiaohangshu <no-reply@example.com>"
+	Dir    string    `yaml:"dir" mapstructure:"dir"`       // file 方式的邮件保存目录
+	SMTP   *MailSMTP `yaml:"smtp" mapstructure:"smtp"`     // smtp 方式的服务器配置
+}
+
+// MailSMTP SMTP 服务器配置
+type MailSMTP struct {
+	Host     string        `yaml:"host" mapstructure:"host"`         // 服务器地址
+	Port     int           `yaml:"port" mapstructure:"port"`         // 端口
+	Username string        `yaml:"username" mapstructure:"username"` // 用户名,为空时不认证
+	Password string        `yaml:"password" mapstructure:"password"` // 密码(建议从环境变量注入)
+	TLS      string        `yaml:"tls" mapstructure:"tls"`           // 加密方式: starttls, tls, none
+	Timeout  time.Duration `yaml:"timeout" mapstructure:"timeout"`   // 连接与发送超时
+}
+
+// NewMail 读取邮件配置
+//
+// 参数:
+//
+//	cfgm: 配置
+//	log: 日志对象
+//
+// 返回值:
+//
+//	*Mail: 邮件配置
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMailConfig: 发送方式、发件人或 SMTP 配置不合法
+func NewMail(cfgm *viper.Viper, log *zap.Logger) (*Mail, error) {
+
+	// 默认配置
+	cfg := &Mail{
+		Driver: MailDriverMemory,
+		From:   "Xiaohangshu <no-reply@localhost>",
+		Dir:    "./data/mail",
+		SMTP: &MailSMTP{
+			Port:    587,
+			TLS:     "starttls",
+			Timeout: time.Second * 10,
+		},
+	}
+
+	if cfgm != nil {
+		if err := cfgm.UnmarshalKey("mail", cfg); err != nil {
+			log.Error("Failed to unmarshal mail configuration", zap.Error(err))
+		}
+	}
+
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("%w: invalid from %q", ErrMailConfig, cfg.From)
+	}
+
+	switch cfg.Driver {
+	case MailDriverMemory, MailDriverFile:
+	case MailDriverSMTP:
+		if cfg.SMTP == nil || cfg.SMTP.Host == "" || cfg.SMTP.Port <= 0 {
+			return nil, fmt.Errorf("%w: smtp host and port are required", ErrMailConfig)
+		}
+		switch cfg.SMTP.TLS {
+		case "starttls", "tls", "none":
+		default:
+			return nil, fmt.Errorf("%w: unsupported smtp tls %q", ErrMailConfig, cfg.SMTP.TLS)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported driver %q", ErrMailConfig, cfg.Driver)
+	}
+
+	return cfg, nil
+}
@@ -1,63 +1,548 @@
 package configs
 
 import (
+	"encoding/base64"
+	"fmt"
 	"slices"
+	"strings"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/oauth2"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
 	"go.uber.org/zap"
 )
 
 type OAuth2 struct {
-	Issuer   string    `yaml:"issuer" mapstructure:"issuer"`
-	LoginURL string    `yaml:"login_url" mapstructure:"login_url"`
-	Manager  *Manager  `yaml:"manager" mapstructure:"manager"`
-	Clients  []*Client `yaml:"clients" mapstructure:"clients"`
+	Issuer         string        `yaml:"issuer" mapstructure:"issuer"`
+	LoginURL       string        `yaml:"login_url" mapstructure:"login_url"`
+	AdminScope     string        `yaml:"admin_scope" mapstructure:"admin_scope"`           // 调用管理接口的访问令牌须包含的权限范围
+	ClientStore    string        `yaml:"client_store" mapstructure:"client_store"`         // 客户端存储: memory(配置文件), database(数据库,配置文件中的客户端作为初始数据导入)
+	ClientCacheTTL time.Duration `yaml:"client_cache_ttl" mapstructure:"client_cache_ttl"` // 数据库存储时客户端元数据的缓存时长,0 表示不缓存;本实例修改密钥时立即失效
+	Manager        *Manager      `yaml:"manager" mapstructure:"manager"`
+	Keys           *Keys         `yaml:"keys" mapstructure:"keys"`
+	Tokens         *Tokens       `yaml:"tokens" mapstructure:"tokens"`
+	Authorize      *Authorize    `yaml:"authorize" mapstructure:"authorize"`
+	Endpoints      *Endpoints    `yaml:"endpoints" mapstructure:"endpoints"`
+	CIBA           *CIBA         `yaml:"ciba" mapstructure:"ciba"`
+	Resources      []*Resource   `yaml:"resources" mapstructure:"resources"`
+	Clients        []*Client     `yaml:"clients" mapstructure:"clients"`
+
+	source ClientSource // 客户端元数据来源,为空时使用 Clients
 }
 
+// 客户端存储
+const (
+	ClientStoreMemory   = "memory"
+	ClientStoreDatabase = "database"
+)
+
+// ClientSource 客户端元数据来源
+// 客户端保存在数据库时由客户端存储实现,GetClient 及依赖它的有效期、权限范围等配置均从中读取
+type ClientSource interface {
+	ClientMetadata(id string) (*Client, error)
+}
+
+// 令牌端点客户端认证方式(RFC 7591 2)
+const (
+	AuthMethodClientSecretBasic = "client_secret_basic" // HTTP Basic 认证
+	AuthMethodClientSecretPost  = "client_secret_post"  // 表单参数 client_id/client_secret
+	AuthMethodNone              = "none"                // 公开客户端,不认证
+)
+
+// 支持的 ID Token 与用户信息 JWE 算法
+var (
+	KeyEncryptionAlgorithms     = []string{"RSA-OAEP", "RSA-OAEP-256", "ECDH-ES", "ECDH-ES+A128KW", "ECDH-ES+A256KW"} // 密钥加密算法
+	ContentEncryptionAlgorithms = []string{"A128CBC-HS256", "A256CBC-HS512", "A128GCM", "A256GCM"}                    // 内容加密算法
+)
+
+// Manager 令牌管理器配置,有效期单位均为秒,作为客户端未单独配置时的默认值
 type Manager struct {
-	AccessTokenExp  int    `yaml:"access_token_exp" mapstructure:"access_token_exp"`
-	RefreshTokenExp int    `yaml:"refresh_token_exp" mapstructure:"refresh_token_exp"`
-	TokenType       string `yaml:"token_type,omitempty" mapstructure:"token_type"`
-	JWTPrivateKey   string `yaml:"jwt_private_key,omitempty" mapstructure:"jwt_private_key"` // JWT签名密钥
-	JWTPublicKey    string `yaml:"jwt_public_key,omitempty" mapstructure:"jwt_public_key"`
-	SigningMethod   string `yaml:"signing_method,omitempty" mapstructure:"signing_method"`
-	Kid             string `yaml:"kid,omitempty" mapstructure:"kid"`
+	AccessTokenExp       int    `yaml:"access_token_exp" mapstructure:"access_token_exp"`             // 访问令牌有效期(秒)
+	IDTokenExp           int    `yaml:"id_token_exp" mapstructure:"id_token_exp"`                     // ID Token 有效期(秒)
+	RefreshTokenExp      int    `yaml:"refresh_token_exp" mapstructure:"refresh_token_exp"`           // 刷新令牌绝对有效期(秒)
+	AuthorizationCodeExp int    `yaml:"authorization_code_exp" mapstructure:"authorization_code_exp"` // 授权码有效期(秒),不超过 600
+	TokenType            string `yaml:"token_type,omitempty" mapstructure:"token_type"`
+	JWTPrivateKey        string `yaml:"jwt_private_key,omitempty" mapstructure:"jwt_private_key"` // JWT签名密钥
+	JWTPublicKey         string `yaml:"jwt_public_key,omitempty" mapstructure:"jwt_public_key"`
+	SigningMethod        string `yaml:"signing_method,omitempty" mapstructure:"signing_method"`
+	Kid                  string `yaml:"kid,omitempty" mapstructure:"kid"`
+}
+
+// Keys 签名密钥配置
+type Keys struct {
+	Signer           string        `yaml:"signer" mapstructure:"signer"`                       // 签名方式: local(进程内持有私钥), socket(委托本地签名服务,私钥不进入本进程)
+	Socket           string        `yaml:"socket" mapstructure:"socket"`                       // socket 签名服务监听的 unix socket 路径
+	Store            string        `yaml:"store" mapstructure:"store"`                         // local 签名时的密钥存储: memory(仅单实例), file(多副本挂载同一共享卷), redis(需配置 redis.addr)
+	Path             string        `yaml:"path" mapstructure:"path"`                           // file 存储的密钥文件路径,须位于各副本共享的卷上
+	KeyPrefix        string        `yaml:"key_prefix" mapstructure:"key_prefix"`               // redis 存储的键前缀
+	RotationInterval time.Duration `yaml:"rotation_interval" mapstructure:"rotation_interval"` // 签名密钥轮换周期,如 720h; 0 表示不自动轮换
+	CheckInterval    time.Duration `yaml:"check_interval" mapstructure:"check_interval"`       // 检查轮换并同步其他副本变更的间隔
+	KEK              string        `yaml:"kek" mapstructure:"kek"`                             // file 与 redis 存储的密钥加密密钥(base64 编码的 32 字节),私钥以 AES-256-GCM 加密保存;为空时私钥明文保存,仅靠文件权限 0600 保护
+}
+
+// 签名密钥存储
+const (
+	KeyStoreMemory = "memory"
+	KeyStoreFile   = "file"
+	KeyStoreRedis  = "redis"
+)
+
+// KEKBytes 解码密钥加密密钥,未配置时返回空
+//
+// 返回值:
+//
+//	[]byte: 32 字节的密钥加密密钥
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrKeysConfig: 不是 base64 编码或长度不是 32 字节
+func (k *Keys) KEKBytes() ([]byte, error) {
+
+	v := strings.TrimSpace(k.KEK)
+	if v == "" {
+		return nil, nil
+	}
+
+	kek, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: kek is not valid base64: %v", ErrKeysConfig, err)
+	}
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("%w: kek must be 32 bytes, got %d", ErrKeysConfig, len(kek))
+	}
+
+	return kek, nil
+}
+
+// 令牌存储
+const (
+	TokenStoreMemory   = "memory"
+	TokenStoreDatabase = "database"
+	TokenStoreRedis    = "redis"
+)
+
+// Tokens 授权码、令牌与刷新令牌族的存储配置
+type Tokens struct {
+	Store         string        `yaml:"store" mapstructure:"store"`                   // 存储方式: memory(单实例,重启后失效), database(数据库,需配置 database.driver), redis(需配置 redis.addr)
+	PurgeInterval time.Duration `yaml:"purge_interval" mapstructure:"purge_interval"` // database 存储清理过期记录的间隔,如 10m; redis 存储按 TTL 过期
+	KeyPrefix     string        `yaml:"key_prefix" mapstructure:"key_prefix"`         // redis 存储的键前缀
+}
+
+// Authorize 授权端点配置
+type Authorize struct {
+	ResponseTypes        []string `yaml:"response_types" mapstructure:"response_types"`                 // 允许的响应类型: code, token
+	CodeChallengeMethods []string `yaml:"code_challenge_methods" mapstructure:"code_challenge_methods"` // 允许的 PKCE 方法: S256, plain
+	ForcePKCE            bool     `yaml:"force_pkce" mapstructure:"force_pkce"`                         // 是否强制授权码模式使用 PKCE
+}
+
+// Endpoints 可选端点开关,关闭的端点不注册路由,也不出现在发现文档中
+type Endpoints struct {
+	Introspection bool `yaml:"introspection" mapstructure:"introspection"` // 令牌内省 /connect/introspect (RFC 7662)
+	Revocation    bool `yaml:"revocation" mapstructure:"revocation"`       // 令牌撤销 /connect/revoke (RFC 7009)
+	EndSession    bool `yaml:"end_session" mapstructure:"end_session"`     // 登出 /connect/endsession
+}
+
+// CIBA 客户端发起的后端认证(Client-Initiated Backchannel Authentication)配置
+type CIBA struct {
+	Enabled   bool   `yaml:"enabled" mapstructure:"enabled"`       // 是否启用 /connect/ciba 端点
+	ExpiresIn int    `yaml:"expires_in" mapstructure:"expires_in"` // auth_req_id 有效期(秒)
+	Interval  int    `yaml:"interval" mapstructure:"interval"`     // poll 模式下的最小轮询间隔(秒)
+	Notifier  string `yaml:"notifier" mapstructure:"notifier"`     // 认证设备通知方式,目前支持: log
+}
+
+// 访问令牌格式
+const (
+	AccessTokenFormatJWT       = "jwt"       // 自包含的 JWT(RFC 9068),资源服务器可离线校验
+	AccessTokenFormatReference = "reference" // 不透明的引用令牌,仅能通过内省端点解析,撤销立即生效
+)
+
+// Resource 受保护资源(资源服务器)配置
+// 访问令牌的 aud 与可选声明按资源决定
+type Resource struct {
+	ID                string   `yaml:"id" mapstructure:"id"`                                             // 资源标识,作为访问令牌的 aud,可通过 resource 参数指定
+	Scopes            []string `yaml:"scopes" mapstructure:"scopes"`                                     // 属于该资源的权限范围,未指定 resource 参数时按 scope 匹配资源
+	Claims            []string `yaml:"claims" mapstructure:"claims"`                                     // 访问令牌中的可选声明: scope, auth_time, acr, amr; 为空表示全部
+	AccessTokenFormat string   `yaml:"access_token_format,omitempty" mapstructure:"access_token_format"` // 访问令牌格式: jwt(默认), reference
+	Clients           []string `yaml:"clients,omitempty" mapstructure:"clients"`                         // 资源服务器调用内省端点时认证所用的客户端ID,只有这些客户端可以内省令牌
+}
+
+// DefaultSecretID 通过 secret 配置的单个密钥的ID
+const DefaultSecretID = "default"
+
+// ClientSecret 客户端密钥配置,只保存哈希,可用 cmd/secrethash 生成
+type ClientSecret struct {
+	ID        string    `yaml:"id" mapstructure:"id"`                           // 密钥ID,撤销时使用
+	Hash      string    `yaml:"hash" mapstructure:"hash"`                       // bcrypt 或 argon2id 哈希
+	ExpiresAt time.Time `yaml:"expires_at,omitempty" mapstructure:"expires_at"` // 过期时间(RFC 3339),不配置表示不过期
 }
 
 type Client struct {
 	ID           string   `yaml:"id" mapstructure:"id"`
-	Secret       string   `yaml:"secret" mapstructure:"secret"`
+	Secret       string   `yaml:"secret,omitempty" mapstructure:"secret"` // 单个密钥的 bcrypt/argon2id 哈希,可用 cmd/secrethash 生成; 明文时启动失败
 	RedirectURIs []string `yaml:"redirect_uris" mapstructure:"redirect_uris"`
 	Scopes       []string `yaml:"scopes" mapstructure:"scopes"`
 	GrantTypes   []string `yaml:"grant_types,omitempty" mapstructure:"grant_types"`
+
+	TokenEndpointAuthMethod string `yaml:"token_endpoint_auth_method,omitempty" mapstructure:"token_endpoint_auth_method"` // 客户端认证方式: client_secret_basic, client_secret_post, none(公开客户端); 为空表示允许 basic 与 post
+
+	Secrets []*ClientSecret `yaml:"secrets,omitempty" mapstructure:"secrets"` // 多个密钥,各自有过期时间,用于不停机轮换; 认证方式不是 none 的客户端至少配置一个密钥
+
+	PostLogoutRedirectURIs []string `yaml:"post_logout_redirect_uris,omitempty" mapstructure:"post_logout_redirect_uris"` // 登出后允许跳转的地址
+
+	AccessTokenFormat string `yaml:"access_token_format,omitempty" mapstructure:"access_token_format"` // 访问令牌格式: jwt(默认), reference; 任一目标资源为 reference 时同样发放引用令牌
+
+	RefreshTokenMode             string        `yaml:"refresh_token_mode,omitempty" mapstructure:"refresh_token_mode"`                           // 刷新令牌模式: rotation(默认,一次性使用), sliding(保持不变,有效期顺延)
+	AccessTokenLifetime          time.Duration `yaml:"access_token_lifetime,omitempty" mapstructure:"access_token_lifetime"`                     // 访问令牌有效期,如 15m; 不配置则使用 manager.access_token_exp
+	IDTokenLifetime              time.Duration `yaml:"id_token_lifetime,omitempty" mapstructure:"id_token_lifetime"`                             // ID Token 有效期; 不配置则使用 manager.id_token_exp
+	AuthorizationCodeLifetime    time.Duration `yaml:"authorization_code_lifetime,omitempty" mapstructure:"authorization_code_lifetime"`         // 授权码有效期,不超过 10m; 不配置则使用 manager.authorization_code_exp
+	RefreshTokenAbsoluteLifetime time.Duration `yaml:"refresh_token_absolute_lifetime,omitempty" mapstructure:"refresh_token_absolute_lifetime"` // 刷新令牌绝对有效期,自首次授权起计算,如 720h; 不配置则使用 manager.refresh_token_exp
+	RefreshTokenIdleLifetime     time.Duration `yaml:"refresh_token_idle_lifetime,omitempty" mapstructure:"refresh_token_idle_lifetime"`         // 刷新令牌空闲有效期,超过该时长未使用即失效,如 72h
+
+	GrantLifetimes map[string]*GrantLifetimes `yaml:"grant_lifetimes,omitempty" mapstructure:"grant_lifetimes"` // 按授权类型覆盖有效期,键为已注册的授权类型
+
+	JWKS    string `yaml:"jwks,omitempty" mapstructure:"jwks"`         // 客户端公钥集合(JSON),用于加密 ID Token 与用户信息
+	JWKSURI string `yaml:"jwks_uri,omitempty" mapstructure:"jwks_uri"` // 客户端公钥集合地址,与 jwks 二选一
+
+	IDTokenEncryptedResponseAlg  string `yaml:"id_token_encrypted_response_alg,omitempty" mapstructure:"id_token_encrypted_response_alg"` // ID Token 密钥加密算法,如 RSA-OAEP-256; 为空表示不加密
+	IDTokenEncryptedResponseEnc  string `yaml:"id_token_encrypted_response_enc,omitempty" mapstructure:"id_token_encrypted_response_enc"` // ID Token 内容加密算法,默认 A128CBC-HS256
+	UserinfoEncryptedResponseAlg string `yaml:"userinfo_encrypted_response_alg,omitempty" mapstructure:"userinfo_encrypted_response_alg"` // 用户信息密钥加密算法,设置后用户信息以先签名后加密的 JWT 返回
+	UserinfoEncryptedResponseEnc string `yaml:"userinfo_encrypted_response_enc,omitempty" mapstructure:"userinfo_encrypted_response_enc"` // 用户信息内容加密算法,默认 A128CBC-HS256
+
+	BackchannelTokenDeliveryMode          string `yaml:"backchannel_token_delivery_mode,omitempty" mapstructure:"backchannel_token_delivery_mode"`                   // CIBA 令牌投递模式: poll, ping, push
+	BackchannelClientNotificationEndpoint string `yaml:"backchannel_client_notification_endpoint,omitempty" mapstructure:"backchannel_client_notification_endpoint"` // ping/push 模式下的客户端通知地址
+
+	RequireVerified []string `yaml:"require_verified,omitempty" mapstructure:"require_verified"` // 用户须已验证的联系方式: email, phone; 未验证时授权请求跳转到 user.verification.url,密码模式与 CIBA 直接拒绝
+	RequireMFA      bool     `yaml:"require_mfa,omitempty" mapstructure:"require_mfa"`           // 用户须完成两步验证;会话未完成时授权请求跳转到 user.mfa.url,密码模式直接拒绝
 }
 
-func NewOAuth2(cfgm *viper.Viper, log *zap.Logger) *OAuth2 {
+func NewOAuth2(cfgm *viper.Viper, log *zap.Logger) (*OAuth2, error) {
 
 	// 默认配置
 	cfg := &OAuth2{
-		Issuer:   "http://localhost:8080",
-		LoginURL: "http://localhost:8081/login",
+		Issuer:         "http://localhost:8080",
+		LoginURL:       "http://localhost:8081/login",
+		AdminScope:     "client_admin",
+		ClientStore:    ClientStoreMemory,
+		ClientCacheTTL: time.Minute,
 		Manager: &Manager{
-			AccessTokenExp:  3600,
-			RefreshTokenExp: 7200,
-			TokenType:       "Bearer",
+			AccessTokenExp:       3600,
+			IDTokenExp:           3600,
+			RefreshTokenExp:      259200,
+			AuthorizationCodeExp: 600,
+			TokenType:            "Bearer",
+		},
+		Keys: &Keys{
+			Signer:           "local",
+			Socket:           "/run/signerd/signer.sock",
+			Store:            "memory",
+			Path:             "./data/signing_keys.json",
+			RotationInterval: time.Hour * 24 * 30,
+			CheckInterval:    time.Minute,
+		},
+		Tokens: &Tokens{
+			Store:         TokenStoreMemory,
+			PurgeInterval: time.Minute * 10,
+			KeyPrefix:     "oauth2:",
+		},
+		Authorize: &Authorize{},
+		Endpoints: &Endpoints{
+			Introspection: true,
+			Revocation:    true,
+			EndSession:    true,
+		},
+		CIBA: &CIBA{
+			ExpiresIn: 120,
+			Interval:  5,
+			Notifier:  "log",
 		},
 		Clients: []*Client{},
 	}
 
 	// 读取配置文件中的 OAuth2 配置
 	if cfgm != nil {
-		if err := cfgm.UnmarshalKey("oauth2", cfg); err != nil {
+		hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+		))
+		if err := cfgm.UnmarshalKey("oauth2", cfg, hook); err != nil {
 			log.Error("Failed to unmarshal OAuth2 configuration", zap.Error(err))
 
 		}
 	}
 
-	return cfg
+	// 列表类型的默认值在解析之后补齐,避免与配置文件中的值合并
+	if cfg.Keys == nil {
+		cfg.Keys = &Keys{}
+	}
+	if cfg.Keys.CheckInterval <= 0 {
+		cfg.Keys.CheckInterval = time.Minute
+	}
+	if cfg.Keys.KeyPrefix == "" {
+		cfg.Keys.KeyPrefix = "oauth2:"
+	}
+	if cfg.Tokens == nil {
+		cfg.Tokens = &Tokens{Store: TokenStoreMemory, KeyPrefix: "oauth2:"}
+	}
+	if cfg.Tokens.PurgeInterval <= 0 {
+		cfg.Tokens.PurgeInterval = time.Minute * 10
+	}
+	if cfg.Authorize == nil {
+		cfg.Authorize = &Authorize{}
+	}
+	if cfg.Endpoints == nil {
+		cfg.Endpoints = &Endpoints{}
+	}
+	if len(cfg.Authorize.ResponseTypes) == 0 {
+		cfg.Authorize.ResponseTypes = []string{"code"}
+	}
+	if len(cfg.Authorize.CodeChallengeMethods) == 0 {
+		cfg.Authorize.CodeChallengeMethods = []string{"S256"}
+	}
+
+	if _, err := cfg.Keys.KEKBytes(); err != nil {
+		return nil, err
+	}
+	switch cfg.Keys.Store {
+	case "", KeyStoreMemory, KeyStoreFile, KeyStoreRedis:
+	default:
+		return nil, fmt.Errorf("%w: unsupported store %q", ErrKeysConfig, cfg.Keys.Store)
+	}
+	if cfg.Keys.Signer != "socket" && (cfg.Keys.Store == KeyStoreFile || cfg.Keys.Store == KeyStoreRedis) && cfg.Keys.KEK == "" {
+		log.Warn("oauth2.keys.kek is not configured, signing private keys are stored unencrypted", zap.String("store", cfg.Keys.Store))
+	}
+
+	if err := cfg.ValidateLifetimes(); err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateRedirectURIs(); err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateSecrets(); err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateAuthMethods(); err != nil {
+		return nil, err
+	}
+	for _, c := range cfg.Clients {
+		if err := c.validateRequireVerified(); err != nil {
+			return nil, err
+		}
+		if err := c.validateEncryption(); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// ValidateRedirectURIs 校验客户端注册的跳转地址与登出跳转地址
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrRedirectURI: 跳转地址不合法,错误信息中包含具体的客户端与地址
+func (o *OAuth2) ValidateRedirectURIs() error {
+	for _, c := range o.Clients {
+		if err := c.validateRedirectURIs(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRedirectURIs 校验单个客户端的跳转地址与登出跳转地址
+func (c *Client) validateRedirectURIs() error {
+	for _, uri := range slices.Concat(c.RedirectURIs, c.PostLogoutRedirectURIs) {
+		if err := oauth2.ValidateRedirectURI(uri); err != nil {
+			return fmt.Errorf("%w: client %s %q: %v", ErrRedirectURI, c.ID, uri, err)
+		}
+	}
+	return nil
+}
+
+// validateRequireVerified 校验客户端要求验证的联系方式
+func (c *Client) validateRequireVerified() error {
+	for _, v := range c.RequireVerified {
+		switch v {
+		case FieldEmail, FieldPhone:
+		default:
+			return fmt.Errorf("%w: client %s require_verified %q", ErrRequireVerified, c.ID, v)
+		}
+	}
+	return nil
+}
+
+// validateEncryption 校验 ID Token 与用户信息的加密算法,设置了加密时须注册 jwks 或 jwks_uri
+func (c *Client) validateEncryption() error {
+
+	encryptions := []struct {
+		name     string
+		alg, enc string
+	}{
+		{"id_token", c.IDTokenEncryptedResponseAlg, c.IDTokenEncryptedResponseEnc},
+		{"userinfo", c.UserinfoEncryptedResponseAlg, c.UserinfoEncryptedResponseEnc},
+	}
+
+	for _, v := range encryptions {
+		if v.alg == "" {
+			// 只设置 enc 不会加密,视为配置错误
+			if v.enc != "" {
+				return fmt.Errorf("%w: client %s %s_encrypted_response_enc requires %s_encrypted_response_alg", ErrEncryption, c.ID, v.name, v.name)
+			}
+			continue
+		}
+		if !slices.Contains(KeyEncryptionAlgorithms, v.alg) {
+			return fmt.Errorf("%w: client %s %s_encrypted_response_alg %q", ErrEncryption, c.ID, v.name, v.alg)
+		}
+		if v.enc != "" && !slices.Contains(ContentEncryptionAlgorithms, v.enc) {
+			return fmt.Errorf("%w: client %s %s_encrypted_response_enc %q", ErrEncryption, c.ID, v.name, v.enc)
+		}
+		if c.JWKS == "" && c.JWKSURI == "" {
+			return fmt.Errorf("%w: client %s %s encryption requires jwks or jwks_uri", ErrEncryption, c.ID, v.name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateClient 校验单个客户端的元数据
+// 配置文件中的客户端在启动时校验,数据库中的客户端在读取时校验;
+// 数据库中的客户端的访问令牌与 ID Token 有效期不得超过 MaxSignedTokenLifetime,否则签名密钥退役后已签发的令牌可能无法校验
+//
+// 参数:
+//
+//	c: 客户端配置
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrInvalidLifetime: 有效期配置错误
+//	ErrRedirectURI: 跳转地址不合法
+//	ErrAuthMethod: 认证方式不支持
+//	ErrRequireVerified: 要求验证的联系方式不支持
+//	ErrClientSecret: 密钥不是哈希或ID重复
+//	ErrEncryption: 加密算法不支持或未注册客户端公钥集合
+func (o *OAuth2) ValidateClient(c *Client) error {
+
+	if err := o.validateClientLifetimes(c); err != nil {
+		return err
+	}
+	if lifetime := c.maxSignedTokenLifetime(); lifetime > o.MaxSignedTokenLifetime() {
+		return fmt.Errorf("%w: client %s token lifetime %s exceeds the signing key retention %s", ErrInvalidLifetime, c.ID, lifetime, o.MaxSignedTokenLifetime())
+	}
+	if err := c.validateRedirectURIs(); err != nil {
+		return err
+	}
+
+	switch c.TokenEndpointAuthMethod {
+	case "", AuthMethodClientSecretBasic, AuthMethodClientSecretPost, AuthMethodNone:
+	default:
+		return fmt.Errorf("%w: client %s token_endpoint_auth_method %q", ErrAuthMethod, c.ID, c.TokenEndpointAuthMethod)
+	}
+
+	if err := c.validateSecrets(); err != nil {
+		return err
+	}
+	if err := c.validateRequireVerified(); err != nil {
+		return err
+	}
+	return c.validateEncryption()
+}
+
+// ValidateAuthMethods 校验配置文件中客户端的认证方式
+// 公开客户端须显式配置 token_endpoint_auth_method: none,不再由未配置密钥推断
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrAuthMethod: 认证方式不支持,认证方式为 none 的客户端配置了密钥,或其他客户端未配置密钥
+func (o *OAuth2) ValidateAuthMethods() error {
+	for _, c := range o.Clients {
+		hasSecrets := c.Secret != "" || len(c.Secrets) > 0
+		switch c.TokenEndpointAuthMethod {
+		case "", AuthMethodClientSecretBasic, AuthMethodClientSecretPost:
+			if !hasSecrets {
+				return fmt.Errorf("%w: client %s has no secrets, set token_endpoint_auth_method to %s for a public client", ErrAuthMethod, c.ID, AuthMethodNone)
+			}
+		case AuthMethodNone:
+			if hasSecrets {
+				return fmt.Errorf("%w: client %s uses %s but has secrets", ErrAuthMethod, c.ID, AuthMethodNone)
+			}
+		default:
+			return fmt.Errorf("%w: client %s token_endpoint_auth_method %q", ErrAuthMethod, c.ID, c.TokenEndpointAuthMethod)
+		}
+	}
+	return nil
+}
+
+// ValidateSecrets 校验配置文件中客户端的密钥配置,见 validateSecrets
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrClientSecret: 密钥配置错误,错误信息中包含具体的客户端与密钥ID
+func (o *OAuth2) ValidateSecrets() error {
+	for _, c := range o.Clients {
+		if err := c.validateSecrets(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSecrets 校验单个客户端的密钥
+// secret 与 secrets 中的密钥均须为 bcrypt/argon2id 哈希且 ID 不重复,明文密钥不再在启动时代为哈希
+func (c *Client) validateSecrets() error {
+
+	ids := []string{}
+	if c.Secret != "" {
+		if !password.IsHash(c.Secret) {
+			return fmt.Errorf("%w: client %s secret must be a bcrypt or argon2id hash, generate one with cmd/secrethash", ErrClientSecret, c.ID)
+		}
+		ids = append(ids, DefaultSecretID)
+	}
+
+	for _, s := range c.Secrets {
+		if s.ID == "" || slices.Contains(ids, s.ID) {
+			return fmt.Errorf("%w: client %s secret id %q is empty or duplicated", ErrClientSecret, c.ID, s.ID)
+		}
+		if !password.IsHash(s.Hash) {
+			return fmt.Errorf("%w: client %s secret %s must be a bcrypt or argon2id hash", ErrClientSecret, c.ID, s.ID)
+		}
+		ids = append(ids, s.ID)
+	}
+
+	return nil
+}
+
+// AccessTokenTTL 访问令牌有效期
+func (m *Manager) AccessTokenTTL() time.Duration {
+	return time.Second * time.Duration(m.AccessTokenExp)
+}
+
+// IDTokenTTL ID Token 有效期
+func (m *Manager) IDTokenTTL() time.Duration {
+	return time.Second * time.Duration(m.IDTokenExp)
 }
 
 // GetClient 根据客户端ID获取客户端配置
+// 设置了 ClientSource 时从中读取,否则从配置文件中查找
 //
 // 参数:
 //
@@ -72,6 +557,9 @@ func NewOAuth2(cfgm *viper.Viper, log *zap.Logger) *OAuth2 {
 //
 //	ErrClientNotFound: 客户端ID错误
 func (o *OAuth2) GetClient(id string) (*Client, error) {
+	if o.source != nil {
+		return o.source.ClientMetadata(id)
+	}
 	for _, c := range o.Clients {
 		if c.ID == id {
 			return c, nil
@@ -80,6 +568,89 @@ func (o *OAuth2) GetClient(id string) (*Client, error) {
 	return nil, ErrClientNotFound
 }
 
+// SetClientSource 设置客户端元数据来源
+func (o *OAuth2) SetClientSource(source ClientSource) {
+	o.source = source
+}
+
+// GetResource 根据资源标识获取资源配置
+//
+// 参数:
+//
+//	id: 资源标识
+//
+// 返回值:
+//
+//	*Resource: 资源配置
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrResourceNotFound: 资源标识错误
+func (o *OAuth2) GetResource(id string) (*Resource, error) {
+	for _, r := range o.Resources {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return nil, ErrResourceNotFound
+}
+
+// ResourcesOf 获取客户端作为资源服务器所代表的资源
+//
+// 参数:
+//
+//	clientID: 客户端ID
+//
+// 返回值:
+//
+//	[]*Resource: 资源配置,客户端不是资源服务器时为空
+func (o *OAuth2) ResourcesOf(clientID string) []*Resource {
+	var resources []*Resource
+	for _, r := range o.Resources {
+		if slices.Contains(r.Clients, clientID) {
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
+
+// ContainsClaim 判断资源访问令牌是否包含指定可选声明
+func (r *Resource) ContainsClaim(claim string) bool {
+	return len(r.Claims) == 0 || slices.Contains(r.Claims, claim)
+}
+
+// IsReferenceToken 判断该资源是否要求引用令牌
+func (r *Resource) IsReferenceToken() bool {
+	return r.AccessTokenFormat == AccessTokenFormatReference
+}
+
+// IsReferenceToken 判断客户端是否使用引用令牌
+func (c *Client) IsReferenceToken() bool {
+	return c.AccessTokenFormat == AccessTokenFormatReference
+}
+
+// AllowsAuthMethod 判断客户端是否允许使用指定的认证方式
+// 未配置认证方式时允许 client_secret_basic 与 client_secret_post,公开客户端允许 none
+//
+// 参数:
+//
+//	method: 请求使用的认证方式
+//	public: 客户端是否为公开客户端
+//
+// 返回值:
+//
+//	bool: 允许返回true
+func (c *Client) AllowsAuthMethod(method string, public bool) bool {
+	if c.TokenEndpointAuthMethod != "" {
+		return c.TokenEndpointAuthMethod == method
+	}
+	if public {
+		return method == AuthMethodNone
+	}
+	return method == AuthMethodClientSecretBasic || method == AuthMethodClientSecretPost
+}
+
 // ContiansScope 判断客户端是否包含指定Scope
 //
 // 参数:
@@ -93,6 +664,19 @@ func (c *Client) ContainsScope(scope string) bool {
 	return slices.Contains(c.Scopes, scope)
 }
 
+// ContainsPostLogoutRedirectURI 判断客户端是否注册了指定的登出跳转地址
+//
+// 参数:
+//
+//	uri: 登出后跳转地址
+//
+// 返回值:
+//
+//	bool: 已注册返回true, 未注册返回false
+func (c *Client) ContainsPostLogoutRedirectURI(uri string) bool {
+	return slices.Contains(c.PostLogoutRedirectURIs, uri)
+}
+
 // ContainsGrantType 判断客户端是否包含指定GrantType
 //
 // 参数:
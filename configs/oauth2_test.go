@@ -0,0 +1,83 @@
+package configs
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestValidateClientEncryption(t *testing.T) {
+
+	cfg, err := NewOAuth2(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const jwks = `{"keys":[]}`
+
+	tests := []struct {
+		name   string
+		client *Client
+		err    error
+	}{
+		{"no encryption", &Client{ID: "c"}, nil},
+		{"id_token with jwks", &Client{ID: "c", JWKS: jwks, IDTokenEncryptedResponseAlg: "RSA-OAEP-256", IDTokenEncryptedResponseEnc: "A256GCM"}, nil},
+		{"userinfo with jwks_uri", &Client{ID: "c", JWKSURI: "https://rp.example.com/jwks", UserinfoEncryptedResponseAlg: "ECDH-ES"}, nil},
+		{"unsupported alg", &Client{ID: "c", JWKS: jwks, IDTokenEncryptedResponseAlg: "RSA1_5"}, ErrEncryption},
+		{"unsupported enc", &Client{ID: "c", JWKS: jwks, UserinfoEncryptedResponseAlg: "RSA-OAEP", UserinfoEncryptedResponseEnc: "A128KW"}, ErrEncryption},
+		{"enc without alg", &Client{ID: "c", JWKS: jwks, IDTokenEncryptedResponseEnc: "A256GCM"}, ErrEncryption},
+		{"no client keys", &Client{ID: "c", IDTokenEncryptedResponseAlg: "RSA-OAEP"}, ErrEncryption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := cfg.ValidateClient(tt.client); !errors.Is(err, tt.err) {
+				t.Fatalf("ValidateClient: %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateClientSecrets(t *testing.T) {
+
+	const hash = "$argon2id$v=19$m=19456,t=2,p=1$0kUCMz7rsL+poDHbr5NxAw$Dnusbouq3RhBKi4XTI/nvM5dR6zyEzAiZ5o8Q0nA+aE"
+
+	tests := []struct {
+		name   string
+		client *Client
+		err    error
+	}{
+		{"hashed secret", &Client{ID: "c", Secret: hash}, nil},
+		{"hashed secrets", &Client{ID: "c", Secrets: []*ClientSecret{{ID: "k1", Hash: hash}}}, nil},
+		{"explicit public client", &Client{ID: "c", TokenEndpointAuthMethod: AuthMethodNone}, nil},
+		{"plaintext secret", &Client{ID: "c", Secret: "client_secret_1"}, ErrClientSecret},
+		{"plaintext secrets", &Client{ID: "c", Secrets: []*ClientSecret{{ID: "k1", Hash: "client_secret_1"}}}, ErrClientSecret},
+		{"duplicated secret id", &Client{ID: "c", Secret: hash, Secrets: []*ClientSecret{{ID: DefaultSecretID, Hash: hash}}}, ErrClientSecret},
+		{"no secrets without none", &Client{ID: "c"}, ErrAuthMethod},
+		{"no secrets with basic", &Client{ID: "c", TokenEndpointAuthMethod: AuthMethodClientSecretBasic}, ErrAuthMethod},
+		{"none with secret", &Client{ID: "c", Secret: hash, TokenEndpointAuthMethod: AuthMethodNone}, ErrAuthMethod},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &OAuth2{Clients: []*Client{tt.client}}
+			err := cfg.ValidateSecrets()
+			if err == nil {
+				err = cfg.ValidateAuthMethods()
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("validate: %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// 数据库中的客户端读取时同样拒绝明文密钥
+	cfg, err := NewOAuth2(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ValidateClient(&Client{ID: "c", Secret: "client_secret_1"}); !errors.Is(err, ErrClientSecret) {
+		t.Fatalf("ValidateClient plaintext secret: %v, want %v", err, ErrClientSecret)
+	}
+}
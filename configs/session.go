@@ -0,0 +1,135 @@
+package configs
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// 登录会话存储
+const (
+	SessionStoreMemory   = "memory"
+	SessionStoreRedis    = "redis"
+	SessionStoreDatabase = "database"
+)
+
+// Session 登录会话配置
+// 会话数据保存在服务端,Cookie 中只有签名(配置 block_keys 时同时加密)的会话ID
+type Session struct {
+	Name          string        `yaml:"name" mapstructure:"name"`                     // Cookie 名称
+	Store         string        `yaml:"store" mapstructure:"store"`                   // 存储方式: memory(单实例,重启后失效), redis(需配置 redis.addr), database(需配置 database.driver)
+	KeyPrefix     string        `yaml:"key_prefix" mapstructure:"key_prefix"`         // redis 存储的键前缀
+	PurgeInterval time.Duration `yaml:"purge_interval" mapstructure:"purge_interval"` // database 存储清理过期会话的间隔
+	HashKeys      []string      `yaml:"hash_keys" mapstructure:"hash_keys"`           // 签名密钥,按字符串的原始字节使用(不做 base64 解码),至少 32 字节;第一个用于签发,其余仅用于验证,轮换时将新密钥放在首位;非开发环境必须配置
+	BlockKeys     []string      `yaml:"block_keys" mapstructure:"block_keys"`         // 加密密钥(可选),按字符串的原始字节使用,16、24 或 32 字节,与 hash_keys 按位置配对
+	MaxAge        time.Duration `yaml:"max_age" mapstructure:"max_age"`               // 会话有效期,如 1h
+	Path          string        `yaml:"path" mapstructure:"path"`                     // Cookie 路径
+	Domain        string        `yaml:"domain" mapstructure:"domain"`                 // Cookie 域名,为空表示仅当前主机
+	Secure        bool          `yaml:"secure" mapstructure:"secure"`                 // 仅通过 HTTPS 发送 Cookie
+	SameSite      string        `yaml:"same_site" mapstructure:"same_site"`           // Cookie 的 SameSite 属性: lax, strict, none;none 须同时开启 secure
+}
+
+// NewSession 读取登录会话配置
+//
+// 参数:
+//
+//	cfgm: 配置
+//	log: 日志对象
+//
+// 返回值:
+//
+//	*Session: 登录会话配置
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrSessionConfig: 存储方式或 SameSite 不合法,或非开发环境未配置签名密钥
+func NewSession(cfgm *viper.Viper, log *zap.Logger) (*Session, error) {
+
+	// 默认配置
+	cfg := &Session{
+		Name:          "xiaohangshu_session",
+		Store:         SessionStoreMemory,
+		KeyPrefix:     "session:",
+		PurgeInterval: time.Minute * 10,
+		MaxAge:        time.Hour,
+		Path:          "/",
+		SameSite:      "lax",
+	}
+
+	if cfgm != nil {
+		if err := cfgm.UnmarshalKey("session", cfg); err != nil {
+			log.Error("Failed to unmarshal session configuration", zap.Error(err))
+		}
+	}
+
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = time.Minute * 10
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = time.Hour
+	}
+
+	switch cfg.Store {
+	case SessionStoreMemory, SessionStoreRedis, SessionStoreDatabase:
+	default:
+		return nil, fmt.Errorf("%w: unsupported store %q", ErrSessionConfig, cfg.Store)
+	}
+
+	if _, err := cfg.SameSiteMode(); err != nil {
+		return nil, err
+	}
+
+	// 未配置签名密钥时每次启动随机生成,重启或多副本时会话失效,只允许在开发环境使用
+	if cfgm != nil && len(cfg.HashKeys) == 0 && !IsDevelopment(cfgm) {
+		return nil, fmt.Errorf("%w: hash_keys are required outside the %s environment", ErrSessionConfig, EnvironmentDevelopment)
+	}
+
+	return cfg, nil
+}
+
+// EnvironmentDevelopment 开发环境的 server.environment 取值
+const EnvironmentDevelopment = "dev"
+
+// IsDevelopment 判断是否为开发环境,server.environment 未配置时与 web 主机一致视为 prod
+//
+// 参数:
+//
+//	cfgm: 配置
+//
+// 返回值:
+//
+//	bool: 开发环境返回true
+func IsDevelopment(cfgm *viper.Viper) bool {
+	return strings.ToLower(cfgm.GetString("server.environment")) == EnvironmentDevelopment
+}
+
+// SameSiteMode Cookie 的 SameSite 属性
+//
+// 返回值:
+//
+//	http.SameSite: SameSite 属性,未配置时为 Lax
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrSessionConfig: 取值不合法,或为 none 但未开启 secure
+func (s *Session) SameSiteMode() (http.SameSite, error) {
+	switch strings.ToLower(s.SameSite) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		if !s.Secure {
+			return 0, fmt.Errorf("%w: same_site none requires secure", ErrSessionConfig)
+		}
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("%w: unsupported same_site %q", ErrSessionConfig, s.SameSite)
+	}
+}
@@ -0,0 +1,36 @@
+package configs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+func TestSessionHashKeysRequiredOutsideDev(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		environment string
+		hashKeys    []string
+		err         error
+	}{
+		{"dev without keys", "dev", nil, nil},
+		{"prod without keys", "prod", nil, ErrSessionConfig},
+		{"environment not set", "", nil, ErrSessionConfig},
+		{"prod with keys", "prod", []string{"0123456789abcdef0123456789abcdef"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.Set("server.environment", tt.environment)
+			v.Set("session.hash_keys", tt.hashKeys)
+
+			if _, err := NewSession(v, zap.NewNop()); !errors.Is(err, tt.err) {
+				t.Fatalf("NewSession: %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package configs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/sms"
+	"go.uber.org/zap"
+)
+
+// 短信发送方式
+const (
+	SMSDriverMemory  = "memory"
+	SMSDriverAliyun  = "aliyun"
+	SMSDriverTencent = "tencent"
+)
+
+// SMS 短信配置
+type SMS struct {
+	Driver    string            `yaml:"driver" mapstructure:"driver"`       // 发送方式: memory(只写入日志,用于本地联调), aliyun, tencent
+	SignName  string            `yaml:"sign_name" mapstructure:"sign_name"` // 短信签名,aliyun 与 tencent 方式必填
+	Templates map[string]string `yaml:"templates" mapstructure:"templates"` // 模板(verify, login)到服务商模板ID的映射,aliyun 与 tencent 方式必须全部配置
+	Timeout   time.Duration     `yaml:"timeout" mapstructure:"timeout"`     // 调用服务商接口的超时
+	Aliyun    *SMSAliyun        `yaml:"aliyun" mapstructure:"aliyun"`       // aliyun 方式的配置
+	Tencent   *SMSTencent       `yaml:"tencent" mapstructure:"tencent"`     // tencent 方式的配置
+}
+
+// SMSAliyun 阿里云短信配置
+type SMSAliyun struct {
+	AccessKeyID     string `yaml:"access_key_id" mapstructure:"access_key_id"`         // AccessKey ID
+	AccessKeySecret string `yaml:"access_key_secret" mapstructure:"access_key_secret"` // AccessKey Secret(建议从环境变量注入)
+	RegionID        string `yaml:"region_id" mapstructure:"region_id"`                 // 地域
+	Endpoint        string `yaml:"endpoint" mapstructure:"endpoint"`                   // 接口地址
+}
+
+// SMSTencent 腾讯云短信配置
+type SMSTencent struct {
+	SecretID  string `yaml:"secret_id" mapstructure:"secret_id"`   // SecretId
+	SecretKey string `yaml:"secret_key" mapstructure:"secret_key"` // SecretKey(建议从环境变量注入)
+	SDKAppID  string `yaml:"sdk_app_id" mapstructure:"sdk_app_id"` // 短信应用 SdkAppId
+	Region    string `yaml:"region" mapstructure:"region"`         // 地域
+	Endpoint  string `yaml:"endpoint" mapstructure:"endpoint"`     // 接口地址
+}
+
+// NewSMS 读取短信配置
+//
+// 参数:
+//
+//	cfgm: 配置
+//	log: 日志对象
+//
+// 返回值:
+//
+//	*SMS: 短信配置
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrSMSConfig: 发送方式不支持,或服务商的密钥、签名、模板未配置
+func NewSMS(cfgm *viper.Viper, log *zap.Logger) (*SMS, error) {
+
+	// 默认配置
+	cfg := &SMS{
+		Driver:  SMSDriverMemory,
+		Timeout: time.Second * 10,
+		Aliyun: &SMSAliyun{
+			RegionID: "cn-hangzhou",
+			Endpoint: "https://dysmsapi.aliyuncs.com/",
+		},
+		Tencent: &SMSTencent{
+			Region:   "ap-guangzhou",
+			Endpoint: "https://sms.tencentcloudapi.com/",
+		},
+	}
+
+	if cfgm != nil {
+		if err := cfgm.UnmarshalKey("sms", cfg); err != nil {
+			log.Error("Failed to unmarshal sms configuration", zap.Error(err))
+		}
+	}
+
+	switch cfg.Driver {
+	case SMSDriverMemory:
+		return cfg, nil
+	case SMSDriverAliyun:
+		if cfg.Aliyun == nil || cfg.Aliyun.AccessKeyID == "" || cfg.Aliyun.AccessKeySecret == "" {
+			return nil, fmt.Errorf("%w: aliyun access key is required", ErrSMSConfig)
+		}
+	case SMSDriverTencent:
+		if cfg.Tencent == nil || cfg.Tencent.SecretID == "" || cfg.Tencent.SecretKey == "" || cfg.Tencent.SDKAppID == "" {
+			return nil, fmt.Errorf("%w: tencent secret and sdk_app_id are required", ErrSMSConfig)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported driver %q", ErrSMSConfig, cfg.Driver)
+	}
+
+	if cfg.SignName == "" {
+		return nil, fmt.Errorf("%w: sign_name is required", ErrSMSConfig)
+	}
+	for name := range sms.TemplateParams {
+		if cfg.Templates[name] == "" {
+			return nil, fmt.Errorf("%w: template %q is required", ErrSMSConfig, name)
+		}
+	}
+
+	return cfg, nil
+}
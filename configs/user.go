@@ -0,0 +1,453 @@
+package configs
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"go.uber.org/zap"
+)
+
+// 用户存储
+const (
+	UserStoreMemory   = "memory"
+	UserStoreDatabase = "database"
+)
+
+// 注册时可要求填写的字段,用户名与密码始终必填
+const (
+	FieldEmail    = "email"
+	FieldPhone    = "phone"
+	FieldNickname = "nickname"
+)
+
+// User 用户配置
+type User struct {
+	Store          string          `yaml:"store" mapstructure:"store"`                     // 用户存储: memory(以下 users,重启后修改丢失), database(数据库,需配置 database.driver;以下 users 作为初始数据导入,已存在的不覆盖)
+	Users          []*SeedUser     `yaml:"users" mapstructure:"users"`                     // 初始用户
+	PasswordPolicy password.Policy `yaml:"password_policy" mapstructure:"password_policy"` // 密码策略,注册与修改密码时校验
+	Registration   *Registration   `yaml:"registration" mapstructure:"registration"`       // 自助注册
+	PasswordReset  *PasswordReset  `yaml:"password_reset" mapstructure:"password_reset"`   // 通过邮件找回密码
+	Verification   *Verification   `yaml:"verification" mapstructure:"verification"`       // 邮箱与手机号验证
+	MFA            *MFA            `yaml:"mfa" mapstructure:"mfa"`                         // 两步验证
+	WebAuthn       *WebAuthn       `yaml:"webauthn" mapstructure:"webauthn"`               // FIDO2 安全密钥与通行密钥
+	SMSLogin       *SMSLogin       `yaml:"sms_login" mapstructure:"sms_login"`             // 短信验证码登录
+	CodeSecret     string          `yaml:"code_secret" mapstructure:"code_secret"`         // 短信验证码的 HMAC 密钥(base64 编码的 32 字节),验证码以 HMAC-SHA256 保存,泄露存储也无法穷举;为空时仅开发环境允许启动并随机生成
+}
+
+// CodeSecretBytes 解码短信验证码的 HMAC 密钥
+//
+// 返回值:
+//
+//	[]byte: 32 字节的 HMAC 密钥
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrUserConfig: 未配置、不是 base64 编码或长度不是 32 字节
+func (u *User) CodeSecretBytes() ([]byte, error) {
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(u.CodeSecret))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code_secret is not valid base64: %v", ErrUserConfig, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: code_secret must be 32 bytes, got %d", ErrUserConfig, len(key))
+	}
+
+	return key, nil
+}
+
+// Registration 自助注册配置
+type Registration struct {
+	Enabled        bool     `yaml:"enabled" mapstructure:"enabled"`                 // 是否开放自助注册
+	URL            string   `yaml:"url" mapstructure:"url"`                         // 注册页地址,未登录的授权请求带 prompt=create 时跳转
+	RequiredFields []string `yaml:"required_fields" mapstructure:"required_fields"` // 必填字段: email, phone, nickname
+	InviteOnly     bool     `yaml:"invite_only" mapstructure:"invite_only"`         // 是否须填写邀请码
+	InviteCodes    []string `yaml:"invite_codes" mapstructure:"invite_codes"`       // 邀请码,可为明文或 argon2id/bcrypt 哈希,可重复使用,移除即失效
+	EmailDomains   []string `yaml:"email_domains" mapstructure:"email_domains"`     // 允许注册的邮箱域名,为空表示不限制;配置后邮箱必填
+}
+
+// Requires 判断注册时字段是否必填
+func (r *Registration) Requires(field string) bool {
+	return slices.Contains(r.RequiredFields, field) || (field == FieldEmail && len(r.EmailDomains) > 0)
+}
+
+// Verification 邮箱与手机号验证配置
+// 邮箱通过邮件链接验证,手机号通过短信验证码验证
+type Verification struct {
+	URL               string        `yaml:"url" mapstructure:"url"`                                 // 验证页地址,客户端要求已验证的联系方式时跳转;邮件中的链接为 url?token=<令牌>,相对地址时加上 oauth2.issuer
+	EmailLinkLifetime time.Duration `yaml:"email_link_lifetime" mapstructure:"email_link_lifetime"` // 邮件验证链接有效期
+	PhoneCodeLifetime time.Duration `yaml:"phone_code_lifetime" mapstructure:"phone_code_lifetime"` // 短信验证码有效期
+	CodeAttempts      int           `yaml:"code_attempts" mapstructure:"code_attempts"`             // 短信验证码最多可输错的次数,超过后须重新发送
+	SendLimit         int           `yaml:"send_limit" mapstructure:"send_limit"`                   // 每个用户每个渠道在限流窗口内最多可发送的次数
+	LimitWindow       time.Duration `yaml:"limit_window" mapstructure:"limit_window"`               // 限流窗口
+}
+
+// MFA 两步验证配置
+// 用户绑定认证器应用(TOTP)后,密码登录须再输入一次性密码
+type MFA struct {
+	URL           string        `yaml:"url" mapstructure:"url"`                       // 两步验证页地址,客户端或用户要求两步验证而会话未完成时跳转,未绑定的在该页绑定
+	Issuer        string        `yaml:"issuer" mapstructure:"issuer"`                 // 认证器应用中显示的服务名称
+	Skew          int           `yaml:"skew" mapstructure:"skew"`                     // 允许前后偏差的时间步数(每步 30 秒),容忍设备时钟误差
+	LoginTimeout  time.Duration `yaml:"login_timeout" mapstructure:"login_timeout"`   // 密码验证通过后须在该时长内完成第二步,超时须重新输入密码
+	CodeAttempts  int           `yaml:"code_attempts" mapstructure:"code_attempts"`   // 每个用户在限流窗口内最多可提交的一次性密码次数
+	LimitWindow   time.Duration `yaml:"limit_window" mapstructure:"limit_window"`     // 限流窗口
+	RecoveryCodes int           `yaml:"recovery_codes" mapstructure:"recovery_codes"` // 每次生成的恢复码数量,丢失认证器时每个恢复码可代替第二步验证一次
+	ReauthWindow  time.Duration `yaml:"reauth_window" mapstructure:"reauth_window"`   // 生成恢复码、移除验证方式等敏感操作须在最近一次两步验证后的该时长内进行,否则须重新验证
+	SecretKey     string        `yaml:"secret_key" mapstructure:"secret_key"`         // 数据库存储的 TOTP 密钥加密密钥(base64 编码的 32 字节),密钥以 AES-256-GCM 加密保存;为空时明文保存
+}
+
+// SecretKeyBytes 解码 TOTP 密钥加密密钥,未配置时返回空
+//
+// 返回值:
+//
+//	[]byte: 32 字节的密钥加密密钥
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrUserConfig: 不是 base64 编码或长度不是 32 字节
+func (m *MFA) SecretKeyBytes() ([]byte, error) {
+
+	v := strings.TrimSpace(m.SecretKey)
+	if v == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: mfa secret_key is not valid base64: %v", ErrUserConfig, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: mfa secret_key must be 32 bytes, got %d", ErrUserConfig, len(key))
+	}
+
+	return key, nil
+}
+
+// WebAuthn 认证器类型偏好与用户验证要求
+const (
+	WebAuthnRequired    = "required"
+	WebAuthnPreferred   = "preferred"
+	WebAuthnDiscouraged = "discouraged"
+)
+
+// WebAuthn FIDO2 安全密钥与通行密钥配置
+// 注册的凭据可用于免密码登录(须用户验证,如指纹或 PIN),也可作为密码登录的第二步
+type WebAuthn struct {
+	RPID                    string        `yaml:"rp_id" mapstructure:"rp_id"`                                       // 依赖方ID,凭据与该域名绑定,修改后已注册的凭据不可用;为空时使用 oauth2.issuer 的主机名
+	RPDisplayName           string        `yaml:"rp_display_name" mapstructure:"rp_display_name"`                   // 认证器中显示的服务名称
+	RPOrigins               []string      `yaml:"rp_origins" mapstructure:"rp_origins"`                             // 允许发起认证的页面源,如 https://id.example.com;为空时使用 oauth2.issuer
+	Attestation             string        `yaml:"attestation" mapstructure:"attestation"`                           // 注册时的证明偏好: none, indirect, direct, enterprise
+	AllowedAAGUIDs          []string      `yaml:"allowed_aaguids" mapstructure:"allowed_aaguids"`                   // 允许注册的认证器型号(AAGUID),为空表示不限制;须将 attestation 设为 direct 或 enterprise,否则浏览器可能隐藏型号
+	UserVerification        string        `yaml:"user_verification" mapstructure:"user_verification"`               // 注册与作为第二步时的用户验证要求: required, preferred, discouraged;免密码登录始终要求用户验证
+	ResidentKey             string        `yaml:"resident_key" mapstructure:"resident_key"`                         // 注册时是否创建可发现凭据(通行密钥): required, preferred, discouraged;只有可发现凭据能免输入账号登录
+	AuthenticatorAttachment string        `yaml:"authenticator_attachment" mapstructure:"authenticator_attachment"` // 认证器类型: platform(设备内置), cross-platform(外接安全密钥),为空表示不限制
+	Timeout                 time.Duration `yaml:"timeout" mapstructure:"timeout"`                                   // 注册与登录须在该时长内完成
+	MaxCredentials          int           `yaml:"max_credentials" mapstructure:"max_credentials"`                   // 每个用户最多可注册的凭据数
+}
+
+// PasswordReset 找回密码配置
+// 重置链接通过邮件发送,令牌只保存哈希,使用一次后失效
+type PasswordReset struct {
+	Enabled       bool          `yaml:"enabled" mapstructure:"enabled"`               // 是否开放找回密码
+	URL           string        `yaml:"url" mapstructure:"url"`                       // 重置密码页地址,邮件中的链接为 url?token=<令牌>;为空时使用 oauth2.issuer + /reset-password
+	TokenLifetime time.Duration `yaml:"token_lifetime" mapstructure:"token_lifetime"` // 重置令牌有效期
+	AccountLimit  int           `yaml:"account_limit" mapstructure:"account_limit"`   // 每个账号在限流窗口内最多可申请的次数
+	IPLimit       int           `yaml:"ip_limit" mapstructure:"ip_limit"`             // 每个IP在限流窗口内最多可申请的次数
+	LimitWindow   time.Duration `yaml:"limit_window" mapstructure:"limit_window"`     // 限流窗口
+}
+
+// SMSLogin 短信验证码登录配置
+// 验证码只保存以 code_secret 计算的 HMAC,过期、使用后或输错次数超过限制即失效
+type SMSLogin struct {
+	Enabled       bool          `yaml:"enabled" mapstructure:"enabled"`                 // 是否开放短信验证码登录
+	AutoRegister  bool          `yaml:"auto_register" mapstructure:"auto_register"`     // 未注册的手机号验证通过后是否自动注册,不受 registration.enabled 限制
+	CodeLifetime  time.Duration `yaml:"code_lifetime" mapstructure:"code_lifetime"`     // 验证码有效期
+	CodeAttempts  int           `yaml:"code_attempts" mapstructure:"code_attempts"`     // 验证码最多可输错的次数,超过后须重新发送
+	SendInterval  time.Duration `yaml:"send_interval" mapstructure:"send_interval"`     // 同一手机号两次发送的最短间隔
+	SendLimit     int           `yaml:"send_limit" mapstructure:"send_limit"`           // 每个手机号在限流窗口内最多可发送的次数
+	IPLimit       int           `yaml:"ip_limit" mapstructure:"ip_limit"`               // 每个IP在限流窗口内最多可发送的次数
+	VerifyLimit   int           `yaml:"verify_limit" mapstructure:"verify_limit"`       // 每个手机号在限流窗口内最多可提交验证码登录的次数
+	VerifyIPLimit int           `yaml:"verify_ip_limit" mapstructure:"verify_ip_limit"` // 每个IP在限流窗口内最多可提交验证码登录的次数
+	LimitWindow   time.Duration `yaml:"limit_window" mapstructure:"limit_window"`       // 限流窗口
+}
+
+// SeedUser 初始用户
+type SeedUser struct {
+	ID            string `yaml:"id" mapstructure:"id"`                         // 用户ID,为空时自动生成
+	Username      string `yaml:"username" mapstructure:"username"`             // 用户名
+	Password      string `yaml:"password" mapstructure:"password"`             // 密码哈希(argon2id 或 bcrypt,可由 cmd/secrethash 生成);明文仅用于开发环境
+	Email         string `yaml:"email" mapstructure:"email"`                   // 邮箱
+	EmailVerified bool   `yaml:"email_verified" mapstructure:"email_verified"` // 邮箱是否已验证
+	Phone         string `yaml:"phone" mapstructure:"phone"`                   // 手机号
+	PhoneVerified bool   `yaml:"phone_verified" mapstructure:"phone_verified"` // 手机号是否已验证
+	Nickname      string `yaml:"nickname" mapstructure:"nickname"`             // 昵称
+	Avatar        string `yaml:"avatar" mapstructure:"avatar"`                 // 头像地址
+	Disabled      bool   `yaml:"disabled" mapstructure:"disabled"`             // 是否禁用
+	MFARequired   bool   `yaml:"mfa_required" mapstructure:"mfa_required"`     // 是否须两步验证
+}
+
+// NewUser 读取用户配置
+//
+// 参数:
+//
+//	cfgm: 配置
+//	log: 日志对象
+//
+// 返回值:
+//
+//	*User: 用户配置
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrUserConfig: 存储方式、密码策略或注册配置不合法,或初始用户的用户名为空、ID/用户名/邮箱/手机号重复
+func NewUser(cfgm *viper.Viper, log *zap.Logger) (*User, error) {
+
+	// 默认配置
+	cfg := &User{
+		Store: UserStoreMemory,
+		PasswordPolicy: password.Policy{
+			MinLength: 8,
+			MaxLength: 128,
+		},
+		Registration: &Registration{
+			URL: "/register",
+		},
+		PasswordReset: &PasswordReset{
+			TokenLifetime: time.Minute * 30,
+			AccountLimit:  3,
+			IPLimit:       20,
+			LimitWindow:   time.Hour,
+		},
+		Verification: &Verification{
+			URL:               "/verify",
+			EmailLinkLifetime: time.Hour * 24,
+			PhoneCodeLifetime: time.Minute * 10,
+			CodeAttempts:      5,
+			SendLimit:         5,
+			LimitWindow:       time.Hour,
+		},
+		MFA: &MFA{
+			URL:           "/mfa",
+			Issuer:        "xiaohangshu",
+			Skew:          1,
+			LoginTimeout:  time.Minute * 5,
+			CodeAttempts:  10,
+			LimitWindow:   time.Minute * 15,
+			RecoveryCodes: 10,
+			ReauthWindow:  time.Minute * 10,
+		},
+		WebAuthn: &WebAuthn{
+			RPDisplayName:    "xiaohangshu",
+			Attestation:      "none",
+			UserVerification: WebAuthnPreferred,
+			ResidentKey:      WebAuthnPreferred,
+			Timeout:          time.Minute * 5,
+			MaxCredentials:   10,
+		},
+		SMSLogin: &SMSLogin{
+			CodeLifetime:  time.Minute * 5,
+			CodeAttempts:  5,
+			SendInterval:  time.Minute,
+			SendLimit:     5,
+			IPLimit:       20,
+			VerifyLimit:   20,
+			VerifyIPLimit: 100,
+			LimitWindow:   time.Hour,
+		},
+	}
+
+	if cfgm != nil {
+		if err := cfgm.UnmarshalKey("user", cfg); err != nil {
+			log.Error("Failed to unmarshal user configuration", zap.Error(err))
+		}
+	}
+
+	switch cfg.Store {
+	case UserStoreMemory, UserStoreDatabase:
+	default:
+		return nil, fmt.Errorf("%w: unsupported store %q", ErrUserConfig, cfg.Store)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.PasswordPolicy.MinLength <= 0 {
+		cfg.PasswordPolicy.MinLength = 8
+	}
+	if cfg.PasswordPolicy.MaxLength <= 0 {
+		cfg.PasswordPolicy.MaxLength = 128
+	}
+	if cfg.PasswordPolicy.MaxLength < cfg.PasswordPolicy.MinLength {
+		return nil, fmt.Errorf("%w: password_policy max_length is less than min_length", ErrUserConfig)
+	}
+
+	if cfg.Registration == nil {
+		cfg.Registration = &Registration{}
+	}
+	if err := cfg.Registration.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.PasswordReset == nil {
+		cfg.PasswordReset = &PasswordReset{}
+	}
+	if r := cfg.PasswordReset; r.TokenLifetime <= 0 || r.AccountLimit <= 0 || r.IPLimit <= 0 || r.LimitWindow <= 0 {
+		return nil, fmt.Errorf("%w: password_reset token_lifetime, account_limit, ip_limit and limit_window must be positive", ErrUserConfig)
+	}
+
+	if cfg.Verification == nil {
+		cfg.Verification = &Verification{}
+	}
+	if v := cfg.Verification; v.URL == "" || v.EmailLinkLifetime <= 0 || v.PhoneCodeLifetime <= 0 || v.CodeAttempts <= 0 || v.SendLimit <= 0 || v.LimitWindow <= 0 {
+		return nil, fmt.Errorf("%w: verification url is required, lifetimes, code_attempts, send_limit and limit_window must be positive", ErrUserConfig)
+	}
+
+	if cfg.MFA == nil {
+		cfg.MFA = &MFA{}
+	}
+	if m := cfg.MFA; m.URL == "" || m.Issuer == "" || m.Skew < 0 || m.LoginTimeout <= 0 || m.CodeAttempts <= 0 || m.LimitWindow <= 0 || m.RecoveryCodes <= 0 || m.ReauthWindow <= 0 {
+		return nil, fmt.Errorf("%w: mfa url and issuer are required, skew must not be negative, login_timeout, code_attempts, limit_window, recovery_codes and reauth_window must be positive", ErrUserConfig)
+	}
+	if _, err := cfg.MFA.SecretKeyBytes(); err != nil {
+		return nil, err
+	}
+	if cfg.Store == UserStoreDatabase && cfg.MFA.SecretKey == "" {
+		log.Warn("user.mfa.secret_key is not configured, totp secrets are stored unencrypted")
+	}
+
+	if cfg.WebAuthn == nil {
+		cfg.WebAuthn = &WebAuthn{}
+	}
+	if err := cfg.WebAuthn.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.SMSLogin == nil {
+		cfg.SMSLogin = &SMSLogin{}
+	}
+	if l := cfg.SMSLogin; l.CodeLifetime <= 0 || l.CodeAttempts <= 0 || l.SendInterval <= 0 || l.SendLimit <= 0 || l.IPLimit <= 0 || l.VerifyLimit <= 0 || l.VerifyIPLimit <= 0 || l.LimitWindow <= 0 {
+		return nil, fmt.Errorf("%w: sms_login code_lifetime, code_attempts, send_interval, send_limit, ip_limit, verify_limit, verify_ip_limit and limit_window must be positive", ErrUserConfig)
+	}
+
+	// 未配置时每次启动随机生成,重启前发送的验证码失效,多副本时只能在发送的副本上验证,只允许在开发环境使用
+	if strings.TrimSpace(cfg.CodeSecret) == "" {
+		if cfgm != nil && !IsDevelopment(cfgm) {
+			return nil, fmt.Errorf("%w: code_secret is required outside the %s environment", ErrUserConfig, EnvironmentDevelopment)
+		}
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		cfg.CodeSecret = base64.StdEncoding.EncodeToString(key)
+		if cfgm != nil {
+			log.Warn("user.code_secret is not configured, a random key is generated and sms codes are invalidated on restart")
+		}
+	}
+	if _, err := cfg.CodeSecretBytes(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// validate 校验初始用户,邮箱统一转为小写
+func (u *User) validate() error {
+
+	seen := map[string][]string{}
+	unique := func(field, value string) error {
+		if value == "" {
+			return nil
+		}
+		if slices.Contains(seen[field], value) {
+			return fmt.Errorf("%w: duplicated %s %q", ErrUserConfig, field, value)
+		}
+		seen[field] = append(seen[field], value)
+		return nil
+	}
+
+	for _, v := range u.Users {
+		if v.Username == "" {
+			return fmt.Errorf("%w: username is empty", ErrUserConfig)
+		}
+		v.Email = strings.ToLower(v.Email)
+
+		for field, value := range map[string]string{"id": v.ID, "username": v.Username, "email": v.Email, "phone": v.Phone} {
+			if err := unique(field, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate 校验注册配置,邮箱域名统一转为小写
+func (r *Registration) validate() error {
+
+	for _, v := range r.RequiredFields {
+		switch v {
+		case FieldEmail, FieldPhone, FieldNickname:
+		default:
+			return fmt.Errorf("%w: unsupported registration required field %q", ErrUserConfig, v)
+		}
+	}
+
+	if r.InviteOnly && len(r.InviteCodes) == 0 {
+		return fmt.Errorf("%w: registration invite_only requires invite_codes", ErrUserConfig)
+	}
+
+	for i, v := range r.EmailDomains {
+		r.EmailDomains[i] = strings.ToLower(strings.TrimPrefix(v, "@"))
+	}
+
+	return nil
+}
+
+// validate 校验 WebAuthn 配置,AAGUID 统一转为小写
+func (w *WebAuthn) validate() error {
+
+	if w.RPDisplayName == "" || w.Timeout <= 0 || w.MaxCredentials <= 0 {
+		return fmt.Errorf("%w: webauthn rp_display_name is required, timeout and max_credentials must be positive", ErrUserConfig)
+	}
+
+	switch w.Attestation {
+	case "none", "indirect", "direct", "enterprise":
+	default:
+		return fmt.Errorf("%w: unsupported webauthn attestation %q", ErrUserConfig, w.Attestation)
+	}
+
+	for name, value := range map[string]string{"user_verification": w.UserVerification, "resident_key": w.ResidentKey} {
+		switch value {
+		case WebAuthnRequired, WebAuthnPreferred, WebAuthnDiscouraged:
+		default:
+			return fmt.Errorf("%w: unsupported webauthn %s %q", ErrUserConfig, name, value)
+		}
+	}
+
+	switch w.AuthenticatorAttachment {
+	case "", "platform", "cross-platform":
+	default:
+		return fmt.Errorf("%w: unsupported webauthn authenticator_attachment %q", ErrUserConfig, w.AuthenticatorAttachment)
+	}
+
+	for i, v := range w.AllowedAAGUIDs {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return fmt.Errorf("%w: invalid webauthn aaguid %q", ErrUserConfig, v)
+		}
+		w.AllowedAAGUIDs[i] = id.String()
+	}
+
+	return nil
+}
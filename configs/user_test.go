@@ -0,0 +1,71 @@
+package configs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+func TestUserMFASecretKey(t *testing.T) {
+
+	tests := []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{"not configured", "", nil},
+		{"32 bytes", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", nil},
+		{"not base64", "not base64!", ErrUserConfig},
+		{"16 bytes", "MDEyMzQ1Njc4OWFiY2RlZg==", ErrUserConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.Set("server.environment", EnvironmentDevelopment)
+			v.Set("user.mfa.secret_key", tt.key)
+
+			if _, err := NewUser(v, zap.NewNop()); !errors.Is(err, tt.err) {
+				t.Fatalf("NewUser: %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUserCodeSecret(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		environment string
+		secret      string
+		err         error
+	}{
+		{"dev without secret", "dev", "", nil},
+		{"prod without secret", "prod", "", ErrUserConfig},
+		{"environment not set", "", "", ErrUserConfig},
+		{"prod with secret", "prod", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", nil},
+		{"short secret", "prod", "MDEyMzQ1Njc4OWFiY2RlZg==", ErrUserConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.Set("server.environment", tt.environment)
+			v.Set("user.code_secret", tt.secret)
+
+			cfg, err := NewUser(v, zap.NewNop())
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("NewUser: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			// 开发环境未配置时随机生成
+			if key, err := cfg.CodeSecretBytes(); err != nil || len(key) != 32 {
+				t.Fatalf("CodeSecretBytes = %d bytes, %v", len(key), err)
+			}
+		})
+	}
+}
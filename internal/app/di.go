@@ -11,6 +11,13 @@ func DependencyInjection() []fx.Option {
 		fx.Provide(user.NewUserApp),
 		fx.Provide(user.NewLoginHandler),
 		fx.Provide(user.NewLogoutHandler),
+		fx.Provide(user.NewRegisterHandler),
+		fx.Provide(user.NewForgotPasswordHandler),
+		fx.Provide(user.NewResetPasswordHandler),
+		fx.Provide(user.NewVerificationHandler),
+		fx.Provide(user.NewMFAHandler),
+		fx.Provide(user.NewWebAuthnHandler),
+		fx.Provide(user.NewSMSLoginHandler),
 	}
 
 }
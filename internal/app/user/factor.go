@@ -0,0 +1,235 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+)
+
+// ErrMFAFactorNotFound 验证方式不存在或不属于该用户
+var ErrMFAFactorNotFound = errors.New("mfa factor not found")
+
+// totpFactorID 认证器应用在验证方式列表中的ID,每个用户最多绑定一个
+// WebAuthn 凭据ID至少 16 字节,base64url 编码后不会与之相同
+const totpFactorID = "totp"
+
+// MFAFactorDTO 已绑定的验证方式
+type MFAFactorDTO struct {
+	ID         string `json:"id"`                     // 验证方式ID:认证器应用为 totp,安全密钥为 base64url 编码的凭据ID
+	Type       string `json:"type"`                   // 类型: MFAMethodTOTP, MFAMethodWebAuthn
+	Name       string `json:"name"`                   // 名称
+	Passkey    bool   `json:"passkey,omitempty"`      // 是否为可同步的通行密钥
+	CreatedAt  string `json:"created_at"`             // 绑定时间
+	LastUsedAt string `json:"last_used_at,omitempty"` // 最近一次使用时间
+}
+
+// MFAFactorRename  修改验证方式名称请求结构体
+type MFAFactorRename struct {
+	Name string `json:"name" binding:"required,max=64"` // 名称
+}
+
+// Factors 获取用户已绑定的全部验证方式,认证器应用在前,安全密钥按注册时间排序
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	[]*MFAFactorDTO: 验证方式
+//	error: 错误信息
+func (h *MFAHandler) Factors(ctx context.Context, userID string) ([]*MFAFactorDTO, error) {
+
+	factors := []*MFAFactorDTO{}
+
+	t, err := h.totps.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, user.ErrTOTPNotFound) {
+		return nil, err
+	}
+	if err == nil && t.Confirmed {
+		name := t.Name
+		if name == "" {
+			name = "认证器应用"
+		}
+		factors = append(factors, &MFAFactorDTO{
+			ID:        totpFactorID,
+			Type:      MFAMethodTOTP,
+			Name:      name,
+			CreatedAt: t.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	list, err := h.credentials.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range list {
+		dto := toWebAuthnCredentialDTO(c)
+		factors = append(factors, &MFAFactorDTO{
+			ID:         dto.ID,
+			Type:       MFAMethodWebAuthn,
+			Name:       dto.Name,
+			Passkey:    dto.Passkey,
+			CreatedAt:  dto.CreatedAt,
+			LastUsedAt: dto.LastUsedAt,
+		})
+	}
+
+	return factors, nil
+}
+
+// RenameFactor 修改验证方式的名称
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	id: 验证方式ID
+//	name: 名称
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFAFactorNotFound: 验证方式不存在或不属于该用户
+func (h *MFAHandler) RenameFactor(ctx context.Context, userID, id, name string) error {
+
+	name = strings.TrimSpace(name)
+
+	if id == totpFactorID {
+		enrolled, err := h.Enrolled(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !enrolled {
+			return ErrMFAFactorNotFound
+		}
+		return h.totps.RenameTOTP(ctx, userID, name)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return ErrMFAFactorNotFound
+	}
+
+	err = h.credentials.RenameWebAuthnCredential(ctx, userID, raw, name)
+	if errors.Is(err, user.ErrWebAuthnCredentialNotFound) {
+		return ErrMFAFactorNotFound
+	}
+	return err
+}
+
+// RemoveFactor 移除验证方式,调用方须确认会话已在近期完成两步验证;
+// 用户须两步验证时不能移除最后一个验证方式,没有其他验证方式时恢复码一并删除
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	id: 验证方式ID
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFAFactorNotFound: 验证方式不存在或不属于该用户
+//	ErrMFARequired: 用户须两步验证且没有其他验证方式
+func (h *MFAHandler) RemoveFactor(ctx context.Context, userID, id string) error {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	factors, err := h.Factors(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	i := -1
+	for k, f := range factors {
+		if f.ID == id {
+			i = k
+			break
+		}
+	}
+	if i < 0 {
+		return ErrMFAFactorNotFound
+	}
+	if u.MFARequired && len(factors) == 1 {
+		return ErrMFARequired
+	}
+
+	detail := map[string]string{"method": factors[i].Type}
+	if id == totpFactorID {
+		err = h.totps.DeleteTOTP(ctx, userID)
+	} else {
+		raw, _ := base64.RawURLEncoding.DecodeString(id)
+		err = h.credentials.DeleteWebAuthnCredential(ctx, userID, raw)
+		detail["credential_id"] = id
+	}
+	if errors.Is(err, user.ErrWebAuthnCredentialNotFound) {
+		return ErrMFAFactorNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.MFADisabled, UserID: userID, Detail: detail})
+	return h.pruneRecoveryCodes(ctx, userID)
+}
+
+// Reset 管理员重置用户的两步验证,删除认证器应用、全部安全密钥与恢复码
+// 用于用户丢失全部验证方式且没有恢复码的情况;用户须两步验证时下次登录后须重新绑定
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	operator: 操作者,记录到安全事件
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	user.ErrUserNotFound: 用户不存在
+func (h *MFAHandler) Reset(ctx context.Context, userID, operator string) error {
+
+	if _, err := h.repo.GetUserInfoByID(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := h.totps.DeleteTOTP(ctx, userID); err != nil {
+		return err
+	}
+
+	list, err := h.credentials.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		err := h.credentials.DeleteWebAuthnCredential(ctx, userID, c.ID)
+		if err != nil && !errors.Is(err, user.ErrWebAuthnCredentialNotFound) {
+			return err
+		}
+	}
+
+	if err := h.recoveries.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.MFAReset, UserID: userID, Detail: map[string]string{"operator": operator}})
+	return nil
+}
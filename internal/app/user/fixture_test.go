@@ -0,0 +1,203 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/infra/repoimpl"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/mail"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/ratelimit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/sms"
+	"go.uber.org/zap"
+)
+
+// 测试使用的初始用户
+const (
+	testUserID   = "1"
+	testUsername = "alice"
+	testEmail    = "alice@example.com"
+	testPhone    = "+8613800000000"
+	testPassword = "alice-password"
+	otherUserID  = "2"
+)
+
+// stubRecorder 记录安全事件的桩
+type stubRecorder struct {
+	mu     sync.Mutex
+	events []*audit.Event
+}
+
+// Record 记录安全事件
+func (r *stubRecorder) Record(ctx context.Context, event *audit.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// has 判断是否记录了指定类型的安全事件
+func (r *stubRecorder) has(typ audit.EventType) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.events {
+		if e.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// testDeps 测试使用的配置与内存依赖,处理者由各测试按需创建
+type testDeps struct {
+	logger        *zap.Logger
+	oauth2        *configs.OAuth2
+	cfg           *configs.User
+	repo          user.UserRepository
+	resetTokens   user.ResetTokenRepository
+	totps         user.TOTPRepository
+	credentials   user.WebAuthnCredentialRepository
+	recoveries    user.RecoveryCodeRepository
+	verifications user.VerificationRepository
+	mail          *mail.MemorySender
+	sms           *sms.MemorySender
+	limiter       ratelimit.Limiter
+	recorder      *stubRecorder
+}
+
+// newTestDeps 创建使用内存存储的依赖,初始用户为 alice 与 bob
+//
+// 参数:
+//
+//	t: 测试
+//	setup: 创建仓储前修改用户配置,可以为 nil
+//
+// 返回值:
+//
+//	*testDeps: 测试依赖
+func newTestDeps(t *testing.T, setup func(*configs.User)) *testDeps {
+	t.Helper()
+
+	logger := zap.NewNop()
+
+	cfg, err := configs.NewOAuth2(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ucfg, err := configs.NewUser(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ucfg.Users = []*configs.SeedUser{
+		{ID: testUserID, Username: testUsername, Password: testPassword, Email: testEmail, Phone: testPhone},
+		{ID: otherUserID, Username: "bob", Password: "bob-password"},
+	}
+	if setup != nil {
+		setup(ucfg)
+	}
+
+	d := &testDeps{
+		logger:   logger,
+		oauth2:   cfg,
+		cfg:      ucfg,
+		mail:     mail.NewMemorySender(logger),
+		sms:      sms.NewMemorySender(logger),
+		limiter:  ratelimit.NewMemoryLimiter(),
+		recorder: &stubRecorder{},
+	}
+
+	if d.repo, err = repoimpl.NewUserRepository(repoimpl.UserRepositoryParams{Config: ucfg, Logger: logger}); err != nil {
+		t.Fatal(err)
+	}
+	if d.resetTokens, err = repoimpl.NewResetTokenRepository(repoimpl.ResetTokenRepositoryParams{Config: ucfg}); err != nil {
+		t.Fatal(err)
+	}
+	if d.totps, err = repoimpl.NewTOTPRepository(repoimpl.TOTPRepositoryParams{Config: ucfg}); err != nil {
+		t.Fatal(err)
+	}
+	if d.credentials, err = repoimpl.NewWebAuthnCredentialRepository(repoimpl.WebAuthnCredentialRepositoryParams{Config: ucfg}); err != nil {
+		t.Fatal(err)
+	}
+	if d.recoveries, err = repoimpl.NewRecoveryCodeRepository(repoimpl.RecoveryCodeRepositoryParams{Config: ucfg}); err != nil {
+		t.Fatal(err)
+	}
+	if d.verifications, err = repoimpl.NewVerificationRepository(repoimpl.VerificationRepositoryParams{Config: ucfg}); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// forgotPasswordHandler 创建找回密码处理者
+func (d *testDeps) forgotPasswordHandler() *ForgotPasswordHandler {
+	return NewForgotPasswordHandler(d.cfg, d.oauth2, d.repo, d.resetTokens, d.mail, d.limiter, d.recorder, d.logger)
+}
+
+// resetPasswordHandler 创建重置密码处理者
+func (d *testDeps) resetPasswordHandler() *ResetPasswordHandler {
+	return NewResetPasswordHandler(d.cfg, d.repo, d.resetTokens, d.recorder, d.logger)
+}
+
+// registerHandler 创建注册处理者
+func (d *testDeps) registerHandler() *RegisterHandler {
+	return NewRegisterHandler(d.cfg, d.repo, d.logger)
+}
+
+// mfaHandler 创建两步验证处理者
+func (d *testDeps) mfaHandler() *MFAHandler {
+	return NewMFAHandler(d.cfg, d.repo, d.totps, d.credentials, d.recoveries, d.limiter, d.recorder, d.logger)
+}
+
+// verificationHandler 创建联系方式验证处理者
+func (d *testDeps) verificationHandler(t *testing.T) *VerificationHandler {
+	t.Helper()
+
+	h, err := NewVerificationHandler(d.cfg, d.oauth2, d.repo, d.verifications, d.mail, d.sms, d.limiter, d.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// smsLoginHandler 创建短信验证码登录处理者
+func (d *testDeps) smsLoginHandler(t *testing.T) *SMSLoginHandler {
+	t.Helper()
+
+	h, err := NewSMSLoginHandler(d.cfg, d.repo, d.verifications, d.sms, d.limiter, d.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// smsCode 等待异步发送的短信达到 n 条,返回第 n 条短信中的验证码
+func (d *testDeps) smsCode(t *testing.T, n int) string {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		messages := d.sms.Messages()
+		if len(messages) >= n {
+			return messages[n-1].Params["code"]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d sms, want %d", len(messages), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// webAuthnHandler 创建 WebAuthn 凭据处理者
+func (d *testDeps) webAuthnHandler(t *testing.T) *WebAuthnHandler {
+	t.Helper()
+
+	h, err := NewWebAuthnHandler(d.cfg, d.oauth2, d.repo, d.totps, d.credentials, d.recoveries, d.recorder, d.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
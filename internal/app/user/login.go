@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"time"
 
 	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
 	"go.uber.org/zap"
@@ -26,26 +27,59 @@ func NewLoginHandler(repo user.UserRepository) *LoginHandler {
 	}
 }
 
-// Handle  处理登录请求,根据用户名和密码返回用户信息或错误信息。
+// Handle  处理登录请求,根据账号(用户名、邮箱或手机号)和密码返回用户信息或错误信息。
 func (h *LoginHandler) Handle(ctx context.Context, query *Login) (userDTO *UserInfoDTO, err error) {
 
-	// 这里可以添加对用户名和密码的验证逻辑
-	// 例如查询数据库验证用户凭据
-
 	user, err := h.repo.GetUserInfoByPassword(ctx, query.Account, query.Password)
 
 	if err != nil {
 		return nil, err
 	}
 
-	// 假设用户名和密码验证通过，返回一个用户信息
-	return &UserInfoDTO{
-		UserID:    user.ID,
-		Username:  query.Account,
-		Nickname:  "Test User",
-		AvatarURL: "http://example.com/avatar.jpg",
-		Email:     "",
-		Phone:     "",
-	}, nil
+	return toUserInfoDTO(user), nil
+
+}
+
+// Get 获取用户信息,用于完成两步验证后返回登录结果
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	*UserInfoDTO: 用户信息
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	user.ErrUserNotFound: 用户不存在
+//	user.ErrUserDisabled: 用户已禁用
+func (h *LoginHandler) Get(ctx context.Context, userID string) (*UserInfoDTO, error) {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status == user.Disable {
+		return nil, user.ErrUserDisabled
+	}
 
+	return toUserInfoDTO(u), nil
+}
+
+// toUserInfoDTO 转换为登录返回的用户信息
+func toUserInfoDTO(u *user.UserInfo) *UserInfoDTO {
+	return &UserInfoDTO{
+		UserID:        u.ID,
+		Username:      u.Loginname,
+		Nickname:      u.Nickname,
+		AvatarURL:     u.Avatar,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Phone:         u.Phone,
+		PhoneVerified: u.PhoneVerified,
+		CreatedAt:     u.CreatedAt.Format(time.RFC3339),
+	}
 }
@@ -0,0 +1,374 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/ratelimit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/totp"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrMFAEnrolled    = errors.New("mfa is already enrolled")   // 已绑定两步验证
+	ErrMFANotEnrolled = errors.New("mfa is not enrolled")       // 未绑定两步验证
+	ErrMFACodeInvalid = errors.New("invalid one-time password") // 一次性密码错误或已使用
+	ErrMFARequired    = errors.New("mfa is required")           // 用户须两步验证,不能解除
+)
+
+// MFACode  一次性密码请求结构体
+type MFACode struct {
+	Code string `json:"code" binding:"required"` // 认证器应用中的一次性密码
+}
+
+// MFADTO 两步验证状态
+type MFADTO struct {
+	TOTP          bool `json:"totp"`           // 是否已绑定认证器应用
+	WebAuthn      bool `json:"webauthn"`       // 是否已注册安全密钥或通行密钥
+	RecoveryCodes int  `json:"recovery_codes"` // 剩余可用的恢复码数量
+	Required      bool `json:"required"`       // 用户是否须两步验证
+}
+
+// TOTPEnrollmentDTO 绑定认证器应用的信息
+type TOTPEnrollmentDTO struct {
+	Secret string `json:"secret"`      // base32 编码的密钥,无法扫码时手动输入
+	URI    string `json:"otpauth_uri"` // otpauth URI,前端生成二维码供认证器应用扫描
+}
+
+// 第二步验证方式
+const (
+	MFAMethodTOTP     = "totp"     // 认证器应用中的一次性密码
+	MFAMethodWebAuthn = "webauthn" // 安全密钥或通行密钥
+	MFAMethodRecovery = "recovery" // 恢复码,仅在已有其他验证方式时可用
+)
+
+// MFAHandler  两步验证处理者
+// 用户绑定认证器应用或注册安全密钥后,密码登录须再完成第二步;每个时间步的一次性密码只能使用一次
+type MFAHandler struct {
+	*zap.Logger
+	cfg         *configs.MFA
+	repo        user.UserRepository
+	totps       user.TOTPRepository
+	credentials user.WebAuthnCredentialRepository
+	recoveries  user.RecoveryCodeRepository
+	limiter     ratelimit.Limiter
+	recorder    audit.Recorder
+}
+
+// NewMFAHandler 创建两步验证处理者
+func NewMFAHandler(cfg *configs.User, repo user.UserRepository, totps user.TOTPRepository, credentials user.WebAuthnCredentialRepository, recoveries user.RecoveryCodeRepository, limiter ratelimit.Limiter, recorder audit.Recorder, logger *zap.Logger) *MFAHandler {
+	return &MFAHandler{
+		Logger:      logger,
+		cfg:         cfg.MFA,
+		repo:        repo,
+		totps:       totps,
+		credentials: credentials,
+		recoveries:  recoveries,
+		limiter:     limiter,
+		recorder:    recorder,
+	}
+}
+
+// Status 获取用户的两步验证状态
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	*MFADTO: 两步验证状态
+//	error: 错误信息
+func (h *MFAHandler) Status(ctx context.Context, userID string) (*MFADTO, error) {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	methods, err := h.Methods(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := h.recoveries.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFADTO{
+		TOTP:          slices.Contains(methods, MFAMethodTOTP),
+		WebAuthn:      slices.Contains(methods, MFAMethodWebAuthn),
+		RecoveryCodes: remaining,
+		Required:      u.MFARequired,
+	}, nil
+}
+
+// Methods 获取用户可用的第二步验证方式,不为空时密码登录后须再完成第二步
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	[]string: 验证方式: MFAMethodTOTP, MFAMethodWebAuthn, MFAMethodRecovery
+//	error: 错误信息
+func (h *MFAHandler) Methods(ctx context.Context, userID string) ([]string, error) {
+
+	var methods []string
+
+	enrolled, err := h.Enrolled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolled {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	list, err := h.credentials.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+
+	if len(methods) > 0 {
+		remaining, err := h.recoveries.CountRecoveryCodes(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if remaining > 0 {
+			methods = append(methods, MFAMethodRecovery)
+		}
+	}
+
+	return methods, nil
+}
+
+// Enrolled 判断用户是否已确认绑定认证器应用
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	bool: 已确认绑定返回true
+//	error: 错误信息
+func (h *MFAHandler) Enrolled(ctx context.Context, userID string) (bool, error) {
+
+	t, err := h.totps.GetTOTP(ctx, userID)
+	if errors.Is(err, user.ErrTOTPNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return t.Confirmed, nil
+}
+
+// BeginTOTP 生成新的密钥开始绑定认证器应用,未确认前替换之前未确认的密钥
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	*TOTPEnrollmentDTO: 密钥与 otpauth URI
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFAEnrolled: 已绑定,须先解除
+func (h *MFAHandler) BeginTOTP(ctx context.Context, userID string) (*TOTPEnrollmentDTO, error) {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	enrolled, err := h.Enrolled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolled {
+		return nil, ErrMFAEnrolled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.totps.SaveTOTP(ctx, &user.TOTP{
+		UserID:    u.ID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollmentDTO{
+		Secret: secret,
+		URI:    totp.URI(h.cfg.Issuer, u.Loginname, secret),
+	}, nil
+}
+
+// ConfirmTOTP 使用认证器应用生成的一次性密码确认绑定
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	code: 一次性密码
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFAEnrolled: 已绑定
+//	ErrMFANotEnrolled: 未开始绑定
+//	ErrMFACodeInvalid: 一次性密码错误
+//	ErrRateLimited: 超过提交次数限制
+func (h *MFAHandler) ConfirmTOTP(ctx context.Context, userID, code string) error {
+
+	t, err := h.totps.GetTOTP(ctx, userID)
+	if errors.Is(err, user.ErrTOTPNotFound) {
+		return ErrMFANotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+	if t.Confirmed {
+		return ErrMFAEnrolled
+	}
+
+	if err := h.check(ctx, t, code, true); err != nil {
+		return err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.MFAEnrolled, UserID: userID, Detail: map[string]string{"method": "totp"}})
+	return nil
+}
+
+// Verify 校验已绑定用户的一次性密码,用于登录的第二步与已登录会话补充两步验证
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	code: 一次性密码
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFANotEnrolled: 未绑定
+//	ErrMFACodeInvalid: 一次性密码错误或已使用
+//	ErrRateLimited: 超过提交次数限制
+func (h *MFAHandler) Verify(ctx context.Context, userID, code string) error {
+
+	t, err := h.totps.GetTOTP(ctx, userID)
+	if errors.Is(err, user.ErrTOTPNotFound) {
+		return ErrMFANotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+	if !t.Confirmed {
+		return ErrMFANotEnrolled
+	}
+
+	return h.check(ctx, t, code, false)
+}
+
+// DisableTOTP 校验一次性密码后解除绑定;用户须两步验证时须已注册安全密钥,没有其他验证方式时恢复码一并删除
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	code: 一次性密码
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFARequired: 用户须两步验证且没有注册安全密钥
+//	ErrMFANotEnrolled: 未绑定
+//	ErrMFACodeInvalid: 一次性密码错误或已使用
+//	ErrRateLimited: 超过提交次数限制
+func (h *MFAHandler) DisableTOTP(ctx context.Context, userID, code string) error {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.MFARequired {
+		list, err := h.credentials.ListWebAuthnCredentials(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return ErrMFARequired
+		}
+	}
+
+	if err := h.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	if err := h.totps.DeleteTOTP(ctx, userID); err != nil {
+		return err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.MFADisabled, UserID: userID, Detail: map[string]string{"method": "totp"}})
+	return h.pruneRecoveryCodes(ctx, userID)
+}
+
+// check 限流后校验一次性密码并记录已使用的时间步
+func (h *MFAHandler) check(ctx context.Context, t *user.TOTP, code string, confirm bool) error {
+
+	ok, err := h.limiter.Allow(ctx, "mfa:"+t.UserID, h.cfg.CodeAttempts, h.cfg.LimitWindow)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRateLimited
+	}
+
+	step, ok := totp.Validate(t.Secret, code, time.Now(), h.cfg.Skew)
+	if !ok {
+		return ErrMFACodeInvalid
+	}
+
+	// 同一时间步的一次性密码被截获后不能再次使用
+	if err := h.totps.UseTOTPStep(ctx, t.UserID, step, confirm); err != nil {
+		if errors.Is(err, user.ErrTOTPCodeUsed) {
+			return ErrMFACodeInvalid
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/totp"
+)
+
+// enrollTOTP 为用户绑定认证器应用并确认,返回密钥
+// 确认使用上一个时间步的验证码,当前时间步的验证码留给测试使用
+func enrollTOTP(t *testing.T, h *MFAHandler, userID string) string {
+	t.Helper()
+
+	ctx := context.Background()
+	dto, err := h.BeginTOTP(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ConfirmTOTP(ctx, userID, totpCode(t, dto.Secret, time.Now().Add(-totp.Period))); err != nil {
+		t.Fatal(err)
+	}
+
+	return dto.Secret
+}
+
+// totpCode 计算指定时间的一次性密码
+func totpCode(t *testing.T, secret string, now time.Time) string {
+	t.Helper()
+
+	code, err := totp.Generate(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestMFAReplay(t *testing.T) {
+
+	d := newTestDeps(t, nil)
+	h := d.mfaHandler()
+	ctx := context.Background()
+
+	secret := enrollTOTP(t, h, testUserID)
+	code := totpCode(t, secret, time.Now())
+
+	if err := h.Verify(ctx, testUserID, code); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一时间步的一次性密码被截获后不能再次使用
+	if err := h.Verify(ctx, testUserID, code); !errors.Is(err, ErrMFACodeInvalid) {
+		t.Fatalf("Verify(replayed) = %v, want ErrMFACodeInvalid", err)
+	}
+
+	// 已使用时间步之前的一次性密码即使仍在偏差范围内也不能使用
+	if err := h.Verify(ctx, testUserID, totpCode(t, secret, time.Now().Add(-totp.Period))); !errors.Is(err, ErrMFACodeInvalid) {
+		t.Fatalf("Verify(older step) = %v, want ErrMFACodeInvalid", err)
+	}
+
+	tt, err := d.totps.GetTOTP(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.totps.UseTOTPStep(ctx, testUserID, tt.LastStep, false); !errors.Is(err, user.ErrTOTPCodeUsed) {
+		t.Fatalf("UseTOTPStep(same step) = %v, want ErrTOTPCodeUsed", err)
+	}
+}
+
+func TestMFARateLimit(t *testing.T) {
+
+	d := newTestDeps(t, func(cfg *configs.User) {
+		cfg.MFA.CodeAttempts = 3
+	})
+	h := d.mfaHandler()
+	ctx := context.Background()
+
+	// 绑定时的确认占用一次提交次数
+	secret := enrollTOTP(t, h, testUserID)
+	code := totpCode(t, secret, time.Now())
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 1; i < d.cfg.MFA.CodeAttempts; i++ {
+		if err := h.Verify(ctx, testUserID, wrong); !errors.Is(err, ErrMFACodeInvalid) {
+			t.Fatalf("attempt %d: Verify(wrong) = %v, want ErrMFACodeInvalid", i, err)
+		}
+	}
+
+	// 超过次数后正确的一次性密码也被拒绝,防止在窗口内穷举
+	if err := h.Verify(ctx, testUserID, code); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Verify after limit = %v, want ErrRateLimited", err)
+	}
+
+	// 限流按用户计算,不影响其他用户
+	other := enrollTOTP(t, h, otherUserID)
+	if err := h.Verify(ctx, otherUserID, totpCode(t, other, time.Now())); err != nil {
+		t.Fatalf("Verify(other user) = %v", err)
+	}
+}
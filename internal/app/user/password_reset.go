@@ -0,0 +1,287 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/mail"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/ratelimit"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrPasswordResetClosed = errors.New("password reset is closed")     // 未开放找回密码
+	ErrRateLimited         = errors.New("too many requests")            // 请求过于频繁
+	ErrNoEmail             = errors.New("user has no email to send to") // 用户未绑定邮箱
+)
+
+// ForgotPassword  找回密码请求结构体
+type ForgotPassword struct {
+	Account string `json:"account" binding:"required"` // 用户名、邮箱或手机号
+	IP      string `json:"-"`                          // 客户端IP,用于限流
+}
+
+// ResetPassword  重置密码请求结构体
+type ResetPassword struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ForgotPasswordHandler  找回密码处理者
+// 账号存在且绑定了邮箱时发送重置链接;无论账号是否存在都返回相同结果,邮件在后台发送,避免通过响应探测账号
+type ForgotPasswordHandler struct {
+	*zap.Logger
+	cfg      *configs.PasswordReset
+	url      string
+	repo     user.UserRepository
+	tokens   user.ResetTokenRepository
+	sender   mail.Sender
+	limiter  ratelimit.Limiter
+	recorder audit.Recorder
+}
+
+// NewForgotPasswordHandler 创建找回密码处理者
+func NewForgotPasswordHandler(cfg *configs.User, oauth2 *configs.OAuth2, repo user.UserRepository, tokens user.ResetTokenRepository, sender mail.Sender, limiter ratelimit.Limiter, recorder audit.Recorder, logger *zap.Logger) *ForgotPasswordHandler {
+
+	resetURL := cfg.PasswordReset.URL
+	if resetURL == "" {
+		resetURL = strings.TrimSuffix(oauth2.Issuer, "/") + "/reset-password"
+	}
+
+	return &ForgotPasswordHandler{
+		Logger:   logger,
+		cfg:      cfg.PasswordReset,
+		url:      resetURL,
+		repo:     repo,
+		tokens:   tokens,
+		sender:   sender,
+		limiter:  limiter,
+		recorder: recorder,
+	}
+}
+
+// Handle  处理找回密码请求
+//
+// 参数:
+//
+//	ctx: 上下文
+//	cmd: 找回密码请求
+//
+// 返回值:
+//
+//	error: 错误信息,账号不存在、已禁用或未绑定邮箱时同样返回 nil
+//
+// 错误信息:
+//
+//	ErrPasswordResetClosed: 未开放找回密码
+//	ErrRateLimited: 账号或IP超过限流次数
+func (h *ForgotPasswordHandler) Handle(ctx context.Context, cmd *ForgotPassword) error {
+
+	if !h.cfg.Enabled {
+		return ErrPasswordResetClosed
+	}
+
+	// 按提交的账号而不是用户限流,账号是否存在不影响结果
+	limits := []struct {
+		key   string
+		limit int
+	}{
+		{"password_reset:ip:" + cmd.IP, h.cfg.IPLimit},
+		{"password_reset:account:" + strings.ToLower(cmd.Account), h.cfg.AccountLimit},
+	}
+	for _, l := range limits {
+		ok, err := h.limiter.Allow(ctx, l.key, l.limit, h.cfg.LimitWindow)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrRateLimited
+		}
+	}
+
+	u, err := h.repo.GetUserInfoByAccount(ctx, cmd.Account)
+	if errors.Is(err, user.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.Status == user.Disable || u.Email == "" {
+		h.Info("password reset skipped", zap.String("user_id", u.ID), zap.Bool("disabled", u.Status == user.Disable))
+		return nil
+	}
+
+	go func() {
+		if err := h.issue(context.Background(), u, "self"); err != nil {
+			h.Error("send password reset mail failed", zap.String("user_id", u.ID), zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// IssueForUser 管理员为用户发送找回密码邮件,不受限流与开关限制
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	operator: 操作者,用于安全事件记录
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	user.ErrUserNotFound: 用户不存在
+//	ErrNoEmail: 用户未绑定邮箱
+func (h *ForgotPasswordHandler) IssueForUser(ctx context.Context, userID, operator string) error {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.Email == "" {
+		return ErrNoEmail
+	}
+
+	return h.issue(ctx, u, operator)
+}
+
+// issue 生成重置令牌并发送邮件,令牌只保存哈希
+func (h *ForgotPasswordHandler) issue(ctx context.Context, u *user.UserInfo, operator string) error {
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+
+	expiresAt := time.Now().Add(h.cfg.TokenLifetime)
+	if err := h.tokens.SaveResetToken(ctx, &user.ResetToken{Hash: hashToken(raw), UserID: u.ID, ExpiresAt: expiresAt}); err != nil {
+		return err
+	}
+
+	link, err := url.Parse(h.url)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", raw)
+	link.RawQuery = q.Encode()
+
+	err = h.sender.Send(ctx, &mail.Message{
+		To:      []string{u.Email},
+		Subject: "重置密码",
+		Text: fmt.Sprintf("%s，你好：\n\n我们收到了重置账号 %s 密码的请求。请在 %d 分钟内打开以下链接设置新密码，链接只能使用一次：\n\n%s\n\n如果不是你本人操作，请忽略本邮件，你的密码不会改变。\n",
+			u.Nickname, u.Loginname, int(h.cfg.TokenLifetime.Minutes()), link.String()),
+	})
+	if err != nil {
+		return err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{
+		Type:   audit.PasswordResetIssued,
+		UserID: u.ID,
+		Detail: map[string]string{"operator": operator},
+	})
+
+	return nil
+}
+
+// ResetPasswordHandler  重置密码处理者
+type ResetPasswordHandler struct {
+	*zap.Logger
+	cfg      *configs.User
+	repo     user.UserRepository
+	tokens   user.ResetTokenRepository
+	recorder audit.Recorder
+}
+
+// NewResetPasswordHandler 创建重置密码处理者
+func NewResetPasswordHandler(cfg *configs.User, repo user.UserRepository, tokens user.ResetTokenRepository, recorder audit.Recorder, logger *zap.Logger) *ResetPasswordHandler {
+	return &ResetPasswordHandler{
+		Logger:   logger,
+		cfg:      cfg,
+		repo:     repo,
+		tokens:   tokens,
+		recorder: recorder,
+	}
+}
+
+// Handle  使用找回密码令牌设置新密码,令牌使用后失效
+// 新密码不符合策略时令牌保留,用户可以修改后重试
+//
+// 参数:
+//
+//	ctx: 上下文
+//	cmd: 重置密码请求
+//
+// 返回值:
+//
+//	string: 用户ID,调用方据此撤销用户已有的登录会话与令牌
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	user.ErrResetTokenInvalid: 令牌无效、已过期、已使用,或用户已禁用
+//	password.ErrPolicy: 新密码不符合策略,错误信息中包含具体原因
+func (h *ResetPasswordHandler) Handle(ctx context.Context, cmd *ResetPassword) (string, error) {
+
+	hash := hashToken(cmd.Token)
+
+	t, err := h.tokens.GetResetToken(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := h.repo.GetUserInfoByID(ctx, t.UserID)
+	if errors.Is(err, user.ErrUserNotFound) {
+		return "", user.ErrResetTokenInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	if u.Status == user.Disable {
+		return "", user.ErrResetTokenInvalid
+	}
+
+	if err := h.cfg.PasswordPolicy.Validate(cmd.Password, u.Loginname, u.Email, u.Phone); err != nil {
+		return "", err
+	}
+
+	if _, err := h.tokens.TakeResetToken(ctx, hash); err != nil {
+		return "", err
+	}
+
+	passwordHash, err := password.Hash(cmd.Password)
+	if err != nil {
+		return "", err
+	}
+	if err := h.repo.UpdatePassword(ctx, u.ID, passwordHash); err != nil {
+		return "", err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.PasswordReset, UserID: u.ID})
+
+	return u.ID, nil
+}
+
+// hashToken 计算令牌的 SHA-256 哈希,令牌为 256 位随机数,无需加盐
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,184 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/mail"
+)
+
+const testNewPassword = "N3w-passw0rd-for-reset"
+
+// tokenPattern 从重置或验证邮件的链接中取出令牌
+var tokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// newResetDeps 创建开放找回密码的测试依赖
+func newResetDeps(t *testing.T) *testDeps {
+	t.Helper()
+	return newTestDeps(t, func(c *configs.User) { c.PasswordReset.Enabled = true })
+}
+
+// waitMessages 等待异步发送的邮件达到 n 封,返回全部邮件
+func waitMessages(t *testing.T, sender *mail.MemorySender, n int) []*mail.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		msgs := sender.Messages()
+		if len(msgs) >= n {
+			return msgs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d mails, want %d", len(msgs), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// requestResetToken 提交找回密码请求,返回邮件中的重置令牌
+func requestResetToken(t *testing.T, d *testDeps, h *ForgotPasswordHandler) string {
+	t.Helper()
+
+	n := len(d.mail.Messages())
+	if err := h.Handle(context.Background(), &ForgotPassword{Account: testUsername, IP: "192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := waitMessages(t, d.mail, n+1)[n]
+	if len(msg.To) != 1 || msg.To[0] != testEmail {
+		t.Fatalf("mail sent to %v", msg.To)
+	}
+	m := tokenPattern.FindStringSubmatch(msg.Text)
+	if m == nil {
+		t.Fatalf("no reset token in mail: %q", msg.Text)
+	}
+	return m[1]
+}
+
+func TestResetTokenSingleUse(t *testing.T) {
+
+	d := newResetDeps(t)
+	reset := d.resetPasswordHandler()
+	ctx := context.Background()
+	raw := requestResetToken(t, d, d.forgotPasswordHandler())
+
+	userID, err := reset.Handle(ctx, &ResetPassword{Token: raw, Password: testNewPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != testUserID {
+		t.Fatalf("reset user %q, want %q", userID, testUserID)
+	}
+	if _, err := d.repo.GetUserInfoByPassword(ctx, testUsername, testNewPassword); err != nil {
+		t.Fatalf("login with new password: %v", err)
+	}
+
+	_, err = reset.Handle(ctx, &ResetPassword{Token: raw, Password: "An0ther-passw0rd-reset"})
+	if !errors.Is(err, user.ErrResetTokenInvalid) {
+		t.Fatalf("reuse token: %v, want %v", err, user.ErrResetTokenInvalid)
+	}
+}
+
+func TestResetTokenKeptOnPolicyError(t *testing.T) {
+
+	d := newResetDeps(t)
+	reset := d.resetPasswordHandler()
+	ctx := context.Background()
+	raw := requestResetToken(t, d, d.forgotPasswordHandler())
+
+	// 新密码不符合策略时令牌保留,修改后可以重试
+	if _, err := reset.Handle(ctx, &ResetPassword{Token: raw, Password: "short"}); err == nil {
+		t.Fatal("weak password accepted")
+	}
+	if _, err := reset.Handle(ctx, &ResetPassword{Token: raw, Password: testNewPassword}); err != nil {
+		t.Fatalf("retry after policy error: %v", err)
+	}
+}
+
+func TestResetTokenExpired(t *testing.T) {
+
+	d := newTestDeps(t, func(c *configs.User) {
+		c.PasswordReset.Enabled = true
+		c.PasswordReset.TokenLifetime = 50 * time.Millisecond
+	})
+	raw := requestResetToken(t, d, d.forgotPasswordHandler())
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err := d.resetPasswordHandler().Handle(context.Background(), &ResetPassword{Token: raw, Password: testNewPassword})
+	if !errors.Is(err, user.ErrResetTokenInvalid) {
+		t.Fatalf("expired token: %v, want %v", err, user.ErrResetTokenInvalid)
+	}
+}
+
+func TestForgotPasswordUnknownAccount(t *testing.T) {
+
+	d := newResetDeps(t)
+	forgot := d.forgotPasswordHandler()
+	ctx := context.Background()
+
+	// 账号存在与否返回相同结果,只有存在的账号收到邮件
+	known := forgot.Handle(ctx, &ForgotPassword{Account: testUsername, IP: "192.0.2.1"})
+	unknown := forgot.Handle(ctx, &ForgotPassword{Account: "nobody", IP: "192.0.2.1"})
+	if known != nil || unknown != nil {
+		t.Fatalf("known account: %v, unknown account: %v", known, unknown)
+	}
+
+	waitMessages(t, d.mail, 1)
+	time.Sleep(50 * time.Millisecond)
+	if n := len(d.mail.Messages()); n != 1 {
+		t.Fatalf("got %d mails, want 1", n)
+	}
+}
+
+func TestForgotPasswordRateLimited(t *testing.T) {
+
+	d := newResetDeps(t)
+	forgot := d.forgotPasswordHandler()
+	ctx := context.Background()
+	limit := d.cfg.PasswordReset.AccountLimit
+
+	// 按提交的账号限流,不存在的账号同样计数
+	for _, account := range []string{testUsername, "nobody"} {
+		for i := 0; i < limit; i++ {
+			if err := forgot.Handle(ctx, &ForgotPassword{Account: account, IP: "192.0.2.1"}); err != nil {
+				t.Fatalf("%s request %d: %v", account, i+1, err)
+			}
+		}
+		err := forgot.Handle(ctx, &ForgotPassword{Account: account, IP: "192.0.2.1"})
+		if !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("%s over account limit: %v, want %v", account, err, ErrRateLimited)
+		}
+	}
+
+	// 同一IP提交不同账号,超过 IPLimit 后拒绝
+	d = newTestDeps(t, func(c *configs.User) {
+		c.PasswordReset.Enabled = true
+		c.PasswordReset.IPLimit = 2
+	})
+	forgot = d.forgotPasswordHandler()
+	for _, account := range []string{"usera", "userb"} {
+		if err := forgot.Handle(ctx, &ForgotPassword{Account: account, IP: "192.0.2.2"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := forgot.Handle(ctx, &ForgotPassword{Account: "userz", IP: "192.0.2.2"})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("over ip limit: %v, want %v", err, ErrRateLimited)
+	}
+}
+
+func TestForgotPasswordClosed(t *testing.T) {
+
+	d := newTestDeps(t, nil)
+
+	err := d.forgotPasswordHandler().Handle(context.Background(), &ForgotPassword{Account: testUsername, IP: "192.0.2.1"})
+	if !errors.Is(err, ErrPasswordResetClosed) {
+		t.Fatalf("forgot password while closed: %v, want %v", err, ErrPasswordResetClosed)
+	}
+}
@@ -0,0 +1,180 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+)
+
+// recoveryCodeBytes 每个恢复码的随机字节数,80 位熵足以抵御对哈希的离线穷举
+const recoveryCodeBytes = 10
+
+// RecoveryCode  恢复码请求结构体
+type RecoveryCode struct {
+	Code string `json:"code" binding:"required"` // 生成时展示的恢复码,忽略大小写与分隔符
+}
+
+// RecoveryCodesDTO 新生成的恢复码,只在生成时返回一次
+type RecoveryCodesDTO struct {
+	Codes []string `json:"codes"` // 恢复码,每个只能使用一次
+}
+
+// RecoveryResult 使用恢复码的结果
+type RecoveryResult struct {
+	Remaining int `json:"remaining"` // 剩余可用的恢复码数量,用尽前应重新生成
+}
+
+// GenerateRecoveryCodes 生成一批新的恢复码,之前的恢复码全部失效;恢复码只保存哈希
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	*RecoveryCodesDTO: 恢复码原文
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFANotEnrolled: 未绑定认证器应用也未注册安全密钥
+func (h *MFAHandler) GenerateRecoveryCodes(ctx context.Context, userID string) (*RecoveryCodesDTO, error) {
+
+	ok, err := user.HasSecondFactor(ctx, h.totps, h.credentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMFANotEnrolled
+	}
+
+	codes := make([]string, 0, h.cfg.RecoveryCodes)
+	hashes := make([]string, 0, h.cfg.RecoveryCodes)
+	for range h.cfg.RecoveryCodes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := h.recoveries.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.RecoveryCodesIssued, UserID: userID, Detail: map[string]string{"count": strconv.Itoa(len(codes))}})
+	return &RecoveryCodesDTO{Codes: codes}, nil
+}
+
+// VerifyRecoveryCode 使用恢复码代替第二步验证,成功后该恢复码失效;与一次性密码共用提交次数限制
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	code: 恢复码
+//
+// 返回值:
+//
+//	*RecoveryResult: 剩余的恢复码数量
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFANotEnrolled: 未绑定认证器应用也未注册安全密钥
+//	user.ErrRecoveryCodeInvalid: 恢复码错误或已使用
+//	ErrRateLimited: 超过提交次数限制
+func (h *MFAHandler) VerifyRecoveryCode(ctx context.Context, userID, code string) (*RecoveryResult, error) {
+
+	ok, err := h.limiter.Allow(ctx, "mfa:"+userID, h.cfg.CodeAttempts, h.cfg.LimitWindow)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRateLimited
+	}
+
+	// 恢复码只能代替已有的验证方式,验证方式被全部移除后不再可用
+	ok, err = user.HasSecondFactor(ctx, h.totps, h.credentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMFANotEnrolled
+	}
+
+	if err := h.recoveries.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+		return nil, err
+	}
+
+	remaining, err := h.recoveries.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.RecoveryCodeUsed, UserID: userID, Detail: map[string]string{"remaining": strconv.Itoa(remaining)}})
+	return &RecoveryResult{Remaining: remaining}, nil
+}
+
+// Fresh 判断最近一次两步验证是否在 reauth_window 内,敏感操作前调用,超出时须重新验证
+//
+// 参数:
+//
+//	authTime: 会话最近一次完成认证的时间
+//
+// 返回值:
+//
+//	bool: 在时限内返回true
+func (h *MFAHandler) Fresh(authTime time.Time) bool {
+	return !authTime.IsZero() && time.Since(authTime) <= h.cfg.ReauthWindow
+}
+
+// pruneRecoveryCodes 用户已没有任何验证方式时删除剩余的恢复码
+func (h *MFAHandler) pruneRecoveryCodes(ctx context.Context, userID string) error {
+
+	ok, err := user.HasSecondFactor(ctx, h.totps, h.credentials, userID)
+	if err != nil || ok {
+		return err
+	}
+
+	return h.recoveries.DeleteRecoveryCodes(ctx, userID)
+}
+
+// generateRecoveryCode 生成形如 abcd-efgh-ijkl-mnop 的恢复码
+func generateRecoveryCode() (string, error) {
+
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+
+	var sb strings.Builder
+	for i := 0; i < len(raw); i += 4 {
+		if i > 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteString(raw[i:min(i+4, len(raw))])
+	}
+
+	return sb.String(), nil
+}
+
+// normalizeRecoveryCode 去除分隔符与空白并转为小写,用户手抄或粘贴时格式可能不同
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+)
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+
+	d := newTestDeps(t, nil)
+	h := d.mfaHandler()
+	ctx := context.Background()
+
+	// 未绑定任何验证方式时不能生成恢复码
+	if _, err := h.GenerateRecoveryCodes(ctx, testUserID); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Fatalf("GenerateRecoveryCodes(not enrolled) = %v, want ErrMFANotEnrolled", err)
+	}
+
+	enrollTOTP(t, h, testUserID)
+	dto, err := h.GenerateRecoveryCodes(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dto.Codes) != d.cfg.MFA.RecoveryCodes {
+		t.Fatalf("generated %d codes, want %d", len(dto.Codes), d.cfg.MFA.RecoveryCodes)
+	}
+
+	code := dto.Codes[0]
+	res, err := h.VerifyRecoveryCode(ctx, testUserID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Remaining != len(dto.Codes)-1 {
+		t.Fatalf("remaining = %d, want %d", res.Remaining, len(dto.Codes)-1)
+	}
+	if !d.recorder.has(audit.RecoveryCodeUsed) {
+		t.Fatal("recovery code use not recorded")
+	}
+
+	// 同一恢复码不能再次使用,改变大小写与分隔符也不行
+	for _, v := range []string{code, strings.ToUpper(strings.ReplaceAll(code, "-", ""))} {
+		if _, err := h.VerifyRecoveryCode(ctx, testUserID, v); !errors.Is(err, user.ErrRecoveryCodeInvalid) {
+			t.Fatalf("VerifyRecoveryCode(%q) reused = %v, want ErrRecoveryCodeInvalid", v, err)
+		}
+	}
+
+	// 恢复码只属于生成它的用户
+	enrollTOTP(t, h, otherUserID)
+	if _, err := h.VerifyRecoveryCode(ctx, otherUserID, dto.Codes[1]); !errors.Is(err, user.ErrRecoveryCodeInvalid) {
+		t.Fatalf("VerifyRecoveryCode(other user) = %v, want ErrRecoveryCodeInvalid", err)
+	}
+
+	// 重新生成后之前的恢复码全部失效
+	if _, err := h.GenerateRecoveryCodes(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.VerifyRecoveryCode(ctx, testUserID, dto.Codes[1]); !errors.Is(err, user.ErrRecoveryCodeInvalid) {
+		t.Fatalf("VerifyRecoveryCode(replaced) = %v, want ErrRecoveryCodeInvalid", err)
+	}
+}
@@ -0,0 +1,161 @@
+package user
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration is closed")         // 未开放自助注册
+	ErrInviteCode         = errors.New("invalid invite code")            // 邀请码错误
+	ErrEmailDomain        = errors.New("email domain is not allowed")    // 邮箱域名不在允许范围内
+	ErrFieldRequired      = errors.New("required field is missing")      // 缺少必填字段
+	ErrRegisterInvalid    = errors.New("invalid registration parameter") // 注册参数不合法
+)
+
+// Register  注册请求结构体
+type Register struct {
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	Nickname   string `json:"nickname"`
+	InviteCode string `json:"invite_code"`
+}
+
+// RegisterHandler  注册处理者
+type RegisterHandler struct {
+	*zap.Logger
+	cfg  *configs.User
+	repo user.UserRepository
+}
+
+// NewRegisterHandler 创建注册处理者
+func NewRegisterHandler(cfg *configs.User, repo user.UserRepository, logger *zap.Logger) *RegisterHandler {
+	return &RegisterHandler{
+		Logger: logger,
+		cfg:    cfg,
+		repo:   repo,
+	}
+}
+
+// Handle  处理注册请求,校验注册配置、字段格式与密码策略后创建用户
+//
+// 参数:
+//
+//	ctx: 上下文
+//	cmd: 注册请求
+//
+// 返回值:
+//
+//	*UserInfoDTO: 新用户信息
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrRegistrationClosed: 未开放自助注册
+//	ErrInviteCode: 须填写邀请码但邀请码错误
+//	ErrFieldRequired: 缺少必填字段,错误信息中包含字段名
+//	ErrEmailDomain: 邮箱域名不在允许范围内
+//	ErrRegisterInvalid: 用户名、邮箱、手机号格式错误或密码不符合策略,错误信息中包含具体原因
+//	user.ErrUsernameExist, user.ErrEmailExist, user.ErrPhoneExist: 用户名、邮箱或手机号已被使用
+func (h *RegisterHandler) Handle(ctx context.Context, cmd *Register) (*UserInfoDTO, error) {
+
+	reg := h.cfg.Registration
+	if !reg.Enabled {
+		return nil, ErrRegistrationClosed
+	}
+
+	if reg.InviteOnly && !h.validInviteCode(cmd.InviteCode) {
+		return nil, ErrInviteCode
+	}
+
+	for field, value := range map[string]string{configs.FieldEmail: cmd.Email, configs.FieldPhone: cmd.Phone, configs.FieldNickname: cmd.Nickname} {
+		if value == "" && reg.Requires(field) {
+			return nil, fmt.Errorf("%w: %s", ErrFieldRequired, field)
+		}
+	}
+
+	if err := user.ValidateUsername(cmd.Username); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRegisterInvalid, err)
+	}
+	if cmd.Email != "" {
+		if err := user.ValidateEmail(cmd.Email); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRegisterInvalid, err)
+		}
+		if len(reg.EmailDomains) > 0 && !slices.Contains(reg.EmailDomains, user.EmailDomain(cmd.Email)) {
+			return nil, ErrEmailDomain
+		}
+	}
+	if cmd.Phone != "" {
+		if err := user.ValidatePhone(cmd.Phone); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRegisterInvalid, err)
+		}
+	}
+	if err := h.cfg.PasswordPolicy.Validate(cmd.Password, cmd.Username, cmd.Email, cmd.Phone); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRegisterInvalid, err)
+	}
+
+	hash, err := password.Hash(cmd.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &user.UserInfo{
+		Loginname: cmd.Username,
+		Nickname:  cmd.Nickname,
+		Email:     cmd.Email,
+		Phone:     cmd.Phone,
+		Status:    user.Normal,
+	}
+	if info.Nickname == "" {
+		info.Nickname = cmd.Username
+	}
+
+	if err := h.repo.CreateUser(ctx, info, hash); err != nil {
+		return nil, err
+	}
+
+	h.Info("user registered", zap.String("user_id", info.ID), zap.String("username", info.Loginname))
+
+	return &UserInfoDTO{
+		UserID:    info.ID,
+		Username:  info.Loginname,
+		Nickname:  info.Nickname,
+		AvatarURL: info.Avatar,
+		Email:     info.Email,
+		Phone:     info.Phone,
+		CreatedAt: info.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
+
+// validInviteCode 校验邀请码,配置中的邀请码可以是哈希或明文
+func (h *RegisterHandler) validInviteCode(code string) bool {
+
+	if code == "" {
+		return false
+	}
+
+	for _, v := range h.cfg.Registration.InviteCodes {
+		if password.IsHash(v) {
+			if ok, _ := password.Verify(v, code); ok {
+				return true
+			}
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(v), []byte(code)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+)
+
+func TestRegisterConflicts(t *testing.T) {
+
+	d := newTestDeps(t, func(cfg *configs.User) {
+		cfg.Registration.Enabled = true
+	})
+	h := d.registerHandler()
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		cmd  *Register
+		want error
+	}{
+		{"duplicate username", &Register{Username: testUsername, Password: "Carol-passw0rd"}, user.ErrUsernameExist},
+		{"duplicate email", &Register{Username: "carol", Password: "Carol-passw0rd", Email: testEmail}, user.ErrEmailExist},
+		{"duplicate email in other case", &Register{Username: "carol", Password: "Carol-passw0rd", Email: "Alice@Example.COM"}, user.ErrEmailExist},
+		{"duplicate phone", &Register{Username: "carol", Password: "Carol-passw0rd", Phone: testPhone}, user.ErrPhoneExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.Handle(ctx, tt.cmd)
+			if !errors.Is(err, tt.want) || !errors.Is(err, user.ErrUserExist) {
+				t.Fatalf("Handle = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// 唯一字段均未被使用时注册成功,之后同一邮箱与手机号不能再次注册
+	dto, err := h.Handle(ctx, &Register{Username: "carol", Password: "Carol-passw0rd", Email: "carol@example.com", Phone: "+8613900000000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dto.UserID == "" || dto.Email != "carol@example.com" {
+		t.Fatalf("unexpected user: %+v", dto)
+	}
+
+	if _, err := h.Handle(ctx, &Register{Username: "dave", Password: "Dave-passw0rd", Email: "CAROL@example.com"}); !errors.Is(err, user.ErrEmailExist) {
+		t.Fatalf("Handle(duplicate email) = %v, want ErrEmailExist", err)
+	}
+	if _, err := h.Handle(ctx, &Register{Username: "dave", Password: "Dave-passw0rd", Phone: "+8613900000000"}); !errors.Is(err, user.ErrPhoneExist) {
+		t.Fatalf("Handle(duplicate phone) = %v, want ErrPhoneExist", err)
+	}
+}
@@ -0,0 +1,276 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/ratelimit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/sms"
+	"go.uber.org/zap"
+)
+
+// ErrSMSLoginClosed 未开放短信验证码登录
+var ErrSMSLoginClosed = errors.New("sms login is closed")
+
+// SMSLoginCode  发送登录验证码请求结构体
+type SMSLoginCode struct {
+	Phone string `json:"phone" binding:"required"` // 手机号,E.164 格式,如 +8613800000000
+	IP    string `json:"-"`                        // 客户端IP,用于限流
+}
+
+// SMSLogin  短信验证码登录请求结构体
+type SMSLogin struct {
+	Phone string `json:"phone" binding:"required"` // 手机号,与发送验证码时相同
+	Code  string `json:"code" binding:"required"`  // 短信验证码
+	IP    string `json:"-"`                        // 客户端IP,用于限流
+}
+
+// SMSLoginHandler  短信验证码登录处理者
+// 未注册的手机号在关闭自动注册时不发送短信但返回相同结果,避免通过响应探测手机号是否注册
+type SMSLoginHandler struct {
+	*zap.Logger
+	cfg           *configs.SMSLogin
+	repo          user.UserRepository
+	verifications user.VerificationRepository
+	sms           sms.Sender
+	limiter       ratelimit.Limiter
+	codeKey       []byte
+}
+
+// NewSMSLoginHandler 创建短信验证码登录处理者
+func NewSMSLoginHandler(cfg *configs.User, repo user.UserRepository, verifications user.VerificationRepository, smsSender sms.Sender, limiter ratelimit.Limiter, logger *zap.Logger) (*SMSLoginHandler, error) {
+
+	codeKey, err := cfg.CodeSecretBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMSLoginHandler{
+		Logger:        logger,
+		cfg:           cfg.SMSLogin,
+		repo:          repo,
+		verifications: verifications,
+		sms:           smsSender,
+		limiter:       limiter,
+		codeKey:       codeKey,
+	}, nil
+}
+
+// SendCode 向手机号发送登录验证码,之前发送的验证码失效;短信在后台发送
+//
+// 参数:
+//
+//	ctx: 上下文
+//	cmd: 发送登录验证码请求
+//
+// 返回值:
+//
+//	error: 错误信息,手机号未注册且未开启自动注册或用户已禁用时同样返回 nil
+//
+// 错误信息:
+//
+//	ErrSMSLoginClosed: 未开放短信验证码登录
+//	user.ErrInvalidPhone: 手机号格式错误
+//	ErrRateLimited: 未到重新发送的间隔,或手机号、IP 超过发送次数限制
+func (h *SMSLoginHandler) SendCode(ctx context.Context, cmd *SMSLoginCode) error {
+
+	if !h.cfg.Enabled {
+		return ErrSMSLoginClosed
+	}
+
+	if err := user.ValidatePhone(cmd.Phone); err != nil {
+		return err
+	}
+
+	// 按提交的手机号而不是用户限流,手机号是否注册不影响结果
+	err := h.allow(ctx,
+		smsLimit{"sms_login:ip:" + cmd.IP, h.cfg.IPLimit, h.cfg.LimitWindow},
+		smsLimit{"sms_login:interval:" + cmd.Phone, 1, h.cfg.SendInterval},
+		smsLimit{"sms_login:phone:" + cmd.Phone, h.cfg.SendLimit, h.cfg.LimitWindow},
+	)
+	if err != nil {
+		return err
+	}
+
+	u, err := h.repo.GetUserInfoByPhone(ctx, cmd.Phone)
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		if !h.cfg.AutoRegister {
+			h.Info("sms login code skipped, phone is not registered")
+			return nil
+		}
+	case err != nil:
+		return err
+	case u.Status == user.Disable:
+		h.Info("sms login code skipped, user is disabled", zap.String("user_id", u.ID))
+		return nil
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = h.verifications.SaveVerification(ctx, &user.Verification{
+		UserID:    cmd.Phone,
+		Channel:   user.ChannelSMSLogin,
+		Target:    cmd.Phone,
+		Hash:      hashCode(h.codeKey, cmd.Phone, code),
+		ExpiresAt: time.Now().Add(h.cfg.CodeLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := h.sms.Send(context.Background(), &sms.Message{
+			To:       cmd.Phone,
+			Template: sms.TemplateLogin,
+			Params:   map[string]string{"code": code},
+		})
+		if err != nil {
+			h.Error("send sms login code failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Handle 使用短信验证码登录,输错超过次数后验证码失效;验证通过后手机号标记为已验证,
+// 未注册的手机号在开启自动注册时创建无密码的用户
+//
+// 参数:
+//
+//	ctx: 上下文
+//	cmd: 短信验证码登录请求
+//
+// 返回值:
+//
+//	*UserInfoDTO: 用户信息
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrSMSLoginClosed: 未开放短信验证码登录
+//	user.ErrVerificationInvalid: 验证码错误、已过期、已使用,或手机号未注册且未开启自动注册
+//	user.ErrUserDisabled: 用户已禁用
+//	ErrRateLimited: 手机号或IP超过提交次数限制
+func (h *SMSLoginHandler) Handle(ctx context.Context, cmd *SMSLogin) (*UserInfoDTO, error) {
+
+	if !h.cfg.Enabled {
+		return nil, ErrSMSLoginClosed
+	}
+
+	err := h.allow(ctx,
+		smsLimit{"sms_login:verify_ip:" + cmd.IP, h.cfg.VerifyIPLimit, h.cfg.LimitWindow},
+		smsLimit{"sms_login:verify_phone:" + cmd.Phone, h.cfg.VerifyLimit, h.cfg.LimitWindow},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := h.verifications.GetVerification(ctx, cmd.Phone, user.ChannelSMSLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先占用一次尝试次数再比对,并发提交的验证码合计不超过 CodeAttempts 次
+	if err := h.verifications.AddVerificationAttempt(ctx, cmd.Phone, user.ChannelSMSLogin, h.cfg.CodeAttempts); err != nil {
+		if errors.Is(err, user.ErrVerificationInvalid) {
+			h.verifications.TakeVerification(ctx, cmd.Phone, user.ChannelSMSLogin, v.Hash)
+		}
+		return nil, err
+	}
+
+	hash := hashCode(h.codeKey, cmd.Phone, cmd.Code)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(v.Hash)) != 1 {
+		return nil, user.ErrVerificationInvalid
+	}
+
+	if _, err := h.verifications.TakeVerification(ctx, cmd.Phone, user.ChannelSMSLogin, hash); err != nil {
+		return nil, err
+	}
+
+	u, err := h.repo.GetUserInfoByPhone(ctx, cmd.Phone)
+	if errors.Is(err, user.ErrUserNotFound) {
+		if !h.cfg.AutoRegister {
+			return nil, user.ErrVerificationInvalid
+		}
+		u, err = h.register(ctx, cmd.Phone)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Status == user.Disable {
+		return nil, user.ErrUserDisabled
+	}
+
+	if !u.PhoneVerified {
+		if err := h.repo.MarkVerified(ctx, u.ID, user.ChannelPhone, cmd.Phone); err != nil {
+			return nil, err
+		}
+		u.PhoneVerified = true
+	}
+
+	h.Info("sms login verified", zap.String("user_id", u.ID))
+	return toUserInfoDTO(u), nil
+}
+
+// smsLimit 短信验证码登录的限流规则
+type smsLimit struct {
+	key    string
+	limit  int
+	window time.Duration
+}
+
+// allow 依次检查限流规则,任一规则超过次数时返回 ErrRateLimited
+func (h *SMSLoginHandler) allow(ctx context.Context, limits ...smsLimit) error {
+	for _, l := range limits {
+		ok, err := h.limiter.Allow(ctx, l.key, l.limit, l.window)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrRateLimited
+		}
+	}
+	return nil
+}
+
+// register 为未注册的手机号创建用户,用户名随机生成,不设置密码
+// 并发登录时手机号已被注册的,返回已注册的用户
+func (h *SMSLoginHandler) register(ctx context.Context, phone string) (*user.UserInfo, error) {
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	info := &user.UserInfo{
+		Loginname:     "sms_" + hex.EncodeToString(b),
+		Nickname:      "用户" + phone[len(phone)-4:],
+		Phone:         phone,
+		PhoneVerified: true,
+		Status:        user.Normal,
+	}
+
+	err := h.repo.CreateUser(ctx, info, "")
+	if errors.Is(err, user.ErrPhoneExist) {
+		return h.repo.GetUserInfoByPhone(ctx, phone)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.Info("user registered by sms login", zap.String("user_id", info.ID), zap.String("username", info.Loginname))
+	return info, nil
+}
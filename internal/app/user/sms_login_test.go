@@ -0,0 +1,208 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+)
+
+// 测试使用的客户端IP与未注册的手机号
+const (
+	testIP         = "192.0.2.1"
+	unknownPhone   = "+8613900000000"
+	smsLoginSecret = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+)
+
+// newSMSLoginDeps 创建开放短信验证码登录的测试依赖
+func newSMSLoginDeps(t *testing.T, setup func(*configs.SMSLogin)) *testDeps {
+	t.Helper()
+
+	return newTestDeps(t, func(c *configs.User) {
+		c.SMSLogin.Enabled = true
+		c.CodeSecret = smsLoginSecret
+		if setup != nil {
+			setup(c.SMSLogin)
+		}
+	})
+}
+
+// wrongSMSCode 与 code 不同的六位验证码
+func wrongSMSCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestSMSLogin(t *testing.T) {
+
+	d := newSMSLoginDeps(t, nil)
+	h := d.smsLoginHandler(t)
+	ctx := context.Background()
+
+	if err := h.SendCode(ctx, &SMSLoginCode{Phone: testPhone, IP: testIP}); err != nil {
+		t.Fatal(err)
+	}
+	code := d.smsCode(t, 1)
+
+	// 保存的是以服务端密钥计算的 HMAC,无密钥的哈希无法与之比对
+	v, err := d.verifications.GetVerification(ctx, testPhone, user.ChannelSMSLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Hash == hashToken(testPhone+":"+code) || strings.Contains(v.Hash, code) {
+		t.Fatal("sms code stored without a server key")
+	}
+	if key, _ := d.cfg.CodeSecretBytes(); v.Hash != hashCode(key, testPhone, code) {
+		t.Fatal("sms code not stored as hmac")
+	}
+
+	dto, err := h.Handle(ctx, &SMSLogin{Phone: testPhone, Code: code, IP: testIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dto.UserID != testUserID {
+		t.Fatalf("logged in as %q, want %q", dto.UserID, testUserID)
+	}
+	if u, _ := d.repo.GetUserInfoByID(ctx, testUserID); !u.PhoneVerified {
+		t.Fatal("phone not marked verified after sms login")
+	}
+
+	// 验证码只能使用一次
+	if _, err := h.Handle(ctx, &SMSLogin{Phone: testPhone, Code: code, IP: testIP}); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("Handle(reused) = %v, want ErrVerificationInvalid", err)
+	}
+}
+
+func TestSMSLoginExpired(t *testing.T) {
+
+	d := newSMSLoginDeps(t, func(c *configs.SMSLogin) { c.CodeLifetime = -time.Minute })
+	h := d.smsLoginHandler(t)
+	ctx := context.Background()
+
+	if err := h.SendCode(ctx, &SMSLoginCode{Phone: testPhone, IP: testIP}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Handle(ctx, &SMSLogin{Phone: testPhone, Code: d.smsCode(t, 1), IP: testIP}); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("Handle(expired) = %v, want ErrVerificationInvalid", err)
+	}
+}
+
+func TestSMSLoginAttempts(t *testing.T) {
+
+	d := newSMSLoginDeps(t, func(c *configs.SMSLogin) { c.CodeAttempts = 3 })
+	h := d.smsLoginHandler(t)
+	ctx := context.Background()
+
+	if err := h.SendCode(ctx, &SMSLoginCode{Phone: testPhone, IP: testIP}); err != nil {
+		t.Fatal(err)
+	}
+	code := d.smsCode(t, 1)
+
+	for i := 0; i < d.cfg.SMSLogin.CodeAttempts; i++ {
+		if _, err := h.Handle(ctx, &SMSLogin{Phone: testPhone, Code: wrongSMSCode(code), IP: testIP}); !errors.Is(err, user.ErrVerificationInvalid) {
+			t.Fatalf("attempt %d: Handle(wrong) = %v", i+1, err)
+		}
+	}
+
+	// 输错次数用完后正确的验证码也失效,须重新发送
+	if _, err := h.Handle(ctx, &SMSLogin{Phone: testPhone, Code: code, IP: testIP}); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("Handle after attempts exhausted = %v, want ErrVerificationInvalid", err)
+	}
+	if _, err := d.verifications.GetVerification(ctx, testPhone, user.ChannelSMSLogin); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("verification not removed after attempts exhausted: %v", err)
+	}
+}
+
+func TestSMSLoginSendInterval(t *testing.T) {
+
+	d := newSMSLoginDeps(t, nil)
+	h := d.smsLoginHandler(t)
+	ctx := context.Background()
+
+	if err := h.SendCode(ctx, &SMSLoginCode{Phone: testPhone, IP: testIP}); err != nil {
+		t.Fatal(err)
+	}
+	code := d.smsCode(t, 1)
+
+	// 未到重新发送的间隔,之前的验证码仍然有效
+	if err := h.SendCode(ctx, &SMSLoginCode{Phone: testPhone, IP: testIP}); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("SendCode within interval = %v, want ErrRateLimited", err)
+	}
+	if _, err := h.Handle(ctx, &SMSLogin{Phone: testPhone, Code: code, IP: testIP}); err != nil {
+		t.Fatalf("Handle with first code = %v", err)
+	}
+	if n := len(d.sms.Messages()); n != 1 {
+		t.Fatalf("sent %d sms, want 1", n)
+	}
+}
+
+func TestSMSLoginUnregistered(t *testing.T) {
+
+	d := newSMSLoginDeps(t, nil)
+	h := d.smsLoginHandler(t)
+	ctx := context.Background()
+
+	// 未注册的手机号与已注册的返回相同结果,但不发送短信也不保存验证码
+	if err := h.SendCode(ctx, &SMSLoginCode{Phone: unknownPhone, IP: testIP}); err != nil {
+		t.Fatalf("SendCode(unregistered) = %v, want nil", err)
+	}
+	if _, err := d.verifications.GetVerification(ctx, unknownPhone, user.ChannelSMSLogin); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("verification saved for unregistered phone: %v", err)
+	}
+	if _, err := h.Handle(ctx, &SMSLogin{Phone: unknownPhone, Code: "123456", IP: testIP}); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("Handle(unregistered) = %v, want ErrVerificationInvalid", err)
+	}
+
+	// 发送间隔同样按提交的手机号计算,不因是否注册而不同
+	if err := h.SendCode(ctx, &SMSLoginCode{Phone: unknownPhone, IP: testIP}); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("SendCode(unregistered) within interval = %v, want ErrRateLimited", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := len(d.sms.Messages()); n != 0 {
+		t.Fatalf("sent %d sms to unregistered phone, want 0", n)
+	}
+}
+
+func TestSMSLoginAutoRegister(t *testing.T) {
+
+	d := newSMSLoginDeps(t, func(c *configs.SMSLogin) { c.AutoRegister = true })
+	h := d.smsLoginHandler(t)
+	ctx := context.Background()
+
+	if err := h.SendCode(ctx, &SMSLoginCode{Phone: unknownPhone, IP: testIP}); err != nil {
+		t.Fatal(err)
+	}
+
+	dto, err := h.Handle(ctx, &SMSLogin{Phone: unknownPhone, Code: d.smsCode(t, 1), IP: testIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dto.UserID == "" || dto.Phone != unknownPhone || !strings.HasPrefix(dto.Username, "sms_") {
+		t.Fatalf("unexpected user: %+v", dto)
+	}
+
+	u, err := d.repo.GetUserInfoByPhone(ctx, unknownPhone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != dto.UserID || !u.PhoneVerified {
+		t.Fatalf("registered user = %+v", u)
+	}
+}
+
+func TestSMSLoginClosed(t *testing.T) {
+
+	d := newTestDeps(t, nil)
+	h := d.smsLoginHandler(t)
+
+	if err := h.SendCode(context.Background(), &SMSLoginCode{Phone: testPhone, IP: testIP}); !errors.Is(err, ErrSMSLoginClosed) {
+		t.Fatalf("SendCode = %v, want ErrSMSLoginClosed", err)
+	}
+}
@@ -1,13 +1,27 @@
 package user
 
 type UserApp struct {
-	LoginHandler  *LoginHandler
-	LogoutHandler *LogoutHandler
+	LoginHandler          *LoginHandler
+	LogoutHandler         *LogoutHandler
+	RegisterHandler       *RegisterHandler
+	ForgotPasswordHandler *ForgotPasswordHandler
+	ResetPasswordHandler  *ResetPasswordHandler
+	VerificationHandler   *VerificationHandler
+	MFAHandler            *MFAHandler
+	WebAuthnHandler       *WebAuthnHandler
+	SMSLoginHandler       *SMSLoginHandler
 }
 
-func NewUserApp(loginHandler *LoginHandler, logoutHandler *LogoutHandler) *UserApp {
+func NewUserApp(loginHandler *LoginHandler, logoutHandler *LogoutHandler, registerHandler *RegisterHandler, forgotPasswordHandler *ForgotPasswordHandler, resetPasswordHandler *ResetPasswordHandler, verificationHandler *VerificationHandler, mfaHandler *MFAHandler, webAuthnHandler *WebAuthnHandler, smsLoginHandler *SMSLoginHandler) *UserApp {
 	return &UserApp{
-		LoginHandler:  loginHandler,
-		LogoutHandler: logoutHandler,
+		LoginHandler:          loginHandler,
+		LogoutHandler:         logoutHandler,
+		RegisterHandler:       registerHandler,
+		ForgotPasswordHandler: forgotPasswordHandler,
+		ResetPasswordHandler:  resetPasswordHandler,
+		VerificationHandler:   verificationHandler,
+		MFAHandler:            mfaHandler,
+		WebAuthnHandler:       webAuthnHandler,
+		SMSLoginHandler:       smsLoginHandler,
 	}
 }
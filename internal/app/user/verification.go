@@ -0,0 +1,339 @@
+package user
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/mail"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/ratelimit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/sms"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoContact       = errors.New("no email or phone to verify") // 用户未绑定待验证的邮箱或手机号
+	ErrAlreadyVerified = errors.New("contact is already verified") // 邮箱或手机号已验证
+)
+
+// VerifyEmail  邮箱验证请求结构体
+type VerifyEmail struct {
+	Token string `json:"token" binding:"required"` // 验证邮件中的令牌
+}
+
+// VerifyPhone  手机号验证请求结构体
+type VerifyPhone struct {
+	Code string `json:"code" binding:"required"` // 短信验证码
+}
+
+// VerificationDTO 联系方式验证状态
+type VerificationDTO struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Phone         string `json:"phone"`
+	PhoneVerified bool   `json:"phone_verified"`
+}
+
+// VerificationHandler  联系方式验证处理者
+// 邮箱通过邮件链接验证,手机号通过短信验证码验证,令牌只保存哈希,验证码只保存以 user.code_secret 计算的 HMAC
+type VerificationHandler struct {
+	*zap.Logger
+	cfg           *configs.Verification
+	url           string
+	repo          user.UserRepository
+	verifications user.VerificationRepository
+	mail          mail.Sender
+	sms           sms.Sender
+	limiter       ratelimit.Limiter
+	codeKey       []byte
+}
+
+// NewVerificationHandler 创建联系方式验证处理者
+func NewVerificationHandler(cfg *configs.User, oauth2 *configs.OAuth2, repo user.UserRepository, verifications user.VerificationRepository, mailSender mail.Sender, smsSender sms.Sender, limiter ratelimit.Limiter, logger *zap.Logger) (*VerificationHandler, error) {
+
+	codeKey, err := cfg.CodeSecretBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	verifyURL := cfg.Verification.URL
+	if strings.HasPrefix(verifyURL, "/") {
+		verifyURL = strings.TrimSuffix(oauth2.Issuer, "/") + verifyURL
+	}
+
+	return &VerificationHandler{
+		Logger:        logger,
+		cfg:           cfg.Verification,
+		url:           verifyURL,
+		repo:          repo,
+		verifications: verifications,
+		mail:          mailSender,
+		sms:           smsSender,
+		limiter:       limiter,
+		codeKey:       codeKey,
+	}, nil
+}
+
+// Status 获取用户的联系方式验证状态
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	*VerificationDTO: 验证状态
+//	error: 错误信息
+func (h *VerificationHandler) Status(ctx context.Context, userID string) (*VerificationDTO, error) {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerificationDTO{
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Phone:         u.Phone,
+		PhoneVerified: u.PhoneVerified,
+	}, nil
+}
+
+// SendEmail 向用户的邮箱发送验证链接,之前发送的链接失效
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrNoContact: 用户未绑定邮箱
+//	ErrAlreadyVerified: 邮箱已验证
+//	ErrRateLimited: 超过发送次数限制
+func (h *VerificationHandler) SendEmail(ctx context.Context, userID string) error {
+
+	u, err := h.prepare(ctx, userID, user.ChannelEmail)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+
+	err = h.verifications.SaveVerification(ctx, &user.Verification{
+		UserID:    u.ID,
+		Channel:   user.ChannelEmail,
+		Target:    u.Email,
+		Hash:      hashToken(raw),
+		ExpiresAt: time.Now().Add(h.cfg.EmailLinkLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(h.url)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", raw)
+	link.RawQuery = q.Encode()
+
+	return h.mail.Send(ctx, &mail.Message{
+		To:      []string{u.Email},
+		Subject: "验证邮箱",
+		Text: fmt.Sprintf("%s，你好：\n\n请在 %d 小时内打开以下链接，验证账号 %s 绑定的邮箱：\n\n%s\n\n如果不是你本人操作，请忽略本邮件。\n",
+			u.Nickname, int(h.cfg.EmailLinkLifetime.Hours()), u.Loginname, link.String()),
+	})
+}
+
+// ConfirmEmail 使用验证链接中的令牌验证邮箱,不要求登录
+//
+// 参数:
+//
+//	ctx: 上下文
+//	token: 验证邮件中的令牌
+//
+// 返回值:
+//
+//	string: 用户ID
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	user.ErrVerificationInvalid: 令牌无效、已过期、已使用,或发送后邮箱已修改
+func (h *VerificationHandler) ConfirmEmail(ctx context.Context, token string) (string, error) {
+
+	hash := hashToken(token)
+
+	v, err := h.verifications.GetVerificationByHash(ctx, user.ChannelEmail, hash)
+	if err != nil {
+		return "", err
+	}
+	if _, err := h.verifications.TakeVerification(ctx, v.UserID, user.ChannelEmail, hash); err != nil {
+		return "", err
+	}
+
+	if err := h.repo.MarkVerified(ctx, v.UserID, user.ChannelEmail, v.Target); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return "", user.ErrVerificationInvalid
+		}
+		return "", err
+	}
+
+	h.Info("email verified", zap.String("user_id", v.UserID))
+	return v.UserID, nil
+}
+
+// SendPhoneCode 向用户的手机号发送验证码,之前发送的验证码失效
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrNoContact: 用户未绑定手机号
+//	ErrAlreadyVerified: 手机号已验证
+//	ErrRateLimited: 超过发送次数限制
+func (h *VerificationHandler) SendPhoneCode(ctx context.Context, userID string) error {
+
+	u, err := h.prepare(ctx, userID, user.ChannelPhone)
+	if err != nil {
+		return err
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = h.verifications.SaveVerification(ctx, &user.Verification{
+		UserID:    u.ID,
+		Channel:   user.ChannelPhone,
+		Target:    u.Phone,
+		Hash:      hashCode(h.codeKey, u.ID, code),
+		ExpiresAt: time.Now().Add(h.cfg.PhoneCodeLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.sms.Send(ctx, &sms.Message{
+		To:       u.Phone,
+		Template: sms.TemplateVerify,
+		Params:   map[string]string{"code": code},
+	})
+}
+
+// ConfirmPhone 使用短信验证码验证手机号,输错超过次数后验证码失效
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	code: 短信验证码
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	user.ErrVerificationInvalid: 验证码错误、已过期、已使用,或发送后手机号已修改
+func (h *VerificationHandler) ConfirmPhone(ctx context.Context, userID, code string) error {
+
+	v, err := h.verifications.GetVerification(ctx, userID, user.ChannelPhone)
+	if err != nil {
+		return err
+	}
+
+	// 先占用一次尝试次数再比对,并发提交的验证码合计不超过 CodeAttempts 次
+	if err := h.verifications.AddVerificationAttempt(ctx, userID, user.ChannelPhone, h.cfg.CodeAttempts); err != nil {
+		if errors.Is(err, user.ErrVerificationInvalid) {
+			h.verifications.TakeVerification(ctx, userID, user.ChannelPhone, v.Hash)
+		}
+		return err
+	}
+
+	hash := hashCode(h.codeKey, userID, code)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(v.Hash)) != 1 {
+		return user.ErrVerificationInvalid
+	}
+
+	if _, err := h.verifications.TakeVerification(ctx, userID, user.ChannelPhone, hash); err != nil {
+		return err
+	}
+
+	if err := h.repo.MarkVerified(ctx, userID, user.ChannelPhone, v.Target); err != nil {
+		return err
+	}
+
+	h.Info("phone verified", zap.String("user_id", userID))
+	return nil
+}
+
+// prepare 发送验证前检查联系方式与发送次数
+func (h *VerificationHandler) prepare(ctx context.Context, userID, channel string) (*user.UserInfo, error) {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	target, verified := u.Email, u.EmailVerified
+	if channel == user.ChannelPhone {
+		target, verified = u.Phone, u.PhoneVerified
+	}
+	if target == "" {
+		return nil, ErrNoContact
+	}
+	if verified {
+		return nil, ErrAlreadyVerified
+	}
+
+	ok, err := h.limiter.Allow(ctx, "verification:"+channel+":"+userID, h.cfg.SendLimit, h.cfg.LimitWindow)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRateLimited
+	}
+
+	return u, nil
+}
+
+// hashCode 以服务端密钥计算短信验证码的 HMAC-SHA256,以用户ID或手机号区分不同对象的相同验证码
+// 验证码只有六位,无密钥的哈希可以离线穷举,读取存储的人没有密钥时无法还原验证码
+func hashCode(key []byte, subject, code string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(subject + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,121 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+)
+
+// wrongCode 与 code 不同的六位验证码
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestConfirmPhone(t *testing.T) {
+
+	d := newTestDeps(t, nil)
+	h := d.verificationHandler(t)
+	ctx := context.Background()
+
+	if err := h.SendPhoneCode(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	code := d.smsCode(t, 1)
+
+	if err := h.ConfirmPhone(ctx, testUserID, wrongCode(code)); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("ConfirmPhone(wrong) = %v, want ErrVerificationInvalid", err)
+	}
+	if err := h.ConfirmPhone(ctx, testUserID, code); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := d.repo.GetUserInfoByID(ctx, testUserID)
+	if !u.PhoneVerified {
+		t.Fatal("phone not marked verified")
+	}
+
+	// 验证码只能使用一次
+	if err := h.ConfirmPhone(ctx, testUserID, code); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("ConfirmPhone(reused) = %v, want ErrVerificationInvalid", err)
+	}
+	if err := h.SendPhoneCode(ctx, testUserID); !errors.Is(err, ErrAlreadyVerified) {
+		t.Fatalf("SendPhoneCode(verified) = %v, want ErrAlreadyVerified", err)
+	}
+}
+
+func TestConfirmPhoneAttempts(t *testing.T) {
+
+	d := newTestDeps(t, nil)
+	h := d.verificationHandler(t)
+	ctx := context.Background()
+
+	if err := h.SendPhoneCode(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	code := d.smsCode(t, 1)
+
+	for i := 0; i < d.cfg.Verification.CodeAttempts; i++ {
+		if err := h.ConfirmPhone(ctx, testUserID, wrongCode(code)); !errors.Is(err, user.ErrVerificationInvalid) {
+			t.Fatalf("attempt %d: ConfirmPhone(wrong) = %v", i+1, err)
+		}
+	}
+
+	// 输错次数用完后正确的验证码也失效,须重新发送
+	if err := h.ConfirmPhone(ctx, testUserID, code); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("ConfirmPhone after attempts exhausted = %v, want ErrVerificationInvalid", err)
+	}
+	if _, err := d.verifications.GetVerification(ctx, testUserID, user.ChannelPhone); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("verification not removed after attempts exhausted: %v", err)
+	}
+
+	if err := h.SendPhoneCode(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ConfirmPhone(ctx, testUserID, d.smsCode(t, 2)); err != nil {
+		t.Fatalf("ConfirmPhone with resent code = %v", err)
+	}
+}
+
+func TestConfirmExpired(t *testing.T) {
+
+	d := newTestDeps(t, func(cfg *configs.User) {
+		cfg.Verification.PhoneCodeLifetime = -time.Minute
+		cfg.Verification.EmailLinkLifetime = -time.Minute
+	})
+	h := d.verificationHandler(t)
+	ctx := context.Background()
+
+	if err := h.SendPhoneCode(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ConfirmPhone(ctx, testUserID, d.smsCode(t, 1)); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("ConfirmPhone(expired) = %v, want ErrVerificationInvalid", err)
+	}
+
+	if err := h.SendEmail(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	messages := d.mail.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(messages))
+	}
+	m := tokenPattern.FindStringSubmatch(messages[0].Text)
+	if m == nil {
+		t.Fatalf("no token in mail: %q", messages[0].Text)
+	}
+	if _, err := h.ConfirmEmail(ctx, m[1]); !errors.Is(err, user.ErrVerificationInvalid) {
+		t.Fatalf("ConfirmEmail(expired) = %v, want ErrVerificationInvalid", err)
+	}
+
+	u, _ := d.repo.GetUserInfoByID(ctx, testUserID)
+	if u.EmailVerified || u.PhoneVerified {
+		t.Fatal("expired verification marked contact verified")
+	}
+}
@@ -0,0 +1,647 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrWebAuthnLimit      = errors.New("too many webauthn credentials")        // 注册的凭据数已达上限
+	ErrWebAuthnNotAllowed = errors.New("authenticator model is not allowed")   // 认证器型号不在允许列表中
+	ErrWebAuthnInvalid    = errors.New("invalid webauthn response")            // 挑战已过期,或认证器的响应校验失败
+	ErrWebAuthnCloned     = errors.New("webauthn credential may be cloned")    // 签名计数未增加,认证器可能被复制
+	ErrWebAuthnNotFound   = errors.New("webauthn credential is not found")     // 凭据不存在或不属于当前用户
+	ErrWebAuthnLastFactor = errors.New("cannot remove the last second factor") // 用户须两步验证,不能删除最后一个验证方式
+)
+
+// WebAuthnRegistration  完成注册 WebAuthn 凭据的请求结构体
+type WebAuthnRegistration struct {
+	Name       string          `json:"name" binding:"max=64"`         // 凭据名称,为空时按类型命名
+	Credential json.RawMessage `json:"credential" binding:"required"` // navigator.credentials.create() 返回的凭据
+}
+
+// WebAuthnAssertion  WebAuthn 登录请求结构体
+type WebAuthnAssertion struct {
+	Credential json.RawMessage `json:"credential" binding:"required"` // navigator.credentials.get() 返回的凭据
+}
+
+// WebAuthnRename  修改凭据名称请求结构体
+type WebAuthnRename struct {
+	Name string `json:"name" binding:"required,max=64"` // 凭据名称
+}
+
+// WebAuthnCredentialDTO WebAuthn 凭据信息
+type WebAuthnCredentialDTO struct {
+	ID                string   `json:"id"`                     // 凭据ID,base64url 编码
+	Name              string   `json:"name"`                   // 凭据名称
+	Passkey           bool     `json:"passkey"`                // 是否为可同步的通行密钥
+	Transports        []string `json:"transports"`             // 认证器支持的传输方式
+	AttestationFormat string   `json:"attestation_format"`     // 注册时的证明格式
+	AAGUID            string   `json:"aaguid"`                 // 认证器型号
+	CreatedAt         string   `json:"created_at"`             // 注册时间
+	LastUsedAt        string   `json:"last_used_at,omitempty"` // 最近一次登录时间
+}
+
+// WebAuthnLoginResult WebAuthn 登录结果
+type WebAuthnLoginResult struct {
+	UserID       string // 用户ID
+	UserVerified bool   // 认证器是否验证了用户(指纹、PIN 等)
+}
+
+// WebAuthnHandler  WebAuthn 凭据处理者
+// 挑战状态由调用方保存在服务端会话中,开始与完成须在同一会话内;凭据只保存公钥与签名计数
+type WebAuthnHandler struct {
+	*zap.Logger
+	cfg         *configs.WebAuthn
+	webauthn    *webauthn.WebAuthn
+	repo        user.UserRepository
+	totps       user.TOTPRepository
+	credentials user.WebAuthnCredentialRepository
+	recoveries  user.RecoveryCodeRepository
+	recorder    audit.Recorder
+}
+
+// NewWebAuthnHandler 创建 WebAuthn 凭据处理者,未配置依赖方ID与页面源时使用 oauth2.issuer
+//
+// 参数:
+//
+//	cfg: 用户配置
+//	oauth2: OAuth2 配置
+//	repo: 用户仓储
+//	totps: 一次性密码仓储
+//	credentials: WebAuthn 凭据仓储
+//	recoveries: 恢复码仓储
+//	recorder: 安全事件记录者
+//	logger: 日志对象
+//
+// 返回值:
+//
+//	*WebAuthnHandler: WebAuthn 凭据处理者
+//	error: 错误信息
+func NewWebAuthnHandler(cfg *configs.User, oauth2 *configs.OAuth2, repo user.UserRepository, totps user.TOTPRepository, credentials user.WebAuthnCredentialRepository, recoveries user.RecoveryCodeRepository, recorder audit.Recorder, logger *zap.Logger) (*WebAuthnHandler, error) {
+
+	w := cfg.WebAuthn
+
+	rpID, origins := w.RPID, w.RPOrigins
+	if rpID == "" || len(origins) == 0 {
+		issuer, err := url.Parse(oauth2.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid oauth2 issuer for webauthn: %v", configs.ErrUserConfig, err)
+		}
+		if rpID == "" {
+			rpID = issuer.Hostname()
+		}
+		if len(origins) == 0 {
+			origins = []string{issuer.Scheme + "://" + issuer.Host}
+		}
+	}
+
+	selection := protocol.AuthenticatorSelection{
+		AuthenticatorAttachment: protocol.AuthenticatorAttachment(w.AuthenticatorAttachment),
+		ResidentKey:             protocol.ResidentKeyRequirement(w.ResidentKey),
+		UserVerification:        protocol.UserVerificationRequirement(w.UserVerification),
+	}
+	if w.ResidentKey == configs.WebAuthnRequired {
+		selection.RequireResidentKey = protocol.ResidentKeyRequired()
+	}
+
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: w.Timeout, TimeoutUVD: w.Timeout}
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:                   rpID,
+		RPDisplayName:          w.RPDisplayName,
+		RPOrigins:              origins,
+		AttestationPreference:  protocol.ConveyancePreference(w.Attestation),
+		AuthenticatorSelection: selection,
+		Timeouts:               webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", configs.ErrUserConfig, err)
+	}
+
+	return &WebAuthnHandler{
+		Logger:      logger,
+		cfg:         w,
+		webauthn:    wa,
+		repo:        repo,
+		totps:       totps,
+		credentials: credentials,
+		recoveries:  recoveries,
+		recorder:    recorder,
+	}, nil
+}
+
+// Credentials 获取用户注册的凭据
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	[]*WebAuthnCredentialDTO: 凭据列表
+//	error: 错误信息
+func (h *WebAuthnHandler) Credentials(ctx context.Context, userID string) ([]*WebAuthnCredentialDTO, error) {
+
+	list, err := h.credentials.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]*WebAuthnCredentialDTO, 0, len(list))
+	for _, v := range list {
+		data = append(data, toWebAuthnCredentialDTO(v))
+	}
+
+	return data, nil
+}
+
+// BeginRegistration 开始注册凭据,已注册的凭据不能在同一认证器上重复注册
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	*protocol.CredentialCreation: 传给 navigator.credentials.create() 的参数
+//	string: 挑战状态,须保存在服务端会话中,完成注册时传入
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrWebAuthnLimit: 注册的凭据数已达上限
+func (h *WebAuthnHandler) BeginRegistration(ctx context.Context, userID string) (*protocol.CredentialCreation, string, error) {
+
+	wu, err := h.user(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(wu.credentials) >= h.cfg.MaxCredentials {
+		return nil, "", ErrWebAuthnLimit
+	}
+
+	creation, sd, err := h.webauthn.BeginRegistration(wu, webauthn.WithExclusions(webauthn.Credentials(wu.credentials).CredentialDescriptors()))
+	if err != nil {
+		return nil, "", err
+	}
+
+	state, err := json.Marshal(sd)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return creation, string(state), nil
+}
+
+// FinishRegistration 校验认证器的响应并保存凭据
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	state: 开始注册时返回的挑战状态
+//	param: 认证器返回的凭据与名称
+//
+// 返回值:
+//
+//	*WebAuthnCredentialDTO: 新注册的凭据
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrWebAuthnInvalid: 挑战已过期或响应校验失败
+//	ErrWebAuthnNotAllowed: 认证器型号不在 allowed_aaguids 中
+//	ErrWebAuthnLimit: 注册的凭据数已达上限
+func (h *WebAuthnHandler) FinishRegistration(ctx context.Context, userID, state string, param *WebAuthnRegistration) (*WebAuthnCredentialDTO, error) {
+
+	sd, err := parseWebAuthnState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	wu, err := h.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wu.credentials) >= h.cfg.MaxCredentials {
+		return nil, ErrWebAuthnLimit
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(param.Credential)
+	if err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	cred, err := h.webauthn.CreateCredential(wu, *sd, parsed)
+	if err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	// 未配置元数据服务时不校验证明证书的签发者,型号限制只能防止误用,不能防止伪造
+	if !h.allowed(cred.Authenticator.AAGUID) {
+		return nil, ErrWebAuthnNotAllowed
+	}
+
+	name := strings.TrimSpace(param.Name)
+	if name == "" {
+		name = "安全密钥"
+		if cred.Flags.BackupEligible {
+			name = "通行密钥"
+		}
+	}
+
+	c := &user.WebAuthnCredential{
+		ID:                cred.ID,
+		UserID:            userID,
+		Name:              name,
+		PublicKey:         cred.PublicKey,
+		AttestationFormat: cred.AttestationType,
+		AAGUID:            cred.Authenticator.AAGUID,
+		SignCount:         cred.Authenticator.SignCount,
+		BackupEligible:    cred.Flags.BackupEligible,
+		BackupState:       cred.Flags.BackupState,
+		CreatedAt:         time.Now(),
+	}
+	for _, t := range cred.Transport {
+		c.Transports = append(c.Transports, string(t))
+	}
+
+	if err := h.credentials.SaveWebAuthnCredential(ctx, c); err != nil {
+		if errors.Is(err, user.ErrWebAuthnCredentialExist) {
+			return nil, fmt.Errorf("%w: credential is already registered", ErrWebAuthnInvalid)
+		}
+		return nil, err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.MFAEnrolled, UserID: userID, Detail: map[string]string{"method": "webauthn", "credential_id": base64.RawURLEncoding.EncodeToString(c.ID)}})
+	return toWebAuthnCredentialDTO(c), nil
+}
+
+// BeginLogin 开始 WebAuthn 登录
+// userID 为空时为免密码登录,由认证器中的可发现凭据确定用户并要求用户验证;
+// 否则为已确定用户的第二步或补充验证,只允许该用户的凭据
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID,免密码登录时为空
+//
+// 返回值:
+//
+//	*protocol.CredentialAssertion: 传给 navigator.credentials.get() 的参数
+//	string: 挑战状态,须保存在服务端会话中,完成登录时传入
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrMFANotEnrolled: 用户未注册凭据
+func (h *WebAuthnHandler) BeginLogin(ctx context.Context, userID string) (*protocol.CredentialAssertion, string, error) {
+
+	var (
+		assertion *protocol.CredentialAssertion
+		sd        *webauthn.SessionData
+		err       error
+	)
+
+	if userID == "" {
+		assertion, sd, err = h.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	} else {
+		wu, uerr := h.user(ctx, userID)
+		if uerr != nil {
+			return nil, "", uerr
+		}
+		if len(wu.credentials) == 0 {
+			return nil, "", ErrMFANotEnrolled
+		}
+		assertion, sd, err = h.webauthn.BeginLogin(wu, webauthn.WithUserVerification(protocol.UserVerificationRequirement(h.cfg.UserVerification)))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	state, err := json.Marshal(sd)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return assertion, string(state), nil
+}
+
+// FinishLogin 校验认证器的签名,更新签名计数
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 开始登录时的用户ID,免密码登录时为空
+//	state: 开始登录时返回的挑战状态
+//	param: 认证器返回的凭据
+//
+// 返回值:
+//
+//	*WebAuthnLoginResult: 登录的用户与是否验证了用户
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrWebAuthnInvalid: 挑战已过期、凭据未注册或签名校验失败
+//	ErrWebAuthnCloned: 签名计数未增加,认证器可能被复制
+//	user.ErrUserDisabled: 用户已禁用
+func (h *WebAuthnHandler) FinishLogin(ctx context.Context, userID, state string, param *WebAuthnAssertion) (*WebAuthnLoginResult, error) {
+
+	sd, err := parseWebAuthnState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	// 免密码登录与已确定用户的挑战不能混用
+	if string(sd.UserID) != userID {
+		return nil, fmt.Errorf("%w: challenge was issued for another login", ErrWebAuthnInvalid)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(param.Credential)
+	if err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	var (
+		wu   *webAuthnUser
+		cred *webauthn.Credential
+	)
+
+	if userID == "" {
+		var found webauthn.User
+		found, cred, err = h.webauthn.ValidatePasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			c, err := h.credentials.GetWebAuthnCredential(ctx, rawID)
+			if err != nil {
+				return nil, err
+			}
+			if c.UserID != string(userHandle) {
+				return nil, user.ErrWebAuthnCredentialNotFound
+			}
+			return h.user(ctx, c.UserID)
+		}, *sd, parsed)
+		if err == nil {
+			wu = found.(*webAuthnUser)
+		}
+	} else {
+		if wu, err = h.user(ctx, userID); err != nil {
+			return nil, err
+		}
+		cred, err = h.webauthn.ValidateLogin(wu, *sd, parsed)
+	}
+	if err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	if wu.u.Status == user.Disable {
+		return nil, user.ErrUserDisabled
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(cred.ID)
+	if cred.Authenticator.CloneWarning {
+		h.recorder.Record(ctx, &audit.Event{Type: audit.WebAuthnCloned, UserID: wu.u.ID, Detail: map[string]string{"credential_id": credentialID}})
+		return nil, ErrWebAuthnCloned
+	}
+
+	if err := h.credentials.UseWebAuthnCredential(ctx, cred.ID, cred.Authenticator.SignCount, cred.Flags.BackupState, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnLoginResult{UserID: wu.u.ID, UserVerified: cred.Flags.UserVerified}, nil
+}
+
+// RenameCredential 修改凭据名称
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	id: base64url 编码的凭据ID
+//	name: 新名称
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrWebAuthnNotFound: 凭据不存在或不属于该用户
+func (h *WebAuthnHandler) RenameCredential(ctx context.Context, userID, id, name string) error {
+
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return ErrWebAuthnNotFound
+	}
+
+	err = h.credentials.RenameWebAuthnCredential(ctx, userID, raw, strings.TrimSpace(name))
+	if errors.Is(err, user.ErrWebAuthnCredentialNotFound) {
+		return ErrWebAuthnNotFound
+	}
+	return err
+}
+
+// DeleteCredential 删除凭据;用户须两步验证时不能删除最后一个验证方式,没有其他验证方式时恢复码一并删除
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	id: base64url 编码的凭据ID
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrWebAuthnNotFound: 凭据不存在或不属于该用户
+//	ErrWebAuthnLastFactor: 用户须两步验证且没有其他验证方式
+func (h *WebAuthnHandler) DeleteCredential(ctx context.Context, userID, id string) error {
+
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return ErrWebAuthnNotFound
+	}
+
+	wu, err := h.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(wu.credentials, func(c webauthn.Credential) bool { return bytes.Equal(c.ID, raw) }) {
+		return ErrWebAuthnNotFound
+	}
+
+	if wu.u.MFARequired && len(wu.credentials) == 1 {
+		t, err := h.totps.GetTOTP(ctx, userID)
+		if err != nil && !errors.Is(err, user.ErrTOTPNotFound) {
+			return err
+		}
+		if t == nil || !t.Confirmed {
+			return ErrWebAuthnLastFactor
+		}
+	}
+
+	err = h.credentials.DeleteWebAuthnCredential(ctx, userID, raw)
+	if errors.Is(err, user.ErrWebAuthnCredentialNotFound) {
+		return ErrWebAuthnNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	h.recorder.Record(ctx, &audit.Event{Type: audit.MFADisabled, UserID: userID, Detail: map[string]string{"method": "webauthn", "credential_id": id}})
+
+	// 没有其他验证方式时恢复码不再可用
+	ok, err := user.HasSecondFactor(ctx, h.totps, h.credentials, userID)
+	if err != nil || ok {
+		return err
+	}
+	return h.recoveries.DeleteRecoveryCodes(ctx, userID)
+}
+
+// user 获取用户与已注册的凭据
+func (h *WebAuthnHandler) user(ctx context.Context, userID string) (*webAuthnUser, error) {
+
+	u, err := h.repo.GetUserInfoByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := h.credentials.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wu := &webAuthnUser{u: u}
+	for _, c := range list {
+		cred := webauthn.Credential{
+			ID:              c.ID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationFormat,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+		for _, t := range c.Transports {
+			cred.Transport = append(cred.Transport, protocol.AuthenticatorTransport(t))
+		}
+		wu.credentials = append(wu.credentials, cred)
+	}
+
+	return wu, nil
+}
+
+// allowed 判断认证器型号是否允许注册
+func (h *WebAuthnHandler) allowed(aaguid []byte) bool {
+
+	if len(h.cfg.AllowedAAGUIDs) == 0 {
+		return true
+	}
+
+	id, err := uuid.FromBytes(aaguid)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(h.cfg.AllowedAAGUIDs, id.String())
+}
+
+// webAuthnUser 适配 webauthn.User
+type webAuthnUser struct {
+	u           *user.UserInfo
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID 用户句柄,使用用户ID,不含可识别个人的信息
+func (w *webAuthnUser) WebAuthnID() []byte {
+	return []byte(w.u.ID)
+}
+
+// WebAuthnName 认证器中显示的账号名称
+func (w *webAuthnUser) WebAuthnName() string {
+	return w.u.Loginname
+}
+
+// WebAuthnDisplayName 认证器中显示的用户名称,未设置昵称时使用用户名
+func (w *webAuthnUser) WebAuthnDisplayName() string {
+	if w.u.Nickname != "" {
+		return w.u.Nickname
+	}
+	return w.u.Loginname
+}
+
+// WebAuthnCredentials 用户已注册的凭据
+func (w *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return w.credentials
+}
+
+// parseWebAuthnState 解析保存在会话中的挑战状态
+func parseWebAuthnState(state string) (*webauthn.SessionData, error) {
+
+	if state == "" {
+		return nil, fmt.Errorf("%w: no pending challenge", ErrWebAuthnInvalid)
+	}
+
+	sd := &webauthn.SessionData{}
+	if err := json.Unmarshal([]byte(state), sd); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnInvalid, err)
+	}
+
+	return sd, nil
+}
+
+// webAuthnError 将校验错误包装为 ErrWebAuthnInvalid,保留协议错误的详细信息便于排查
+func webAuthnError(err error) error {
+
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		return fmt.Errorf("%w: %s: %s", ErrWebAuthnInvalid, perr.Details, perr.DevInfo)
+	}
+
+	return fmt.Errorf("%w: %v", ErrWebAuthnInvalid, err)
+}
+
+// toWebAuthnCredentialDTO 转换为凭据信息
+func toWebAuthnCredentialDTO(c *user.WebAuthnCredential) *WebAuthnCredentialDTO {
+
+	dto := &WebAuthnCredentialDTO{
+		ID:                base64.RawURLEncoding.EncodeToString(c.ID),
+		Name:              c.Name,
+		Passkey:           c.BackupEligible,
+		Transports:        c.Transports,
+		AttestationFormat: c.AttestationFormat,
+		CreatedAt:         c.CreatedAt.Format(time.RFC3339),
+	}
+	if id, err := uuid.FromBytes(c.AAGUID); err == nil {
+		dto.AAGUID = id.String()
+	}
+	if !c.LastUsedAt.IsZero() {
+		dto.LastUsedAt = c.LastUsedAt.Format(time.RFC3339)
+	}
+
+	return dto
+}
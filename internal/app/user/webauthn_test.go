@@ -0,0 +1,403 @@
+package user
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+)
+
+// 认证器数据的标志位
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// virtualAuthenticator 软件实现的认证器,使用 P-256 密钥与 none 证明格式
+type virtualAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	id         []byte
+	aaguid     []byte
+	userHandle []byte
+	signCount  uint32
+	origin     string
+}
+
+// newVirtualAuthenticator 创建认证器,origin 为发起认证的页面源
+func newVirtualAuthenticator(t *testing.T, origin string) *virtualAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &virtualAuthenticator{key: key, id: make([]byte, 16), aaguid: make([]byte, 16), origin: origin}
+	rand.Read(a.id)
+	rand.Read(a.aaguid)
+	return a
+}
+
+// clientData 生成客户端数据
+func (a *virtualAuthenticator) clientData(t *testing.T, typ string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{"type": typ, "challenge": challenge, "origin": a.origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// authData 生成认证器数据,attested 为 true 时附带凭据公钥
+func (a *virtualAuthenticator) authData(t *testing.T, rpID string, attested bool) []byte {
+	t.Helper()
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+
+	flags := byte(flagUserPresent | flagUserVerified)
+	if attested {
+		flags |= flagAttested
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		pub, err := webauthncbor.Marshal(&webauthncose.EC2PublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{
+				KeyType:   int64(webauthncose.EllipticKey),
+				Algorithm: int64(webauthncose.AlgES256),
+			},
+			Curve:  int64(webauthncose.P256),
+			XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+			YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, a.aaguid...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, pub...)
+	}
+
+	return data
+}
+
+// create 模拟 navigator.credentials.create(),返回注册凭据
+func (a *virtualAuthenticator) create(t *testing.T, creation *protocol.CredentialCreation) json.RawMessage {
+	t.Helper()
+
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(t, creation.Response.RelyingParty.ID, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    a.clientData(t, "webauthn.create", creation.Response.Challenge),
+		"attestationObject": attestation,
+		"transports":        []string{"usb"},
+	})
+}
+
+// get 模拟 navigator.credentials.get(),签名计数增加 step 后签名
+func (a *virtualAuthenticator) get(t *testing.T, assertion *protocol.CredentialAssertion, step uint32) json.RawMessage {
+	t.Helper()
+
+	a.signCount += step
+	authData := a.authData(t, assertion.Response.RelyingPartyID, false)
+	clientData := a.clientData(t, "webauthn.get", assertion.Response.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    clientData,
+		"authenticatorData": authData,
+		"signature":         sig,
+		"userHandle":        a.userHandle,
+	})
+}
+
+// credential 编码 PublicKeyCredential,字节字段使用 base64url
+func (a *virtualAuthenticator) credential(t *testing.T, response map[string]any) json.RawMessage {
+	t.Helper()
+
+	encoded := map[string]any{}
+	for k, v := range response {
+		if b, ok := v.([]byte); ok {
+			v = base64.RawURLEncoding.EncodeToString(b)
+		}
+		encoded[k] = v
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(a.id)
+	data, err := json.Marshal(map[string]any{"id": id, "rawId": id, "type": "public-key", "response": encoded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// webAuthnFixture WebAuthn 测试使用的处理者与依赖
+type webAuthnFixture struct {
+	*testDeps
+	handler *WebAuthnHandler
+	origin  string
+}
+
+// newWebAuthnFixture 创建 WebAuthn 处理者,setup 修改 WebAuthn 配置,可以为 nil
+func newWebAuthnFixture(t *testing.T, setup func(*configs.WebAuthn)) *webAuthnFixture {
+	t.Helper()
+
+	d := newTestDeps(t, func(c *configs.User) {
+		if setup != nil {
+			setup(c.WebAuthn)
+		}
+	})
+
+	issuer, err := url.Parse(d.oauth2.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &webAuthnFixture{testDeps: d, handler: d.webAuthnHandler(t), origin: issuer.Scheme + "://" + issuer.Host}
+}
+
+// register 为用户注册认证器
+func (f *webAuthnFixture) register(t *testing.T, userID string) *virtualAuthenticator {
+	t.Helper()
+
+	a := newVirtualAuthenticator(t, f.origin)
+	if _, err := f.registerWith(t, userID, a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// registerWith 使用指定认证器完成注册
+func (f *webAuthnFixture) registerWith(t *testing.T, userID string, a *virtualAuthenticator) (*WebAuthnCredentialDTO, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	creation, state, err := f.handler.BeginRegistration(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.handler.FinishRegistration(ctx, userID, state, &WebAuthnRegistration{Credential: a.create(t, creation)})
+}
+
+// login 使用认证器登录,userID 为空时为免密码登录
+func (f *webAuthnFixture) login(t *testing.T, userID string, a *virtualAuthenticator, step uint32) (*WebAuthnLoginResult, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	assertion, state, err := f.handler.BeginLogin(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.handler.FinishLogin(ctx, userID, state, &WebAuthnAssertion{Credential: a.get(t, assertion, step)})
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+
+	f := newWebAuthnFixture(t, nil)
+	ctx := context.Background()
+	a := newVirtualAuthenticator(t, f.origin)
+
+	dto, err := f.registerWith(t, testUserID, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dto.ID != base64.RawURLEncoding.EncodeToString(a.id) || dto.AttestationFormat != "none" || dto.Name == "" {
+		t.Fatalf("registered credential = %+v", dto)
+	}
+	if !f.recorder.has(audit.MFAEnrolled) {
+		t.Fatal("enrollment not recorded")
+	}
+
+	list, err := f.handler.Credentials(ctx, testUserID)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("credentials: %d, %v", len(list), err)
+	}
+
+	// 同一认证器不能重复注册
+	if _, err := f.registerWith(t, testUserID, a); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("register twice: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+
+	// 挑战只能用于发起注册的用户
+	creation, state, err := f.handler.BeginRegistration(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newVirtualAuthenticator(t, f.origin)
+	if _, err := f.handler.FinishRegistration(ctx, otherUserID, state, &WebAuthnRegistration{Credential: other.create(t, creation)}); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("finish with another user: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+
+	// 页面源不在 rp_origins 中时拒绝
+	phishing := newVirtualAuthenticator(t, "https://evil.example.com")
+	if _, err := f.registerWith(t, testUserID, phishing); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("register from another origin: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+}
+
+func TestWebAuthnRegistrationNotAllowed(t *testing.T) {
+
+	f := newWebAuthnFixture(t, func(w *configs.WebAuthn) {
+		w.AllowedAAGUIDs = []string{"00000000-0000-0000-0000-000000000001"}
+	})
+
+	if _, err := f.registerWith(t, testUserID, newVirtualAuthenticator(t, f.origin)); !errors.Is(err, ErrWebAuthnNotAllowed) {
+		t.Fatalf("register unlisted model: %v, want %v", err, ErrWebAuthnNotAllowed)
+	}
+}
+
+func TestWebAuthnRegistrationLimit(t *testing.T) {
+
+	f := newWebAuthnFixture(t, func(w *configs.WebAuthn) {
+		w.MaxCredentials = 1
+	})
+
+	f.register(t, testUserID)
+	if _, _, err := f.handler.BeginRegistration(context.Background(), testUserID); !errors.Is(err, ErrWebAuthnLimit) {
+		t.Fatalf("register over limit: %v, want %v", err, ErrWebAuthnLimit)
+	}
+}
+
+func TestWebAuthnPasswordlessLogin(t *testing.T) {
+
+	f := newWebAuthnFixture(t, nil)
+	a := f.register(t, testUserID)
+
+	result, err := f.login(t, "", a, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UserID != testUserID || !result.UserVerified {
+		t.Fatalf("passwordless login = %+v", result)
+	}
+
+	// 用户句柄与凭据所属用户不一致时拒绝
+	a.userHandle = []byte(otherUserID)
+	if _, err := f.login(t, "", a, 1); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("login with another user handle: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+
+	// 未注册的认证器不能登录
+	unknown := newVirtualAuthenticator(t, f.origin)
+	unknown.userHandle = []byte(testUserID)
+	if _, err := f.login(t, "", unknown, 1); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("login with unknown credential: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+}
+
+func TestWebAuthnCloneDetection(t *testing.T) {
+
+	f := newWebAuthnFixture(t, nil)
+	ctx := context.Background()
+	a := f.register(t, testUserID)
+
+	if _, err := f.login(t, testUserID, a, 5); err != nil {
+		t.Fatal(err)
+	}
+	c, err := f.credentials.GetWebAuthnCredential(ctx, a.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SignCount != 5 || c.LastUsedAt.IsZero() {
+		t.Fatalf("sign count %d, last used %v", c.SignCount, c.LastUsedAt)
+	}
+
+	// 复制的认证器使用相同或更小的签名计数
+	clone := *a
+	clone.signCount = 3
+	if _, err := f.login(t, testUserID, &clone, 0); !errors.Is(err, ErrWebAuthnCloned) {
+		t.Fatalf("login with cloned authenticator: %v, want %v", err, ErrWebAuthnCloned)
+	}
+	if !f.recorder.has(audit.WebAuthnCloned) {
+		t.Fatal("clone warning not recorded")
+	}
+	if c, _ := f.credentials.GetWebAuthnCredential(ctx, a.id); c.SignCount != 5 {
+		t.Fatalf("sign count updated to %d by cloned authenticator", c.SignCount)
+	}
+
+	// 原认证器计数继续增加,仍可登录
+	if _, err := f.login(t, testUserID, a, 1); err != nil {
+		t.Fatalf("login after clone warning: %v", err)
+	}
+}
+
+func TestWebAuthnStepUp(t *testing.T) {
+
+	f := newWebAuthnFixture(t, nil)
+	ctx := context.Background()
+	alice := f.register(t, testUserID)
+	bob := f.register(t, otherUserID)
+
+	result, err := f.login(t, testUserID, alice, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UserID != testUserID {
+		t.Fatalf("step up user %q, want %q", result.UserID, testUserID)
+	}
+
+	// 只允许当前用户的凭据
+	if _, err := f.login(t, testUserID, bob, 1); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("step up with another user's credential: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+
+	// 补充验证与免密码登录的挑战不能混用
+	assertion, state, err := f.handler.BeginLogin(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.handler.FinishLogin(ctx, "", state, &WebAuthnAssertion{Credential: alice.get(t, assertion, 1)}); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("passwordless with step up challenge: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+	assertion, state, err = f.handler.BeginLogin(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.handler.FinishLogin(ctx, testUserID, state, &WebAuthnAssertion{Credential: alice.get(t, assertion, 1)}); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("step up with passwordless challenge: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+
+	// 没有挑战状态时拒绝
+	if _, err := f.handler.FinishLogin(ctx, testUserID, "", &WebAuthnAssertion{Credential: alice.get(t, assertion, 1)}); !errors.Is(err, ErrWebAuthnInvalid) {
+		t.Fatalf("step up without challenge: %v, want %v", err, ErrWebAuthnInvalid)
+	}
+
+	// 未注册凭据的用户不能开始补充验证
+	f = newWebAuthnFixture(t, nil)
+	if _, _, err := f.handler.BeginLogin(ctx, testUserID); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Fatalf("step up without credentials: %v, want %v", err, ErrMFANotEnrolled)
+	}
+}
@@ -1,14 +1,31 @@
 package user
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrInvalidPassword       = errors.New("invalid password")             // 密码错误
-	ErrUserNotFound          = errors.New("user not found")               // 用户不存在
-	ErrUserExist             = errors.New("user already exists")          // 用户已存在
-	ErrInvalidUserOrPassword = errors.New("invalid username or password") // 用户名或密码错误
-	ErrSessionlogIdIsnil     = errors.New("session log id is nil")        // session log id 为空
-	ErrSessionlogUserIdIsnil = errors.New("session log user id is nil")   // session log user id 为空
-	ErrAuthGrantTypeIsnil    = errors.New("auth grant type is nil")       // auth grant type is nil
+	ErrInvalidPassword            = errors.New("invalid password")                    // 密码错误
+	ErrUserNotFound               = errors.New("user not found")                      // 用户不存在
+	ErrUserExist                  = errors.New("user already exists")                 // 用户已存在
+	ErrInvalidUserOrPassword      = errors.New("invalid username or password")        // 用户名或密码错误
+	ErrUserDisabled               = errors.New("user is disabled")                    // 用户已禁用
+	ErrUsernameExist              = fmt.Errorf("%w: username is taken", ErrUserExist) // 用户名已被使用
+	ErrEmailExist                 = fmt.Errorf("%w: email is taken", ErrUserExist)    // 邮箱已被使用
+	ErrPhoneExist                 = fmt.Errorf("%w: phone is taken", ErrUserExist)    // 手机号已被使用
+	ErrInvalidUsername            = errors.New("invalid username")                    // 用户名格式错误
+	ErrInvalidEmail               = errors.New("invalid email")                       // 邮箱格式错误
+	ErrResetTokenInvalid          = errors.New("invalid or expired reset token")      // 找回密码令牌无效或已过期
+	ErrInvalidPhone               = errors.New("invalid phone")                       // 手机号格式错误
+	ErrVerificationInvalid        = errors.New("invalid or expired verification")     // 验证链接或验证码无效、已过期
+	ErrTOTPNotFound               = errors.New("totp is not enrolled")                // 未绑定一次性密码
+	ErrTOTPCodeUsed               = errors.New("totp code is already used")           // 一次性密码已使用
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")       // WebAuthn 凭据不存在
+	ErrWebAuthnCredentialExist    = errors.New("webauthn credential already exists")  // WebAuthn 凭据已注册
+	ErrRecoveryCodeInvalid        = errors.New("invalid or used recovery code")       // 恢复码错误或已使用
+	ErrSessionlogIdIsnil          = errors.New("session log id is nil")               // session log id 为空
+	ErrSessionlogUserIdIsnil      = errors.New("session log user id is nil")          // session log user id 为空
+	ErrAuthGrantTypeIsnil         = errors.New("auth grant type is nil")              // auth grant type is nil
 
 )
@@ -0,0 +1,105 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TOTP 用户绑定的基于时间的一次性密码(RFC 6238)
+// 密钥须可还原才能校验验证码,因此以原文保存,存储须与密码哈希同等保护
+type TOTP struct {
+	UserID    string    // 用户ID
+	Secret    string    // base32 编码的密钥
+	Name      string    // 用户为认证器应用起的名称,便于管理
+	Confirmed bool      // 是否已用验证码确认绑定,未确认的不要求两步验证
+	LastStep  int64     // 最近一次通过校验的时间步,不大于该值的验证码视为已使用
+	CreatedAt time.Time // 绑定时间
+}
+
+// TOTPRepository 一次性密码仓储
+type TOTPRepository interface {
+
+	// SaveTOTP 保存一次性密码,替换该用户之前的记录
+	SaveTOTP(ctx context.Context, t *TOTP) error
+
+	// GetTOTP 获取用户的一次性密码
+	//
+	// 错误信息:
+	//
+	//	ErrTOTPNotFound: 用户未绑定
+	GetTOTP(ctx context.Context, userID string) (*TOTP, error)
+
+	// UseTOTPStep 记录已使用的时间步,confirm 为 true 时同时确认绑定
+	// 仅当 step 大于已记录的时间步时生效,并发调用时只有一个调用方成功
+	//
+	// 错误信息:
+	//
+	//	ErrTOTPNotFound: 用户未绑定
+	//	ErrTOTPCodeUsed: 该时间步或更晚的验证码已使用
+	UseTOTPStep(ctx context.Context, userID string, step int64, confirm bool) error
+
+	// RenameTOTP 修改一次性密码的名称
+	//
+	// 错误信息:
+	//
+	//	ErrTOTPNotFound: 用户未绑定
+	RenameTOTP(ctx context.Context, userID, name string) error
+
+	// DeleteTOTP 删除用户的一次性密码,未绑定时不报错
+	DeleteTOTP(ctx context.Context, userID string) error
+}
+
+// RequiresMFA 判断用户登录是否须两步验证:用户被要求两步验证,或已确认绑定一次性密码,或已注册 WebAuthn 凭据
+//
+// 参数:
+//
+//	ctx: 上下文
+//	totps: 一次性密码仓储
+//	credentials: WebAuthn 凭据仓储
+//	u: 用户信息
+//
+// 返回值:
+//
+//	bool: 须两步验证返回true
+//	error: 错误信息
+func RequiresMFA(ctx context.Context, totps TOTPRepository, credentials WebAuthnCredentialRepository, u *UserInfo) (bool, error) {
+
+	if u.MFARequired {
+		return true, nil
+	}
+
+	return HasSecondFactor(ctx, totps, credentials, u.ID)
+}
+
+// HasSecondFactor 判断用户是否已确认绑定一次性密码或已注册 WebAuthn 凭据
+// 恢复码只能代替已有的验证方式,不单独计算
+//
+// 参数:
+//
+//	ctx: 上下文
+//	totps: 一次性密码仓储
+//	credentials: WebAuthn 凭据仓储
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	bool: 有任一验证方式返回true
+//	error: 错误信息
+func HasSecondFactor(ctx context.Context, totps TOTPRepository, credentials WebAuthnCredentialRepository, userID string) (bool, error) {
+
+	t, err := totps.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, ErrTOTPNotFound) {
+		return false, err
+	}
+	if err == nil && t.Confirmed {
+		return true, nil
+	}
+
+	list, err := credentials.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return len(list) > 0, nil
+}
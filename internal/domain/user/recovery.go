@@ -0,0 +1,24 @@
+package user
+
+import "context"
+
+// RecoveryCodeRepository 恢复码仓储
+// 恢复码在用户丢失认证器应用或安全密钥时代替第二步验证,每个只能使用一次;只保存哈希,原文仅在生成时展示一次
+type RecoveryCodeRepository interface {
+
+	// ReplaceRecoveryCodes 保存新生成的一批恢复码,同时删除该用户之前的恢复码
+	ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error
+
+	// UseRecoveryCode 使用并删除恢复码,并发调用时只有一个调用方成功
+	//
+	// 错误信息:
+	//
+	//	ErrRecoveryCodeInvalid: 恢复码不存在或已使用
+	UseRecoveryCode(ctx context.Context, userID, hash string) error
+
+	// CountRecoveryCodes 获取用户剩余可用的恢复码数量
+	CountRecoveryCodes(ctx context.Context, userID string) (int, error)
+
+	// DeleteRecoveryCodes 删除用户的全部恢复码,没有时不报错
+	DeleteRecoveryCodes(ctx context.Context, userID string) error
+}
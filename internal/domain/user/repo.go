@@ -7,7 +7,53 @@ import (
 type (
 	UserRepository interface {
 
-		// GetUserInfoByPassword 根据用户名和密码获取用户信息
+		// GetUserInfoByPassword 根据账号和密码获取用户信息,账号可以是用户名、邮箱或手机号
+		// 密码哈希使用的参数低于当前配置时在验证成功后重新计算
+		//
+		// 错误信息:
+		//
+		//	ErrInvalidUserOrPassword: 用户不存在或密码错误
+		//	ErrUserDisabled: 用户已禁用
 		GetUserInfoByPassword(ctx context.Context, username, password string) (*UserInfo, error)
+
+		// GetUserInfoByAccount 根据账号获取用户信息,账号可以是用户名、邮箱或手机号
+		GetUserInfoByAccount(ctx context.Context, account string) (*UserInfo, error)
+
+		// GetUserInfoByID 根据用户ID获取用户信息
+		GetUserInfoByID(ctx context.Context, id string) (*UserInfo, error)
+
+		// GetUserInfoByUsername 根据用户名获取用户信息
+		GetUserInfoByUsername(ctx context.Context, username string) (*UserInfo, error)
+
+		// GetUserInfoByEmail 根据邮箱获取用户信息,不区分大小写
+		GetUserInfoByEmail(ctx context.Context, email string) (*UserInfo, error)
+
+		// GetUserInfoByPhone 根据手机号获取用户信息
+		GetUserInfoByPhone(ctx context.Context, phone string) (*UserInfo, error)
+
+		// CreateUser 创建用户,ID 为空时自动生成,创建成功后回填 ID 与注册时间
+		//
+		// 错误信息:
+		//
+		//	ErrUsernameExist: 用户名已被使用
+		//	ErrEmailExist: 邮箱已被使用
+		//	ErrPhoneExist: 手机号已被使用
+		CreateUser(ctx context.Context, info *UserInfo, passwordHash string) error
+
+		// UpdatePassword 更新用户的密码哈希
+		//
+		// 错误信息:
+		//
+		//	ErrUserNotFound: 用户不存在
+		UpdatePassword(ctx context.Context, id, passwordHash string) error
+
+		// MarkVerified 将用户的邮箱或手机号标记为已验证
+		// 仅当用户当前的邮箱或手机号仍为 value 时生效,验证期间已修改的不标记
+		//
+		// 错误信息:
+		//
+		//	ErrUserNotFound: 用户不存在
+		//	ErrVerificationInvalid: 邮箱或手机号已修改
+		MarkVerified(ctx context.Context, id, channel, value string) error
 	}
 )
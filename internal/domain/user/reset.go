@@ -0,0 +1,34 @@
+package user
+
+import (
+	"context"
+	"time"
+)
+
+// ResetToken 找回密码令牌,只保存令牌的哈希
+type ResetToken struct {
+	Hash      string    // 令牌的 SHA-256 哈希(十六进制)
+	UserID    string    // 用户ID
+	ExpiresAt time.Time // 过期时间
+}
+
+// ResetTokenRepository 找回密码令牌仓储
+type ResetTokenRepository interface {
+
+	// SaveResetToken 保存令牌,同时删除该用户之前的令牌
+	SaveResetToken(ctx context.Context, t *ResetToken) error
+
+	// GetResetToken 获取令牌,不删除
+	//
+	// 错误信息:
+	//
+	//	ErrResetTokenInvalid: 令牌不存在或已过期
+	GetResetToken(ctx context.Context, hash string) (*ResetToken, error)
+
+	// TakeResetToken 取出并删除令牌,并发调用时只有一个调用方成功
+	//
+	// 错误信息:
+	//
+	//	ErrResetTokenInvalid: 令牌不存在、已过期或已被使用
+	TakeResetToken(ctx context.Context, hash string) (*ResetToken, error)
+}
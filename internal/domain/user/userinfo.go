@@ -1,5 +1,7 @@
 package user
 
+import "time"
+
 type Status int
 
 const (
@@ -8,9 +10,38 @@ const (
 )
 
 type UserInfo struct {
-	ID        string // 用户ID
-	Loginname string // 用户名
-	Nickname  string // 昵称
-	Avatar    string // 头像地址
-	Status    Status // 是否启用
+	ID            string    // 用户ID
+	Loginname     string    // 用户名
+	Nickname      string    // 昵称
+	Avatar        string    // 头像地址
+	Email         string    // 邮箱,未绑定时为空
+	EmailVerified bool      // 邮箱是否已验证
+	Phone         string    // 手机号,未绑定时为空
+	PhoneVerified bool      // 手机号是否已验证
+	MFARequired   bool      // 是否须两步验证,未绑定时登录后先引导绑定
+	Status        Status    // 是否启用
+	CreatedAt     time.Time // 注册时间
+}
+
+// Unverified 返回 channels 中用户尚未验证的联系方式,未绑定的视为未验证
+//
+// 参数:
+//
+//	channels: 要求验证的联系方式: ChannelEmail, ChannelPhone
+//
+// 返回值:
+//
+//	[]string: 未验证的联系方式,全部已验证时为空
+func (u *UserInfo) Unverified(channels []string) []string {
+
+	var missing []string
+	for _, v := range channels {
+		switch {
+		case v == ChannelEmail && !u.EmailVerified,
+			v == ChannelPhone && !u.PhoneVerified:
+			missing = append(missing, v)
+		}
+	}
+
+	return missing
 }
@@ -0,0 +1,55 @@
+package user
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{2,31}$`) // 字母开头,3-32 位,不含 @ 与 +,避免与邮箱、手机号混淆
+	phonePattern    = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)           // E.164 格式
+)
+
+// ValidateUsername 校验用户名格式
+//
+// 错误信息:
+//
+//	ErrInvalidUsername: 须以字母开头,由 3-32 位字母、数字、_ . - 组成
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return ErrInvalidUsername
+	}
+	return nil
+}
+
+// ValidateEmail 校验邮箱格式,只接受不带显示名称的地址
+//
+// 错误信息:
+//
+//	ErrInvalidEmail: 邮箱格式错误
+func ValidateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// ValidatePhone 校验手机号格式,须为带国家码的 E.164 格式,如 +8613800000000
+//
+// 错误信息:
+//
+//	ErrInvalidPhone: 手机号格式错误
+func ValidatePhone(phone string) error {
+	if !phonePattern.MatchString(phone) {
+		return ErrInvalidPhone
+	}
+	return nil
+}
+
+// EmailDomain 邮箱的域名部分,统一转为小写
+func EmailDomain(email string) string {
+	_, domain, _ := strings.Cut(email, "@")
+	return strings.ToLower(domain)
+}
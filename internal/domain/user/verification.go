@@ -0,0 +1,62 @@
+package user
+
+import (
+	"context"
+	"time"
+)
+
+// 联系方式验证渠道
+const (
+	ChannelEmail = "email" // 邮件链接
+	ChannelPhone = "phone" // 短信验证码
+
+	// ChannelSMSLogin 短信验证码登录,手机号可能尚未注册,验证记录的 UserID 为手机号
+	ChannelSMSLogin = "sms_login"
+)
+
+// Verification 联系方式验证记录,每个用户每个渠道只保留最近一次
+// 邮件链接令牌只保存哈希,短信验证码只保存以服务端密钥计算的 HMAC
+type Verification struct {
+	UserID    string    // 用户ID,ChannelSMSLogin 为手机号
+	Channel   string    // 验证渠道: ChannelEmail, ChannelPhone, ChannelSMSLogin
+	Target    string    // 待验证的邮箱或手机号
+	Hash      string    // 令牌的 SHA-256 哈希或验证码的 HMAC-SHA256(十六进制)
+	Attempts  int       // 验证码已输错的次数
+	ExpiresAt time.Time // 过期时间
+}
+
+// VerificationRepository 联系方式验证仓储
+type VerificationRepository interface {
+
+	// SaveVerification 保存验证记录,替换该用户同一渠道之前的记录
+	SaveVerification(ctx context.Context, v *Verification) error
+
+	// GetVerification 获取用户在指定渠道的验证记录,不删除
+	//
+	// 错误信息:
+	//
+	//	ErrVerificationInvalid: 记录不存在或已过期
+	GetVerification(ctx context.Context, userID, channel string) (*Verification, error)
+
+	// GetVerificationByHash 按令牌哈希获取验证记录,用于邮件链接
+	//
+	// 错误信息:
+	//
+	//	ErrVerificationInvalid: 记录不存在或已过期
+	GetVerificationByHash(ctx context.Context, channel, hash string) (*Verification, error)
+
+	// AddVerificationAttempt 在比对验证码之前占用一次尝试次数,计数与检查是原子的,
+	// 并发提交的验证码合计不会超过 limit 次
+	//
+	// 错误信息:
+	//
+	//	ErrVerificationInvalid: 记录不存在、已过期或尝试次数已达到 limit
+	AddVerificationAttempt(ctx context.Context, userID, channel string, limit int) error
+
+	// TakeVerification 取出并删除哈希匹配的验证记录,并发调用时只有一个调用方成功
+	//
+	// 错误信息:
+	//
+	//	ErrVerificationInvalid: 记录不存在、已过期、已被使用或已被新的记录替换
+	TakeVerification(ctx context.Context, userID, channel, hash string) (*Verification, error)
+}
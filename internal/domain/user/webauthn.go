@@ -0,0 +1,65 @@
+package user
+
+import (
+	"context"
+	"time"
+)
+
+// WebAuthnCredential 用户注册的 FIDO2 安全密钥或通行密钥(WebAuthn 凭据)
+// 只保存公钥,可用于免密码登录,也可作为密码登录的第二步
+type WebAuthnCredential struct {
+	ID                []byte    // 凭据ID,由认证器生成,全局唯一
+	UserID            string    // 用户ID
+	Name              string    // 用户为凭据起的名称,便于管理
+	PublicKey         []byte    // COSE 编码的公钥
+	AttestationFormat string    // 注册时的证明格式,如 none、packed、fido-u2f、tpm
+	AAGUID            []byte    // 认证器型号标识
+	Transports        []string  // 认证器支持的传输方式,如 usb、nfc、ble、internal、hybrid
+	SignCount         uint32    // 签名计数,登录时须大于该值,否则可能是被复制的认证器
+	BackupEligible    bool      // 是否可同步备份(通行密钥)
+	BackupState       bool      // 是否已同步备份
+	CreatedAt         time.Time // 注册时间
+	LastUsedAt        time.Time // 最近一次登录时间,未使用时为零值
+}
+
+// WebAuthnCredentialRepository WebAuthn 凭据仓储
+type WebAuthnCredentialRepository interface {
+
+	// SaveWebAuthnCredential 保存新注册的凭据
+	//
+	// 错误信息:
+	//
+	//	ErrWebAuthnCredentialExist: 凭据ID已存在
+	SaveWebAuthnCredential(ctx context.Context, c *WebAuthnCredential) error
+
+	// GetWebAuthnCredential 按凭据ID获取凭据,用于免密码登录时确定用户
+	//
+	// 错误信息:
+	//
+	//	ErrWebAuthnCredentialNotFound: 凭据不存在
+	GetWebAuthnCredential(ctx context.Context, id []byte) (*WebAuthnCredential, error)
+
+	// ListWebAuthnCredentials 获取用户的全部凭据,按注册时间排序
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]*WebAuthnCredential, error)
+
+	// UseWebAuthnCredential 登录成功后更新签名计数、备份状态与最近使用时间
+	//
+	// 错误信息:
+	//
+	//	ErrWebAuthnCredentialNotFound: 凭据不存在
+	UseWebAuthnCredential(ctx context.Context, id []byte, signCount uint32, backupState bool, usedAt time.Time) error
+
+	// RenameWebAuthnCredential 修改用户凭据的名称
+	//
+	// 错误信息:
+	//
+	//	ErrWebAuthnCredentialNotFound: 凭据不存在或不属于该用户
+	RenameWebAuthnCredential(ctx context.Context, userID string, id []byte, name string) error
+
+	// DeleteWebAuthnCredential 删除用户的凭据
+	//
+	// 错误信息:
+	//
+	//	ErrWebAuthnCredentialNotFound: 凭据不存在或不属于该用户
+	DeleteWebAuthnCredential(ctx context.Context, userID string, id []byte) error
+}
@@ -0,0 +1,27 @@
+package infra
+
+import (
+	"github.com/spf13/viper"
+	r "github.com/xiaohangshuhub/go-workit/pkg/cache/redis"
+	"github.com/xiaohangshuhub/go-workit/pkg/webapp/cachectx"
+)
+
+// CacheContext 按配置文件中的 redis 配置注册 Redis 连接
+//
+// 参数:
+//
+//	cfg: 配置
+//
+// 返回值:
+//
+//	func(*cachectx.Options): 传给 AddCacheContext 的配置函数
+func CacheContext(cfg *viper.Viper) func(*cachectx.Options) {
+	return func(opts *cachectx.Options) {
+		opts.UseRedis("", func(o *r.Options) {
+			o.Addr = cfg.GetString("redis.addr")
+			o.Password = cfg.GetString("redis.password")
+			o.DB = cfg.GetInt("redis.db")
+			o.PoolSize = cfg.GetInt("redis.pool_size")
+		})
+	}
+}
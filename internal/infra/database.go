@@ -0,0 +1,69 @@
+package infra
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"github.com/xiaohangshuhub/go-workit/pkg/db"
+	"github.com/xiaohangshuhub/go-workit/pkg/webapp/dbctx"
+)
+
+// 数据库驱动
+const (
+	DriverPostgres  = "postgres"
+	DriverMySQL     = "mysql"
+	DriverSQLServer = "sqlserver"
+	DriverSQLite    = "sqlite"
+)
+
+// DbContext 按配置文件中的 database 配置注册数据库连接
+//
+// database.driver 指定驱动: postgres, mysql, sqlserver, sqlite;
+// database.dsn 为连接字符串,其余连接池与日志配置同 go-workit 的 db.DatabaseConfig
+//
+// 参数:
+//
+//	cfg: 配置
+//
+// 返回值:
+//
+//	func(*dbctx.Options): 传给 AddDbContext 的配置函数,驱动不支持时 panic
+func DbContext(cfg *viper.Viper) func(*dbctx.Options) {
+
+	driver := cfg.GetString("database.driver")
+	dsn := cfg.GetString("database.dsn")
+
+	// 连接池与日志配置
+	apply := func(c *db.DatabaseConfig) {
+		if err := cfg.UnmarshalKey("database", c); err != nil {
+			panic(fmt.Sprintf("invalid database configuration: %v", err))
+		}
+	}
+
+	return func(opts *dbctx.Options) {
+		switch driver {
+		case DriverPostgres:
+			opts.UsePostgresSQL("", func(c *db.PostgresConfigOptions) {
+				apply(&c.DatabaseConfig)
+				c.PgSQLCfg.DSN = dsn
+			})
+		case DriverMySQL:
+			opts.UseMySQL("", func(c *db.MySQLConfigOptions) {
+				apply(&c.DatabaseConfig)
+				c.MySQLCfg.DSN = dsn
+			})
+		case DriverSQLServer:
+			opts.UseSQLServer("", func(c *db.SQLServerConfigOptions) {
+				apply(&c.DatabaseConfig)
+				c.SQLServerCfg.DSN = dsn
+			})
+		case DriverSQLite:
+			opts.UseSQLite("", func(c *db.SQLiteConfigOptions) {
+				apply(&c.DatabaseConfig)
+				c.SQLiteCfg.DSN = dsn
+			})
+		default:
+			panic(fmt.Sprintf("unsupported database driver %q", driver))
+		}
+	}
+}
@@ -9,6 +9,15 @@ func DependencyInjection() []fx.Option {
 
 	return []fx.Option{
 		fx.Provide(repoimpl.NewUserRepository),
+		fx.Provide(repoimpl.NewResetTokenRepository),
+		fx.Provide(repoimpl.NewVerificationRepository),
+		fx.Provide(repoimpl.NewTOTPRepository),
+		fx.Provide(repoimpl.NewWebAuthnCredentialRepository),
+		fx.Provide(repoimpl.NewRecoveryCodeRepository),
+		fx.Provide(NewSession),
+		fx.Provide(NewMailSender),
+		fx.Provide(NewSMSSender),
+		fx.Provide(NewRateLimiter),
 	}
 
 }
@@ -0,0 +1,40 @@
+package infra
+
+import (
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/mail"
+	"go.uber.org/zap"
+)
+
+// NewMailSender 按 mail.driver 创建邮件发送者
+//
+// 参数:
+//
+//	cfg: 邮件配置
+//	logger: 日志对象
+//
+// 返回值:
+//
+//	mail.Sender: 邮件发送者
+//	error: 错误信息,file 方式创建目录失败时返回
+func NewMailSender(cfg *configs.Mail, logger *zap.Logger) (mail.Sender, error) {
+
+	switch cfg.Driver {
+	case configs.MailDriverSMTP:
+		return mail.NewSMTPSender(mail.SMTPOptions{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.From,
+			TLS:      cfg.SMTP.TLS,
+			Timeout:  cfg.SMTP.Timeout,
+		}), nil
+	case configs.MailDriverFile:
+		logger.Warn("mail is written to files instead of being delivered", zap.String("dir", cfg.Dir))
+		return mail.NewFileSender(cfg.Dir, cfg.From)
+	default:
+		logger.Warn("mail is written to the log instead of being delivered, do not use in production")
+		return mail.NewMemorySender(logger), nil
+	}
+}
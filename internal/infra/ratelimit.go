@@ -0,0 +1,31 @@
+package infra
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/ratelimit"
+	"go.uber.org/fx"
+)
+
+// RateLimiterParams 创建限流器的依赖
+// 未配置 redis.addr 时不提供 Redis 连接
+type RateLimiterParams struct {
+	fx.In
+
+	Redis *redis.Client `optional:"true"`
+}
+
+// NewRateLimiter 创建限流器,配置了 Redis 时多实例共享计数,否则仅对单实例有效
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	ratelimit.Limiter: 限流器
+func NewRateLimiter(p RateLimiterParams) ratelimit.Limiter {
+	if p.Redis != nil {
+		return ratelimit.NewRedisLimiter(p.Redis, "ratelimit:")
+	}
+	return ratelimit.NewMemoryLimiter()
+}
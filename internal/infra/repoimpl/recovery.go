@@ -0,0 +1,164 @@
+package repoimpl
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeRepositoryParams 创建恢复码仓储的依赖
+// 未配置 database.driver 时不提供数据库连接
+type RecoveryCodeRepositoryParams struct {
+	fx.In
+
+	Config *configs.User
+	DB     *gorm.DB `optional:"true"`
+}
+
+// NewRecoveryCodeRepository 按 user.store 创建恢复码仓储,与用户使用同一存储
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	user.RecoveryCodeRepository: 恢复码仓储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+func NewRecoveryCodeRepository(p RecoveryCodeRepositoryParams) (user.RecoveryCodeRepository, error) {
+
+	if p.Config.Store == configs.UserStoreDatabase {
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		if err := p.DB.AutoMigrate(&recoveryCodeModel{}); err != nil {
+			return nil, err
+		}
+		return &gormRecoveryCodeRepository{db: p.DB}, nil
+	}
+
+	return &memoryRecoveryCodeRepository{codes: make(map[string][]string)}, nil
+}
+
+// memoryRecoveryCodeRepository 内存恢复码仓储
+type memoryRecoveryCodeRepository struct {
+	sync.Mutex
+	codes map[string][]string // 键为用户ID,值为恢复码哈希
+}
+
+// ReplaceRecoveryCodes 保存新生成的恢复码,替换之前的恢复码
+func (r *memoryRecoveryCodeRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.codes[userID] = slices.Clone(hashes)
+	return nil
+}
+
+// UseRecoveryCode 使用并删除恢复码
+func (r *memoryRecoveryCodeRepository) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	i := slices.Index(r.codes[userID], hash)
+	if i < 0 {
+		return user.ErrRecoveryCodeInvalid
+	}
+
+	r.codes[userID] = slices.Delete(r.codes[userID], i, i+1)
+	return nil
+}
+
+// CountRecoveryCodes 获取剩余的恢复码数量
+func (r *memoryRecoveryCodeRepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.codes[userID]), nil
+}
+
+// DeleteRecoveryCodes 删除用户的全部恢复码
+func (r *memoryRecoveryCodeRepository) DeleteRecoveryCodes(ctx context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.codes, userID)
+	return nil
+}
+
+// recoveryCodeModel 恢复码表
+type recoveryCodeModel struct {
+	UserID    string `gorm:"primaryKey;size:64"`
+	Hash      string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+}
+
+// TableName 恢复码表名
+func (recoveryCodeModel) TableName() string {
+	return "user_recovery_codes"
+}
+
+// gormRecoveryCodeRepository 数据库恢复码仓储
+type gormRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+// ReplaceRecoveryCodes 保存新生成的恢复码,替换之前的恢复码
+func (r *gormRecoveryCodeRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Where("user_id = ?", userID).Delete(&recoveryCodeModel{}).Error; err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		models := make([]recoveryCodeModel, 0, len(hashes))
+		for _, h := range hashes {
+			models = append(models, recoveryCodeModel{UserID: userID, Hash: h, CreatedAt: now})
+		}
+
+		return tx.Create(&models).Error
+	})
+}
+
+// UseRecoveryCode 使用并删除恢复码,以删除的行数判断是否由本次调用取得
+func (r *gormRecoveryCodeRepository) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+
+	res := r.db.WithContext(ctx).Where("user_id = ? AND hash = ?", userID, hash).Delete(&recoveryCodeModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return user.ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+// CountRecoveryCodes 获取剩余的恢复码数量
+func (r *gormRecoveryCodeRepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&recoveryCodeModel{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+// DeleteRecoveryCodes 删除用户的全部恢复码
+func (r *gormRecoveryCodeRepository) DeleteRecoveryCodes(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&recoveryCodeModel{}).Error
+}
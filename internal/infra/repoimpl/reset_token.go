@@ -0,0 +1,170 @@
+package repoimpl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// ResetTokenRepositoryParams 创建找回密码令牌仓储的依赖
+// 未配置 database.driver 时不提供数据库连接
+type ResetTokenRepositoryParams struct {
+	fx.In
+
+	Config *configs.User
+	DB     *gorm.DB `optional:"true"`
+}
+
+// NewResetTokenRepository 按 user.store 创建找回密码令牌仓储,与用户使用同一存储
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	user.ResetTokenRepository: 找回密码令牌仓储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+func NewResetTokenRepository(p ResetTokenRepositoryParams) (user.ResetTokenRepository, error) {
+
+	if p.Config.Store == configs.UserStoreDatabase {
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		if err := p.DB.AutoMigrate(&resetTokenModel{}); err != nil {
+			return nil, err
+		}
+		return &gormResetTokenRepository{db: p.DB}, nil
+	}
+
+	return &memoryResetTokenRepository{tokens: make(map[string]*user.ResetToken)}, nil
+}
+
+// memoryResetTokenRepository 内存找回密码令牌仓储
+type memoryResetTokenRepository struct {
+	sync.Mutex
+	tokens map[string]*user.ResetToken
+}
+
+// SaveResetToken 保存令牌,同时删除该用户之前的令牌与已过期的令牌
+func (r *memoryResetTokenRepository) SaveResetToken(ctx context.Context, t *user.ResetToken) error {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	for k, v := range r.tokens {
+		if v.UserID == t.UserID || now.After(v.ExpiresAt) {
+			delete(r.tokens, k)
+		}
+	}
+
+	cp := *t
+	r.tokens[t.Hash] = &cp
+	return nil
+}
+
+// GetResetToken 获取令牌
+func (r *memoryResetTokenRepository) GetResetToken(ctx context.Context, hash string) (*user.ResetToken, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	v, ok := r.tokens[hash]
+	if !ok || time.Now().After(v.ExpiresAt) {
+		return nil, user.ErrResetTokenInvalid
+	}
+
+	cp := *v
+	return &cp, nil
+}
+
+// TakeResetToken 取出并删除令牌
+func (r *memoryResetTokenRepository) TakeResetToken(ctx context.Context, hash string) (*user.ResetToken, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	v, ok := r.tokens[hash]
+	if !ok {
+		return nil, user.ErrResetTokenInvalid
+	}
+	delete(r.tokens, hash)
+
+	if time.Now().After(v.ExpiresAt) {
+		return nil, user.ErrResetTokenInvalid
+	}
+
+	return v, nil
+}
+
+// resetTokenModel 找回密码令牌表
+type resetTokenModel struct {
+	Hash      string    `gorm:"primaryKey;size:64"`
+	UserID    string    `gorm:"size:64;index;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// TableName 找回密码令牌表名
+func (resetTokenModel) TableName() string {
+	return "user_reset_tokens"
+}
+
+// gormResetTokenRepository 数据库找回密码令牌仓储
+type gormResetTokenRepository struct {
+	db *gorm.DB
+}
+
+// SaveResetToken 保存令牌,同时删除该用户之前的令牌与已过期的令牌
+func (r *gormResetTokenRepository) SaveResetToken(ctx context.Context, t *user.ResetToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Where("user_id = ? OR expires_at < ?", t.UserID, time.Now()).Delete(&resetTokenModel{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&resetTokenModel{Hash: t.Hash, UserID: t.UserID, ExpiresAt: t.ExpiresAt}).Error
+	})
+}
+
+// GetResetToken 获取令牌
+func (r *gormResetTokenRepository) GetResetToken(ctx context.Context, hash string) (*user.ResetToken, error) {
+
+	var m resetTokenModel
+	err := r.db.WithContext(ctx).Where("hash = ? AND expires_at > ?", hash, time.Now()).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, user.ErrResetTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.ResetToken{Hash: m.Hash, UserID: m.UserID, ExpiresAt: m.ExpiresAt}, nil
+}
+
+// TakeResetToken 取出并删除令牌,以删除的行数判断是否由本次调用取得
+func (r *gormResetTokenRepository) TakeResetToken(ctx context.Context, hash string) (*user.ResetToken, error) {
+
+	t, err := r.GetResetToken(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	res := r.db.WithContext(ctx).Where("hash = ?", hash).Delete(&resetTokenModel{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, user.ErrResetTokenInvalid
+	}
+
+	return t, nil
+}
@@ -0,0 +1,329 @@
+package repoimpl
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// encryptedSecretPrefix 加密保存的 TOTP 密钥前缀,之后为 base64 编码的 nonce 与密文
+const encryptedSecretPrefix = "enc:"
+
+var (
+	ErrTOTPSecretEncrypted = errors.New("totp secret is encrypted but no mfa secret_key is configured") // TOTP 密钥已加密但未配置密钥加密密钥
+	ErrTOTPSecretDecrypt   = errors.New("decrypt totp secret failed")                                   // 密钥加密密钥错误或密文被篡改
+)
+
+// TOTPRepositoryParams 创建一次性密码仓储的依赖
+// 未配置 database.driver 时不提供数据库连接
+type TOTPRepositoryParams struct {
+	fx.In
+
+	Config *configs.User
+	DB     *gorm.DB `optional:"true"`
+}
+
+// NewTOTPRepository 按 user.store 创建一次性密码仓储,与用户使用同一存储
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	user.TOTPRepository: 一次性密码仓储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+//	configs.ErrUserConfig: mfa.secret_key 格式错误
+func NewTOTPRepository(p TOTPRepositoryParams) (user.TOTPRepository, error) {
+
+	if p.Config.Store == configs.UserStoreDatabase {
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		if err := p.DB.AutoMigrate(&totpModel{}); err != nil {
+			return nil, err
+		}
+
+		repo := &gormTOTPRepository{db: p.DB}
+
+		key, err := p.Config.MFA.SecretKeyBytes()
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			if repo.aead, err = newSecretAEAD(key); err != nil {
+				return nil, err
+			}
+		}
+
+		return repo, nil
+	}
+
+	return &memoryTOTPRepository{records: make(map[string]*user.TOTP)}, nil
+}
+
+// memoryTOTPRepository 内存一次性密码仓储
+type memoryTOTPRepository struct {
+	sync.Mutex
+	records map[string]*user.TOTP // 键为用户ID
+}
+
+// SaveTOTP 保存一次性密码
+func (r *memoryTOTPRepository) SaveTOTP(ctx context.Context, t *user.TOTP) error {
+	r.Lock()
+	defer r.Unlock()
+
+	cp := *t
+	r.records[t.UserID] = &cp
+	return nil
+}
+
+// GetTOTP 获取一次性密码
+func (r *memoryTOTPRepository) GetTOTP(ctx context.Context, userID string) (*user.TOTP, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	t, ok := r.records[userID]
+	if !ok {
+		return nil, user.ErrTOTPNotFound
+	}
+
+	cp := *t
+	return &cp, nil
+}
+
+// UseTOTPStep 记录已使用的时间步
+func (r *memoryTOTPRepository) UseTOTPStep(ctx context.Context, userID string, step int64, confirm bool) error {
+	r.Lock()
+	defer r.Unlock()
+
+	t, ok := r.records[userID]
+	if !ok {
+		return user.ErrTOTPNotFound
+	}
+	if step <= t.LastStep {
+		return user.ErrTOTPCodeUsed
+	}
+
+	t.LastStep = step
+	if confirm {
+		t.Confirmed = true
+	}
+	return nil
+}
+
+// RenameTOTP 修改一次性密码的名称
+func (r *memoryTOTPRepository) RenameTOTP(ctx context.Context, userID, name string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	t, ok := r.records[userID]
+	if !ok {
+		return user.ErrTOTPNotFound
+	}
+
+	t.Name = name
+	return nil
+}
+
+// DeleteTOTP 删除一次性密码
+func (r *memoryTOTPRepository) DeleteTOTP(ctx context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.records, userID)
+	return nil
+}
+
+// totpModel 一次性密码表
+type totpModel struct {
+	UserID    string `gorm:"primaryKey;size:64"`
+	Secret    string `gorm:"size:255;not null"` // 配置了 mfa.secret_key 时为 encryptedSecretPrefix 开头的密文
+	Name      string `gorm:"size:64"`
+	Confirmed bool   `gorm:"not null;default:false"`
+	LastStep  int64  `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+// TableName 一次性密码表名
+func (totpModel) TableName() string {
+	return "user_totps"
+}
+
+// gormTOTPRepository 数据库一次性密码仓储
+// 配置了密钥加密密钥时 TOTP 密钥以 AES-256-GCM 加密保存,附加数据为用户ID,密文不能挪给其他用户使用
+type gormTOTPRepository struct {
+	db   *gorm.DB
+	aead cipher.AEAD // 为空时明文保存
+}
+
+// SaveTOTP 保存一次性密码,替换之前的记录
+func (r *gormTOTPRepository) SaveTOTP(ctx context.Context, t *user.TOTP) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		secret, err := r.seal(t.UserID, t.Secret)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", t.UserID).Delete(&totpModel{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&totpModel{
+			UserID:    t.UserID,
+			Secret:    secret,
+			Name:      t.Name,
+			Confirmed: t.Confirmed,
+			LastStep:  t.LastStep,
+			CreatedAt: t.CreatedAt,
+		}).Error
+	})
+}
+
+// GetTOTP 获取一次性密码
+// 配置了密钥加密密钥而保存的仍为明文时,读取后加密改写
+func (r *gormTOTPRepository) GetTOTP(ctx context.Context, userID string) (*user.TOTP, error) {
+
+	var m totpModel
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, user.ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := r.open(m.UserID, m.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.aead != nil && !strings.HasPrefix(m.Secret, encryptedSecretPrefix) {
+		sealed, err := r.seal(m.UserID, secret)
+		if err != nil {
+			return nil, err
+		}
+		err = r.db.WithContext(ctx).Model(&totpModel{}).Where("user_id = ? AND secret = ?", m.UserID, m.Secret).Update("secret", sealed).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &user.TOTP{
+		UserID:    m.UserID,
+		Secret:    secret,
+		Name:      m.Name,
+		Confirmed: m.Confirmed,
+		LastStep:  m.LastStep,
+		CreatedAt: m.CreatedAt,
+	}, nil
+}
+
+// UseTOTPStep 记录已使用的时间步,以更新的行数判断是否由本次调用取得
+func (r *gormTOTPRepository) UseTOTPStep(ctx context.Context, userID string, step int64, confirm bool) error {
+
+	updates := map[string]any{"last_step": step}
+	if confirm {
+		updates["confirmed"] = true
+	}
+
+	res := r.db.WithContext(ctx).Model(&totpModel{}).Where("user_id = ? AND last_step < ?", userID, step).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	if _, err := r.GetTOTP(ctx, userID); err != nil {
+		return err
+	}
+	return user.ErrTOTPCodeUsed
+}
+
+// RenameTOTP 修改一次性密码的名称,以更新的行数与记录是否存在判断结果
+func (r *gormTOTPRepository) RenameTOTP(ctx context.Context, userID, name string) error {
+
+	res := r.db.WithContext(ctx).Model(&totpModel{}).Where("user_id = ?", userID).Update("name", name)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	// MySQL 默认只统计值有变化的行,名称未变时也会返回 0
+	_, err := r.GetTOTP(ctx, userID)
+	return err
+}
+
+// DeleteTOTP 删除一次性密码
+func (r *gormTOTPRepository) DeleteTOTP(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&totpModel{}).Error
+}
+
+// seal 加密 TOTP 密钥,未配置密钥加密密钥时原样返回
+func (r *gormTOTPRepository) seal(userID, secret string) (string, error) {
+
+	if r.aead == nil {
+		return secret, nil
+	}
+
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := r.aead.Seal(nonce, nonce, []byte(secret), []byte(userID))
+	return encryptedSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// open 解密 seal 加密的 TOTP 密钥,明文保存的原样返回
+func (r *gormTOTPRepository) open(userID, stored string) (string, error) {
+
+	encoded, ok := strings.CutPrefix(stored, encryptedSecretPrefix)
+	if !ok {
+		return stored, nil
+	}
+	if r.aead == nil {
+		return "", ErrTOTPSecretEncrypted
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < r.aead.NonceSize() {
+		return "", ErrTOTPSecretDecrypt
+	}
+
+	n := r.aead.NonceSize()
+	plain, err := r.aead.Open(nil, sealed[:n], sealed[n:], []byte(userID))
+	if err != nil {
+		return "", ErrTOTPSecretDecrypt
+	}
+
+	return string(plain), nil
+}
+
+// newSecretAEAD 创建 AES-256-GCM 加密器
+func newSecretAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
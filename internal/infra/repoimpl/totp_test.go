@@ -0,0 +1,131 @@
+package repoimpl
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testTOTPSecret 测试使用的 TOTP 密钥
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// newTestTOTPRepository 在同一数据库上按密钥加密密钥创建一次性密码仓储,key 为空时明文保存
+func newTestTOTPRepository(t *testing.T, db *gorm.DB, key []byte) user.TOTPRepository {
+	t.Helper()
+
+	cfg, err := configs.NewUser(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Store = configs.UserStoreDatabase
+	if key != nil {
+		cfg.MFA.SecretKey = base64.StdEncoding.EncodeToString(key)
+	}
+
+	repo, err := NewTOTPRepository(TOTPRepositoryParams{Config: cfg, DB: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// storedSecret 数据库中保存的 TOTP 密钥
+func storedSecret(t *testing.T, db *gorm.DB, userID string) string {
+	t.Helper()
+
+	var m totpModel
+	if err := db.Where("user_id = ?", userID).Take(&m).Error; err != nil {
+		t.Fatal(err)
+	}
+	return m.Secret
+}
+
+func TestTOTPSecretEncryptedAtRest(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/test.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := []byte(strings.Repeat("k", 32))
+
+	repo := newTestTOTPRepository(t, db, key)
+	if err := repo.SaveTOTP(ctx, &user.TOTP{UserID: "1", Secret: testTOTPSecret, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := storedSecret(t, db, "1")
+	if !strings.HasPrefix(stored, encryptedSecretPrefix) || strings.Contains(stored, testTOTPSecret) {
+		t.Fatalf("secret stored in plaintext: %q", stored)
+	}
+
+	got, err := repo.GetTOTP(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Secret != testTOTPSecret {
+		t.Fatalf("secret = %q, want %q", got.Secret, testTOTPSecret)
+	}
+
+	// 密文以用户ID为附加数据,挪给其他用户后无法解密
+	if err := db.Create(&totpModel{UserID: "2", Secret: stored}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetTOTP(ctx, "2"); !errors.Is(err, ErrTOTPSecretDecrypt) {
+		t.Fatalf("GetTOTP(moved ciphertext) = %v, want ErrTOTPSecretDecrypt", err)
+	}
+
+	if _, err := newTestTOTPRepository(t, db, []byte(strings.Repeat("x", 32))).GetTOTP(ctx, "1"); !errors.Is(err, ErrTOTPSecretDecrypt) {
+		t.Fatalf("GetTOTP(wrong key) = %v, want ErrTOTPSecretDecrypt", err)
+	}
+	if _, err := newTestTOTPRepository(t, db, nil).GetTOTP(ctx, "1"); !errors.Is(err, ErrTOTPSecretEncrypted) {
+		t.Fatalf("GetTOTP(no key) = %v, want ErrTOTPSecretEncrypted", err)
+	}
+}
+
+func TestTOTPPlaintextSecretMigrated(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/test.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 未配置密钥加密密钥时保存的明文密钥,配置后读取时加密改写
+	if err := newTestTOTPRepository(t, db, nil).SaveTOTP(ctx, &user.TOTP{UserID: "1", Secret: testTOTPSecret}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedSecret(t, db, "1"); stored != testTOTPSecret {
+		t.Fatalf("secret = %q, want plaintext", stored)
+	}
+
+	repo := newTestTOTPRepository(t, db, []byte(strings.Repeat("k", 32)))
+	got, err := repo.GetTOTP(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Secret != testTOTPSecret {
+		t.Fatalf("secret = %q, want %q", got.Secret, testTOTPSecret)
+	}
+	if stored := storedSecret(t, db, "1"); !strings.HasPrefix(stored, encryptedSecretPrefix) {
+		t.Fatalf("plaintext secret not migrated: %q", stored)
+	}
+
+	// 改写后时间步记录照常
+	if err := repo.UseTOTPStep(ctx, "1", 10, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UseTOTPStep(ctx, "1", 10, false); !errors.Is(err, user.ErrTOTPCodeUsed) {
+		t.Fatalf("UseTOTPStep(same step) = %v, want ErrTOTPCodeUsed", err)
+	}
+}
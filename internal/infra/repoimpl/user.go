@@ -2,39 +2,394 @@ package repoimpl
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
-	"github.com/xiaohangshuhub/xiaohangshu/pkg/http"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
+// 可用于查找用户的字段
+const (
+	fieldID       = "id"
+	fieldUsername = "username"
+	fieldEmail    = "email"
+	fieldPhone    = "phone"
+)
+
+// userModel 用户表
+// 密码哈希为 PHC 格式,哈希算法与参数随哈希一起保存,升级参数不影响已有哈希的验证
+type userModel struct {
+	ID            string  `gorm:"primaryKey;size:64"`
+	Username      string  `gorm:"size:64;uniqueIndex;not null"`
+	Email         *string `gorm:"size:255;uniqueIndex"`
+	EmailVerified bool
+	Phone         *string `gorm:"size:32;uniqueIndex"`
+	PhoneVerified bool
+	MFARequired   bool
+	Nickname      string `gorm:"size:64"`
+	Avatar        string `gorm:"size:512"`
+	Status        user.Status
+	PasswordHash  string `gorm:"size:255"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TableName 用户表名
+func (userModel) TableName() string {
+	return "users"
+}
+
+// toUserInfo 转换为用户信息
+func (m *userModel) toUserInfo() *user.UserInfo {
+
+	info := &user.UserInfo{
+		ID:            m.ID,
+		Loginname:     m.Username,
+		Nickname:      m.Nickname,
+		Avatar:        m.Avatar,
+		EmailVerified: m.EmailVerified,
+		PhoneVerified: m.PhoneVerified,
+		MFARequired:   m.MFARequired,
+		Status:        m.Status,
+		CreatedAt:     m.CreatedAt,
+	}
+	if m.Email != nil {
+		info.Email = *m.Email
+	}
+	if m.Phone != nil {
+		info.Phone = *m.Phone
+	}
+
+	return info
+}
+
+// userStore 用户数据存储
+type userStore interface {
+
+	// find 按字段查找用户,不存在时返回 user.ErrUserNotFound
+	find(ctx context.Context, field, value string) (*userModel, error)
+
+	// updatePasswordHash 更新密码哈希
+	updatePasswordHash(ctx context.Context, id, hash string) error
+
+	// create 创建用户,唯一字段冲突时返回错误
+	create(ctx context.Context, m *userModel) error
+
+	// markVerified 字段值仍为 value 时将其标记为已验证,返回是否标记
+	markVerified(ctx context.Context, id, field, value string) (bool, error)
+}
+
+// UserRepositoryParams 创建用户仓储的依赖
+// 未配置 database.driver 时不提供数据库连接
+type UserRepositoryParams struct {
+	fx.In
+
+	Config *configs.User
+	DB     *gorm.DB `optional:"true"`
+	Logger *zap.Logger
+}
+
+// UserRepositoryImpl 用户仓储
 type UserRepositoryImpl struct {
-	userClient *http.UserClient
+	*zap.Logger
+	store userStore
 }
 
-// GetUserInfoByUsername 根据用户名获取用户信息
-func (impl *UserRepositoryImpl) GetUserInfoByPassword(ctx context.Context, username, password string) (*user.UserInfo, error) {
+// NewUserRepository 按 user.store 创建用户仓储
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	user.UserRepository: 用户仓储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+func NewUserRepository(p UserRepositoryParams) (user.UserRepository, error) {
+
+	var (
+		store userStore
+		err   error
+	)
 
-	//请求用户服务
-	//_, err = impl.userClient.GetUserInfoByPwd(ctx, username, password)
+	switch p.Config.Store {
+	case configs.UserStoreDatabase:
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		store, err = newGormUserStore(p.DB, p.Config.Users, p.Logger)
+	default:
+		store, err = newMemoryUserStore(p.Config.Users, p.Logger)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	if username != "admin" || password != "admin" {
+	return &UserRepositoryImpl{Logger: p.Logger, store: store}, nil
+}
 
-		err := user.ErrInvalidUserOrPassword
+// GetUserInfoByPassword 根据账号和密码获取用户信息
+func (impl *UserRepositoryImpl) GetUserInfoByPassword(ctx context.Context, username, plain string) (*user.UserInfo, error) {
 
+	m, err := impl.findAccount(ctx, username)
+	if errors.Is(err, user.ErrUserNotFound) || (err == nil && m.PasswordHash == "") {
+		// 用户不存在或未设置密码时同样计算一次哈希,避免通过响应时间探测账号
+		password.Verify(dummyHash(), plain)
+		return nil, user.ErrInvalidUserOrPassword
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	// 假设用户名和密码验证通过，返回一个用户信息
-	return &user.UserInfo{
-		ID:        "1",
-		Loginname: username,
-		Nickname:  "Test User",
-		Avatar:    "http://example.com/avatar.jpg",
-	}, nil
+	ok, err := password.Verify(m.PasswordHash, plain)
+	if err != nil {
+		impl.Error("verify password failed", zap.String("user_id", m.ID), zap.Error(err))
+		return nil, user.ErrInvalidUserOrPassword
+	}
+	if !ok {
+		return nil, user.ErrInvalidUserOrPassword
+	}
+
+	if m.Status == user.Disable {
+		return nil, user.ErrUserDisabled
+	}
+
+	if password.NeedsRehash(m.PasswordHash) {
+		impl.rehash(ctx, m.ID, plain)
+	}
+
+	return m.toUserInfo(), nil
+}
+
+// GetUserInfoByAccount 根据账号获取用户信息
+func (impl *UserRepositoryImpl) GetUserInfoByAccount(ctx context.Context, account string) (*user.UserInfo, error) {
+	return toUserInfo(impl.findAccount(ctx, account))
+}
+
+// GetUserInfoByID 根据用户ID获取用户信息
+func (impl *UserRepositoryImpl) GetUserInfoByID(ctx context.Context, id string) (*user.UserInfo, error) {
+	return toUserInfo(impl.find(ctx, fieldID, id))
+}
+
+// GetUserInfoByUsername 根据用户名获取用户信息
+func (impl *UserRepositoryImpl) GetUserInfoByUsername(ctx context.Context, username string) (*user.UserInfo, error) {
+	return toUserInfo(impl.find(ctx, fieldUsername, username))
+}
+
+// GetUserInfoByEmail 根据邮箱获取用户信息
+func (impl *UserRepositoryImpl) GetUserInfoByEmail(ctx context.Context, email string) (*user.UserInfo, error) {
+	return toUserInfo(impl.find(ctx, fieldEmail, email))
+}
+
+// GetUserInfoByPhone 根据手机号获取用户信息
+func (impl *UserRepositoryImpl) GetUserInfoByPhone(ctx context.Context, phone string) (*user.UserInfo, error) {
+	return toUserInfo(impl.find(ctx, fieldPhone, phone))
+}
+
+// CreateUser 创建用户
+// 先逐个检查唯一字段以返回明确的错误,并发注册导致插入失败时再检查一次
+func (impl *UserRepositoryImpl) CreateUser(ctx context.Context, info *user.UserInfo, passwordHash string) error {
+
+	m := &userModel{
+		ID:           info.ID,
+		Username:     info.Loginname,
+		Nickname:     info.Nickname,
+		Avatar:       info.Avatar,
+		Status:       info.Status,
+		MFARequired:  info.MFARequired,
+		PasswordHash: passwordHash,
+	}
+	if m.ID == "" {
+		m.ID = uuid.NewString()
+	}
+	if info.Email != "" {
+		email := strings.ToLower(info.Email)
+		m.Email = &email
+		m.EmailVerified = info.EmailVerified
+	}
+	if info.Phone != "" {
+		m.Phone = &info.Phone
+		m.PhoneVerified = info.PhoneVerified
+	}
+
+	if err := impl.conflict(ctx, m); err != nil {
+		return err
+	}
+
+	if err := impl.store.create(ctx, m); err != nil {
+		if conflict := impl.conflict(ctx, m); conflict != nil {
+			return conflict
+		}
+		return err
+	}
+
+	info.ID = m.ID
+	info.Email = deref(m.Email)
+	info.CreatedAt = m.CreatedAt
+
+	return nil
+}
+
+// UpdatePassword 更新用户的密码哈希
+func (impl *UserRepositoryImpl) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	return impl.store.updatePasswordHash(ctx, id, passwordHash)
+}
+
+// MarkVerified 将用户的邮箱或手机号标记为已验证
+func (impl *UserRepositoryImpl) MarkVerified(ctx context.Context, id, channel, value string) error {
+
+	field := fieldEmail
+	switch channel {
+	case user.ChannelEmail:
+		value = strings.ToLower(value)
+	case user.ChannelPhone:
+		field = fieldPhone
+	default:
+		return user.ErrVerificationInvalid
+	}
+
+	ok, err := impl.store.markVerified(ctx, id, field, value)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, err := impl.find(ctx, fieldID, id); err != nil {
+			return err
+		}
+		return user.ErrVerificationInvalid
+	}
+
+	return nil
+}
+
+// conflict 检查用户名、邮箱、手机号是否已被使用
+func (impl *UserRepositoryImpl) conflict(ctx context.Context, m *userModel) error {
+
+	checks := []struct {
+		field string
+		value string
+		err   error
+	}{
+		{fieldUsername, m.Username, user.ErrUsernameExist},
+		{fieldEmail, deref(m.Email), user.ErrEmailExist},
+		{fieldPhone, deref(m.Phone), user.ErrPhoneExist},
+	}
+
+	for _, v := range checks {
+		_, err := impl.find(ctx, v.field, v.value)
+		if err == nil {
+			return v.err
+		}
+		if !errors.Is(err, user.ErrUserNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findAccount 依次按用户名、邮箱、手机号查找用户
+func (impl *UserRepositoryImpl) findAccount(ctx context.Context, account string) (*userModel, error) {
+
+	for _, field := range []string{fieldUsername, fieldEmail, fieldPhone} {
+		m, err := impl.find(ctx, field, account)
+		if !errors.Is(err, user.ErrUserNotFound) {
+			return m, err
+		}
+	}
+
+	return nil, user.ErrUserNotFound
+}
+
+// find 按字段查找用户,值为空时视为不存在,邮箱不区分大小写
+func (impl *UserRepositoryImpl) find(ctx context.Context, field, value string) (*userModel, error) {
+
+	if value == "" {
+		return nil, user.ErrUserNotFound
+	}
+	if field == fieldEmail {
+		value = strings.ToLower(value)
+	}
+
+	return impl.store.find(ctx, field, value)
 }
 
-func NewUserRepository(client *http.UserClient) user.UserRepository {
-	return &UserRepositoryImpl{
-		userClient: client,
+// rehash 按当前参数重新计算密码哈希,失败时只记录日志,不影响本次登录
+func (impl *UserRepositoryImpl) rehash(ctx context.Context, id, plain string) {
+
+	hash, err := password.Hash(plain)
+	if err == nil {
+		err = impl.store.updatePasswordHash(ctx, id, hash)
+	}
+	if err != nil {
+		impl.Warn("upgrade password hash failed", zap.String("user_id", id), zap.Error(err))
+		return
+	}
+
+	impl.Info("password hash upgraded", zap.String("user_id", id))
+}
+
+// toUserInfo 转换查找结果
+func toUserInfo(m *userModel, err error) (*user.UserInfo, error) {
+	if err != nil {
+		return nil, err
 	}
+	return m.toUserInfo(), nil
+}
+
+// dummyHash 用户不存在时参与验证的哈希
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := password.Hash(uuid.NewString())
+	return hash
+})
+
+// fromSeed 由初始用户配置创建用户表记录
+// 密码为明文时计算哈希并告警,配置文件中应只保存哈希
+func fromSeed(v *configs.SeedUser, logger *zap.Logger) (*userModel, error) {
+
+	m := &userModel{
+		ID:           v.ID,
+		Username:     v.Username,
+		Nickname:     v.Nickname,
+		Avatar:       v.Avatar,
+		MFARequired:  v.MFARequired,
+		PasswordHash: v.Password,
+	}
+	if m.ID == "" {
+		m.ID = uuid.NewString()
+	}
+	if v.Email != "" {
+		m.Email = &v.Email
+		m.EmailVerified = v.EmailVerified
+	}
+	if v.Phone != "" {
+		m.Phone = &v.Phone
+		m.PhoneVerified = v.PhoneVerified
+	}
+	if v.Disabled {
+		m.Status = user.Disable
+	}
+
+	if m.PasswordHash != "" && !password.IsHash(m.PasswordHash) {
+		logger.Warn("user password is stored in plain text, replace it with a hash generated by cmd/secrethash", zap.String("username", v.Username))
+
+		var err error
+		if m.PasswordHash, err = password.Hash(v.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
 }
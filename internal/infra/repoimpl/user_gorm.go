@@ -0,0 +1,102 @@
+package repoimpl
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gormUserStore 数据库用户存储
+// 配置文件中的用户在启动时导入,ID、用户名、邮箱或手机号已存在的用户不会被覆盖
+type gormUserStore struct {
+	db *gorm.DB
+}
+
+// newGormUserStore 创建数据库用户存储
+//
+// 参数:
+//
+//	db: 数据库连接
+//	seeds: 初始用户
+//	logger: 日志对象
+//
+// 返回值:
+//
+//	userStore: 用户存储
+//	error: 错误信息,建表或导入失败时返回
+func newGormUserStore(db *gorm.DB, seeds []*configs.SeedUser, logger *zap.Logger) (userStore, error) {
+
+	if err := db.AutoMigrate(&userModel{}); err != nil {
+		return nil, err
+	}
+
+	for _, v := range seeds {
+		m, err := fromSeed(v, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			logger.Info("user imported from configuration", zap.String("user_id", m.ID), zap.String("username", m.Username))
+		}
+	}
+
+	return &gormUserStore{db: db}, nil
+}
+
+// find 按字段查找用户
+func (s *gormUserStore) find(ctx context.Context, field, value string) (*userModel, error) {
+
+	var m userModel
+	err := s.db.WithContext(ctx).Where(clause.Eq{Column: clause.Column{Name: field}, Value: value}).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, user.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// updatePasswordHash 更新密码哈希
+func (s *gormUserStore) updatePasswordHash(ctx context.Context, id, hash string) error {
+
+	res := s.db.WithContext(ctx).Model(&userModel{}).Where("id = ?", id).Update("password_hash", hash)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return user.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// create 创建用户
+func (s *gormUserStore) create(ctx context.Context, m *userModel) error {
+	return s.db.WithContext(ctx).Create(m).Error
+}
+
+// markVerified 字段值仍为 value 时将其标记为已验证
+func (s *gormUserStore) markVerified(ctx context.Context, id, field, value string) (bool, error) {
+
+	res := s.db.WithContext(ctx).Model(&userModel{}).
+		Where("id = ?", id).
+		Where(clause.Eq{Column: clause.Column{Name: field}, Value: value}).
+		Update(field+"_verified", true)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected > 0, nil
+}
@@ -0,0 +1,153 @@
+package repoimpl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+// memoryUserStore 内存用户存储
+// 用户来自配置文件,运行期间的修改在重启后丢失
+type memoryUserStore struct {
+	sync.RWMutex
+	users map[string]*userModel
+}
+
+// newMemoryUserStore 创建内存用户存储
+//
+// 参数:
+//
+//	seeds: 初始用户
+//	logger: 日志对象
+//
+// 返回值:
+//
+//	userStore: 用户存储
+//	error: 错误信息,明文密码哈希失败时返回
+func newMemoryUserStore(seeds []*configs.SeedUser, logger *zap.Logger) (userStore, error) {
+
+	s := &memoryUserStore{users: make(map[string]*userModel, len(seeds))}
+
+	now := time.Now()
+	for _, v := range seeds {
+		m, err := fromSeed(v, logger)
+		if err != nil {
+			return nil, err
+		}
+		m.CreatedAt, m.UpdatedAt = now, now
+		s.users[m.ID] = m
+	}
+
+	return s, nil
+}
+
+// find 按字段查找用户,返回副本
+func (s *memoryUserStore) find(ctx context.Context, field, value string) (*userModel, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if field == fieldID {
+		if m, ok := s.users[value]; ok {
+			cp := *m
+			return &cp, nil
+		}
+		return nil, user.ErrUserNotFound
+	}
+
+	for _, m := range s.users {
+		var v string
+		switch field {
+		case fieldUsername:
+			v = m.Username
+		case fieldEmail:
+			v = deref(m.Email)
+		case fieldPhone:
+			v = deref(m.Phone)
+		}
+		if v == value {
+			cp := *m
+			return &cp, nil
+		}
+	}
+
+	return nil, user.ErrUserNotFound
+}
+
+// updatePasswordHash 更新密码哈希
+func (s *memoryUserStore) updatePasswordHash(ctx context.Context, id, hash string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m, ok := s.users[id]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+
+	cp := *m
+	cp.PasswordHash = hash
+	s.users[id] = &cp
+
+	return nil
+}
+
+// markVerified 字段值仍为 value 时将其标记为已验证
+func (s *memoryUserStore) markVerified(ctx context.Context, id, field, value string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	m, ok := s.users[id]
+	if !ok {
+		return false, user.ErrUserNotFound
+	}
+
+	cp := *m
+	switch {
+	case field == fieldEmail && deref(m.Email) == value:
+		cp.EmailVerified = true
+	case field == fieldPhone && deref(m.Phone) == value:
+		cp.PhoneVerified = true
+	default:
+		return false, nil
+	}
+	cp.UpdatedAt = time.Now()
+	s.users[id] = &cp
+
+	return true, nil
+}
+
+// create 创建用户,在同一把锁内检查唯一字段
+func (s *memoryUserStore) create(ctx context.Context, m *userModel) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.users[m.ID]; ok {
+		return user.ErrUserExist
+	}
+	for _, v := range s.users {
+		if v.Username == m.Username ||
+			(m.Email != nil && deref(v.Email) == *m.Email) ||
+			(m.Phone != nil && deref(v.Phone) == *m.Phone) {
+			return user.ErrUserExist
+		}
+	}
+
+	now := time.Now()
+	cp := *m
+	cp.CreatedAt, cp.UpdatedAt = now, now
+	s.users[m.ID] = &cp
+	m.CreatedAt, m.UpdatedAt = now, now
+
+	return nil
+}
+
+// deref 读取可为空的字段
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
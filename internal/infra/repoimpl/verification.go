@@ -0,0 +1,257 @@
+package repoimpl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// VerificationRepositoryParams 创建联系方式验证仓储的依赖
+// 未配置 database.driver 时不提供数据库连接
+type VerificationRepositoryParams struct {
+	fx.In
+
+	Config *configs.User
+	DB     *gorm.DB `optional:"true"`
+}
+
+// NewVerificationRepository 按 user.store 创建联系方式验证仓储,与用户使用同一存储
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	user.VerificationRepository: 联系方式验证仓储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+func NewVerificationRepository(p VerificationRepositoryParams) (user.VerificationRepository, error) {
+
+	if p.Config.Store == configs.UserStoreDatabase {
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		if err := p.DB.AutoMigrate(&verificationModel{}); err != nil {
+			return nil, err
+		}
+		return &gormVerificationRepository{db: p.DB}, nil
+	}
+
+	return &memoryVerificationRepository{records: make(map[string]*user.Verification)}, nil
+}
+
+// memoryVerificationRepository 内存联系方式验证仓储
+type memoryVerificationRepository struct {
+	sync.Mutex
+	records map[string]*user.Verification // 键为 用户ID + ":" + 渠道
+}
+
+// verificationKey 内存仓储的键
+func verificationKey(userID, channel string) string {
+	return userID + ":" + channel
+}
+
+// SaveVerification 保存验证记录,同时删除已过期的记录
+func (r *memoryVerificationRepository) SaveVerification(ctx context.Context, v *user.Verification) error {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	for k, old := range r.records {
+		if now.After(old.ExpiresAt) {
+			delete(r.records, k)
+		}
+	}
+
+	cp := *v
+	r.records[verificationKey(v.UserID, v.Channel)] = &cp
+	return nil
+}
+
+// GetVerification 获取验证记录
+func (r *memoryVerificationRepository) GetVerification(ctx context.Context, userID, channel string) (*user.Verification, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	v, ok := r.records[verificationKey(userID, channel)]
+	if !ok || time.Now().After(v.ExpiresAt) {
+		return nil, user.ErrVerificationInvalid
+	}
+
+	cp := *v
+	return &cp, nil
+}
+
+// GetVerificationByHash 按令牌哈希获取验证记录
+func (r *memoryVerificationRepository) GetVerificationByHash(ctx context.Context, channel, hash string) (*user.Verification, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	for _, v := range r.records {
+		if v.Channel == channel && v.Hash == hash && !now.After(v.ExpiresAt) {
+			cp := *v
+			return &cp, nil
+		}
+	}
+
+	return nil, user.ErrVerificationInvalid
+}
+
+// AddVerificationAttempt 占用一次尝试次数
+func (r *memoryVerificationRepository) AddVerificationAttempt(ctx context.Context, userID, channel string, limit int) error {
+	r.Lock()
+	defer r.Unlock()
+
+	v, ok := r.records[verificationKey(userID, channel)]
+	if !ok || v.Attempts >= limit || time.Now().After(v.ExpiresAt) {
+		return user.ErrVerificationInvalid
+	}
+	v.Attempts++
+	return nil
+}
+
+// TakeVerification 取出并删除哈希匹配的验证记录
+func (r *memoryVerificationRepository) TakeVerification(ctx context.Context, userID, channel, hash string) (*user.Verification, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	key := verificationKey(userID, channel)
+	v, ok := r.records[key]
+	if !ok || v.Hash != hash {
+		return nil, user.ErrVerificationInvalid
+	}
+	delete(r.records, key)
+
+	if time.Now().After(v.ExpiresAt) {
+		return nil, user.ErrVerificationInvalid
+	}
+
+	return v, nil
+}
+
+// verificationModel 联系方式验证表
+type verificationModel struct {
+	UserID    string    `gorm:"primaryKey;size:64"`
+	Channel   string    `gorm:"primaryKey;size:16"`
+	Target    string    `gorm:"size:255;not null"`
+	Hash      string    `gorm:"size:64;index;not null"`
+	Attempts  int       `gorm:"not null;default:0"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// TableName 联系方式验证表名
+func (verificationModel) TableName() string {
+	return "user_verifications"
+}
+
+// toVerification 转换为验证记录
+func (m *verificationModel) toVerification() *user.Verification {
+	return &user.Verification{
+		UserID:    m.UserID,
+		Channel:   m.Channel,
+		Target:    m.Target,
+		Hash:      m.Hash,
+		Attempts:  m.Attempts,
+		ExpiresAt: m.ExpiresAt,
+	}
+}
+
+// gormVerificationRepository 数据库联系方式验证仓储
+type gormVerificationRepository struct {
+	db *gorm.DB
+}
+
+// SaveVerification 保存验证记录,同时删除已过期的记录
+func (r *gormVerificationRepository) SaveVerification(ctx context.Context, v *user.Verification) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		err := tx.Where("(user_id = ? AND channel = ?) OR expires_at < ?", v.UserID, v.Channel, time.Now()).Delete(&verificationModel{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&verificationModel{
+			UserID:    v.UserID,
+			Channel:   v.Channel,
+			Target:    v.Target,
+			Hash:      v.Hash,
+			Attempts:  v.Attempts,
+			ExpiresAt: v.ExpiresAt,
+		}).Error
+	})
+}
+
+// GetVerification 获取验证记录
+func (r *gormVerificationRepository) GetVerification(ctx context.Context, userID, channel string) (*user.Verification, error) {
+	return r.take(r.db.WithContext(ctx).Where("user_id = ? AND channel = ?", userID, channel))
+}
+
+// GetVerificationByHash 按令牌哈希获取验证记录
+func (r *gormVerificationRepository) GetVerificationByHash(ctx context.Context, channel, hash string) (*user.Verification, error) {
+	return r.take(r.db.WithContext(ctx).Where("channel = ? AND hash = ?", channel, hash))
+}
+
+// AddVerificationAttempt 占用一次尝试次数,以带次数条件的更新的行数判断是否占用成功
+func (r *gormVerificationRepository) AddVerificationAttempt(ctx context.Context, userID, channel string, limit int) error {
+
+	res := r.db.WithContext(ctx).Model(&verificationModel{}).
+		Where("user_id = ? AND channel = ? AND attempts < ? AND expires_at > ?", userID, channel, limit, time.Now()).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return user.ErrVerificationInvalid
+	}
+
+	return nil
+}
+
+// TakeVerification 取出并删除哈希匹配的验证记录,以删除的行数判断是否由本次调用取得
+func (r *gormVerificationRepository) TakeVerification(ctx context.Context, userID, channel, hash string) (*user.Verification, error) {
+
+	v, err := r.GetVerification(ctx, userID, channel)
+	if err != nil {
+		return nil, err
+	}
+	if v.Hash != hash {
+		return nil, user.ErrVerificationInvalid
+	}
+
+	res := r.db.WithContext(ctx).Where("user_id = ? AND channel = ? AND hash = ?", userID, channel, hash).Delete(&verificationModel{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, user.ErrVerificationInvalid
+	}
+
+	return v, nil
+}
+
+// take 读取一条未过期的验证记录
+func (r *gormVerificationRepository) take(db *gorm.DB) (*user.Verification, error) {
+
+	var m verificationModel
+	err := db.Where("expires_at > ?", time.Now()).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, user.ErrVerificationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.toVerification(), nil
+}
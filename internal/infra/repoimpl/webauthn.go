@@ -0,0 +1,332 @@
+package repoimpl
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredentialRepositoryParams 创建 WebAuthn 凭据仓储的依赖
+// 未配置 database.driver 时不提供数据库连接
+type WebAuthnCredentialRepositoryParams struct {
+	fx.In
+
+	Config *configs.User
+	DB     *gorm.DB `optional:"true"`
+}
+
+// NewWebAuthnCredentialRepository 按 user.store 创建 WebAuthn 凭据仓储,与用户使用同一存储
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	user.WebAuthnCredentialRepository: WebAuthn 凭据仓储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+func NewWebAuthnCredentialRepository(p WebAuthnCredentialRepositoryParams) (user.WebAuthnCredentialRepository, error) {
+
+	if p.Config.Store == configs.UserStoreDatabase {
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		if err := p.DB.AutoMigrate(&webAuthnCredentialModel{}); err != nil {
+			return nil, err
+		}
+		return &gormWebAuthnCredentialRepository{db: p.DB}, nil
+	}
+
+	return &memoryWebAuthnCredentialRepository{}, nil
+}
+
+// memoryWebAuthnCredentialRepository 内存 WebAuthn 凭据仓储
+type memoryWebAuthnCredentialRepository struct {
+	sync.Mutex
+	records []*user.WebAuthnCredential // 按注册顺序保存
+}
+
+// SaveWebAuthnCredential 保存凭据
+func (r *memoryWebAuthnCredentialRepository) SaveWebAuthnCredential(ctx context.Context, c *user.WebAuthnCredential) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.find(c.ID) >= 0 {
+		return user.ErrWebAuthnCredentialExist
+	}
+
+	cp := *c
+	r.records = append(r.records, &cp)
+	return nil
+}
+
+// GetWebAuthnCredential 获取凭据
+func (r *memoryWebAuthnCredentialRepository) GetWebAuthnCredential(ctx context.Context, id []byte) (*user.WebAuthnCredential, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return nil, user.ErrWebAuthnCredentialNotFound
+	}
+
+	cp := *r.records[i]
+	return &cp, nil
+}
+
+// ListWebAuthnCredentials 获取用户的全部凭据
+func (r *memoryWebAuthnCredentialRepository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]*user.WebAuthnCredential, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var list []*user.WebAuthnCredential
+	for _, v := range r.records {
+		if v.UserID == userID {
+			cp := *v
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+// UseWebAuthnCredential 更新签名计数与最近使用时间
+func (r *memoryWebAuthnCredentialRepository) UseWebAuthnCredential(ctx context.Context, id []byte, signCount uint32, backupState bool, usedAt time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return user.ErrWebAuthnCredentialNotFound
+	}
+
+	r.records[i].SignCount = signCount
+	r.records[i].BackupState = backupState
+	r.records[i].LastUsedAt = usedAt
+	return nil
+}
+
+// RenameWebAuthnCredential 修改凭据名称
+func (r *memoryWebAuthnCredentialRepository) RenameWebAuthnCredential(ctx context.Context, userID string, id []byte, name string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	i := r.find(id)
+	if i < 0 || r.records[i].UserID != userID {
+		return user.ErrWebAuthnCredentialNotFound
+	}
+
+	r.records[i].Name = name
+	return nil
+}
+
+// DeleteWebAuthnCredential 删除凭据
+func (r *memoryWebAuthnCredentialRepository) DeleteWebAuthnCredential(ctx context.Context, userID string, id []byte) error {
+	r.Lock()
+	defer r.Unlock()
+
+	i := r.find(id)
+	if i < 0 || r.records[i].UserID != userID {
+		return user.ErrWebAuthnCredentialNotFound
+	}
+
+	r.records = slices.Delete(r.records, i, i+1)
+	return nil
+}
+
+// find 查找凭据的下标,不存在时返回 -1,调用方须持有锁
+func (r *memoryWebAuthnCredentialRepository) find(id []byte) int {
+	return slices.IndexFunc(r.records, func(v *user.WebAuthnCredential) bool {
+		return bytes.Equal(v.ID, id)
+	})
+}
+
+// webAuthnCredentialModel WebAuthn 凭据表
+// 凭据ID以 base64url 编码保存,便于建立索引
+type webAuthnCredentialModel struct {
+	ID                string `gorm:"primaryKey;size:512"`
+	UserID            string `gorm:"size:64;not null;index"`
+	Name              string `gorm:"size:64"`
+	PublicKey         []byte `gorm:"not null"`
+	AttestationFormat string `gorm:"size:32"`
+	AAGUID            []byte
+	Transports        string `gorm:"size:128"` // 以空格分隔
+	SignCount         uint32 `gorm:"not null;default:0"`
+	BackupEligible    bool   `gorm:"not null;default:false"`
+	BackupState       bool   `gorm:"not null;default:false"`
+	CreatedAt         time.Time
+	LastUsedAt        *time.Time
+}
+
+// TableName WebAuthn 凭据表名
+func (webAuthnCredentialModel) TableName() string {
+	return "user_webauthn_credentials"
+}
+
+// toCredential 转换为领域对象
+func (m *webAuthnCredentialModel) toCredential() (*user.WebAuthnCredential, error) {
+
+	id, err := base64.RawURLEncoding.DecodeString(m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &user.WebAuthnCredential{
+		ID:                id,
+		UserID:            m.UserID,
+		Name:              m.Name,
+		PublicKey:         m.PublicKey,
+		AttestationFormat: m.AttestationFormat,
+		AAGUID:            m.AAGUID,
+		Transports:        strings.Fields(m.Transports),
+		SignCount:         m.SignCount,
+		BackupEligible:    m.BackupEligible,
+		BackupState:       m.BackupState,
+		CreatedAt:         m.CreatedAt,
+	}
+	if m.LastUsedAt != nil {
+		c.LastUsedAt = *m.LastUsedAt
+	}
+
+	return c, nil
+}
+
+// gormWebAuthnCredentialRepository 数据库 WebAuthn 凭据仓储
+type gormWebAuthnCredentialRepository struct {
+	db *gorm.DB
+}
+
+// SaveWebAuthnCredential 保存凭据
+func (r *gormWebAuthnCredentialRepository) SaveWebAuthnCredential(ctx context.Context, c *user.WebAuthnCredential) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		id := base64.RawURLEncoding.EncodeToString(c.ID)
+
+		var count int64
+		if err := tx.Model(&webAuthnCredentialModel{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return user.ErrWebAuthnCredentialExist
+		}
+
+		return tx.Create(&webAuthnCredentialModel{
+			ID:                id,
+			UserID:            c.UserID,
+			Name:              c.Name,
+			PublicKey:         c.PublicKey,
+			AttestationFormat: c.AttestationFormat,
+			AAGUID:            c.AAGUID,
+			Transports:        strings.Join(c.Transports, " "),
+			SignCount:         c.SignCount,
+			BackupEligible:    c.BackupEligible,
+			BackupState:       c.BackupState,
+			CreatedAt:         c.CreatedAt,
+		}).Error
+	})
+}
+
+// GetWebAuthnCredential 获取凭据
+func (r *gormWebAuthnCredentialRepository) GetWebAuthnCredential(ctx context.Context, id []byte) (*user.WebAuthnCredential, error) {
+
+	var m webAuthnCredentialModel
+	err := r.db.WithContext(ctx).Where("id = ?", base64.RawURLEncoding.EncodeToString(id)).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, user.ErrWebAuthnCredentialNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.toCredential()
+}
+
+// ListWebAuthnCredentials 获取用户的全部凭据
+func (r *gormWebAuthnCredentialRepository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]*user.WebAuthnCredential, error) {
+
+	var models []webAuthnCredentialModel
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	list := make([]*user.WebAuthnCredential, 0, len(models))
+	for i := range models {
+		c, err := models[i].toCredential()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+
+	return list, nil
+}
+
+// UseWebAuthnCredential 更新签名计数与最近使用时间
+func (r *gormWebAuthnCredentialRepository) UseWebAuthnCredential(ctx context.Context, id []byte, signCount uint32, backupState bool, usedAt time.Time) error {
+
+	res := r.db.WithContext(ctx).Model(&webAuthnCredentialModel{}).
+		Where("id = ?", base64.RawURLEncoding.EncodeToString(id)).
+		Updates(map[string]any{"sign_count": signCount, "backup_state": backupState, "last_used_at": usedAt})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return user.ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// RenameWebAuthnCredential 修改凭据名称
+func (r *gormWebAuthnCredentialRepository) RenameWebAuthnCredential(ctx context.Context, userID string, id []byte, name string) error {
+
+	res := r.db.WithContext(ctx).Model(&webAuthnCredentialModel{}).
+		Where("id = ? AND user_id = ?", base64.RawURLEncoding.EncodeToString(id), userID).
+		Update("name", name)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	// MySQL 默认只统计值有变化的行,名称未变时也会返回 0
+	var count int64
+	err := r.db.WithContext(ctx).Model(&webAuthnCredentialModel{}).
+		Where("id = ? AND user_id = ?", base64.RawURLEncoding.EncodeToString(id), userID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return user.ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential 删除凭据
+func (r *gormWebAuthnCredentialRepository) DeleteWebAuthnCredential(ctx context.Context, userID string, id []byte) error {
+
+	res := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", base64.RawURLEncoding.EncodeToString(id), userID).
+		Delete(&webAuthnCredentialModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return user.ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
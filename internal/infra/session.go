@@ -0,0 +1,84 @@
+package infra
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// SessionParams 创建登录会话的依赖
+// 未配置 database.driver 时不提供数据库连接,未配置 redis.addr 时不提供 Redis 连接
+type SessionParams struct {
+	fx.In
+
+	Config *configs.Session
+	DB     *gorm.DB      `optional:"true"`
+	Redis  *redis.Client `optional:"true"`
+	Logger *zap.Logger
+}
+
+// NewSession 按 session 配置创建登录会话
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	*session.Session: 登录会话
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+//	configs.ErrRedisNotConfigured: 使用 Redis 存储但未配置 Redis
+//	session.ErrInvalidKey: 签名或加密密钥长度不合法
+func NewSession(p SessionParams) (*session.Session, error) {
+
+	var backend session.Backend
+
+	switch p.Config.Store {
+	case configs.SessionStoreRedis:
+		if p.Redis == nil {
+			return nil, configs.ErrRedisNotConfigured
+		}
+		backend = session.NewRedisBackend(p.Redis, p.Config.KeyPrefix)
+	case configs.SessionStoreDatabase:
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		b, err := session.NewGormBackend(p.DB, p.Config.PurgeInterval)
+		if err != nil {
+			return nil, err
+		}
+		backend = b
+	default:
+		backend = session.NewMemoryBackend()
+	}
+
+	sameSite, err := p.Config.SameSiteMode()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := session.Options{
+		Name:     p.Config.Name,
+		MaxAge:   p.Config.MaxAge,
+		Path:     p.Config.Path,
+		Domain:   p.Config.Domain,
+		Secure:   p.Config.Secure,
+		SameSite: sameSite,
+	}
+	// 密钥按配置字符串的原始字节使用,不做 base64 解码
+	for _, k := range p.Config.HashKeys {
+		opts.HashKeys = append(opts.HashKeys, []byte(k))
+	}
+	for _, k := range p.Config.BlockKeys {
+		opts.BlockKeys = append(opts.BlockKeys, []byte(k))
+	}
+
+	return session.NewSession(opts, backend, p.Logger)
+}
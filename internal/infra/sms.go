@@ -0,0 +1,47 @@
+package infra
+
+import (
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/sms"
+	"go.uber.org/zap"
+)
+
+// NewSMSSender 按 sms.driver 创建短信发送者
+//
+// 参数:
+//
+//	cfg: 短信配置
+//	logger: 日志对象
+//
+// 返回值:
+//
+//	sms.Sender: 短信发送者
+func NewSMSSender(cfg *configs.SMS, logger *zap.Logger) sms.Sender {
+
+	switch cfg.Driver {
+	case configs.SMSDriverAliyun:
+		return sms.NewAliyunSender(sms.AliyunOptions{
+			AccessKeyID:     cfg.Aliyun.AccessKeyID,
+			AccessKeySecret: cfg.Aliyun.AccessKeySecret,
+			SignName:        cfg.SignName,
+			Templates:       cfg.Templates,
+			RegionID:        cfg.Aliyun.RegionID,
+			Endpoint:        cfg.Aliyun.Endpoint,
+			Timeout:         cfg.Timeout,
+		})
+	case configs.SMSDriverTencent:
+		return sms.NewTencentSender(sms.TencentOptions{
+			SecretID:  cfg.Tencent.SecretID,
+			SecretKey: cfg.Tencent.SecretKey,
+			SDKAppID:  cfg.Tencent.SDKAppID,
+			SignName:  cfg.SignName,
+			Templates: cfg.Templates,
+			Region:    cfg.Tencent.Region,
+			Endpoint:  cfg.Tencent.Endpoint,
+			Timeout:   cfg.Timeout,
+		})
+	default:
+		logger.Warn("sms is written to the log instead of being delivered, do not use in production")
+		return sms.NewMemorySender(logger)
+	}
+}
@@ -1,14 +1,18 @@
 package webapi
 
 import (
+	goauth2 "github.com/go-oauth2/oauth2/v4"
 	"github.com/xiaohangshuhub/xiaohangshu/configs"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/app"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/infra"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/ciba"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/client"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/oidc"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
-	"github.com/xiaohangshuhub/xiaohangshu/pkg/http"
-	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
 	"go.uber.org/fx"
 )
 
@@ -17,11 +21,22 @@ func DependencyInjection() []fx.Option {
 		fx.Provide(oauth2.NewManager),
 		fx.Provide(oauth2.NewOAuth2Service),
 		fx.Provide(oauth2.NewOAuth2Handlers),
-		fx.Provide(http.NewUserHTTPClient),
-		fx.Provide(client.NewMemoryClientStore),
+		fx.Provide(fx.Annotate(client.NewStore, fx.As(fx.Self()), fx.As(new(goauth2.ClientStore)))),
+		fx.Provide(keys.NewKeyStore),
+		fx.Provide(keys.NewProvider),
+		fx.Provide(token.NewAuthorizeGenerate),
 		fx.Provide(token.NewCustomJWTAccessGenerate),
-		fx.Provide(token.NewMemotyTokenStore),
-		fx.Provide(session.NewSession),
+		fx.Provide(oidc.NewEncrypter),
+		fx.Provide(oidc.NewService),
+		fx.Provide(fx.Annotate(token.NewTokenStore, fx.As(fx.Self()), fx.As(new(goauth2.TokenStore)))),
+		fx.Provide(token.NewFamilyStore),
+		fx.Provide(token.NewRefreshPolicy),
+		fx.Provide(audit.NewLogRecorder),
+		fx.Provide(sso.NewStore),
+		fx.Provide(sso.NewService),
+		fx.Provide(ciba.NewMemoryStore),
+		fx.Provide(ciba.NewNotifier),
+		fx.Provide(ciba.NewService),
 	}
 
 	di = append(di, configs.DependencyInjection()...)
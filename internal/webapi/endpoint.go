@@ -6,6 +6,15 @@ import (
 	"github.com/xiaohangshuhub/xiaohangshu/configs"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/handler"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/ciba"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/client"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/oidc"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/middleware"
 	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
 	"go.uber.org/zap"
 )
@@ -17,35 +26,106 @@ func login(r *gin.Engine) {
 		// 加载登录页面
 		ctx.File("../../web/dist/index.html")
 	})
+
+	// 注册、找回密码、联系方式验证、两步验证页面与登录页面为同一单页应用
+	for _, path := range []string{"/register", "/forgot-password", "/reset-password", "/verify", "/mfa"} {
+		r.GET(path, func(ctx *gin.Context) {
+			ctx.File("../../web/dist/index.html")
+		})
+	}
 }
 
 // 授权端口:V1
-func authApiV1EndPoint(r *gin.Engine, srv *server.Server, cfg *configs.OAuth2, session *session.Session, logger *zap.Logger) {
+func authApiV1EndPoint(r *gin.Engine, srv *server.Server, mgr *oauth2.Manager, cfg *configs.OAuth2, users *configs.User, cibaSvc *ciba.Service, keyProvider keys.Provider, idTokens *oidc.Service, session *session.Session, sessions *sso.Service, userApp *user.UserApp, logger *zap.Logger) {
 
 	connect := r.Group("connect")
 	{
 		connect.GET("authorize", handler.Authorize(srv, session, logger))
-		connect.POST("token", handler.Token(srv, logger))
-		connect.GET("userinfo", handler.Userinfo(logger))
-		connect.GET("introspect", handler.Introspect(logger))
-		connect.GET("revoke", handler.Revoke(logger))
+		connect.POST("token", handler.Token(srv, cibaSvc, logger))
+		connect.GET("userinfo", handler.Userinfo(srv, idTokens, logger))
+		connect.POST("userinfo", handler.Userinfo(srv, idTokens, logger))
+
+		if cfg.Endpoints.Introspection {
+			connect.POST("introspect", handler.Introspect(mgr, cfg, logger))
+		}
+		if cfg.Endpoints.Revocation {
+			connect.POST("revoke", handler.Revoke(mgr, logger))
+		}
+		if cfg.Endpoints.EndSession {
+			connect.GET("endsession", handler.EndSession(cfg, keyProvider, session, sessions, userApp, logger))
+			connect.POST("endsession", handler.EndSession(cfg, keyProvider, session, sessions, userApp, logger))
+		}
+
+		if cibaSvc.Enabled() {
+			connect.POST("ciba", handler.Backchannel(cibaSvc, logger))
+			connect.POST("ciba/complete", handler.BackchannelComplete(cibaSvc, session, sessions, logger))
+		}
 	}
 
 	wellknownGroup := r.Group(".well-known")
 	{
-		wellknownGroup.GET("openid-configuration/jwks", handler.Jwks(cfg, logger))
-		wellknownGroup.GET("openid-configuration", handler.OpenidConfiguration(cfg, logger))
+		wellknownGroup.GET("openid-configuration/jwks", handler.Jwks(keyProvider, logger))
+		wellknownGroup.GET("openid-configuration", handler.OpenidConfiguration(cfg, users, srv, keyProvider, logger))
 	}
 
 }
 
 // 用户端口:V1
-func userApiV1EndPoint(r *gin.Engine, userApp *user.UserApp, session *session.Session, logger *zap.Logger) {
+func userApiV1EndPoint(r *gin.Engine, users *configs.User, userApp *user.UserApp, session *session.Session, sessions *sso.Service, logger *zap.Logger) {
 
 	user := r.Group("/api/v1/user/")
 	{
-		user.POST("login", handler.Login(session, userApp, logger))
-		user.POST("logout", handler.Logout(session, userApp, logger))
+		user.POST("login", handler.Login(session, sessions, users, userApp, logger))
+		user.POST("login/mfa", handler.LoginMFA(session, sessions, userApp, logger))
+		user.POST("login/recovery", handler.LoginRecovery(session, sessions, userApp, logger))
+		user.POST("login/webauthn/options", handler.BeginWebAuthnLogin(session, userApp, logger))
+		user.POST("login/webauthn", handler.FinishWebAuthnLogin(session, sessions, userApp, logger))
+		user.POST("login/sms/code", handler.SendSMSLoginCode(userApp, logger))
+		user.POST("login/sms", handler.LoginSMS(session, sessions, users, userApp, logger))
+		user.POST("register", handler.Register(session, sessions, userApp, logger))
+		user.POST("password/forgot", handler.ForgotPassword(userApp, logger))
+		user.POST("password/reset", handler.ResetPassword(session, sessions, userApp, logger))
+		user.POST("logout", handler.Logout(session, sessions, userApp, logger))
+		user.GET("verification", handler.GetVerification(session, sessions, userApp, logger))
+		user.POST("verification/email", handler.SendEmailVerification(session, sessions, userApp, logger))
+		user.POST("verification/email/confirm", handler.ConfirmEmailVerification(session, userApp, logger))
+		user.POST("verification/phone", handler.SendPhoneVerification(session, sessions, userApp, logger))
+		user.POST("verification/phone/confirm", handler.ConfirmPhoneVerification(session, sessions, userApp, logger))
+		user.GET("mfa", handler.GetMFA(session, sessions, userApp, logger))
+		user.POST("mfa/verify", handler.VerifyMFA(session, sessions, userApp, logger))
+		user.POST("mfa/totp", handler.BeginTOTP(session, sessions, userApp, logger))
+		user.POST("mfa/totp/confirm", handler.ConfirmTOTP(session, sessions, userApp, logger))
+		user.DELETE("mfa/totp", handler.DisableTOTP(session, sessions, userApp, logger))
+		user.POST("mfa/recovery", handler.VerifyRecoveryCode(session, sessions, userApp, logger))
+		user.POST("mfa/recovery-codes", handler.GenerateRecoveryCodes(session, sessions, userApp, logger))
+		user.GET("mfa/factors", handler.MFAFactors(session, sessions, userApp, logger))
+		user.PATCH("mfa/factors/:id", handler.RenameMFAFactor(session, sessions, userApp, logger))
+		user.DELETE("mfa/factors/:id", handler.RemoveMFAFactor(session, sessions, userApp, logger))
+		user.POST("mfa/webauthn/options", handler.BeginWebAuthnStepUp(session, sessions, userApp, logger))
+		user.POST("mfa/webauthn", handler.FinishWebAuthnStepUp(session, sessions, userApp, logger))
+		user.GET("webauthn/credentials", handler.WebAuthnCredentials(session, sessions, userApp, logger))
+		user.POST("webauthn/credentials/options", handler.BeginWebAuthnRegistration(session, sessions, userApp, logger))
+		user.POST("webauthn/credentials", handler.FinishWebAuthnRegistration(session, sessions, userApp, logger))
+		user.PATCH("webauthn/credentials/:id", handler.RenameWebAuthnCredential(session, sessions, userApp, logger))
+		user.DELETE("webauthn/credentials/:id", handler.DeleteWebAuthnCredential(session, sessions, userApp, logger))
+		user.GET("sessions", handler.ListMySessions(session, sessions, logger))
+		user.DELETE("sessions/:sid", handler.RevokeMySession(session, sessions, logger))
+	}
+}
+
+// 管理端口:V1
+// 调用方须使用包含管理权限范围的访问令牌,通常通过 client_credentials 获取;代表用户的令牌须经两步验证签发
+func adminApiV1EndPoint(r *gin.Engine, srv *server.Server, cfg *configs.OAuth2, store client.Store, sessions *sso.Service, userApp *user.UserApp, recorder audit.Recorder, logger *zap.Logger) {
+
+	admin := r.Group("/api/v1/admin/", middleware.JWTBearer(srv.ValidationBearerToken, cfg.AdminScope), middleware.RequireUserACR(token.ACRMultiFactor))
+	{
+		admin.GET("clients/:id/secrets", handler.ListClientSecrets(store, logger))
+		admin.POST("clients/:id/secrets", handler.AddClientSecret(store, recorder, logger))
+		admin.DELETE("clients/:id/secrets/:secret_id", handler.RetireClientSecret(store, recorder, logger))
+		admin.GET("users/:id/sessions", handler.ListUserSessions(sessions, logger))
+		admin.DELETE("users/:id/sessions/:sid", handler.RevokeUserSession(sessions, logger))
+		admin.POST("users/:id/password-reset", handler.SendPasswordReset(userApp, logger))
+		admin.POST("users/:id/mfa/reset", handler.ResetUserMFA(userApp, logger))
 	}
 }
 
@@ -53,4 +133,5 @@ var EndPointList = []any{
 	login,
 	authApiV1EndPoint,
 	userApiV1EndPoint,
+	adminApiV1EndPoint,
 }
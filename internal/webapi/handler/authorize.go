@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"errors"
+	"net/http"
 	"net/url"
 
 	"github.com/gin-gonic/gin"
+	oerrors "github.com/go-oauth2/oauth2/v4/errors"
 	"github.com/go-oauth2/oauth2/v4/server"
 	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
 	"go.uber.org/zap"
@@ -16,26 +19,37 @@ import (
 // @Accept json
 // @Produce json
 // @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
 // @Router /connect/authorize [get]
-func Authorize(srv *server.Server, session *session.Session, log *zap.Logger) gin.HandlerFunc {
+func Authorize(srv *server.Server, seesion *session.Session, log *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		w := c.Writer
 		r := c.Request
 
-		if v, _ := session.Get(r, "authorize_form"); v != nil {
+		if v, _ := seesion.Get(r, session.AuthorizeFormKey); v != nil {
 			r.ParseForm()
 			if r.Form.Get("client_id") == "" {
 				r.Form = v.(url.Values)
 			}
 		}
 
-		if err := session.Delete(w, r, "authorize_form"); err != nil {
+		if err := seesion.Delete(w, r, session.AuthorizeFormKey); err != nil {
 			log.Error("delete request form error", zap.Error(err))
 			return
 		}
 
 		if err := srv.HandleAuthorizeRequest(w, r); err != nil {
+
+			// 跳转地址未注册时不能重定向,直接返回错误(RFC 6749 4.1.2.1)
+			if errors.Is(err, oerrors.ErrInvalidRedirectURI) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":             "invalid_request",
+					"error_description": "The redirect_uri is missing or not registered for this client",
+				})
+				return
+			}
+
 			c.JSON(500, ErrorResponse{Error: err.Error()})
 			return
 		}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/ciba"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// BackchannelAuthenticationResponse 后端认证响应
+type BackchannelAuthenticationResponse struct {
+	AuthReqID string `json:"auth_req_id"`
+	ExpiresIn int64  `json:"expires_in"`
+	Interval  int64  `json:"interval,omitempty"`
+}
+
+// BackchannelCompleteRequest 认证设备确认请求
+type BackchannelCompleteRequest struct {
+	AuthReqID string `json:"auth_req_id" binding:"required"`
+	Approved  bool   `json:"approved"`
+}
+
+// Backchannel godoc
+// @Summary Backchannel Authentication
+// @Description CIBA 后端认证端点,由客户端发起,用户在认证设备上确认
+// @Tags OAuth2
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Success 200 {object} BackchannelAuthenticationResponse
+// @Failure 400 {object} map[string]interface{}
+// @Router /connect/ciba [post]
+func Backchannel(svc *ciba.Service, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		req, err := svc.Authenticate(c.Request)
+		if err != nil {
+			log.Error("backchannel authentication error", zap.Error(err))
+			cibaError(c, err)
+			return
+		}
+
+		data := BackchannelAuthenticationResponse{
+			AuthReqID: req.ID,
+			ExpiresIn: int64(time.Until(req.ExpiresAt) / time.Second),
+		}
+		if req.DeliveryMode != ciba.Push {
+			data.Interval = int64(req.Interval / time.Second)
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, data)
+	}
+}
+
+// BackchannelComplete godoc
+// @Summary Backchannel Authentication Complete
+// @Description 认证设备上的用户确认或拒绝 CIBA 认证请求
+// @Tags OAuth2
+// @Accept json
+// @Produce json
+// @Param body body BackchannelCompleteRequest true "确认信息"
+// @Success 200 {object} response.Response[string]
+// @Router /connect/ciba/complete [post]
+func BackchannelComplete(svc *ciba.Service, session *session.Session, sessions *sso.Service, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &BackchannelCompleteRequest{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			log.Error("bind json failed", zap.Error(err))
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		sess, err := currentSession(c, session, sessions)
+		if err != nil {
+			log.Error("get login session failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+		if sess == nil {
+			c.JSON(http.StatusUnauthorized, response.Unauthorized())
+			return
+		}
+
+		if err := svc.Complete(c, param.AuthReqID, sess.UserID, sess.AMR, param.Approved); err != nil {
+			log.Error("backchannel authentication complete error", zap.Error(err))
+			cibaError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success("ok"))
+	}
+}
+
+// cibaError 输出 CIBA 错误响应
+func cibaError(c *gin.Context, err error) {
+	re := ciba.NewErrorResponse(err)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(re.StatusCode, gin.H{
+		"error":             re.Error.Error(),
+		"error_description": re.Description,
+	})
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/client"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/middleware"
+	"go.uber.org/zap"
+)
+
+type (
+
+	// AddClientSecretRequest 添加客户端密钥请求
+	AddClientSecretRequest struct {
+		ExpiresAt *time.Time `json:"expires_at,omitempty"` // 过期时间(RFC 3339),不填表示不过期
+	}
+
+	// AddClientSecretResponse 添加客户端密钥响应,明文密钥只返回这一次
+	AddClientSecretResponse struct {
+		*client.Secret
+		ClientSecret string `json:"client_secret"` // 明文密钥
+	}
+
+	// ClientSecretInfo 客户端密钥信息,不包含哈希
+	ClientSecretInfo struct {
+		*client.Secret
+		Active bool `json:"active"` // 当前是否可用于认证
+	}
+)
+
+// ListClientSecrets godoc
+// @Summary ListClientSecrets
+// @Description 列出客户端密钥,只返回元数据
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer 访问令牌,须包含管理权限范围"
+// @Param id path string true "客户端ID"
+// @Success 200 {object} response.Response[[]ClientSecretInfo]
+// @Router /api/v1/admin/clients/{id}/secrets [get]
+func ListClientSecrets(store client.Store, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		cli, err := store.Get(c, c.Param("id"))
+		if err != nil {
+			clientStoreError(c, err, log)
+			return
+		}
+
+		now := time.Now()
+		data := make([]ClientSecretInfo, 0, len(cli.Secrets))
+		for _, v := range cli.Secrets {
+			data = append(data, ClientSecretInfo{Secret: v, Active: v.Active(now)})
+		}
+
+		c.JSON(http.StatusOK, response.Success(data))
+	}
+}
+
+// AddClientSecret godoc
+// @Summary AddClientSecret
+// @Description 为客户端生成新密钥,旧密钥继续有效,便于不停机轮换;明文密钥只在响应中返回一次
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer 访问令牌,须包含管理权限范围"
+// @Param id path string true "客户端ID"
+// @Param body body AddClientSecretRequest false "过期时间"
+// @Success 200 {object} response.Response[AddClientSecretResponse]
+// @Router /api/v1/admin/clients/{id}/secrets [post]
+func AddClientSecret(store client.Store, recorder audit.Recorder, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &AddClientSecretRequest{}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(param); err != nil {
+				c.JSON(http.StatusBadRequest, response.BadRequest())
+				return
+			}
+		}
+
+		var expiresAt time.Time
+		if param.ExpiresAt != nil {
+			if !param.ExpiresAt.After(time.Now()) {
+				c.JSON(http.StatusBadRequest, response.BadRequest("expires_at 必须晚于当前时间"))
+				return
+			}
+			expiresAt = *param.ExpiresAt
+		}
+
+		secret, plain, err := client.NewSecret(expiresAt)
+		if err != nil {
+			log.Error("generate client secret failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		clientID := c.Param("id")
+		if err := store.AddSecret(c, clientID, secret); err != nil {
+			clientStoreError(c, err, log)
+			return
+		}
+
+		recorder.Record(c, &audit.Event{
+			Type:     audit.ClientSecretAdded,
+			ClientID: clientID,
+			Detail:   map[string]string{"secret_id": secret.ID, "operator": middleware.TokenInfo(c).GetClientID()},
+		})
+
+		c.JSON(http.StatusOK, response.Success(AddClientSecretResponse{Secret: secret, ClientSecret: plain}))
+	}
+}
+
+// RetireClientSecret godoc
+// @Summary RetireClientSecret
+// @Description 撤销客户端密钥;可指定宽限期,期满后密钥失效,期间新旧密钥同时可用
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer 访问令牌,须包含管理权限范围"
+// @Param id path string true "客户端ID"
+// @Param secret_id path string true "密钥ID"
+// @Param grace query string false "宽限期,如 24h; 不填表示立即失效"
+// @Success 200 {object} response.Response[string]
+// @Router /api/v1/admin/clients/{id}/secrets/{secret_id} [delete]
+func RetireClientSecret(store client.Store, recorder audit.Recorder, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var grace time.Duration
+		if v := c.Query("grace"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				c.JSON(http.StatusBadRequest, response.BadRequest("grace 格式错误"))
+				return
+			}
+			grace = d
+		}
+
+		clientID, secretID := c.Param("id"), c.Param("secret_id")
+		expiresAt := time.Now().Add(grace)
+
+		if err := store.RetireSecret(c, clientID, secretID, expiresAt); err != nil {
+			clientStoreError(c, err, log)
+			return
+		}
+
+		recorder.Record(c, &audit.Event{
+			Type:     audit.ClientSecretRetired,
+			ClientID: clientID,
+			Detail: map[string]string{
+				"secret_id":  secretID,
+				"expires_at": expiresAt.Format(time.RFC3339),
+				"operator":   middleware.TokenInfo(c).GetClientID(),
+			},
+		})
+
+		c.JSON(http.StatusOK, response.Success("retired"))
+	}
+}
+
+// clientStoreError 输出客户端存储错误
+func clientStoreError(c *gin.Context, err error, log *zap.Logger) {
+	switch {
+	case errors.Is(err, client.ErrClientNotFound):
+		c.JSON(http.StatusNotFound, response.NotFound("客户端不存在"))
+	case errors.Is(err, client.ErrSecretNotFound):
+		c.JSON(http.StatusNotFound, response.NotFound("密钥不存在"))
+	case errors.Is(err, client.ErrPublicClient):
+		c.JSON(http.StatusBadRequest, response.BadRequest("公开客户端不能添加密钥"))
+	default:
+		log.Error("client store error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	oerrors "github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// EndSession godoc
+// @Summary End Session
+// @Description RP 发起的登出,清除用户登录会话;post_logout_redirect_uri 须为客户端注册过的地址
+// @Description 须携带本服务签发给该用户的 id_token_hint(可以已过期),避免第三方页面诱导浏览器登出用户
+// @Tags OAuth2
+// @Produce json
+// @Param id_token_hint query string true "之前签发的 ID Token"
+// @Param client_id query string false "客户端ID,须在 id_token_hint 的 aud 中;省略时取 aud"
+// @Param post_logout_redirect_uri query string false "登出后跳转地址"
+// @Param state query string false "原样回传给客户端的状态值"
+// @Success 200 {object} map[string]interface{}
+// @Success 302
+// @Failure 400 {object} map[string]string
+// @Router /connect/endsession [get]
+func EndSession(cfg *configs.OAuth2, keyProvider keys.Provider, seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		// ID Token 只允许本服务签发,签名校验通过即可确认登出由持有该用户令牌的客户端发起;已过期的 ID Token 同样可用
+		hint := &jwt.RegisteredClaims{}
+		err := keys.ParseJWT(c, keyProvider, c.Request.FormValue("id_token_hint"), hint, jwt.WithoutClaimsValidation())
+		if err != nil || hint.Issuer != cfg.Issuer || hint.Subject == "" || len(hint.Audience) == 0 {
+			log.Warn("end session error: id_token_hint is invalid", zap.Error(err))
+			oauthError(c, oerrors.ErrInvalidRequest)
+			return
+		}
+
+		clientID := c.Request.FormValue("client_id")
+		if clientID == "" {
+			clientID = hint.Audience[0]
+		}
+		if !slices.Contains(hint.Audience, clientID) {
+			log.Warn("end session error: client_id is not an audience of id_token_hint", zap.String("client_id", clientID))
+			oauthError(c, oerrors.ErrInvalidRequest)
+			return
+		}
+
+		redirectURI := c.Request.FormValue("post_logout_redirect_uri")
+
+		// 先校验跳转地址,避免开放重定向
+		var u *url.URL
+		if redirectURI != "" {
+			client, err := cfg.GetClient(clientID)
+			if err == nil && client.ContainsPostLogoutRedirectURI(redirectURI) {
+				u, err = url.Parse(redirectURI)
+			}
+			if err != nil || u == nil {
+				log.Error("end session error: post_logout_redirect_uri is invalid", zap.String("post_logout_redirect_uri", redirectURI))
+				oauthError(c, oerrors.ErrInvalidRequest)
+				return
+			}
+		}
+
+		userid, err := seesion.Get(c.Request, userIdTag)
+		if err != nil {
+			log.Error("get user id from session failed", zap.Error(err))
+		}
+
+		// 浏览器当前登录的是其他用户时不登出
+		if userid != nil && userid.(string) != hint.Subject {
+			log.Warn("end session error: id_token_hint subject does not match the session user")
+			oauthError(c, oerrors.ErrInvalidRequest)
+			return
+		}
+
+		if userid != nil {
+			userApp.LogoutHandler.Handle(c, &user.Logout{UserId: userid.(string)})
+		}
+
+		if sid, _ := seesion.Get(c.Request, session.SIDKey); sid != nil {
+			if err := sessions.End(c, sid.(string)); err != nil {
+				log.Error("end login session failed", zap.Error(err))
+			}
+		}
+
+		if err := seesion.Clear(c.Writer, c.Request); err != nil {
+			log.Error("clear session failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "logout error"})
+			return
+		}
+
+		if u == nil {
+			c.JSON(http.StatusOK, response.Success("logout success"))
+			return
+		}
+
+		if state := c.Request.FormValue("state"); state != "" {
+			q := u.Query()
+			q.Set("state", state)
+			u.RawQuery = q.Encode()
+		}
+
+		c.Redirect(http.StatusFound, u.String())
+	}
+}
@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/middleware"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// MFAFactors godoc
+// @Summary MFAFactors
+// @Description 获取当前用户已绑定的验证方式(认证器应用与安全密钥),须当前会话已完成两步验证
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[[]user.MFAFactorDTO]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Router /api/v1/user/mfa/factors [get]
+func MFAFactors(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireMultiFactor(c, seesion, sessions, userApp, log)
+		if !ok {
+			return
+		}
+
+		data, err := userApp.MFAHandler.Factors(c, current.UserID)
+		if err != nil {
+			mfaError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(data))
+	}
+}
+
+// RenameMFAFactor godoc
+// @Summary RenameMFAFactor
+// @Description 修改验证方式的名称,须当前会话已完成两步验证
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param id path string true "验证方式ID"
+// @Param body body user.MFAFactorRename true "名称"
+// @Success 200 {object} response.Response[any]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 404 {object} response.Response[any]
+// @Router /api/v1/user/mfa/factors/{id} [patch]
+func RenameMFAFactor(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireMultiFactor(c, seesion, sessions, userApp, log)
+		if !ok {
+			return
+		}
+
+		param := &user.MFAFactorRename{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		if err := userApp.MFAHandler.RenameFactor(c, current.UserID, c.Param("id"), param.Name); err != nil {
+			mfaError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success[any](nil))
+	}
+}
+
+// RemoveMFAFactor godoc
+// @Summary RemoveMFAFactor
+// @Description 移除验证方式,须在 user.mfa.reauth_window 内完成过两步验证;用户须两步验证时不能移除最后一个验证方式,移除最后一个时恢复码一并删除
+// @Tags User
+// @Produce json
+// @Param id path string true "验证方式ID"
+// @Success 200 {object} response.Response[MFAResponse]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 404 {object} response.Response[any]
+// @Router /api/v1/user/mfa/factors/{id} [delete]
+func RemoveMFAFactor(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireReauth(c, seesion, sessions, userApp, log)
+		if !ok {
+			return
+		}
+
+		if err := userApp.MFAHandler.RemoveFactor(c, current.UserID, c.Param("id")); err != nil {
+			mfaError(c, err, log)
+			return
+		}
+
+		mfaStatus(c, seesion, current, userApp, log)
+	}
+}
+
+// GenerateRecoveryCodes godoc
+// @Summary GenerateRecoveryCodes
+// @Description 生成新的恢复码,之前的恢复码全部失效;恢复码只在本次响应中返回,须在 user.mfa.reauth_window 内完成过两步验证
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[user.RecoveryCodesDTO]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Router /api/v1/user/mfa/recovery-codes [post]
+func GenerateRecoveryCodes(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireReauth(c, seesion, sessions, userApp, log)
+		if !ok {
+			return
+		}
+
+		data, err := userApp.MFAHandler.GenerateRecoveryCodes(c, current.UserID)
+		if err != nil {
+			recoveryError(c, err, log)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response.Success(data))
+	}
+}
+
+// VerifyRecoveryCode godoc
+// @Summary VerifyRecoveryCode
+// @Description 已登录但未完成两步验证的会话提交恢复码补充验证,恢复码使用后失效
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.RecoveryCode true "恢复码"
+// @Success 200 {object} response.Response[MFAResponse]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/mfa/recovery [post]
+func VerifyRecoveryCode(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		param := &user.RecoveryCode{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		if _, err := userApp.MFAHandler.VerifyRecoveryCode(c, current.UserID, param.Code); err != nil {
+			recoveryError(c, err, log)
+			return
+		}
+
+		if err := stepUp(c, seesion, sessions, current, "otp"); err != nil {
+			log.Error("step up login session failed", zap.String("sid", current.SID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		mfaStatus(c, seesion, current, userApp, log)
+	}
+}
+
+// LoginRecovery godoc
+// @Summary LoginRecovery
+// @Description 登录第二步,丢失认证器应用或安全密钥时提交恢复码;恢复码使用后失效,成功后会话的认证方式为 pwd otp,第一步为短信验证码时为 sms otp
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.RecoveryCode true "恢复码"
+// @Success 200 {object} response.Response[user.UserInfoDTO]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/login/recovery [post]
+func LoginRecovery(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.RecoveryCode{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		userID, ok := pendingMFAUser(c, seesion)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, response.Unauthorized("登录已超时，请重新输入密码"))
+			return
+		}
+
+		if _, err := userApp.MFAHandler.VerifyRecoveryCode(c, userID, param.Code); err != nil {
+			recoveryError(c, err, logger)
+			return
+		}
+
+		completeLogin(c, seesion, sessions, userApp, userID, secondFactorAMR(c, seesion, "otp"), logger)
+	}
+}
+
+// ResetUserMFA godoc
+// @Summary ResetUserMFA
+// @Description 重置用户的两步验证,删除认证器应用、全部安全密钥与恢复码,用于用户丢失全部验证方式;操作记录到安全事件
+// @Tags Admin
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 404 {object} response.Response[any]
+// @Router /api/v1/admin/users/{id}/mfa/reset [post]
+func ResetUserMFA(userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ti := middleware.TokenInfo(c)
+		operator := ti.GetClientID()
+		if ti.GetUserID() != "" {
+			operator = ti.GetUserID()
+		}
+
+		err := userApp.MFAHandler.Reset(c, c.Param("id"), operator)
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, response.Success[any](nil))
+		case errors.Is(err, domainuser.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, response.NotFound("用户不存在"))
+		default:
+			logger.Error("reset mfa failed", zap.String("user_id", c.Param("id")), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+		}
+	}
+}
+
+// requireReauth 敏感操作前校验会话:已绑定两步验证的用户须在 user.mfa.reauth_window 内完成过两步验证,
+// 超出时返回 403,前端引导重新验证(一次性密码、安全密钥或恢复码)后重试
+func requireReauth(c *gin.Context, seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) (*sso.Session, bool) {
+
+	current, ok := requireMultiFactor(c, seesion, sessions, userApp, log)
+	if !ok {
+		return nil, false
+	}
+
+	// 尚未绑定任何验证方式的用户只有密码会话,由 requireMultiFactor 放行
+	if token.ACRForAMR(current.AMR) != token.ACRMultiFactor {
+		return current, true
+	}
+
+	v, _ := seesion.Get(c.Request, session.AuthTimeKey)
+	authTime, _ := v.(int64)
+	if authTime == 0 || !userApp.MFAHandler.Fresh(time.Unix(authTime, 0)) {
+		c.JSON(http.StatusForbidden, response.Forbidden("请重新完成两步验证"))
+		return nil, false
+	}
+
+	return current, true
+}
+
+// recoveryError 输出恢复码错误,其余错误同两步验证
+func recoveryError(c *gin.Context, err error, log *zap.Logger) {
+	if errors.Is(err, user.ErrMFANotEnrolled) {
+		c.JSON(http.StatusBadRequest, response.BadRequest("未绑定认证器应用或安全密钥"))
+		return
+	}
+
+	mfaError(c, err, log)
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/infra/repoimpl"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/ratelimit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// newTestMFAApp 创建只包含两步验证处理者的用户应用,用户 1 已绑定认证器应用,用户 2 未绑定
+func newTestMFAApp(t *testing.T) (*user.UserApp, *configs.User) {
+	t.Helper()
+
+	logger := zap.NewNop()
+
+	cfg, err := configs.NewUser(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Users = []*configs.SeedUser{
+		{ID: "1", Username: "alice", Password: "alice-password"},
+		{ID: "2", Username: "bob", Password: "bob-password"},
+	}
+
+	repo, err := repoimpl.NewUserRepository(repoimpl.UserRepositoryParams{Config: cfg, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	totps, err := repoimpl.NewTOTPRepository(repoimpl.TOTPRepositoryParams{Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := repoimpl.NewWebAuthnCredentialRepository(repoimpl.WebAuthnCredentialRepositoryParams{Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveries, err := repoimpl.NewRecoveryCodeRepository(repoimpl.RecoveryCodeRepositoryParams{Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = totps.SaveTOTP(context.Background(), &domainuser.TOTP{UserID: "1", Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", Confirmed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mfa := user.NewMFAHandler(cfg, repo, totps, credentials, recoveries, ratelimit.NewMemoryLimiter(), audit.NewLogRecorder(logger), logger)
+	return &user.UserApp{MFAHandler: mfa}, cfg
+}
+
+func TestRequireReauth(t *testing.T) {
+
+	sess, sessions := newTestSessions(t)
+	userApp, cfg := newTestMFAApp(t)
+	logger := zap.NewNop()
+
+	tests := []struct {
+		name     string
+		userID   string
+		amr      string
+		authTime time.Duration // 距上次认证的时长
+		status   int           // 拒绝时的状态码,为 0 表示放行
+	}{
+		{"mfa session within window", "1", "pwd otp", 0, 0},
+		{"mfa session outside window", "1", "pwd otp", cfg.MFA.ReauthWindow + time.Minute, http.StatusForbidden},
+		{"password session of enrolled user", "1", "pwd", 0, http.StatusForbidden},
+		{"password session of user without mfa", "2", "pwd", cfg.MFA.ReauthWindow + time.Minute, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			cookies := testSignIn(t, sess, sessions, nil, tt.userID, tt.amr)
+
+			c, _ := newTestContext(cookies)
+			if err := sess.Set(c.Writer, c.Request, session.AuthTimeKey, time.Now().Add(-tt.authTime).Unix()); err != nil {
+				t.Fatal(err)
+			}
+
+			c, w := newTestContext(cookies)
+			current, ok := requireReauth(c, sess, sessions, userApp, logger)
+			if tt.status == 0 {
+				if !ok || current == nil || current.UserID != tt.userID {
+					t.Fatalf("requireReauth rejected: %d %s", w.Code, w.Body.String())
+				}
+				return
+			}
+			if ok || w.Code != tt.status {
+				t.Fatalf("requireReauth = %v, status %d, want %d", ok, w.Code, tt.status)
+			}
+		})
+	}
+}
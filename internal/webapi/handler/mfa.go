@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// MFAResponse 两步验证状态响应
+type MFAResponse struct {
+	*user.MFADTO
+	Satisfied   bool   `json:"satisfied"`              // 当前会话是否已完成两步验证(一次性密码、安全密钥或免密码登录)
+	ContinueURL string `json:"continue_url,omitempty"` // 有待完成的授权请求时,完成两步验证后前端跳转到该地址继续授权
+}
+
+// GetMFA godoc
+// @Summary GetMFA
+// @Description 获取当前用户的两步验证状态
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[MFAResponse]
+// @Failure 401 {object} response.Response[any]
+// @Router /api/v1/user/mfa [get]
+func GetMFA(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		mfaStatus(c, seesion, current, userApp, log)
+	}
+}
+
+// BeginTOTP godoc
+// @Summary BeginTOTP
+// @Description 开始绑定认证器应用,返回密钥与 otpauth URI;确认前再次调用会替换密钥;已注册安全密钥的用户须在 user.mfa.reauth_window 内完成过两步验证
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[user.TOTPEnrollmentDTO]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 409 {object} response.Response[any]
+// @Router /api/v1/user/mfa/totp [post]
+func BeginTOTP(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireReauth(c, seesion, sessions, userApp, log)
+		if !ok {
+			return
+		}
+
+		data, err := userApp.MFAHandler.BeginTOTP(c, current.UserID)
+		if err != nil {
+			mfaError(c, err, log)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response.Success(data))
+	}
+}
+
+// ConfirmTOTP godoc
+// @Summary ConfirmTOTP
+// @Description 提交认证器应用中的一次性密码确认绑定,当前会话同时视为已完成两步验证
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.MFACode true "一次性密码"
+// @Success 200 {object} response.Response[MFAResponse]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 409 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/mfa/totp/confirm [post]
+func ConfirmTOTP(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		param := &user.MFACode{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		if err := userApp.MFAHandler.ConfirmTOTP(c, current.UserID, param.Code); err != nil {
+			mfaError(c, err, log)
+			return
+		}
+
+		if err := stepUp(c, seesion, sessions, current, "otp"); err != nil {
+			log.Error("step up login session failed", zap.String("sid", current.SID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		mfaStatus(c, seesion, current, userApp, log)
+	}
+}
+
+// VerifyMFA godoc
+// @Summary VerifyMFA
+// @Description 已登录但未完成两步验证的会话(如绑定前登录)提交一次性密码补充验证
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.MFACode true "一次性密码"
+// @Success 200 {object} response.Response[MFAResponse]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/mfa/verify [post]
+func VerifyMFA(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		param := &user.MFACode{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		if err := userApp.MFAHandler.Verify(c, current.UserID, param.Code); err != nil {
+			mfaError(c, err, log)
+			return
+		}
+
+		if err := stepUp(c, seesion, sessions, current, "otp"); err != nil {
+			log.Error("step up login session failed", zap.String("sid", current.SID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		mfaStatus(c, seesion, current, userApp, log)
+	}
+}
+
+// DisableTOTP godoc
+// @Summary DisableTOTP
+// @Description 提交一次性密码解除绑定认证器应用;用户被要求两步验证时不能解除
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.MFACode true "一次性密码"
+// @Success 200 {object} response.Response[MFAResponse]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/mfa/totp [delete]
+func DisableTOTP(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		param := &user.MFACode{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		if err := userApp.MFAHandler.DisableTOTP(c, current.UserID, param.Code); err != nil {
+			mfaError(c, err, log)
+			return
+		}
+
+		mfaStatus(c, seesion, current, userApp, log)
+	}
+}
+
+// mfaStatus 输出当前用户的两步验证状态
+func mfaStatus(c *gin.Context, seesion *session.Session, current *sso.Session, userApp *user.UserApp, log *zap.Logger) {
+
+	data, err := userApp.MFAHandler.Status(c, current.UserID)
+	if err != nil {
+		mfaError(c, err, log)
+		return
+	}
+
+	c.JSON(http.StatusOK, response.Success(MFAResponse{
+		MFADTO:      data,
+		Satisfied:   token.ACRForAMR(current.AMR) == token.ACRMultiFactor,
+		ContinueURL: continueURL(c, seesion),
+	}))
+}
+
+// stepUp 已登录会话补充认证后更换会话ID,并更新会话中的认证时间与认证方式
+func stepUp(c *gin.Context, seesion *session.Session, sessions *sso.Service, current *sso.Session, method string) error {
+
+	amr := slices.Clone(current.AMR)
+	if !slices.Contains(amr, method) {
+		amr = append(amr, method)
+	}
+
+	// 认证等级提升后更换会话ID,防止会话固定攻击
+	if err := seesion.Regenerate(c.Writer, c.Request); err != nil {
+		return err
+	}
+	if err := sessions.StepUp(c, current, amr); err != nil {
+		return err
+	}
+
+	seesion.Set(c.Writer, c.Request, session.AuthTimeKey, time.Now().Unix())
+	seesion.Set(c.Writer, c.Request, session.AMRKey, strings.Join(amr, " "))
+	seesion.Set(c.Writer, c.Request, session.ACRKey, token.ACRForAMR(amr))
+
+	return nil
+}
+
+// mfaError 输出两步验证错误
+func mfaError(c *gin.Context, err error, log *zap.Logger) {
+	switch {
+	case errors.Is(err, user.ErrMFACodeInvalid):
+		c.JSON(http.StatusBadRequest, response.BadRequest("一次性密码错误"))
+	case errors.Is(err, user.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, response.BadRequest("未绑定认证器应用"))
+	case errors.Is(err, user.ErrMFAEnrolled):
+		c.JSON(http.StatusConflict, response.Conflict("已绑定认证器应用"))
+	case errors.Is(err, domainuser.ErrRecoveryCodeInvalid):
+		c.JSON(http.StatusBadRequest, response.BadRequest("恢复码错误或已使用"))
+	case errors.Is(err, user.ErrMFAFactorNotFound):
+		c.JSON(http.StatusNotFound, response.NotFound("验证方式不存在"))
+	case errors.Is(err, user.ErrMFARequired):
+		c.JSON(http.StatusForbidden, response.Forbidden("账号须两步验证，不能解除"))
+	case errors.Is(err, user.ErrRateLimited):
+		c.JSON(http.StatusTooManyRequests, response.TooManyRequests())
+	case errors.Is(err, domainuser.ErrUserNotFound):
+		c.JSON(http.StatusUnauthorized, response.Unauthorized())
+	default:
+		log.Error("mfa failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+	}
+}
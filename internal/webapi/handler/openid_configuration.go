@@ -1,14 +1,18 @@
 package handler
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"net/http"
-	"os"
+	"slices"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/server"
 	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/ciba"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/oidc"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
 	"go.uber.org/zap"
 )
@@ -26,15 +30,22 @@ type (
 		DeviceAuthorizationEndpoint            string   `json:"device_authorization_endpoint,omitempty"`              // 设备授权端点（可选）
 		IntrospectionEndpoint                  string   `json:"introspection_endpoint,omitempty"`                     // Token Introspection 端点（可选）
 		RevocationEndpoint                     string   `json:"revocation_endpoint,omitempty"`                        // Token 撤销端点（可选）
+		EndSessionEndpoint                     string   `json:"end_session_endpoint,omitempty"`                       // 登出端点（可选）
 		ResponseTypesSupported                 []string `json:"response_types_supported"`                             // 支持的响应类型
 		SubjectTypesSupported                  []string `json:"subject_types_supported"`                              // 支持的 Subject 类型
 		IDTokenSigningAlgValuesSupported       []string `json:"id_token_signing_alg_values_supported"`                // ID Token 签名算法
 		UserinfoSigningAlgValuesSupported      []string `json:"userinfo_signing_alg_values_supported,omitempty"`      // 用户信息签名算法
+		IDTokenEncryptionAlgValuesSupported    []string `json:"id_token_encryption_alg_values_supported,omitempty"`   // ID Token 密钥加密算法
+		IDTokenEncryptionEncValuesSupported    []string `json:"id_token_encryption_enc_values_supported,omitempty"`   // ID Token 内容加密算法
+		UserinfoEncryptionAlgValuesSupported   []string `json:"userinfo_encryption_alg_values_supported,omitempty"`   // 用户信息密钥加密算法
+		UserinfoEncryptionEncValuesSupported   []string `json:"userinfo_encryption_enc_values_supported,omitempty"`   // 用户信息内容加密算法
 		AuthorizationSigningAlgValuesSupported []string `json:"authorization_signing_alg_values_supported,omitempty"` // 授权响应签名算法
 		ScopesSupported                        []string `json:"scopes_supported"`                                     // 支持的 Scope
 		GrantTypesSupported                    []string `json:"grant_types_supported,omitempty"`                      // 支持的授权方式
 		ClaimsSupported                        []string `json:"claims_supported,omitempty"`                           // 支持的 Claims
+		ACRValuesSupported                     []string `json:"acr_values_supported,omitempty"`                       // 支持的认证上下文等级: 1 单因素, 2 多因素
 		CodeChallengeMethodsSupported          []string `json:"code_challenge_methods_supported,omitempty"`           // 支持的 PKCE 方法
+		PromptValuesSupported                  []string `json:"prompt_values_supported,omitempty"`                    // 支持的 prompt 取值,开放注册时包含 create
 		TokenEndpointAuthMethodsSupported      []string `json:"token_endpoint_auth_methods_supported,omitempty"`      // Token 端点认证方式
 		DeviceCodeChallengeMethodsSupported    []string `json:"device_code_challenge_methods_supported,omitempty"`    // 设备端点支持的 PKCE 方法
 		ClaimsParameterSupported               bool     `json:"claims_parameter_supported,omitempty"`                 // 是否支持 claims 参数
@@ -43,18 +54,21 @@ type (
 		FrontchannelLogoutSessionSupported     bool     `json:"frontchannel_logout_session_supported,omitempty"`      // 是否支持前端登出时会话管理
 		BackchannelLogoutSupported             bool     `json:"backchannel_logout_supported,omitempty"`               // 是否支持后端通道登出
 		BackchannelLogoutSessionSupported      bool     `json:"backchannel_logout_session_supported,omitempty"`       // 是否支持后端登出时会话管理
+		BackchannelAuthenticationEndpoint      string   `json:"backchannel_authentication_endpoint,omitempty"`        // CIBA 后端认证端点（可选）
+		BackchannelTokenDeliveryModesSupported []string `json:"backchannel_token_delivery_modes_supported,omitempty"` // CIBA 支持的令牌投递模式
+		BackchannelUserCodeParameterSupported  bool     `json:"backchannel_user_code_parameter_supported,omitempty"`  // CIBA 是否支持 user_code 参数
 	}
 )
 
 // OpenidConfiguration godoc
 // @Summary OpenID 配置发现端点
-// @Description 提供 OpenID Connect 发现文档
+// @Description 提供 OpenID Connect 发现文档,内容由已注册的客户端与启用的功能生成
 // @Tags WellKnown
 // @Accept json
 // @Produce json
 // @Success 200 {object} OpenIDConfiguration
 // @Router /.well-known/openid-configuration [get]
-func OpenidConfiguration(cfg *configs.OAuth2, log *zap.Logger) gin.HandlerFunc {
+func OpenidConfiguration(cfg *configs.OAuth2, users *configs.User, srv *server.Server, keyProvider keys.Provider, log *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		issuer := cfg.Issuer
@@ -65,10 +79,12 @@ func OpenidConfiguration(cfg *configs.OAuth2, log *zap.Logger) gin.HandlerFunc {
 			return
 		}
 
-		// 配置中获取JWT签名方法
-		signingMethod := "RS256" // 默认值
-		if cfg.Manager != nil && cfg.Manager.SigningMethod != "" {
-			signingMethod = cfg.Manager.SigningMethod
+		// 签名算法以实际持有的密钥为准,签名服务托管的密钥可能与配置不同
+		signingAlgs, err := signingAlgorithms(c, keyProvider)
+		if err != nil {
+			log.Error("Failed to resolve signing algorithms", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError("could not resolve signing algorithms"))
+			return
 		}
 
 		data := OpenIDConfiguration{
@@ -77,96 +93,158 @@ func OpenidConfiguration(cfg *configs.OAuth2, log *zap.Logger) gin.HandlerFunc {
 			TokenEndpoint:                     issuer + "/connect/token",
 			UserinfoEndpoint:                  issuer + "/connect/userinfo",
 			JwksURI:                           issuer + "/.well-known/openid-configuration/jwks",
-			ResponseTypesSupported:            []string{"code", "token", "id_token"},
+			ResponseTypesSupported:            supportedResponseTypes(srv),
 			SubjectTypesSupported:             []string{"public"},
-			IDTokenSigningAlgValuesSupported:  []string{signingMethod},
-			ScopesSupported:                   []string{"openid", "profile", "email", "offline_access"},
-			ClaimsSupported:                   []string{"sub", "name", "email", "email_verified"},
-			GrantTypesSupported:               []string{"authorization_code", "refresh_token", "password", "client_credentials"},
-			TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
-			CodeChallengeMethodsSupported:     []string{"S256", "plain"},
+			IDTokenSigningAlgValuesSupported:  signingAlgs,
+			UserinfoSigningAlgValuesSupported: signingAlgs,
+			ScopesSupported:                   supportedScopes(cfg),
+			ClaimsSupported:                   oidc.ClaimsSupported,
+			ACRValuesSupported:                []string{token.ACRPassword, token.ACRMultiFactor},
+			GrantTypesSupported:               supportedGrantTypes(cfg, srv),
+			TokenEndpointAuthMethodsSupported: supportedAuthMethods(cfg),
+			CodeChallengeMethodsSupported:     cfg.Authorize.CodeChallengeMethods,
+
+			IDTokenEncryptionAlgValuesSupported:  oidc.KeyEncryptionAlgorithms,
+			IDTokenEncryptionEncValuesSupported:  oidc.ContentEncryptionAlgorithms,
+			UserinfoEncryptionAlgValuesSupported: oidc.KeyEncryptionAlgorithms,
+			UserinfoEncryptionEncValuesSupported: oidc.ContentEncryptionAlgorithms,
+		}
+
+		if users.Registration.Enabled {
+			data.PromptValuesSupported = []string{"create"}
+		}
+
+		if cfg.Endpoints.Introspection {
+			data.IntrospectionEndpoint = issuer + "/connect/introspect"
+		}
+		if cfg.Endpoints.Revocation {
+			data.RevocationEndpoint = issuer + "/connect/revoke"
+		}
+		if cfg.Endpoints.EndSession {
+			data.EndSessionEndpoint = issuer + "/connect/endsession"
+		}
+
+		if cfg.CIBA != nil && cfg.CIBA.Enabled {
+			data.BackchannelAuthenticationEndpoint = issuer + "/connect/ciba"
+			data.BackchannelTokenDeliveryModesSupported = []string{"poll", "ping", "push"}
 		}
 
 		c.JSON(http.StatusOK, data)
 	}
 }
 
-// Jwks godoc
-// @Summary JWKS 端点
-// @Description 提供签名密钥的JWK集合
-// @Tags WellKnown
-// @Accept json
-// @Produce json
-// @Success 200 {object} jwk.Set
-// @Failure 500 {object} response.ErrorResponse
-// @Router /.well-known/openid-configuration/jwks [get]
-func Jwks(cfg *configs.OAuth2, log *zap.Logger) gin.HandlerFunc {
-	return func(c *gin.Context) {
+// supportedResponseTypes 授权端点允许的响应类型
+func supportedResponseTypes(srv *server.Server) []string {
+	types := make([]string, 0, len(srv.Config.AllowedResponseTypes))
+	for _, v := range srv.Config.AllowedResponseTypes {
+		types = append(types, v.String())
+	}
+	return types
+}
 
-		// 检查配置是否有效
-		if cfg.Manager == nil {
-			log.Error("OAuth2 manager configuration is missing")
-			c.JSON(http.StatusInternalServerError, response.InternalServerError("server configuration error"))
-			return
+// supportedScopes 配置文件中的客户端可申请的权限范围
+// 客户端保存在数据库时按导入的初始客户端计算,不逐个查询数据库
+func supportedScopes(cfg *configs.OAuth2) []string {
+	scopes := []string{}
+	for _, client := range cfg.Clients {
+		for _, v := range client.Scopes {
+			if !slices.Contains(scopes, v) {
+				scopes = append(scopes, v)
+			}
 		}
+	}
+	return scopes
+}
 
-		jwtPublicKeyPath := cfg.Manager.JWTPublicKey
-		if jwtPublicKeyPath == "" {
-			log.Error("JWT public key path not configured")
-			c.JSON(http.StatusInternalServerError, response.InternalServerError("server configuration error"))
-			return
-		}
+// signingAlgorithms 当前签名密钥与 JWKS 中发布的密钥使用的签名算法,当前密钥的算法在前
+// 轮换期间新旧密钥的算法可能不同,依赖方需要同时接受
+func signingAlgorithms(ctx context.Context, keyProvider keys.Provider) ([]string, error) {
 
-		pubKeyData, err := os.ReadFile(jwtPublicKeyPath)
-		if err != nil {
-			log.Error("Failed to read JWT public key", zap.String("path", jwtPublicKeyPath), zap.Error(err))
-			c.JSON(http.StatusInternalServerError, response.InternalServerError("could not read public key"))
-			return
-		}
+	active, err := keyProvider.Active(ctx)
+	if err != nil {
+		return nil, err
+	}
+	algs := []string{active.Alg()}
 
-		key, err := jwk.ParseKey(pubKeyData, jwk.WithPEM(true))
-		if err != nil {
-			log.Error("Failed to parse JWK", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, response.InternalServerError("could not parse public key"))
-			return
+	set, err := keyProvider.PublicSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Key(i)
+		if alg := key.Algorithm().String(); alg != "" && !slices.Contains(algs, alg) {
+			algs = append(algs, alg)
 		}
+	}
+
+	return algs, nil
+}
 
-		// 设置或生成kid
-		if kid := key.KeyID(); kid == "" {
-			desiredKid := generateKeyID([]byte(cfg.Manager.Kid))
-			if err := key.Set(jwk.KeyIDKey, desiredKid); err != nil {
-				log.Error("Failed to set key ID", zap.Error(err))
-			} else {
-				log.Info("Generated kid for JWK", zap.String("kid", desiredKid))
+// supportedAuthMethods 配置文件中的客户端允许使用的令牌端点认证方式
+// 客户端保存在数据库时按导入的初始客户端计算,不逐个查询数据库
+func supportedAuthMethods(cfg *configs.OAuth2) []string {
+	methods := []string{}
+	for _, client := range cfg.Clients {
+		public := client.TokenEndpointAuthMethod == configs.AuthMethodNone
+		for _, v := range []string{configs.AuthMethodClientSecretBasic, configs.AuthMethodClientSecretPost, configs.AuthMethodNone} {
+			if client.AllowsAuthMethod(v, public) && !slices.Contains(methods, v) {
+				methods = append(methods, v)
 			}
 		}
+	}
+	return methods
+}
+
+// supportedGrantTypes 已注册客户端使用且服务端实际支持的授权方式
+func supportedGrantTypes(cfg *configs.OAuth2, srv *server.Server) []string {
+
+	implicit := slices.Contains(srv.Config.AllowedResponseTypes, oauth2.Token)
+	cibaEnabled := cfg.CIBA != nil && cfg.CIBA.Enabled
+
+	grants := []string{}
+	for _, client := range cfg.Clients {
+		for _, v := range client.GrantTypes {
 
-		// 设置算法（重要）
-		if alg := key.Algorithm(); alg == nil || alg.String() == "" {
-			if err := key.Set(jwk.AlgorithmKey, "RS256"); err != nil {
-				log.Warn("Failed to set algorithm for key", zap.Error(err))
+			gt := oauth2.GrantType(v)
+			switch {
+			case gt == oauth2.Implicit && implicit:
+				v = "implicit"
+			case gt == ciba.GrantType && cibaEnabled:
+			case gt != oauth2.Implicit && srv.CheckGrantType(gt):
+			default:
+				continue
 			}
-		}
 
-		// 设置密钥用途
-		if err := key.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
-			log.Warn("Failed to set key usage", zap.Error(err))
+			if !slices.Contains(grants, v) {
+				grants = append(grants, v)
+			}
 		}
+	}
 
-		set := jwk.NewSet()
-		if err := set.AddKey(key); err != nil {
-			log.Error("Failed to add key to JWKS", zap.Error(err))
+	return grants
+}
+
+// Jwks godoc
+// @Summary JWKS 端点
+// @Description 提供签名密钥的JWK集合,包含当前密钥、待启用密钥以及仍在有效期内的退役密钥
+// @Tags WellKnown
+// @Accept json
+// @Produce json
+// @Success 200 {object} jwk.Set
+// @Failure 500 {object} response.ErrorResponse
+// @Router /.well-known/openid-configuration/jwks [get]
+func Jwks(keyProvider keys.Provider, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		set, err := keyProvider.PublicSet(c)
+		if err != nil {
+			log.Error("Failed to build JWKS", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, response.InternalServerError("could not build JWKS"))
 			return
 		}
 
+		// 允许依赖方短时间缓存,轮换时新密钥已提前发布
+		c.Header("Cache-Control", "public, max-age=300")
 		c.JSON(http.StatusOK, set)
 	}
 }
-
-// generateKeyID 生成健壮且唯一的key ID
-// 基于密钥内容生成 kid
-func generateKeyID(key []byte) string {
-	hash := sha256.Sum256(key)
-	return base64.RawURLEncoding.EncodeToString(hash[:8])
-}
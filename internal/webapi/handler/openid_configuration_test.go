@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/manage"
+	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"go.uber.org/zap"
+)
+
+func TestOpenidConfigurationFromKeysAndClients(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	cfg, err := configs.NewOAuth2(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Issuer = "https://auth.example.com"
+	cfg.Manager.SigningMethod = "ES256"
+	cfg.Clients = []*configs.Client{
+		{ID: "web", Secrets: []*configs.ClientSecret{{ID: "k1", Hash: "$2a$10$hash"}}, TokenEndpointAuthMethod: configs.AuthMethodClientSecretPost},
+		{ID: "spa", TokenEndpointAuthMethod: configs.AuthMethodNone},
+	}
+	ucfg, err := configs.NewUser(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := keys.NewManager(cfg, keys.NewMemoryKeyStore(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 密钥生成后修改配置,发现文档仍以实际密钥的算法为准
+	cfg.Manager.SigningMethod = "RS256"
+
+	srv := server.NewDefaultServer(manage.NewDefaultManager())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	OpenidConfiguration(cfg, ucfg, srv, provider, logger)(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var doc OpenIDConfiguration
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(doc.IDTokenSigningAlgValuesSupported, []string{"ES256"}) {
+		t.Fatalf("id_token_signing_alg_values_supported = %v, want [ES256]", doc.IDTokenSigningAlgValuesSupported)
+	}
+	want := []string{configs.AuthMethodClientSecretPost, configs.AuthMethodNone}
+	if !slices.Equal(doc.TokenEndpointAuthMethodsSupported, want) {
+		t.Fatalf("token_endpoint_auth_methods_supported = %v, want %v", doc.TokenEndpointAuthMethodsSupported, want)
+	}
+}
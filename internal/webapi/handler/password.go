@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/middleware"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// ForgotPassword godoc
+// @Summary ForgotPassword
+// @Description 找回密码,账号存在且绑定了邮箱时发送重置链接;为避免探测账号,无论账号是否存在都返回 202
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.ForgotPassword true "账号"
+// @Success 202 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/password/forgot [post]
+func ForgotPassword(userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.ForgotPassword{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+		param.IP = c.ClientIP()
+
+		err := userApp.ForgotPasswordHandler.Handle(c, param)
+		switch {
+		case err == nil:
+			c.JSON(http.StatusAccepted, response.Success[any](nil))
+		case errors.Is(err, user.ErrPasswordResetClosed):
+			c.JSON(http.StatusForbidden, response.Forbidden("未开放找回密码"))
+		case errors.Is(err, user.ErrRateLimited):
+			c.JSON(http.StatusTooManyRequests, response.TooManyRequests())
+		default:
+			logger.Error("forgot password failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+		}
+	}
+}
+
+// ResetPassword godoc
+// @Summary ResetPassword
+// @Description 使用找回密码邮件中的令牌设置新密码;成功后撤销用户全部登录会话与令牌,需要重新登录
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.ResetPassword true "令牌与新密码"
+// @Success 200 {object} response.Response[RevokeSessionResponse]
+// @Failure 400 {object} response.Response[any]
+// @Router /api/v1/user/password/reset [post]
+func ResetPassword(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.ResetPassword{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		userID, err := userApp.ResetPasswordHandler.Handle(c, param)
+		switch {
+		case err == nil:
+		case errors.Is(err, domainuser.ErrResetTokenInvalid):
+			c.JSON(http.StatusBadRequest, response.BadRequest("链接无效或已过期"))
+			return
+		case errors.Is(err, password.ErrPolicy):
+			c.JSON(http.StatusBadRequest, response.BadRequest(err.Error()))
+			return
+		default:
+			logger.Error("reset password failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		n, err := sessions.RevokeAll(c, userID, "password_reset")
+		if err != nil {
+			// 密码已修改,撤销失败只记录日志,由管理员处理
+			logger.Error("revoke sessions after password reset failed", zap.String("user_id", userID), zap.Error(err))
+		}
+
+		if v, _ := seesion.Get(c.Request, userIdTag); v == userID {
+			if err := seesion.Clear(c.Writer, c.Request); err != nil {
+				logger.Error("clear session failed", zap.Error(err))
+			}
+		}
+
+		c.JSON(http.StatusOK, response.Success(RevokeSessionResponse{RevokedTokens: n}))
+	}
+}
+
+// SendPasswordReset godoc
+// @Summary SendPasswordReset
+// @Description 为用户发送找回密码邮件,供客服处理无法自助找回的用户,不受找回密码开关与限流限制
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer 访问令牌,须包含管理权限范围"
+// @Param id path string true "用户ID"
+// @Success 202 {object} response.Response[any]
+// @Failure 404 {object} response.Response[any]
+// @Failure 409 {object} response.Response[any]
+// @Router /api/v1/admin/users/{id}/password-reset [post]
+func SendPasswordReset(userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		operator := middleware.TokenInfo(c).GetClientID()
+		err := userApp.ForgotPasswordHandler.IssueForUser(c, c.Param("id"), operator)
+		switch {
+		case err == nil:
+			c.JSON(http.StatusAccepted, response.Success[any](nil))
+		case errors.Is(err, domainuser.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, response.NotFound("用户不存在"))
+		case errors.Is(err, user.ErrNoEmail):
+			c.JSON(http.StatusConflict, response.Conflict("用户未绑定邮箱"))
+		default:
+			logger.Error("send password reset failed", zap.String("user_id", c.Param("id")), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+		}
+	}
+}
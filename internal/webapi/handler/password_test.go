@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/infra/repoimpl"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/mail"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/ratelimit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	ctx := context.Background()
+
+	cfg, err := configs.NewOAuth2(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ucfg, err := configs.NewUser(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ucfg.Users = []*configs.SeedUser{{ID: "1", Username: "alice", Password: "alice-password", Email: "alice@example.com"}}
+	scfg, err := configs.NewSession(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := repoimpl.NewUserRepository(repoimpl.UserRepositoryParams{Config: ucfg, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetTokens, err := repoimpl.NewResetTokenRepository(repoimpl.ResetTokenRepositoryParams{Config: ucfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := mail.NewMemorySender(logger)
+	recorder := audit.NewLogRecorder(logger)
+	userApp := &user.UserApp{
+		ForgotPasswordHandler: user.NewForgotPasswordHandler(ucfg, cfg, repo, resetTokens, sender, ratelimit.NewMemoryLimiter(), recorder, logger),
+		ResetPasswordHandler:  user.NewResetPasswordHandler(ucfg, repo, resetTokens, recorder, logger),
+	}
+
+	tokens := token.NewMemotyTokenStore(logger)
+	sessions := sso.NewService(scfg, sso.NewMemoryStore(), tokens, recorder, logger)
+	sess, err := session.NewSession(session.Options{}, session.NewMemoryBackend(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 用户已有一个登录会话与一个令牌
+	if _, err := sessions.Start(ctx, "1", "192.0.2.1", "test", []string{"pwd"}); err != nil {
+		t.Fatal(err)
+	}
+	ti := models.NewToken()
+	ti.SetClientID("c1")
+	ti.SetUserID("1")
+	ti.SetAccess("access-1")
+	ti.SetAccessCreateAt(time.Now())
+	ti.SetAccessExpiresIn(time.Hour)
+	if err := tokens.Create(ctx, ti); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := userApp.ForgotPasswordHandler.IssueForUser(ctx, "1", "test"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := sender.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d mails, want 1", len(msgs))
+	}
+	m := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(msgs[0].Text)
+	if m == nil {
+		t.Fatalf("no reset token in mail: %q", msgs[0].Text)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body := `{"token":"` + m[1] + `","password":"N3w-passw0rd-for-reset"}`
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/user/password/reset", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	ResetPassword(sess, sessions, userApp, logger)(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp response.Response[RevokeSessionResponse]
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.RevokedTokens != 1 {
+		t.Fatalf("revoked %d tokens, want 1", resp.Data.RevokedTokens)
+	}
+
+	if list, err := sessions.List(ctx, "1"); err != nil || len(list) != 0 {
+		t.Fatalf("sessions after reset: %d, %v", len(list), err)
+	}
+	if found, err := tokens.Find(ctx, token.IndexUser, "1"); err != nil || len(found) != 0 {
+		t.Fatalf("tokens after reset: %d, %v", len(found), err)
+	}
+	if got, _ := tokens.GetByAccess(ctx, "access-1"); got != nil {
+		t.Fatal("access token still valid after reset")
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// RegisterResponse 注册响应
+type RegisterResponse struct {
+	*user.UserInfoDTO
+	ContinueURL string `json:"continue_url,omitempty"` // 注册前有待完成的授权请求时,前端跳转到该地址继续授权
+}
+
+// Register godoc
+// @Summary Register
+// @Description 用户自助注册,注册成功后自动登录;注册前有待完成的授权请求时返回 continue_url
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.Register true "注册信息"
+// @Success 201 {object} response.Response[RegisterResponse]
+// @Failure 400 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 409 {object} response.Response[any]
+// @Router /api/v1/user/register [post]
+func Register(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.Register{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		data, err := userApp.RegisterHandler.Handle(c, param)
+		if err != nil {
+			registerError(c, err, logger)
+			return
+		}
+
+		if err = signIn(c, seesion, sessions, data.UserID, "pwd"); err != nil {
+			logger.Error("sign in after registration failed", zap.String("user_id", data.UserID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		// 注册时填写了邮箱则发送验证邮件,发送失败不影响注册
+		if data.Email != "" {
+			go func() {
+				if err := userApp.VerificationHandler.SendEmail(context.Background(), data.UserID); err != nil {
+					logger.Warn("send verification mail after registration failed", zap.String("user_id", data.UserID), zap.Error(err))
+				}
+			}()
+		}
+
+		c.JSON(http.StatusCreated, response.Success(RegisterResponse{UserInfoDTO: data, ContinueURL: continueURL(c, seesion)}))
+	}
+}
+
+// continueURL 会话中有待完成的授权请求时返回继续授权的地址
+func continueURL(c *gin.Context, seesion *session.Session) string {
+	if v, _ := seesion.Get(c.Request, session.AuthorizeFormKey); v != nil {
+		return "/connect/authorize"
+	}
+	return ""
+}
+
+// registerError 输出注册错误
+func registerError(c *gin.Context, err error, log *zap.Logger) {
+	switch {
+	case errors.Is(err, user.ErrRegistrationClosed):
+		c.JSON(http.StatusForbidden, response.Forbidden("未开放注册"))
+	case errors.Is(err, user.ErrInviteCode):
+		c.JSON(http.StatusForbidden, response.Forbidden("邀请码错误"))
+	case errors.Is(err, user.ErrEmailDomain):
+		c.JSON(http.StatusForbidden, response.Forbidden("该邮箱域名不允许注册"))
+	case errors.Is(err, user.ErrFieldRequired), errors.Is(err, user.ErrRegisterInvalid):
+		c.JSON(http.StatusBadRequest, response.BadRequest(err.Error()))
+	case errors.Is(err, domainuser.ErrUsernameExist):
+		c.JSON(http.StatusConflict, response.Conflict("用户名已被使用"))
+	case errors.Is(err, domainuser.ErrEmailExist):
+		c.JSON(http.StatusConflict, response.Conflict("邮箱已被使用"))
+	case errors.Is(err, domainuser.ErrPhoneExist):
+		c.JSON(http.StatusConflict, response.Conflict("手机号已被使用"))
+	default:
+		log.Error("register failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+	}
+}
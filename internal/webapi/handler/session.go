@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/middleware"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+type (
+
+	// SessionInfo 登录会话信息
+	SessionInfo struct {
+		*sso.Session
+		Current bool `json:"current"` // 是否为发起请求的浏览器所在的会话
+	}
+
+	// RevokeSessionResponse 撤销登录会话响应
+	RevokeSessionResponse struct {
+		RevokedTokens int `json:"revoked_tokens"` // 一并撤销的授权码与令牌记录数
+	}
+)
+
+// ListMySessions godoc
+// @Summary ListMySessions
+// @Description 列出当前用户全部有效的登录会话,最近活动的在前
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[[]SessionInfo]
+// @Failure 401 {object} response.Response[any]
+// @Router /api/v1/user/sessions [get]
+func ListMySessions(seesion *session.Session, sessions *sso.Service, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, err := currentSession(c, seesion, sessions)
+		if err != nil {
+			log.Error("get login session failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+		if current == nil {
+			c.JSON(http.StatusUnauthorized, response.Unauthorized())
+			return
+		}
+
+		list, err := sessions.List(c, current.UserID)
+		if err != nil {
+			log.Error("list login sessions failed", zap.String("user_id", current.UserID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(sessionInfos(list, current.SID)))
+	}
+}
+
+// RevokeMySession godoc
+// @Summary RevokeMySession
+// @Description 撤销当前用户的登录会话,会话期间签发的授权码与令牌一并撤销;撤销当前会话等同于登出
+// @Tags User
+// @Produce json
+// @Param sid path string true "登录会话ID"
+// @Success 200 {object} response.Response[RevokeSessionResponse]
+// @Failure 401 {object} response.Response[any]
+// @Failure 404 {object} response.Response[any]
+// @Router /api/v1/user/sessions/{sid} [delete]
+func RevokeMySession(seesion *session.Session, sessions *sso.Service, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, err := currentSession(c, seesion, sessions)
+		if err != nil {
+			log.Error("get login session failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+		if current == nil {
+			c.JSON(http.StatusUnauthorized, response.Unauthorized())
+			return
+		}
+
+		sid := c.Param("sid")
+		n, err := sessions.Revoke(c, current.UserID, sid, current.UserID)
+		if err != nil {
+			sessionError(c, err, log)
+			return
+		}
+
+		if sid == current.SID {
+			if err := seesion.Clear(c.Writer, c.Request); err != nil {
+				log.Error("clear session failed", zap.Error(err))
+			}
+		}
+
+		c.JSON(http.StatusOK, response.Success(RevokeSessionResponse{RevokedTokens: n}))
+	}
+}
+
+// ListUserSessions godoc
+// @Summary ListUserSessions
+// @Description 列出用户全部有效的登录会话,最近活动的在前
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer 访问令牌,须包含管理权限范围"
+// @Param id path string true "用户ID"
+// @Success 200 {object} response.Response[[]SessionInfo]
+// @Router /api/v1/admin/users/{id}/sessions [get]
+func ListUserSessions(sessions *sso.Service, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID := c.Param("id")
+		list, err := sessions.List(c, userID)
+		if err != nil {
+			log.Error("list login sessions failed", zap.String("user_id", userID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(sessionInfos(list, "")))
+	}
+}
+
+// RevokeUserSession godoc
+// @Summary RevokeUserSession
+// @Description 撤销用户的登录会话,会话期间签发的授权码与令牌一并撤销,用于设备丢失等场景
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer 访问令牌,须包含管理权限范围"
+// @Param id path string true "用户ID"
+// @Param sid path string true "登录会话ID"
+// @Success 200 {object} response.Response[RevokeSessionResponse]
+// @Failure 404 {object} response.Response[any]
+// @Router /api/v1/admin/users/{id}/sessions/{sid} [delete]
+func RevokeUserSession(sessions *sso.Service, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		operator := middleware.TokenInfo(c).GetClientID()
+		n, err := sessions.Revoke(c, c.Param("id"), c.Param("sid"), operator)
+		if err != nil {
+			sessionError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(RevokeSessionResponse{RevokedTokens: n}))
+	}
+}
+
+// currentSession 读取发起请求的浏览器所在的有效登录会话,未登录或会话已过期、已撤销时返回 nil
+func currentSession(c *gin.Context, seesion *session.Session, sessions *sso.Service) (*sso.Session, error) {
+
+	userID, _ := seesion.Get(c.Request, userIdTag)
+	sid, _ := seesion.Get(c.Request, session.SIDKey)
+
+	uid, _ := userID.(string)
+	sidValue, _ := sid.(string)
+	if uid == "" {
+		return nil, nil
+	}
+
+	sess, err := sessions.Active(c, sidValue)
+	if err != nil || sess == nil || sess.UserID != uid {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// sessionInfos 登录会话列表,标记当前会话
+func sessionInfos(list []*sso.Session, currentSID string) []SessionInfo {
+	data := make([]SessionInfo, 0, len(list))
+	for _, v := range list {
+		data = append(data, SessionInfo{Session: v, Current: v.SID == currentSID})
+	}
+	return data
+}
+
+// sessionError 输出登录会话错误
+func sessionError(c *gin.Context, err error, log *zap.Logger) {
+	if errors.Is(err, sso.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, response.NotFound("登录会话不存在"))
+		return
+	}
+	log.Error("login session error", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, response.InternalServerError())
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// SendSMSLoginCode godoc
+// @Summary SendSMSLoginCode
+// @Description 发送短信登录验证码;为避免探测手机号是否注册,未注册且未开启自动注册时不发送短信但同样返回 202
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.SMSLoginCode true "手机号"
+// @Success 202 {object} response.Response[any]
+// @Failure 400 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/login/sms/code [post]
+func SendSMSLoginCode(userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.SMSLoginCode{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+		param.IP = c.ClientIP()
+
+		err := userApp.SMSLoginHandler.SendCode(c, param)
+		switch {
+		case err == nil:
+			c.JSON(http.StatusAccepted, response.Success[any](nil))
+		case errors.Is(err, user.ErrSMSLoginClosed):
+			c.JSON(http.StatusForbidden, response.Forbidden("未开放短信验证码登录"))
+		case errors.Is(err, domainuser.ErrInvalidPhone):
+			c.JSON(http.StatusBadRequest, response.BadRequest("手机号须为带国家码的格式，如 +8613800000000"))
+		case errors.Is(err, user.ErrRateLimited):
+			c.JSON(http.StatusTooManyRequests, response.TooManyRequests())
+		default:
+			logger.Error("send sms login code failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+		}
+	}
+}
+
+// LoginSMS godoc
+// @Summary LoginSMS
+// @Description 使用短信验证码登录,会话的认证方式为 sms;已绑定两步验证的用户返回 mfa_required,须在 user.mfa.login_timeout 内完成第二步
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.SMSLogin true "手机号与验证码"
+// @Success 200 {object} response.Response[user.UserInfoDTO]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/login/sms [post]
+func LoginSMS(seesion *session.Session, sessions *sso.Service, users *configs.User, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.SMSLogin{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+		param.IP = c.ClientIP()
+
+		data, err := userApp.SMSLoginHandler.Handle(c, param)
+		switch {
+		case err == nil:
+		case errors.Is(err, user.ErrSMSLoginClosed):
+			c.JSON(http.StatusForbidden, response.Forbidden("未开放短信验证码登录"))
+			return
+		case errors.Is(err, domainuser.ErrVerificationInvalid):
+			c.JSON(http.StatusBadRequest, response.BadRequest("验证码错误或已过期"))
+			return
+		case errors.Is(err, domainuser.ErrUserDisabled):
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "login failed"})
+			return
+		case errors.Is(err, user.ErrRateLimited):
+			c.JSON(http.StatusTooManyRequests, response.TooManyRequests())
+			return
+		default:
+			logger.Error("sms login failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		// 与密码登录相同,已绑定两步验证的用户须完成第二步
+		methods, err := userApp.MFAHandler.Methods(c, data.UserID)
+		if err != nil {
+			logger.Error("get mfa failed", zap.String("user_id", data.UserID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+		if len(methods) > 0 {
+			beginMFALogin(c, seesion, users, data.UserID, "sms")
+			c.JSON(http.StatusOK, response.Success(MFAChallengeResponse{MFARequired: true, Methods: methods}))
+			return
+		}
+
+		if err := signIn(c, seesion, sessions, data.UserID, "sms"); err != nil {
+			logger.Error("sign in failed", zap.String("user_id", data.UserID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(data))
+	}
+}
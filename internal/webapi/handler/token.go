@@ -1,10 +1,19 @@
 package handler
 
 import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	goauth2 "github.com/go-oauth2/oauth2/v4"
+	oerrors "github.com/go-oauth2/oauth2/v4/errors"
 	"github.com/go-oauth2/oauth2/v4/server"
-
-	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/ciba"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
 	"go.uber.org/zap"
 )
 
@@ -16,9 +25,33 @@ import (
 // @Produce json
 // @Success 200 {object} map[string]interface{}
 // @Router /connect/token [post]
-func Token(srv *server.Server, log *zap.Logger) gin.HandlerFunc {
+func Token(srv *server.Server, cibaSvc *ciba.Service, log *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
+		// CIBA 授权类型不在 go-oauth2 的支持范围内,单独处理
+		if cibaSvc.Enabled() && c.PostForm("grant_type") == string(ciba.GrantType) {
+			ti, err := cibaSvc.Token(c.Request)
+			if err != nil {
+				if err != ciba.ErrAuthorizationPending && err != ciba.ErrSlowDown {
+					log.Error("ciba token request error", zap.Error(err))
+				}
+				cibaError(c, err)
+				return
+			}
+
+			data, err := cibaSvc.TokenData(c, ti)
+			if err != nil {
+				log.Error("ciba token data error", zap.Error(err))
+				cibaError(c, err)
+				return
+			}
+
+			c.Header("Cache-Control", "no-store")
+			c.Header("Pragma", "no-cache")
+			c.JSON(http.StatusOK, data)
+			return
+		}
+
 		err := srv.HandleTokenRequest(c.Writer, c.Request)
 		if err != nil {
 			log.Error("HandleTokenRequest error", zap.Error(err))
@@ -27,32 +60,189 @@ func Token(srv *server.Server, log *zap.Logger) gin.HandlerFunc {
 	}
 }
 
+// IntrospectionResponse 令牌内省响应(RFC 7662)
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`               // 令牌是否有效
+	Scope     string   `json:"scope,omitempty"`      // 授权范围
+	ClientID  string   `json:"client_id,omitempty"`  // 客户端ID
+	TokenType string   `json:"token_type,omitempty"` // 令牌类型
+	Exp       int64    `json:"exp,omitempty"`        // 过期时间(Unix秒)
+	Iat       int64    `json:"iat,omitempty"`        // 签发时间(Unix秒)
+	Sub       string   `json:"sub,omitempty"`        // 主体,用户ID或客户端ID
+	Aud       []string `json:"aud,omitempty"`        // 受众
+	Iss       string   `json:"iss,omitempty"`        // 签发者
+	Jti       string   `json:"jti,omitempty"`        // 令牌ID
+	AuthTime  int64    `json:"auth_time,omitempty"`  // 用户认证时间(Unix秒)
+	ACR       string   `json:"acr,omitempty"`        // 认证上下文等级
+	AMR       []string `json:"amr,omitempty"`        // 认证方式
+}
+
 // Revoke godoc
 // @Summary Revoke
-// @Description 撤销token
+// @Description 撤销访问令牌或刷新令牌(RFC 7009),令牌无效时同样返回成功
 // @Tags OAuth2
-// @Accept json
+// @Accept x-www-form-urlencoded
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Router /connect/revoke [get]
-func Revoke(log *zap.Logger) gin.HandlerFunc {
+// @Param token formData string true "待撤销的令牌"
+// @Param token_type_hint formData string false "令牌类型提示: access_token, refresh_token"
+// @Success 200
+// @Failure 401 {object} map[string]string
+// @Router /connect/revoke [post]
+func Revoke(mgr *oauth2.Manager, log *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		data := response.Success("hello revoke")
-		c.JSON(200, data)
+
+		cli, err := mgr.AuthenticateClient(c.Request)
+		if err != nil {
+			oauthError(c, err)
+			return
+		}
+
+		value := c.PostForm("token")
+		if value == "" {
+			oauthError(c, oerrors.ErrInvalidRequest)
+			return
+		}
+
+		if err := mgr.RevokeToken(c, cli.GetID(), value, c.PostForm("token_type_hint")); err != nil {
+			log.Error("revoke token error", zap.String("client_id", cli.GetID()), zap.Error(err))
+			oauthError(c, oerrors.ErrServerError)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
 	}
 }
 
 // Introspect godoc
 // @Summary Introspect
-// @Description 检查token有效性
+// @Description 令牌内省(RFC 7662),返回令牌是否有效及其元数据;只有 oauth2.resources[].clients 中登记的资源服务器可以调用,
+// @Description 主体、授权范围、受众与认证信息只返回给令牌受众中的资源服务器
 // @Tags OAuth2
-// @Accept json
+// @Accept x-www-form-urlencoded
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Router /connect/introspect [get]
-func Introspect(log *zap.Logger) gin.HandlerFunc {
+// @Param token formData string true "待检查的令牌"
+// @Param token_type_hint formData string false "令牌类型提示: access_token, refresh_token"
+// @Success 200 {object} IntrospectionResponse
+// @Failure 401 {object} map[string]string
+// @Router /connect/introspect [post]
+func Introspect(mgr *oauth2.Manager, cfg *configs.OAuth2, log *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		data := response.Success("hello introspect")
-		c.JSON(200, data)
+
+		cli, err := mgr.AuthenticateClient(c.Request)
+		if err != nil {
+			oauthError(c, err)
+			return
+		}
+
+		// 内省会暴露令牌的主体与授权范围,只允许资源服务器调用
+		if len(cfg.ResourcesOf(cli.GetID())) == 0 {
+			log.Warn("introspection from a client that is not a resource server", zap.String("client_id", cli.GetID()))
+			oauthError(c, oerrors.ErrUnauthorizedClient)
+			return
+		}
+
+		value := c.PostForm("token")
+		if value == "" {
+			oauthError(c, oerrors.ErrInvalidRequest)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+
+		ti, isRefresh := mgr.LoadToken(c, value, c.PostForm("token_type_hint"))
+		if ti == nil {
+			c.JSON(http.StatusOK, IntrospectionResponse{Active: false})
+			return
+		}
+
+		data := IntrospectionResponse{
+			Active:    true,
+			ClientID:  ti.GetClientID(),
+			TokenType: cfg.Manager.TokenType,
+			Iss:       cfg.Issuer,
+		}
+
+		if isRefresh {
+			data.TokenType = oauth2.RefreshTokenHint
+			data.Iat = ti.GetRefreshCreateAt().Unix()
+			if ti.GetRefreshExpiresIn() > 0 {
+				data.Exp = ti.GetRefreshCreateAt().Add(ti.GetRefreshExpiresIn()).Unix()
+			}
+		} else {
+			data.Iat = ti.GetAccessCreateAt().Unix()
+			if ti.GetAccessExpiresIn() > 0 {
+				data.Exp = ti.GetAccessCreateAt().Add(ti.GetAccessExpiresIn()).Unix()
+			}
+		}
+
+		// 主体、授权范围与认证信息只返回给令牌受众中的资源服务器,其他资源服务器只能得知令牌是否有效
+		// 引用令牌不携带声明,aud 与 jti 由签发时写入的扩展信息提供;刷新令牌没有受众
+		eti, ok := ti.(goauth2.ExtendableTokenInfo)
+		if isRefresh || !ok || eti.GetExtension() == nil {
+			c.JSON(http.StatusOK, data)
+			return
+		}
+		ext := eti.GetExtension()
+		if !inAudience(cli.GetID(), cfg.ResourcesOf(cli.GetID()), ext[token.AudienceExtension]) {
+			c.JSON(http.StatusOK, data)
+			return
+		}
+
+		data.Scope = ti.GetScope()
+		data.Sub = ti.GetUserID()
+		if data.Sub == "" {
+			data.Sub = ti.GetClientID()
+		}
+		data.Aud = ext[token.AudienceExtension]
+		data.Jti = ext.Get(token.TokenIDExtension)
+		data.ACR = ext.Get(token.ACRExtension)
+		data.AMR = strings.Fields(ext.Get(token.AMRExtension))
+		data.AuthTime, _ = strconv.ParseInt(ext.Get(token.AuthTimeExtension), 10, 64)
+
+		c.JSON(http.StatusOK, data)
 	}
 }
+
+// inAudience 判断调用方是否为令牌受众: 客户端本身或其代表的资源在 aud 中
+func inAudience(clientID string, resources []*configs.Resource, aud []string) bool {
+	if slices.Contains(aud, clientID) {
+		return true
+	}
+	for _, r := range resources {
+		if slices.Contains(aud, r.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// oauthError 输出 OAuth2 错误响应
+func oauthError(c *gin.Context, err error) {
+
+	if re := token.NewErrorResponse(err); re != nil {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(re.StatusCode, gin.H{
+			"error":             re.Error.Error(),
+			"error_description": re.Description,
+		})
+		return
+	}
+
+	desc, ok := oerrors.Descriptions[err]
+	if !ok {
+		err = oerrors.ErrServerError
+		desc = oerrors.Descriptions[err]
+	}
+
+	status := oerrors.StatusCodes[err]
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, gin.H{
+		"error":             err.Error(),
+		"error_description": desc,
+	})
+}
@@ -1,41 +1,94 @@
 package handler
 
 import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/oidc"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
 	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
 	"go.uber.org/zap"
 )
 
 const (
-	userIdTag = "user_id"
+	userIdTag = session.UserIDKey
 )
 
 // Userinfo godoc
 // @Summary Userinfo
-// @Description 获取用户信息
+// @Description 获取用户信息,需携带包含 openid 权限范围的 Bearer 访问令牌;客户端注册了加密算法时返回 application/jwt
 // @Tags OAuth2
 // @Accept json
 // @Produce json
+// @Param Authorization header string true "Bearer 访问令牌"
 // @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Router /connect/userinfo [get]
-func Userinfo(log *zap.Logger) gin.HandlerFunc {
+// @Router /connect/userinfo [post]
+func Userinfo(srv *server.Server, idTokens *oidc.Service, log *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		data := response.Success("hello userinfo")
-		c.JSON(200, data)
+
+		c.Header("Cache-Control", "no-store")
+
+		ti, err := srv.ValidationBearerToken(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token", "error_description": err.Error()})
+			return
+		}
+
+		if ti.GetUserID() == "" || !oidc.HasScope(ti.GetScope(), oidc.ScopeOpenID) {
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope"})
+			return
+		}
+
+		claims, encrypted, err := idTokens.Userinfo(c, ti)
+		if err != nil {
+			log.Error("userinfo error", zap.String("client_id", ti.GetClientID()), zap.Error(err))
+			if errors.Is(err, domainuser.ErrUserNotFound) {
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if encrypted != "" {
+			c.Data(http.StatusOK, "application/jwt", []byte(encrypted))
+			return
+		}
+
+		c.JSON(http.StatusOK, claims)
 	}
 }
 
+// MFAChallengeResponse 密码或短信验证码验证通过但须完成第二步时的登录响应
+type MFAChallengeResponse struct {
+	MFARequired bool     `json:"mfa_required"` // 须调用 /api/v1/user/login/mfa(totp)或 /api/v1/user/login/webauthn(webauthn)完成第二步
+	Methods     []string `json:"methods"`      // 可用的第二步验证方式: totp, webauthn
+}
+
 // Login godoc
 // @Summary Login
-// @Description 用户登录
+// @Description 用户登录;已绑定两步验证的用户返回 mfa_required,须在 user.mfa.login_timeout 内完成第二步
 // @Tags User
 // @Accept json
 // @Produce json
 // @Success 200 {object} map[string]interface{}
 // @Router /api/v1/user/login [post]
-func Login(seesion *session.Session, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+func Login(seesion *session.Session, sessions *sso.Service, users *configs.User, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		param := &user.Login{}
@@ -43,24 +96,148 @@ func Login(seesion *session.Session, userApp *user.UserApp, logger *zap.Logger)
 		if err := c.BindJSON(param); err != nil {
 			logger.Error("bind json failed", zap.Error(err))
 			c.JSON(400, ErrorResponse{Error: "login failed"})
+			return
 		}
 
 		data, err := userApp.LoginHandler.Handle(c, param)
 
+		// 账号不存在、密码错误与用户已禁用返回相同的错误,避免探测账号
+		if errors.Is(err, domainuser.ErrInvalidUserOrPassword) || errors.Is(err, domainuser.ErrUserDisabled) {
+			logger.Warn("login failed", zap.String("account", param.Account), zap.Error(err))
+			c.JSON(401, ErrorResponse{Error: "login failed"})
+			return
+		}
 		if err != nil {
 			logger.Error("login failed", zap.Error(err))
 			c.JSON(500, ErrorResponse{Error: "login failed"})
+			return
+		}
+
+		// 已绑定两步验证的用户只记录待验证的用户ID,完成第二步后才写入会话
+		methods, err := userApp.MFAHandler.Methods(c, data.UserID)
+		if err != nil {
+			logger.Error("get mfa failed", zap.String("user_id", data.UserID), zap.Error(err))
+			c.JSON(500, ErrorResponse{Error: "login failed"})
+			return
+		}
+		if len(methods) > 0 {
+			beginMFALogin(c, seesion, users, data.UserID, "pwd")
+			c.JSON(200, response.Success(MFAChallengeResponse{MFARequired: true, Methods: methods}))
+			return
 		}
 
-		if err = seesion.Set(c.Writer, c.Request, userIdTag, data.UserID); err != nil {
-			logger.Error("set user id to session failed", zap.Error(err))
+		if err = signIn(c, seesion, sessions, data.UserID, "pwd"); err != nil {
+			logger.Error("sign in failed", zap.String("user_id", data.UserID), zap.Error(err))
 			c.JSON(500, ErrorResponse{Error: "login failed"})
+			return
 		}
 
 		c.JSON(200, response.Success(data))
 	}
 }
 
+// LoginMFA godoc
+// @Summary LoginMFA
+// @Description 登录第二步,提交认证器应用中的一次性密码;成功后会话的认证方式为 pwd otp,第一步为短信验证码时为 sms otp
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.MFACode true "一次性密码"
+// @Success 200 {object} response.Response[user.UserInfoDTO]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/login/mfa [post]
+func LoginMFA(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.MFACode{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		userID, ok := pendingMFAUser(c, seesion)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, response.Unauthorized("登录已超时，请重新输入密码"))
+			return
+		}
+
+		if err := userApp.MFAHandler.Verify(c, userID, param.Code); err != nil {
+			mfaError(c, err, logger)
+			return
+		}
+
+		completeLogin(c, seesion, sessions, userApp, userID, secondFactorAMR(c, seesion, "otp"), logger)
+	}
+}
+
+// beginMFALogin 第一步验证通过后记录待完成第二步的用户ID与第一步的认证方式,完成第二步后才写入会话
+func beginMFALogin(c *gin.Context, seesion *session.Session, users *configs.User, userID, firstFactor string) {
+	seesion.Set(c.Writer, c.Request, session.MFAUserIDKey, userID)
+	seesion.Set(c.Writer, c.Request, session.MFADeadlineKey, time.Now().Add(users.MFA.LoginTimeout).Unix())
+	seesion.Set(c.Writer, c.Request, session.MFAFirstFactorKey, firstFactor)
+}
+
+// secondFactorAMR 完成第二步后的认证方式,第一步的认证方式在前,如 "pwd otp"、"sms hwk"
+func secondFactorAMR(c *gin.Context, seesion *session.Session, factor string) string {
+
+	v, _ := seesion.Get(c.Request, session.MFAFirstFactorKey)
+	first, _ := v.(string)
+	if first == "" {
+		first = "pwd"
+	}
+
+	return first + " " + factor
+}
+
+// pendingMFAUser 获取已通过第一步验证、等待完成第二步的用户ID,超时后清除等待状态
+func pendingMFAUser(c *gin.Context, seesion *session.Session) (string, bool) {
+
+	v, _ := seesion.Get(c.Request, session.MFAUserIDKey)
+	d, _ := seesion.Get(c.Request, session.MFADeadlineKey)
+	userID, _ := v.(string)
+	deadline, _ := d.(int64)
+	if userID == "" || time.Now().Unix() > deadline {
+		clearMFALogin(c, seesion)
+		return "", false
+	}
+
+	return userID, true
+}
+
+// completeLogin 完成第二步或免密码验证后登录,返回用户信息
+func completeLogin(c *gin.Context, seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, userID, amr string, logger *zap.Logger) {
+
+	data, err := userApp.LoginHandler.Get(c, userID)
+	if errors.Is(err, domainuser.ErrUserNotFound) || errors.Is(err, domainuser.ErrUserDisabled) {
+		clearMFALogin(c, seesion)
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "login failed"})
+		return
+	}
+	if err != nil {
+		logger.Error("get user failed", zap.String("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+		return
+	}
+
+	clearMFALogin(c, seesion)
+	if err := signIn(c, seesion, sessions, userID, amr); err != nil {
+		logger.Error("sign in failed", zap.String("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, response.Success(data))
+}
+
+// clearMFALogin 清除等待第二步验证的登录状态
+func clearMFALogin(c *gin.Context, seesion *session.Session) {
+	seesion.Delete(c.Writer, c.Request, session.MFAUserIDKey)
+	seesion.Delete(c.Writer, c.Request, session.MFADeadlineKey)
+	seesion.Delete(c.Writer, c.Request, session.MFAFirstFactorKey)
+}
+
 // Logout godoc
 // @Summary Logout
 // @Description 用户登出
@@ -69,7 +246,7 @@ func Login(seesion *session.Session, userApp *user.UserApp, logger *zap.Logger)
 // @Produce json
 // @Success 200 {object} map[string]interface{}
 // @Router /api/v1/user/logout [post]
-func Logout(seesion *session.Session, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
+func Logout(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		userid, err := seesion.Get(c.Request, userIdTag)
@@ -77,6 +254,7 @@ func Logout(seesion *session.Session, userApp *user.UserApp, logger *zap.Logger)
 		if err != nil {
 			logger.Error("get user id from session failed", zap.Error(err))
 			c.JSON(500, ErrorResponse{Error: "logout error"})
+			return
 		}
 
 		// logout log
@@ -84,11 +262,69 @@ func Logout(seesion *session.Session, userApp *user.UserApp, logger *zap.Logger)
 			userApp.LogoutHandler.Handle(c, &user.Logout{UserId: userid.(string)})
 		}
 
-		if err = seesion.Delete(c.Writer, c.Request, userIdTag); err != nil {
-			logger.Error("delete user id from session failed", zap.Error(err))
+		// 结束登录会话
+		if sid, _ := seesion.Get(c.Request, session.SIDKey); sid != nil {
+			if err := sessions.End(c, sid.(string)); err != nil {
+				logger.Error("end login session failed", zap.Error(err))
+			}
+		}
+
+		// 删除服务端会话并使 Cookie 过期
+		if err = seesion.Clear(c.Writer, c.Request); err != nil {
+			logger.Error("clear session failed", zap.Error(err))
 			c.JSON(500, ErrorResponse{Error: "logout error"})
+			return
 		}
 
 		c.JSON(200, response.Success("logout success"))
 	}
 }
+
+// signIn 登录成功后更换会话ID,结束此前登记的登录会话,登记新的登录会话,并在会话中记录用户与认证信息
+// 同一浏览器重新登录(包括切换账号)时旧的登录会话不再残留在会话列表中
+//
+// 参数:
+//
+//	c: 请求上下文
+//	seesion: 会话
+//	sessions: 登录会话服务
+//	userID: 用户ID
+//	amr: 认证方式,多个以空格分隔
+//
+// 返回值:
+//
+//	error: 错误信息
+func signIn(c *gin.Context, seesion *session.Session, sessions *sso.Service, userID, amr string) error {
+
+	// Cookie 中已有的登录会话随本次登录结束
+	if old, _ := seesion.Get(c.Request, session.SIDKey); old != nil {
+		if sid, ok := old.(string); ok {
+			if err := sessions.End(c, sid); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 更换会话ID,防止会话固定攻击;会话中登录前保存的授权请求保留
+	if err := seesion.Regenerate(c.Writer, c.Request); err != nil {
+		return err
+	}
+
+	// 登记登录会话,会话期间签发的令牌记录 sid,撤销会话时一并撤销
+	sess, err := sessions.Start(c, userID, c.ClientIP(), c.Request.UserAgent(), strings.Fields(amr))
+	if err != nil {
+		return err
+	}
+
+	if err := seesion.Set(c.Writer, c.Request, userIdTag, userID); err != nil {
+		return err
+	}
+
+	// 记录认证时间与认证方式,用于访问令牌的 auth_time/amr/acr 声明
+	seesion.Set(c.Writer, c.Request, session.AuthTimeKey, time.Now().Unix())
+	seesion.Set(c.Writer, c.Request, session.AMRKey, amr)
+	seesion.Set(c.Writer, c.Request, session.ACRKey, token.ACRForAMR(strings.Fields(amr)))
+	seesion.Set(c.Writer, c.Request, session.SIDKey, sess.SID)
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// newTestSessions 创建内存会话与登录会话服务
+func newTestSessions(t *testing.T) (*session.Session, *sso.Service) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	scfg, err := configs.NewSession(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := sso.NewService(scfg, sso.NewMemoryStore(), token.NewMemotyTokenStore(logger), audit.NewLogRecorder(logger), logger)
+
+	sess, err := session.NewSession(session.Options{}, session.NewMemoryBackend(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sess, sessions
+}
+
+// newTestContext 创建带 cookies 的请求上下文
+func newTestContext(cookies []*http.Cookie) (*gin.Context, *httptest.ResponseRecorder) {
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	for _, v := range cookies {
+		c.Request.AddCookie(v)
+	}
+
+	return c, w
+}
+
+// testSignIn 使用 cookies 中的会话登录,返回响应设置的 Cookie
+func testSignIn(t *testing.T, sess *session.Session, sessions *sso.Service, cookies []*http.Cookie, userID, amr string) []*http.Cookie {
+	t.Helper()
+
+	c, w := newTestContext(cookies)
+	if err := signIn(c, sess, sessions, userID, amr); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()
+}
+
+func TestSignInEndsPreviousSession(t *testing.T) {
+
+	sess, sessions := newTestSessions(t)
+	ctx := context.Background()
+
+	cookies := testSignIn(t, sess, sessions, nil, "1", "pwd")
+	first, err := sessions.List(ctx, "1")
+	if err != nil || len(first) != 1 {
+		t.Fatalf("sessions after first login: %d, %v", len(first), err)
+	}
+
+	// 同一浏览器切换账号登录,原账号的登录会话随之结束
+	testSignIn(t, sess, sessions, cookies, "2", "pwd")
+	if list, _ := sessions.List(ctx, "1"); len(list) != 0 {
+		t.Fatalf("previous session not ended: %d sessions", len(list))
+	}
+	if list, _ := sessions.List(ctx, "2"); len(list) != 1 {
+		t.Fatalf("new session not started: %d sessions", len(list))
+	}
+}
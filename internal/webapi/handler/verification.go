@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// VerificationResponse 联系方式验证状态响应
+type VerificationResponse struct {
+	*user.VerificationDTO
+	ContinueURL string `json:"continue_url,omitempty"` // 有待完成的授权请求时,验证完成后前端跳转到该地址继续授权
+}
+
+// GetVerification godoc
+// @Summary GetVerification
+// @Description 获取当前用户邮箱与手机号的验证状态
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[VerificationResponse]
+// @Failure 401 {object} response.Response[any]
+// @Router /api/v1/user/verification [get]
+func GetVerification(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		data, err := userApp.VerificationHandler.Status(c, current.UserID)
+		if err != nil {
+			verificationError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(VerificationResponse{VerificationDTO: data, ContinueURL: continueURL(c, seesion)}))
+	}
+}
+
+// SendEmailVerification godoc
+// @Summary SendEmailVerification
+// @Description 向当前用户的邮箱发送验证链接,之前发送的链接失效
+// @Tags User
+// @Produce json
+// @Success 202 {object} response.Response[any]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 409 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/verification/email [post]
+func SendEmailVerification(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		if err := userApp.VerificationHandler.SendEmail(c, current.UserID); err != nil {
+			verificationError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, response.Success[any](nil))
+	}
+}
+
+// ConfirmEmailVerification godoc
+// @Summary ConfirmEmailVerification
+// @Description 使用验证邮件中的令牌验证邮箱,不要求登录;浏览器已登录同一用户且有待完成的授权请求时返回 continue_url
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.VerifyEmail true "验证令牌"
+// @Success 200 {object} response.Response[VerificationResponse]
+// @Failure 400 {object} response.Response[any]
+// @Router /api/v1/user/verification/email/confirm [post]
+func ConfirmEmailVerification(seesion *session.Session, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.VerifyEmail{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		userID, err := userApp.VerificationHandler.ConfirmEmail(c, param.Token)
+		if err != nil {
+			verificationError(c, err, log)
+			return
+		}
+
+		// 验证链接可能在其他浏览器中打开,只向同一用户返回验证状态
+		resp := VerificationResponse{}
+		if v, _ := seesion.Get(c.Request, userIdTag); v == userID {
+			if resp.VerificationDTO, err = userApp.VerificationHandler.Status(c, userID); err != nil {
+				verificationError(c, err, log)
+				return
+			}
+			resp.ContinueURL = continueURL(c, seesion)
+		}
+
+		c.JSON(http.StatusOK, response.Success(resp))
+	}
+}
+
+// SendPhoneVerification godoc
+// @Summary SendPhoneVerification
+// @Description 向当前用户的手机号发送短信验证码,之前发送的验证码失效
+// @Tags User
+// @Produce json
+// @Success 202 {object} response.Response[any]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 409 {object} response.Response[any]
+// @Failure 429 {object} response.Response[any]
+// @Router /api/v1/user/verification/phone [post]
+func SendPhoneVerification(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		if err := userApp.VerificationHandler.SendPhoneCode(c, current.UserID); err != nil {
+			verificationError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, response.Success[any](nil))
+	}
+}
+
+// ConfirmPhoneVerification godoc
+// @Summary ConfirmPhoneVerification
+// @Description 使用短信验证码验证当前用户的手机号,输错超过次数后须重新发送
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.VerifyPhone true "短信验证码"
+// @Success 200 {object} response.Response[VerificationResponse]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Router /api/v1/user/verification/phone/confirm [post]
+func ConfirmPhoneVerification(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		param := &user.VerifyPhone{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		if err := userApp.VerificationHandler.ConfirmPhone(c, current.UserID, param.Code); err != nil {
+			verificationError(c, err, log)
+			return
+		}
+
+		data, err := userApp.VerificationHandler.Status(c, current.UserID)
+		if err != nil {
+			verificationError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(VerificationResponse{VerificationDTO: data, ContinueURL: continueURL(c, seesion)}))
+	}
+}
+
+// requireSession 读取当前登录会话,未登录时输出 401
+func requireSession(c *gin.Context, seesion *session.Session, sessions *sso.Service, log *zap.Logger) (*sso.Session, bool) {
+
+	current, err := currentSession(c, seesion, sessions)
+	if err != nil {
+		log.Error("get login session failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+		return nil, false
+	}
+	if current == nil {
+		c.JSON(http.StatusUnauthorized, response.Unauthorized())
+		return nil, false
+	}
+
+	return current, true
+}
+
+// verificationError 输出联系方式验证错误
+func verificationError(c *gin.Context, err error, log *zap.Logger) {
+	switch {
+	case errors.Is(err, domainuser.ErrVerificationInvalid):
+		c.JSON(http.StatusBadRequest, response.BadRequest("验证链接或验证码无效或已过期"))
+	case errors.Is(err, user.ErrNoContact):
+		c.JSON(http.StatusBadRequest, response.BadRequest("未绑定邮箱或手机号"))
+	case errors.Is(err, user.ErrAlreadyVerified):
+		c.JSON(http.StatusConflict, response.Conflict("已验证"))
+	case errors.Is(err, user.ErrRateLimited):
+		c.JSON(http.StatusTooManyRequests, response.TooManyRequests())
+	case errors.Is(err, domainuser.ErrUserNotFound):
+		c.JSON(http.StatusUnauthorized, response.Unauthorized())
+	default:
+		log.Error("verification failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+	}
+}
@@ -0,0 +1,372 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/app/user"
+	domainuser "github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/response"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// WebAuthnCredentials godoc
+// @Summary WebAuthnCredentials
+// @Description 获取当前用户注册的安全密钥与通行密钥
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[[]user.WebAuthnCredentialDTO]
+// @Failure 401 {object} response.Response[any]
+// @Router /api/v1/user/webauthn/credentials [get]
+func WebAuthnCredentials(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		data, err := userApp.WebAuthnHandler.Credentials(c, current.UserID)
+		if err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(data))
+	}
+}
+
+// BeginWebAuthnRegistration godoc
+// @Summary BeginWebAuthnRegistration
+// @Description 开始注册安全密钥或通行密钥,返回 navigator.credentials.create() 的参数;已绑定两步验证的用户须在 user.mfa.reauth_window 内完成过两步验证
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[map[string]interface{}]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 409 {object} response.Response[any]
+// @Router /api/v1/user/webauthn/credentials/options [post]
+func BeginWebAuthnRegistration(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireReauth(c, seesion, sessions, userApp, log)
+		if !ok {
+			return
+		}
+
+		creation, state, err := userApp.WebAuthnHandler.BeginRegistration(c, current.UserID)
+		if err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		seesion.Set(c.Writer, c.Request, session.WebAuthnRegistrationKey, state)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response.Success(creation))
+	}
+}
+
+// FinishWebAuthnRegistration godoc
+// @Summary FinishWebAuthnRegistration
+// @Description 提交认证器创建的凭据完成注册,须与开始注册在同一会话内
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.WebAuthnRegistration true "凭据与名称"
+// @Success 200 {object} response.Response[user.WebAuthnCredentialDTO]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Router /api/v1/user/webauthn/credentials [post]
+func FinishWebAuthnRegistration(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		param := &user.WebAuthnRegistration{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		data, err := userApp.WebAuthnHandler.FinishRegistration(c, current.UserID, takeWebAuthnState(c, seesion, session.WebAuthnRegistrationKey), param)
+		if err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success(data))
+	}
+}
+
+// RenameWebAuthnCredential godoc
+// @Summary RenameWebAuthnCredential
+// @Description 修改安全密钥或通行密钥的名称
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param id path string true "凭据ID"
+// @Param body body user.WebAuthnRename true "名称"
+// @Success 200 {object} response.Response[any]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 404 {object} response.Response[any]
+// @Router /api/v1/user/webauthn/credentials/{id} [patch]
+func RenameWebAuthnCredential(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		param := &user.WebAuthnRename{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		if err := userApp.WebAuthnHandler.RenameCredential(c, current.UserID, c.Param("id"), param.Name); err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success[any](nil))
+	}
+}
+
+// DeleteWebAuthnCredential godoc
+// @Summary DeleteWebAuthnCredential
+// @Description 删除安全密钥或通行密钥,须在 user.mfa.reauth_window 内完成过两步验证;用户须两步验证时不能删除最后一个验证方式
+// @Tags User
+// @Produce json
+// @Param id path string true "凭据ID"
+// @Success 200 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Failure 404 {object} response.Response[any]
+// @Router /api/v1/user/webauthn/credentials/{id} [delete]
+func DeleteWebAuthnCredential(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireReauth(c, seesion, sessions, userApp, log)
+		if !ok {
+			return
+		}
+
+		if err := userApp.WebAuthnHandler.DeleteCredential(c, current.UserID, c.Param("id")); err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		c.JSON(http.StatusOK, response.Success[any](nil))
+	}
+}
+
+// BeginWebAuthnLogin godoc
+// @Summary BeginWebAuthnLogin
+// @Description 开始 WebAuthn 登录,返回 navigator.credentials.get() 的参数;密码验证通过等待第二步时只允许该用户的凭据,否则为免密码登录,由通行密钥确定用户
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[map[string]interface{}]
+// @Router /api/v1/user/login/webauthn/options [post]
+func BeginWebAuthnLogin(seesion *session.Session, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID, _ := pendingMFAUser(c, seesion)
+
+		assertion, state, err := userApp.WebAuthnHandler.BeginLogin(c, userID)
+		if err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		seesion.Set(c.Writer, c.Request, session.WebAuthnLoginKey, state)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response.Success(assertion))
+	}
+}
+
+// FinishWebAuthnLogin godoc
+// @Summary FinishWebAuthnLogin
+// @Description 提交认证器的签名完成登录;作为第二步时会话的认证方式为 pwd hwk(第一步为短信验证码时为 sms hwk),免密码登录须用户验证,认证方式为 hwk mfa
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.WebAuthnAssertion true "凭据"
+// @Success 200 {object} response.Response[user.UserInfoDTO]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Router /api/v1/user/login/webauthn [post]
+func FinishWebAuthnLogin(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		param := &user.WebAuthnAssertion{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		// 挑战只能使用一次,校验前即从会话中删除
+		state := takeWebAuthnState(c, seesion, session.WebAuthnLoginKey)
+		pending, _ := pendingMFAUser(c, seesion)
+
+		result, err := userApp.WebAuthnHandler.FinishLogin(c, pending, state, param)
+		if errors.Is(err, domainuser.ErrUserDisabled) {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "login failed"})
+			return
+		}
+		if err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		// 免密码登录要求用户验证,持有认证器并通过指纹或 PIN 验证视为两种认证因素
+		amr := "hwk mfa"
+		if pending != "" {
+			amr = secondFactorAMR(c, seesion, "hwk")
+		}
+
+		completeLogin(c, seesion, sessions, userApp, result.UserID, amr, log)
+	}
+}
+
+// BeginWebAuthnStepUp godoc
+// @Summary BeginWebAuthnStepUp
+// @Description 已登录但未完成两步验证的会话开始使用安全密钥补充验证,返回 navigator.credentials.get() 的参数
+// @Tags User
+// @Produce json
+// @Success 200 {object} response.Response[map[string]interface{}]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Router /api/v1/user/mfa/webauthn/options [post]
+func BeginWebAuthnStepUp(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		assertion, state, err := userApp.WebAuthnHandler.BeginLogin(c, current.UserID)
+		if err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		seesion.Set(c.Writer, c.Request, session.WebAuthnLoginKey, state)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response.Success(assertion))
+	}
+}
+
+// FinishWebAuthnStepUp godoc
+// @Summary FinishWebAuthnStepUp
+// @Description 提交安全密钥的签名完成补充验证,当前会话视为已完成两步验证
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param body body user.WebAuthnAssertion true "凭据"
+// @Success 200 {object} response.Response[MFAResponse]
+// @Failure 400 {object} response.Response[any]
+// @Failure 401 {object} response.Response[any]
+// @Failure 403 {object} response.Response[any]
+// @Router /api/v1/user/mfa/webauthn [post]
+func FinishWebAuthnStepUp(seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		current, ok := requireSession(c, seesion, sessions, log)
+		if !ok {
+			return
+		}
+
+		param := &user.WebAuthnAssertion{}
+		if err := c.ShouldBindJSON(param); err != nil {
+			c.JSON(http.StatusBadRequest, response.BadRequest())
+			return
+		}
+
+		if _, err := userApp.WebAuthnHandler.FinishLogin(c, current.UserID, takeWebAuthnState(c, seesion, session.WebAuthnLoginKey), param); err != nil {
+			webAuthnError(c, err, log)
+			return
+		}
+
+		if err := stepUp(c, seesion, sessions, current, "hwk"); err != nil {
+			log.Error("step up login session failed", zap.String("sid", current.SID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, response.InternalServerError())
+			return
+		}
+
+		mfaStatus(c, seesion, current, userApp, log)
+	}
+}
+
+// requireMultiFactor 要求已登录;用户已绑定两步验证时,会话须已完成两步验证,防止只知道密码的人添加或删除验证方式
+func requireMultiFactor(c *gin.Context, seesion *session.Session, sessions *sso.Service, userApp *user.UserApp, log *zap.Logger) (*sso.Session, bool) {
+
+	current, ok := requireSession(c, seesion, sessions, log)
+	if !ok {
+		return nil, false
+	}
+
+	if token.ACRForAMR(current.AMR) == token.ACRMultiFactor {
+		return current, true
+	}
+
+	methods, err := userApp.MFAHandler.Methods(c, current.UserID)
+	if err != nil {
+		log.Error("get mfa failed", zap.String("user_id", current.UserID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+		return nil, false
+	}
+	if len(methods) > 0 {
+		c.JSON(http.StatusForbidden, response.Forbidden("请先完成两步验证"))
+		return nil, false
+	}
+
+	return current, true
+}
+
+// takeWebAuthnState 取出会话中的挑战状态并删除,每个挑战只能使用一次
+func takeWebAuthnState(c *gin.Context, seesion *session.Session, key string) string {
+
+	v, _ := seesion.Get(c.Request, key)
+	seesion.Delete(c.Writer, c.Request, key)
+
+	state, _ := v.(string)
+	return state
+}
+
+// webAuthnError 输出 WebAuthn 错误
+func webAuthnError(c *gin.Context, err error, log *zap.Logger) {
+	switch {
+	case errors.Is(err, user.ErrWebAuthnInvalid):
+		log.Warn("webauthn verification failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, response.BadRequest("安全密钥验证失败"))
+	case errors.Is(err, user.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, response.BadRequest("未注册安全密钥"))
+	case errors.Is(err, user.ErrWebAuthnNotAllowed):
+		c.JSON(http.StatusForbidden, response.Forbidden("不支持该型号的安全密钥"))
+	case errors.Is(err, user.ErrWebAuthnCloned):
+		c.JSON(http.StatusForbidden, response.Forbidden("安全密钥可能已被复制，请删除后重新注册"))
+	case errors.Is(err, user.ErrWebAuthnLastFactor):
+		c.JSON(http.StatusForbidden, response.Forbidden("账号须两步验证，不能删除最后一个验证方式"))
+	case errors.Is(err, user.ErrWebAuthnLimit):
+		c.JSON(http.StatusConflict, response.Conflict("安全密钥数量已达上限"))
+	case errors.Is(err, user.ErrWebAuthnNotFound):
+		c.JSON(http.StatusNotFound, response.NotFound("安全密钥不存在"))
+	case errors.Is(err, domainuser.ErrUserNotFound):
+		c.JSON(http.StatusUnauthorized, response.Unauthorized())
+	default:
+		log.Error("webauthn failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, response.InternalServerError())
+	}
+}
@@ -0,0 +1,61 @@
+package ciba
+
+import (
+	"errors"
+	"net/http"
+
+	oerrors "github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+)
+
+// CIBA 规范定义的错误码
+var (
+	ErrAuthorizationPending = errors.New("authorization_pending") // 用户尚未确认
+	ErrSlowDown             = errors.New("slow_down")             // 轮询过于频繁
+	ErrExpiredToken         = errors.New("expired_token")         // auth_req_id 已过期
+	ErrUnknownUserID        = errors.New("unknown_user_id")       // login_hint 无法识别用户
+	ErrUnknownAuthReq       = errors.New("unknown auth_req_id")   // auth_req_id 不存在
+)
+
+var descriptions = map[error]string{
+	ErrAuthorizationPending:           "The authorization request is still pending",
+	ErrSlowDown:                       "The client is polling too quickly",
+	ErrExpiredToken:                   "The auth_req_id has expired",
+	ErrUnknownUserID:                  "The login hint does not identify a known user",
+	oerrors.ErrAccessDenied:           oerrors.Descriptions[oerrors.ErrAccessDenied],
+	oerrors.ErrInvalidClient:          oerrors.Descriptions[oerrors.ErrInvalidClient],
+	oerrors.ErrInvalidGrant:           oerrors.Descriptions[oerrors.ErrInvalidGrant],
+	oerrors.ErrInvalidRequest:         oerrors.Descriptions[oerrors.ErrInvalidRequest],
+	oerrors.ErrInvalidScope:           oerrors.Descriptions[oerrors.ErrInvalidScope],
+	oerrors.ErrUnauthorizedClient:     oerrors.Descriptions[oerrors.ErrUnauthorizedClient],
+	oerrors.ErrUnsupportedGrantType:   oerrors.Descriptions[oerrors.ErrUnsupportedGrantType],
+	oerrors.ErrTemporarilyUnavailable: oerrors.Descriptions[oerrors.ErrTemporarilyUnavailable],
+}
+
+// NewErrorResponse 将错误转换为 CIBA 错误响应
+// 未知错误统一按 server_error 处理
+func NewErrorResponse(err error) *oerrors.Response {
+
+	if errors.Is(err, ErrUnknownAuthReq) {
+		err = oerrors.ErrInvalidGrant
+	}
+	if re := token.NewErrorResponse(err); re != nil {
+		return re
+	}
+
+	desc, ok := descriptions[err]
+	if !ok {
+		re := oerrors.NewResponse(oerrors.ErrServerError, http.StatusInternalServerError)
+		re.Description = oerrors.Descriptions[oerrors.ErrServerError]
+		return re
+	}
+
+	status := http.StatusBadRequest
+	if err == oerrors.ErrInvalidClient {
+		status = http.StatusUnauthorized
+	}
+
+	re := oerrors.NewResponse(err, status)
+	re.Description = desc
+	return re
+}
@@ -0,0 +1,44 @@
+package ciba
+
+import (
+	"context"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/zap"
+)
+
+// Notifier 认证设备通知者
+// 负责把待确认的认证请求送达用户的认证设备(如手机App推送)
+type Notifier interface {
+	Notify(ctx context.Context, req *AuthRequest) error
+}
+
+// LogNotifier 本地桩实现,仅把认证请求写入日志
+// 用于本地联调: 从日志中取得 auth_req_id 后调用 /connect/ciba/complete 完成确认
+type LogNotifier struct {
+	*zap.Logger
+}
+
+// Notify 输出认证请求
+func (n *LogNotifier) Notify(ctx context.Context, req *AuthRequest) error {
+	n.Info("CIBA authentication request pending",
+		zap.String("auth_req_id", req.ID),
+		zap.String("user_id", req.UserID),
+		zap.String("client_id", req.ClientID),
+		zap.String("scope", req.Scope),
+		zap.String("binding_message", req.BindingMessage),
+	)
+	return nil
+}
+
+// NewNotifier 根据配置创建认证设备通知者
+func NewNotifier(cfg *configs.OAuth2, logger *zap.Logger) Notifier {
+
+	switch cfg.CIBA.Notifier {
+	case "", "log":
+		return &LogNotifier{Logger: logger}
+	default:
+		logger.Warn("unknown CIBA notifier, fallback to log", zap.String("notifier", cfg.CIBA.Notifier))
+		return &LogNotifier{Logger: logger}
+	}
+}
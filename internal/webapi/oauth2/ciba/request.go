@@ -0,0 +1,52 @@
+package ciba
+
+import (
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+)
+
+// GrantType CIBA 授权类型
+const GrantType oauth2.GrantType = "urn:openid:params:grant-type:ciba"
+
+// DeliveryMode 令牌投递模式
+type DeliveryMode string
+
+const (
+	Poll DeliveryMode = "poll" // 客户端轮询令牌端点
+	Ping DeliveryMode = "ping" // 认证完成后通知客户端,客户端再到令牌端点取令牌
+	Push DeliveryMode = "push" // 认证完成后直接把令牌推送给客户端
+)
+
+// Status 认证请求状态
+type Status int
+
+const (
+	Pending  Status = iota // 等待用户确认
+	Approved               // 用户已同意
+	Denied                 // 用户已拒绝
+	Issued                 // 令牌已发放
+)
+
+// AuthRequest 后端认证请求
+type AuthRequest struct {
+	ID                      string       // auth_req_id
+	ClientID                string       // 客户端ID
+	UserID                  string       // 被认证的用户ID
+	Scope                   string       // 请求的权限范围
+	BindingMessage          string       // 同时显示在消费设备和认证设备上的绑定信息
+	ClientNotificationToken string       // ping/push 模式下回调客户端使用的令牌
+	DeliveryMode            DeliveryMode // 令牌投递模式
+	Status                  Status       // 当前状态
+	AMR                     []string     // 用户确认时登录会话的认证方式,写入签发的令牌
+	ApprovedAt              time.Time    // 用户确认的时间,作为签发令牌的 auth_time
+	Interval                time.Duration
+	CreatedAt               time.Time
+	ExpiresAt               time.Time
+	LastPolledAt            time.Time
+}
+
+// Expired 判断认证请求是否已过期
+func (r *AuthRequest) Expired(now time.Time) bool {
+	return now.After(r.ExpiresAt)
+}
@@ -0,0 +1,557 @@
+package ciba
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/client"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/oidc"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"go.uber.org/zap"
+)
+
+const (
+	slowDownStep      = 5 * time.Second // 触发 slow_down 后轮询间隔的增量
+	maxBindingMessage = 64              // binding_message 最大长度
+)
+
+// Service CIBA 后端认证服务
+type Service struct {
+	*zap.Logger
+	cfg            *configs.OAuth2
+	store          Store
+	notifier       Notifier
+	repo           user.UserRepository
+	totps          user.TOTPRepository
+	credentials    user.WebAuthnCredentialRepository
+	clientStore    oauth2.ClientStore
+	accessGenerate oauth2.AccessGenerate
+	tokenStore     oauth2.TokenStore
+	idTokens       *oidc.Service
+	httpClient     *http.Client
+}
+
+// NewService 创建 CIBA 后端认证服务
+func NewService(cfg *configs.OAuth2, store Store, notifier Notifier, repo user.UserRepository, totps user.TOTPRepository, credentials user.WebAuthnCredentialRepository, clientStore oauth2.ClientStore, accessGenerate oauth2.AccessGenerate, tokenStore oauth2.TokenStore, idTokens *oidc.Service, logger *zap.Logger) *Service {
+	return &Service{
+		Logger:         logger,
+		cfg:            cfg,
+		store:          store,
+		notifier:       notifier,
+		repo:           repo,
+		totps:          totps,
+		credentials:    credentials,
+		clientStore:    clientStore,
+		accessGenerate: accessGenerate,
+		tokenStore:     tokenStore,
+		idTokens:       idTokens,
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled 是否启用 CIBA
+func (s *Service) Enabled() bool {
+	return s.cfg.CIBA != nil && s.cfg.CIBA.Enabled
+}
+
+// Authenticate 处理后端认证请求
+//
+// 参数:
+//
+//	r *http.Request: /connect/ciba 请求
+//
+// 返回值:
+//
+//	*AuthRequest: 已创建的认证请求
+//	error: 错误信息
+func (s *Service) Authenticate(r *http.Request) (*AuthRequest, error) {
+
+	ctx := r.Context()
+
+	cli, err := s.authenticateClient(r)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.cfg.GetClient(cli.GetID())
+	if err != nil {
+		return nil, errors.ErrInvalidClient
+	}
+
+	if !client.ContainsGrantType(string(GrantType)) {
+		s.Error("ciba Authenticate Error: grant_type is invalid", zap.String("client_id", client.ID))
+		return nil, errors.ErrUnauthorizedClient
+	}
+
+	mode := DeliveryMode(client.BackchannelTokenDeliveryMode)
+	if mode == "" {
+		mode = Poll
+	}
+
+	notificationToken := r.Form.Get("client_notification_token")
+	switch mode {
+	case Poll:
+	case Ping, Push:
+		if client.BackchannelClientNotificationEndpoint == "" {
+			s.Error("ciba Authenticate Error: notification endpoint is not registered", zap.String("client_id", client.ID))
+			return nil, errors.ErrUnauthorizedClient
+		}
+		if notificationToken == "" {
+			return nil, errors.ErrInvalidRequest
+		}
+	default:
+		s.Error("ciba Authenticate Error: delivery mode is invalid", zap.String("client_id", client.ID), zap.String("mode", string(mode)))
+		return nil, errors.ErrUnauthorizedClient
+	}
+
+	// 校验 scope, CIBA 要求必须包含 openid
+	scope := strings.Join(strings.Fields(r.Form.Get("scope")), " ")
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return nil, errors.ErrInvalidScope
+	}
+	hasOpenID := false
+	for _, v := range scopes {
+		if v == "openid" {
+			hasOpenID = true
+		}
+		if !client.ContainsScope(v) {
+			s.Error("ciba Authenticate Error: scope is invalid", zap.String("client_id", client.ID), zap.String("scope", v))
+			return nil, errors.ErrInvalidScope
+		}
+	}
+	if !hasOpenID {
+		return nil, errors.ErrInvalidScope
+	}
+
+	// 仅支持 login_hint
+	if r.Form.Get("login_hint_token") != "" || r.Form.Get("id_token_hint") != "" {
+		return nil, errors.ErrInvalidRequest
+	}
+	loginHint := r.Form.Get("login_hint")
+	if loginHint == "" {
+		return nil, errors.ErrInvalidRequest
+	}
+
+	bindingMessage := r.Form.Get("binding_message")
+	if len([]rune(bindingMessage)) > maxBindingMessage {
+		return nil, errors.ErrInvalidRequest
+	}
+
+	u, err := s.repo.GetUserInfoByAccount(ctx, loginHint)
+	if err != nil {
+		s.Error("ciba Authenticate Error: login_hint is unknown", zap.String("client_id", client.ID), zap.Error(err))
+		return nil, ErrUnknownUserID
+	}
+	if u.Status == user.Disable {
+		s.Error("ciba Authenticate Error: user is disabled", zap.String("client_id", client.ID), zap.String("user_id", u.ID))
+		return nil, ErrUnknownUserID
+	}
+	if missing := u.Unverified(client.RequireVerified); len(missing) > 0 {
+		s.Error("ciba Authenticate Error: contact is not verified", zap.String("client_id", client.ID), zap.String("user_id", u.ID), zap.Strings("unverified", missing))
+		return nil, errors.ErrAccessDenied
+	}
+
+	expiresIn := time.Duration(s.cfg.CIBA.ExpiresIn) * time.Second
+	if v := r.Form.Get("requested_expiry"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, errors.ErrInvalidRequest
+		}
+		if d := time.Duration(n) * time.Second; d < expiresIn {
+			expiresIn = d
+		}
+	}
+
+	id, err := newAuthReqID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	req := &AuthRequest{
+		ID:                      id,
+		ClientID:                client.ID,
+		UserID:                  u.ID,
+		Scope:                   scope,
+		BindingMessage:          bindingMessage,
+		ClientNotificationToken: notificationToken,
+		DeliveryMode:            mode,
+		Status:                  Pending,
+		Interval:                time.Duration(s.cfg.CIBA.Interval) * time.Second,
+		CreatedAt:               now,
+		ExpiresAt:               now.Add(expiresIn),
+	}
+
+	if err := s.store.Create(ctx, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.notifier.Notify(ctx, req); err != nil {
+		s.Error("ciba Authenticate Error: notify authentication device failed", zap.String("auth_req_id", req.ID), zap.Error(err))
+		s.store.Delete(ctx, req.ID)
+		return nil, errors.ErrTemporarilyUnavailable
+	}
+
+	return req, nil
+}
+
+// Complete 认证设备上的用户确认或拒绝认证请求
+//
+// 参数:
+//
+//	ctx context.Context: 上下文
+//	id string: auth_req_id
+//	userID string: 当前在认证设备上登录的用户ID
+//	amr []string: 认证设备上登录会话的认证方式
+//	approved bool: 是否同意
+//
+// 返回值:
+//
+//	error: 错误信息
+func (s *Service) Complete(ctx context.Context, id, userID string, amr []string, approved bool) error {
+
+	req, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if req.UserID != userID {
+		s.Error("ciba Complete Error: user mismatch", zap.String("auth_req_id", id), zap.String("user_id", userID))
+		return errors.ErrAccessDenied
+	}
+
+	if req.Expired(time.Now()) {
+		s.store.Delete(ctx, id)
+		return ErrExpiredToken
+	}
+
+	if req.Status != Pending {
+		return errors.ErrInvalidRequest
+	}
+
+	// 须两步验证时,认证设备上的会话须已完成两步验证才能同意;请求保持待确认,补充验证后可再次确认
+	if approved {
+		needMFA, err := s.requiresMFA(ctx, req)
+		if err != nil {
+			return err
+		}
+		if needMFA && token.ACRForAMR(amr) != token.ACRMultiFactor {
+			s.Error("ciba Complete Error: mfa is required", zap.String("auth_req_id", id), zap.String("user_id", userID))
+			return errors.ErrAccessDenied
+		}
+	}
+
+	req.Status = Denied
+	if approved {
+		req.Status = Approved
+		req.AMR = amr
+		req.ApprovedAt = time.Now()
+	}
+
+	// 并发确认时只有一次能从待确认状态写入,push 模式下令牌只推送一次
+	if err := s.store.Update(ctx, req, Pending); err != nil {
+		if err == ErrUnknownAuthReq {
+			return errors.ErrInvalidRequest
+		}
+		return err
+	}
+
+	switch req.DeliveryMode {
+	case Ping:
+		s.notifyClient(ctx, req, map[string]interface{}{"auth_req_id": req.ID})
+	case Push:
+		s.push(ctx, req)
+	}
+
+	return nil
+}
+
+// Token 处理 urn:openid:params:grant-type:ciba 令牌请求
+//
+// 参数:
+//
+//	r *http.Request: 令牌请求
+//
+// 返回值:
+//
+//	oauth2.TokenInfo: 令牌信息
+//	error: 错误信息
+func (s *Service) Token(r *http.Request) (oauth2.TokenInfo, error) {
+
+	ctx := r.Context()
+
+	cli, err := s.authenticateClient(r)
+	if err != nil {
+		return nil, err
+	}
+
+	id := r.Form.Get("auth_req_id")
+	if id == "" {
+		return nil, errors.ErrInvalidRequest
+	}
+
+	req, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ClientID != cli.GetID() {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	// push 模式下令牌由服务端直接推送,不允许轮询
+	if req.DeliveryMode == Push {
+		return nil, errors.ErrUnauthorizedClient
+	}
+
+	now := time.Now()
+	if req.Expired(now) {
+		s.store.Delete(ctx, id)
+		return nil, ErrExpiredToken
+	}
+
+	// 轮询记录只在仍待确认时写入,不覆盖并发的确认结果;
+	// 已确认或已拒绝的请求先原子地取出再处理,并发的令牌请求只有一个能取得并发放令牌
+	switch req.Status {
+	case Pending:
+		if req.DeliveryMode == Poll && !req.LastPolledAt.IsZero() && now.Sub(req.LastPolledAt) < req.Interval {
+			req.Interval += slowDownStep
+			req.LastPolledAt = now
+			s.store.Update(ctx, req, Pending)
+			return nil, ErrSlowDown
+		}
+		req.LastPolledAt = now
+		s.store.Update(ctx, req, Pending)
+		return nil, ErrAuthorizationPending
+	case Denied:
+		if _, err := s.store.Take(ctx, id, Denied); err != nil {
+			return nil, err
+		}
+		return nil, errors.ErrAccessDenied
+	case Approved:
+		req, err := s.store.Take(ctx, id, Approved)
+		if err != nil {
+			return nil, err
+		}
+		return s.issue(ctx, cli, req, r)
+	default:
+		return nil, errors.ErrInvalidGrant
+	}
+}
+
+// TokenData 令牌响应数据,授权范围包含 openid 时附带发放令牌时签发的 ID Token
+func (s *Service) TokenData(ctx context.Context, ti oauth2.TokenInfo) (map[string]interface{}, error) {
+	data := map[string]interface{}{
+		"access_token": ti.GetAccess(),
+		"token_type":   s.cfg.Manager.TokenType,
+		"expires_in":   int64(ti.GetAccessExpiresIn() / time.Second),
+	}
+
+	if scope := ti.GetScope(); scope != "" {
+		data["scope"] = scope
+	}
+
+	if it, ok := ti.(*issuedToken); ok && it.idToken != "" {
+		data["id_token"] = it.idToken
+	}
+
+	return data, nil
+}
+
+// issuedToken 附带已签发 ID Token 的令牌信息
+type issuedToken struct {
+	oauth2.TokenInfo
+	idToken string
+}
+
+// issue 为已确认的认证请求发放令牌
+func (s *Service) issue(ctx context.Context, cli oauth2.ClientInfo, req *AuthRequest, r *http.Request) (oauth2.TokenInfo, error) {
+
+	ti := models.NewToken()
+	ti.SetClientID(req.ClientID)
+	ti.SetUserID(req.UserID)
+	ti.SetScope(req.Scope)
+
+	createAt := time.Now()
+	ti.SetAccessCreateAt(createAt)
+	ti.SetAccessExpiresIn(s.cfg.AccessTokenLifetime(req.ClientID, GrantType.String()))
+	ti.SetExtension(url.Values{
+		token.GrantExtension:    {GrantType.String()},
+		token.AuthTimeExtension: {strconv.FormatInt(req.ApprovedAt.Unix(), 10)},
+		token.AMRExtension:      {strings.Join(req.AMR, " ")},
+		token.ACRExtension:      {token.ACRForAMR(req.AMR)},
+	})
+
+	td := &oauth2.GenerateBasic{
+		Client:    cli,
+		UserID:    req.UserID,
+		CreateAt:  createAt,
+		TokenInfo: ti,
+		Request:   r,
+	}
+
+	av, _, err := s.accessGenerate.Token(ctx, td, false)
+	if err != nil {
+		return nil, err
+	}
+	ti.SetAccess(av)
+
+	// 先签发 ID Token 再保存令牌,签发失败时不留下客户端未收到的访问令牌
+	idToken, err := s.idTokens.IDToken(ctx, ti)
+	if err != nil {
+		s.Error("ciba issue Error: issue id token failed", zap.String("auth_req_id", req.ID), zap.Error(err))
+		return nil, errors.ErrServerError
+	}
+
+	if err := s.tokenStore.Create(ctx, ti); err != nil {
+		return nil, err
+	}
+
+	return &issuedToken{TokenInfo: ti, idToken: idToken}, nil
+}
+
+// requiresMFA 判断认证请求是否须两步验证:用户须两步验证或已绑定一次性密码、WebAuthn 凭据,或客户端要求两步验证
+func (s *Service) requiresMFA(ctx context.Context, req *AuthRequest) (bool, error) {
+
+	if client, err := s.cfg.GetClient(req.ClientID); err == nil && client.RequireMFA {
+		return true, nil
+	}
+
+	u, err := s.repo.GetUserInfoByID(ctx, req.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	return user.RequiresMFA(ctx, s.totps, s.credentials, u)
+}
+
+// push push 模式下把令牌或错误推送给客户端
+func (s *Service) push(ctx context.Context, req *AuthRequest) {
+
+	id := req.ID
+	req, err := s.store.Take(ctx, id, req.Status)
+	if err != nil {
+		s.Error("ciba push Error: auth request already taken", zap.String("auth_req_id", id), zap.Error(err))
+		return
+	}
+
+	if req.Status == Denied {
+		s.notifyClient(ctx, req, map[string]interface{}{
+			"auth_req_id":       req.ID,
+			"error":             errors.ErrAccessDenied.Error(),
+			"error_description": descriptions[errors.ErrAccessDenied],
+		})
+		return
+	}
+
+	cli, err := s.clientStore.GetByID(ctx, req.ClientID)
+	if err != nil || cli == nil {
+		s.Error("ciba push Error: client not found", zap.String("client_id", req.ClientID), zap.Error(err))
+		return
+	}
+
+	ti, err := s.issue(ctx, cli, req, nil)
+	if err != nil {
+		s.Error("ciba push Error: issue token failed", zap.String("auth_req_id", req.ID), zap.Error(err))
+		return
+	}
+
+	data, err := s.TokenData(ctx, ti)
+	if err != nil {
+		s.Error("ciba push Error: build token data failed", zap.String("auth_req_id", req.ID), zap.Error(err))
+		return
+	}
+	data["auth_req_id"] = req.ID
+	s.notifyClient(ctx, req, data)
+}
+
+// notifyClient 回调客户端通知端点
+func (s *Service) notifyClient(ctx context.Context, req *AuthRequest, body map[string]interface{}) {
+
+	client, err := s.cfg.GetClient(req.ClientID)
+	if err != nil {
+		s.Error("ciba notifyClient Error: client not found", zap.String("client_id", req.ClientID))
+		return
+	}
+
+	jv, err := json.Marshal(body)
+	if err != nil {
+		s.Error("ciba notifyClient Error: marshal body failed", zap.Error(err))
+		return
+	}
+
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, client.BackchannelClientNotificationEndpoint, bytes.NewReader(jv))
+	if err != nil {
+		s.Error("ciba notifyClient Error: build request failed", zap.Error(err))
+		return
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	hr.Header.Set("Authorization", "Bearer "+req.ClientNotificationToken)
+
+	resp, err := s.httpClient.Do(hr)
+	if err != nil {
+		s.Error("ciba notifyClient Error: request failed", zap.String("auth_req_id", req.ID), zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		s.Error("ciba notifyClient Error: unexpected status", zap.String("auth_req_id", req.ID), zap.Int("status", resp.StatusCode))
+	}
+}
+
+// authenticateClient 校验客户端身份,支持 client_secret_basic 和 client_secret_post
+// 客户端注册了 token_endpoint_auth_method 时只接受该方式
+func (s *Service) authenticateClient(r *http.Request) (oauth2.ClientInfo, error) {
+
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.ErrInvalidRequest
+	}
+
+	clientID, secret, method, err := client.Credentials(r)
+	if err != nil {
+		return nil, errors.ErrInvalidClient
+	}
+
+	cli, err := s.clientStore.GetByID(r.Context(), clientID)
+	if err != nil || cli == nil {
+		return nil, errors.ErrInvalidClient
+	}
+
+	// 元数据读取失败时无法确认认证方式,按认证失败处理
+	meta, err := s.cfg.GetClient(clientID)
+	if err != nil || !meta.AllowsAuthMethod(method, cli.IsPublic()) {
+		return nil, errors.ErrInvalidClient
+	}
+
+	// 密钥只保存哈希,只能通过 VerifyPassword 校验
+	if v, ok := cli.(oauth2.ClientPasswordVerifier); !ok || !v.VerifyPassword(secret) {
+		return nil, errors.ErrInvalidClient
+	}
+
+	return cli, nil
+}
+
+// newAuthReqID 生成 auth_req_id
+func newAuthReqID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate auth_req_id: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
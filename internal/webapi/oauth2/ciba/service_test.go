@@ -0,0 +1,466 @@
+package ciba
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	oerrors "github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/infra/repoimpl"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/client"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/oidc"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"go.uber.org/zap"
+)
+
+const (
+	testClientID = "ciba_client"
+	testSecret   = "ciba_secret"
+	testUserID   = "1"
+)
+
+// stubNotifier 记录送达认证设备的认证请求,err 不为空时模拟送达失败
+type stubNotifier struct {
+	mu   sync.Mutex
+	reqs []*AuthRequest
+	err  error
+}
+
+func (n *stubNotifier) Notify(ctx context.Context, req *AuthRequest) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.err != nil {
+		return n.err
+	}
+	cp := *req
+	n.reqs = append(n.reqs, &cp)
+	return nil
+}
+
+func (n *stubNotifier) last(t *testing.T) *AuthRequest {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.reqs) == 0 {
+		t.Fatal("authentication device was not notified")
+	}
+	return n.reqs[len(n.reqs)-1]
+}
+
+// newTestService 创建使用内存存储与桩通知者的 CIBA 服务
+func newTestService(t *testing.T, c *configs.Client) (*Service, *stubNotifier, Store) {
+	t.Helper()
+
+	logger := zap.NewNop()
+
+	cfg, err := configs.NewOAuth2(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.CIBA.Enabled = true
+	cfg.Clients = []*configs.Client{c}
+
+	ucfg, err := configs.NewUser(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ucfg.Users = []*configs.SeedUser{{ID: testUserID, Username: "alice", Password: "alice-password"}}
+
+	repo, err := repoimpl.NewUserRepository(repoimpl.UserRepositoryParams{Config: ucfg, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	totps, err := repoimpl.NewTOTPRepository(repoimpl.TOTPRepositoryParams{Config: ucfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := repoimpl.NewWebAuthnCredentialRepository(repoimpl.WebAuthnCredentialRepositoryParams{Config: ucfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients, err := client.NewMemoryClientStore(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := keys.NewManager(cfg, keys.NewMemoryKeyStore(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore()
+	notifier := &stubNotifier{}
+
+	s := NewService(cfg, store, notifier, repo, totps, credentials, clients,
+		token.NewCustomJWTAccessGenerate(cfg, provider, token.NewRefreshPolicy(cfg)), token.NewMemotyTokenStore(logger),
+		oidc.NewService(cfg, provider, repo, oidc.NewEncrypter(), logger), logger)
+
+	return s, notifier, store
+}
+
+// testSecretHash 客户端密钥的哈希,配置中只保存哈希
+var testSecretHash = func() string {
+	hash, err := password.Hash(testSecret)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}()
+
+// pollClient poll 模式的客户端配置
+func pollClient() *configs.Client {
+	return &configs.Client{
+		ID:         testClientID,
+		Secret:     testSecretHash,
+		Scopes:     []string{"openid", "profile"},
+		GrantTypes: []string{string(GrantType)},
+	}
+}
+
+// newRequest 创建带 client_secret_basic 认证的表单请求
+func newRequest(form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/connect/ciba", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(testClientID, testSecret)
+	return r
+}
+
+// authenticate 发起后端认证请求
+func authenticate(t *testing.T, s *Service, form url.Values) *AuthRequest {
+	t.Helper()
+
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("scope", "openid profile")
+	form.Set("login_hint", "alice")
+
+	req, err := s.Authenticate(newRequest(form))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return req
+}
+
+// poll 以 auth_req_id 请求令牌
+func poll(s *Service, id string) error {
+	_, err := s.Token(newRequest(url.Values{
+		"grant_type":  {string(GrantType)},
+		"auth_req_id": {id},
+	}))
+	return err
+}
+
+func TestPollApproved(t *testing.T) {
+
+	s, notifier, _ := newTestService(t, pollClient())
+	ctx := context.Background()
+
+	req := authenticate(t, s, url.Values{"binding_message": {"W4SCT"}})
+
+	notified := notifier.last(t)
+	if notified.ID != req.ID || notified.UserID != testUserID || notified.BindingMessage != "W4SCT" {
+		t.Fatalf("notified request = %+v, want %+v", notified, req)
+	}
+
+	if err := poll(s, req.ID); err != ErrAuthorizationPending {
+		t.Fatalf("poll before approval: %v, want %v", err, ErrAuthorizationPending)
+	}
+	if err := poll(s, req.ID); err != ErrSlowDown {
+		t.Fatalf("poll within interval: %v, want %v", err, ErrSlowDown)
+	}
+
+	if err := s.Complete(ctx, req.ID, "2", []string{"pwd"}, true); err != oerrors.ErrAccessDenied {
+		t.Fatalf("complete by another user: %v, want %v", err, oerrors.ErrAccessDenied)
+	}
+	if err := s.Complete(ctx, req.ID, testUserID, []string{"pwd"}, true); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if err := s.Complete(ctx, req.ID, testUserID, []string{"pwd"}, true); err != oerrors.ErrInvalidRequest {
+		t.Fatalf("complete twice: %v, want %v", err, oerrors.ErrInvalidRequest)
+	}
+
+	ti, err := s.Token(newRequest(url.Values{
+		"grant_type":  {string(GrantType)},
+		"auth_req_id": {req.ID},
+	}))
+	if err != nil {
+		t.Fatalf("token after approval: %v", err)
+	}
+	if ti.GetUserID() != testUserID || ti.GetClientID() != testClientID || ti.GetScope() != "openid profile" {
+		t.Fatalf("token info = %s %s %s", ti.GetUserID(), ti.GetClientID(), ti.GetScope())
+	}
+
+	data, err := s.TokenData(ctx, ti)
+	if err != nil {
+		t.Fatalf("TokenData: %v", err)
+	}
+	if data["id_token"] == nil {
+		t.Fatalf("token response without id_token: %v", data)
+	}
+
+	if err := poll(s, req.ID); err != ErrUnknownAuthReq {
+		t.Fatalf("poll after tokens were issued: %v, want %v", err, ErrUnknownAuthReq)
+	}
+}
+
+func TestPollApprovedConcurrent(t *testing.T) {
+
+	s, _, _ := newTestService(t, pollClient())
+
+	req := authenticate(t, s, nil)
+	if err := s.Complete(context.Background(), req.ID, testUserID, []string{"pwd"}, true); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	const n = 16
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		issued int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := poll(s, req.ID)
+			if err != nil && err != ErrUnknownAuthReq {
+				t.Errorf("concurrent poll: %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				issued++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if issued != 1 {
+		t.Fatalf("tokens issued %d times, want 1", issued)
+	}
+}
+
+func TestPollDenied(t *testing.T) {
+
+	s, _, _ := newTestService(t, pollClient())
+
+	req := authenticate(t, s, nil)
+	if err := s.Complete(context.Background(), req.ID, testUserID, nil, false); err != nil {
+		t.Fatalf("deny: %v", err)
+	}
+
+	if err := poll(s, req.ID); err != oerrors.ErrAccessDenied {
+		t.Fatalf("poll after denial: %v, want %v", err, oerrors.ErrAccessDenied)
+	}
+	if err := poll(s, req.ID); err != ErrUnknownAuthReq {
+		t.Fatalf("poll twice after denial: %v, want %v", err, ErrUnknownAuthReq)
+	}
+}
+
+func TestPollDoesNotOverwriteApproval(t *testing.T) {
+
+	s, _, store := newTestService(t, pollClient())
+	ctx := context.Background()
+
+	req := authenticate(t, s, nil)
+
+	// 轮询读取到待确认状态后、写入轮询时间前,用户完成了确认
+	stale, err := store.Get(ctx, req.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Complete(ctx, req.ID, testUserID, []string{"pwd"}, true); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if err := store.Update(ctx, stale, Pending); err != ErrUnknownAuthReq {
+		t.Fatalf("stale update: %v, want %v", err, ErrUnknownAuthReq)
+	}
+
+	if err := poll(s, req.ID); err != nil {
+		t.Fatalf("token after approval: %v", err)
+	}
+}
+
+func TestNotifyFailed(t *testing.T) {
+
+	s, notifier, store := newTestService(t, pollClient())
+	notifier.err = errors.New("device unreachable")
+
+	_, err := s.Authenticate(newRequest(url.Values{
+		"scope":      {"openid"},
+		"login_hint": {"alice"},
+	}))
+	if err != oerrors.ErrTemporarilyUnavailable {
+		t.Fatalf("Authenticate: %v, want %v", err, oerrors.ErrTemporarilyUnavailable)
+	}
+
+	ms := store.(*MemoryStore)
+	if len(ms.reqs) != 0 {
+		t.Fatalf("%d auth requests kept after notification failed", len(ms.reqs))
+	}
+}
+
+func TestAuthenticateClient(t *testing.T) {
+
+	s, notifier, _ := newTestService(t, pollClient())
+
+	r := httptest.NewRequest(http.MethodPost, "/connect/ciba", strings.NewReader(url.Values{
+		"scope":      {"openid"},
+		"login_hint": {"alice"},
+	}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(testClientID, "wrong")
+
+	if _, err := s.Authenticate(r); err != oerrors.ErrInvalidClient {
+		t.Fatalf("Authenticate with wrong secret: %v, want %v", err, oerrors.ErrInvalidClient)
+	}
+	if len(notifier.reqs) != 0 {
+		t.Fatal("authentication device notified for an unauthenticated client")
+	}
+
+	_, err := s.Authenticate(newRequest(url.Values{
+		"scope":      {"openid"},
+		"login_hint": {"nobody"},
+	}))
+	if err != ErrUnknownUserID {
+		t.Fatalf("Authenticate with unknown login_hint: %v, want %v", err, ErrUnknownUserID)
+	}
+}
+
+func TestPush(t *testing.T) {
+
+	var (
+		mu     sync.Mutex
+		pushed []map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer notify-token" {
+			t.Errorf("notification authorization = %q", r.Header.Get("Authorization"))
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode notification: %v", err)
+		}
+		mu.Lock()
+		pushed = append(pushed, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := pollClient()
+	c.BackchannelTokenDeliveryMode = string(Push)
+	c.BackchannelClientNotificationEndpoint = srv.URL
+
+	s, _, _ := newTestService(t, c)
+	ctx := context.Background()
+
+	req := authenticate(t, s, url.Values{"client_notification_token": {"notify-token"}})
+
+	if err := poll(s, req.ID); err != oerrors.ErrUnauthorizedClient {
+		t.Fatalf("poll in push mode: %v, want %v", err, oerrors.ErrUnauthorizedClient)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Complete(ctx, req.ID, testUserID, []string{"pwd"}, true)
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pushed) != 1 {
+		t.Fatalf("tokens pushed %d times, want 1", len(pushed))
+	}
+	if pushed[0]["auth_req_id"] != req.ID || pushed[0]["access_token"] == nil || pushed[0]["id_token"] == nil {
+		t.Fatalf("pushed body = %v", pushed[0])
+	}
+}
+
+func TestAuthTimeIsApprovalTime(t *testing.T) {
+
+	s, _, store := newTestService(t, pollClient())
+	ctx := context.Background()
+
+	req := authenticate(t, s, nil)
+	if err := s.Complete(ctx, req.ID, testUserID, []string{"pwd"}, true); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	// 将确认时间前移,与发放令牌的时间区分
+	approved, err := store.Get(ctx, req.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.ApprovedAt.IsZero() {
+		t.Fatal("approval time not recorded")
+	}
+	approved.ApprovedAt = approved.ApprovedAt.Add(-time.Hour)
+	if err := store.Update(ctx, approved, Approved); err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err := s.Token(newRequest(url.Values{
+		"grant_type":  {string(GrantType)},
+		"auth_req_id": {req.ID},
+	}))
+	if err != nil {
+		t.Fatalf("token after approval: %v", err)
+	}
+
+	got := ti.(*issuedToken).TokenInfo.(*models.Token).Extension.Get(token.AuthTimeExtension)
+	if want := strconv.FormatInt(approved.ApprovedAt.Unix(), 10); got != want {
+		t.Fatalf("auth_time = %s, want %s (approval time)", got, want)
+	}
+}
+
+func TestIDTokenFailureStoresNoToken(t *testing.T) {
+
+	// 客户端公钥集合地址不可达,ID Token 无法加密
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	c := pollClient()
+	c.JWKSURI = srv.URL
+	c.IDTokenEncryptedResponseAlg = "RSA-OAEP-256"
+
+	s, _, _ := newTestService(t, c)
+	ctx := context.Background()
+
+	req := authenticate(t, s, nil)
+	if err := s.Complete(ctx, req.ID, testUserID, []string{"pwd"}, true); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	if err := poll(s, req.ID); err != oerrors.ErrServerError {
+		t.Fatalf("token with id token failure: %v, want %v", err, oerrors.ErrServerError)
+	}
+
+	issued, err := s.tokenStore.(token.IndexedStore).Find(ctx, token.IndexUser, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issued) != 0 {
+		t.Fatalf("%d tokens stored although the id token failed", len(issued))
+	}
+}
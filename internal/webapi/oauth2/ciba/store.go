@@ -0,0 +1,109 @@
+package ciba
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store 后端认证请求存储
+type Store interface {
+
+	// Create 保存新的认证请求
+	Create(ctx context.Context, req *AuthRequest) error
+
+	// Get 根据 auth_req_id 获取认证请求,不存在时返回 ErrUnknownAuthReq
+	Get(ctx context.Context, id string) (*AuthRequest, error)
+
+	// Update 认证请求仍为 from 状态时更新,状态已变化或不存在时返回 ErrUnknownAuthReq
+	// 并发的确认与轮询只有一方能基于同一状态写入,不会互相覆盖
+	Update(ctx context.Context, req *AuthRequest, from Status) error
+
+	// Take 认证请求为 status 状态时取出并删除,状态不符或不存在时返回 ErrUnknownAuthReq
+	// 同一认证请求只能被取出一次,发放令牌前须先取出
+	Take(ctx context.Context, id string, status Status) (*AuthRequest, error)
+
+	// Delete 删除认证请求
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryStore 内存认证请求存储
+type MemoryStore struct {
+	mu   sync.Mutex
+	reqs map[string]*AuthRequest
+}
+
+// NewMemoryStore 创建内存认证请求存储
+func NewMemoryStore() Store {
+	return &MemoryStore{
+		reqs: make(map[string]*AuthRequest),
+	}
+}
+
+// Create 保存新的认证请求,同时清理已过期的请求
+func (s *MemoryStore) Create(ctx context.Context, req *AuthRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, v := range s.reqs {
+		if v.Expired(now) {
+			delete(s.reqs, id)
+		}
+	}
+
+	cp := *req
+	s.reqs[req.ID] = &cp
+	return nil
+}
+
+// Get 根据 auth_req_id 获取认证请求
+func (s *MemoryStore) Get(ctx context.Context, id string) (*AuthRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.reqs[id]
+	if !ok {
+		return nil, ErrUnknownAuthReq
+	}
+
+	cp := *v
+	return &cp, nil
+}
+
+// Update 认证请求仍为 from 状态时更新
+func (s *MemoryStore) Update(ctx context.Context, req *AuthRequest, from Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.reqs[req.ID]; !ok || v.Status != from {
+		return ErrUnknownAuthReq
+	}
+
+	cp := *req
+	s.reqs[req.ID] = &cp
+	return nil
+}
+
+// Take 认证请求为 status 状态时取出并删除
+func (s *MemoryStore) Take(ctx context.Context, id string, status Status) (*AuthRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.reqs[id]
+	if !ok || v.Status != status {
+		return nil, ErrUnknownAuthReq
+	}
+	delete(s.reqs, id)
+
+	return v, nil
+}
+
+// Delete 删除认证请求
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.reqs, id)
+	return nil
+}
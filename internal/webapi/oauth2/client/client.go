@@ -0,0 +1,144 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	pkgoauth2 "github.com/xiaohangshuhub/xiaohangshu/pkg/oauth2"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+)
+
+// secretSize 生成的客户端密钥随机字节数
+const secretSize = 32
+
+// RedirectURIValidator 可按全部注册地址校验跳转地址的客户端
+type RedirectURIValidator interface {
+	oauth2.ClientInfo
+	MatchRedirectURI(uri string) bool
+}
+
+// Secret 客户端密钥,只保存哈希
+// 同一客户端可同时存在多个有效密钥,轮换时先添加新密钥,客户端切换后再让旧密钥过期
+type Secret struct {
+	ID        string    `json:"id"`                  // 密钥ID
+	Hash      string    `json:"-"`                   // argon2id 或 bcrypt 哈希
+	CreatedAt time.Time `json:"created_at,omitzero"` // 创建时间,配置文件中的密钥为空
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // 过期时间,零值表示不过期
+}
+
+// Active 判断密钥在指定时间是否有效
+func (s *Secret) Active(now time.Time) bool {
+	return s.ExpiresAt.IsZero() || now.Before(s.ExpiresAt)
+}
+
+// NewSecret 生成新的客户端密钥
+//
+// 参数:
+//
+//	expiresAt: 过期时间,零值表示不过期
+//
+// 返回值:
+//
+//	*Secret: 密钥,只包含哈希
+//	string: 明文密钥,只在创建时返回一次
+//	error: 错误信息
+func NewSecret(expiresAt time.Time) (*Secret, string, error) {
+
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(b)
+
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &Secret{
+		ID:        newSecretID(),
+		Hash:      hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}, plain, nil
+}
+
+// newSecretID 生成密钥ID
+func newSecretID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Client 客户端信息
+// 与 go-oauth2 的 models.Client 不同,保存全部注册的跳转地址,按完全匹配校验;
+// 密钥只保存哈希,通过 VerifyPassword 校验
+type Client struct {
+	ID           string
+	Secrets      []*Secret
+	RedirectURIs []string
+	Public       bool
+	UserID       string
+}
+
+// GetID 客户端ID
+func (c *Client) GetID() string {
+	return c.ID
+}
+
+// GetSecret 密钥只保存哈希,不再提供明文
+func (c *Client) GetSecret() string {
+	return ""
+}
+
+// GetDomain 只注册了一个跳转地址时返回该地址
+// go-oauth2 在授权请求未携带 redirect_uri 时以此作为跳转地址;
+// 注册了多个地址时返回空,授权请求必须携带 redirect_uri
+func (c *Client) GetDomain() string {
+	if len(c.RedirectURIs) == 1 {
+		return c.RedirectURIs[0]
+	}
+	return ""
+}
+
+// IsPublic 是否为公开客户端,即认证方式为 none 的客户端,公开客户端没有密钥
+func (c *Client) IsPublic() bool {
+	return c.Public
+}
+
+// GetUserID 客户端所属用户ID
+func (c *Client) GetUserID() string {
+	return c.UserID
+}
+
+// VerifyPassword 校验客户端密钥,与任一未过期的密钥匹配即通过
+// 实现 oauth2.ClientPasswordVerifier,go-oauth2 与本服务的客户端认证均通过该方法校验
+func (c *Client) VerifyPassword(secret string) bool {
+
+	if c.Public {
+		return true
+	}
+	if secret == "" {
+		return false
+	}
+
+	now := time.Now()
+	for _, s := range c.Secrets {
+		if !s.Active(now) {
+			continue
+		}
+		if ok, _ := password.Verify(s.Hash, secret); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchRedirectURI 判断跳转地址是否与注册的跳转地址之一完全匹配(含 RFC 8252 回环地址规则)
+func (c *Client) MatchRedirectURI(uri string) bool {
+	return pkgoauth2.MatchRedirectURI(c.RedirectURIs, uri)
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestConfig 创建包含一个机密客户端与一个公开客户端的配置
+func newTestConfig(t *testing.T) *configs.OAuth2 {
+	t.Helper()
+
+	cfg, err := configs.NewOAuth2(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := password.Hash("web-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Clients = []*configs.Client{
+		{ID: "web", Secret: hash},
+		{ID: "spa", TokenEndpointAuthMethod: configs.AuthMethodNone},
+	}
+	return cfg
+}
+
+func TestClientStorePublicClient(t *testing.T) {
+
+	cfg := newTestConfig(t)
+
+	memory, err := NewMemoryClientStore(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/test.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormStore, err := NewGormClientStore(cfg, db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for name, s := range map[string]Store{"memory": memory, "database": gormStore} {
+		t.Run(name, func(t *testing.T) {
+
+			web, err := s.Get(ctx, "web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if web.IsPublic() || web.VerifyPassword("") || !web.VerifyPassword("web-secret") {
+				t.Fatal("confidential client accepted without its secret")
+			}
+
+			spa, err := s.Get(ctx, "spa")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !spa.IsPublic() {
+				t.Fatal("client with token_endpoint_auth_method none is not public")
+			}
+
+			secret, _, err := NewSecret(time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.AddSecret(ctx, "spa", secret); !errors.Is(err, ErrPublicClient) {
+				t.Fatalf("add secret to public client: %v, want %v", err, ErrPublicClient)
+			}
+		})
+	}
+}
+
+func TestFromConfigRejectsPlaintextSecret(t *testing.T) {
+
+	// 未显式配置 none 且没有密钥的客户端不是公开客户端
+	cli, err := FromConfig(&configs.Client{ID: "c"}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cli.IsPublic() || cli.VerifyPassword("") {
+		t.Fatal("client without secrets treated as public")
+	}
+
+	if _, err := FromConfig(&configs.Client{ID: "c", Secret: "plain"}, zap.NewNop()); !errors.Is(err, configs.ErrClientSecret) {
+		t.Fatalf("plaintext secret: %v, want %v", err, configs.ErrClientSecret)
+	}
+}
+
+func TestVerifyPasswordSecretExpiry(t *testing.T) {
+
+	oldSecret, oldPlain, err := NewSecret(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSecret, newPlain, err := NewSecret(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &Client{ID: "web", Secrets: []*Secret{oldSecret, newSecret}}
+
+	// 轮换期间新旧密钥均可认证
+	if !cli.VerifyPassword(oldPlain) || !cli.VerifyPassword(newPlain) {
+		t.Fatal("active secrets rejected during rotation")
+	}
+
+	// 旧密钥过期后不能再认证,未设置过期时间的密钥不受影响
+	oldSecret.ExpiresAt = time.Now().Add(-time.Second)
+	if cli.VerifyPassword(oldPlain) {
+		t.Fatal("expired secret accepted")
+	}
+	if !cli.VerifyPassword(newPlain) {
+		t.Fatal("secret without expiry rejected")
+	}
+	if cli.VerifyPassword("wrong") {
+		t.Fatal("wrong secret accepted")
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+)
+
+// Credentials 读取请求中的客户端凭证
+// 优先读取 HTTP Basic 认证,其次读取表单参数;表单中没有 client_secret 时认证方式为 none
+//
+// 参数:
+//
+//	r: HTTP 请求
+//
+// 返回值:
+//
+//	clientID: 客户端ID
+//	secret: 客户端密钥
+//	method: 认证方式: client_secret_basic, client_secret_post, none
+//	err: 错误信息
+//
+// 错误信息:
+//
+//	errors.ErrInvalidClient: 请求中没有客户端ID
+func Credentials(r *http.Request) (clientID, secret, method string, err error) {
+
+	if clientID, secret, err = server.ClientBasicHandler(r); err == nil {
+		return clientID, secret, configs.AuthMethodClientSecretBasic, nil
+	}
+
+	if r.Form == nil {
+		r.ParseForm()
+	}
+
+	if clientID, secret, err = server.ClientFormHandler(r); err != nil {
+		return "", "", "", err
+	}
+
+	method = configs.AuthMethodClientSecretPost
+	if secret == "" {
+		method = configs.AuthMethodNone
+	}
+
+	return clientID, secret, method, nil
+}
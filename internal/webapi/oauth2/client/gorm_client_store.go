@@ -0,0 +1,447 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// clientModel 客户端表,保存客户端的全部元数据
+// 有效期均以秒保存,0 表示沿用全局配置
+type clientModel struct {
+	ID                     string   `gorm:"primaryKey;size:128"`
+	RedirectURIs           []string `gorm:"serializer:json;type:text"`
+	PostLogoutRedirectURIs []string `gorm:"serializer:json;type:text"`
+	Scopes                 []string `gorm:"serializer:json;type:text"`
+	GrantTypes             []string `gorm:"serializer:json;type:text"`
+
+	TokenEndpointAuthMethod string `gorm:"size:32"`
+	AccessTokenFormat       string `gorm:"size:16"`
+	RefreshTokenMode        string `gorm:"size:16"`
+
+	AccessTokenLifetime          int64
+	IDTokenLifetime              int64
+	AuthorizationCodeLifetime    int64
+	RefreshTokenAbsoluteLifetime int64
+	RefreshTokenIdleLifetime     int64
+
+	GrantLifetimes map[string]grantLifetimesModel `gorm:"serializer:json;type:text"`
+
+	JWKS                         string `gorm:"type:text"`
+	JWKSURI                      string `gorm:"size:512"`
+	IDTokenEncryptedResponseAlg  string `gorm:"size:32"`
+	IDTokenEncryptedResponseEnc  string `gorm:"size:32"`
+	UserinfoEncryptedResponseAlg string `gorm:"size:32"`
+	UserinfoEncryptedResponseEnc string `gorm:"size:32"`
+
+	BackchannelTokenDeliveryMode          string `gorm:"size:16"`
+	BackchannelClientNotificationEndpoint string `gorm:"size:512"`
+
+	RequireVerified []string `gorm:"serializer:json;type:text"`
+	RequireMFA      bool
+
+	Secrets []clientSecretModel `gorm:"foreignKey:ClientID"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName 客户端表名
+func (clientModel) TableName() string {
+	return "oauth2_clients"
+}
+
+// grantLifetimesModel 按授权类型覆盖的有效期(秒)
+type grantLifetimesModel struct {
+	AccessToken          int64 `json:"access_token,omitempty"`
+	IDToken              int64 `json:"id_token,omitempty"`
+	RefreshTokenAbsolute int64 `json:"refresh_token_absolute,omitempty"`
+}
+
+// clientSecretModel 客户端密钥表,只保存哈希
+type clientSecretModel struct {
+	ClientID  string `gorm:"primaryKey;size:128"`
+	ID        string `gorm:"primaryKey;size:64"`
+	Hash      string `gorm:"size:255;not null"`
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+}
+
+// TableName 客户端密钥表名
+func (clientSecretModel) TableName() string {
+	return "oauth2_client_secrets"
+}
+
+// metadataQueryTimeout 读取客户端元数据的超时时间,configs.ClientSource 不传递上下文
+const metadataQueryTimeout = 5 * time.Second
+
+// GormClientStore 数据库客户端存储
+// 实现 configs.ClientSource,权限范围、授权方式、有效期等元数据同样从数据库读取;
+// 配置文件中的客户端在启动时导入,数据库中已存在的客户端不会被覆盖
+type GormClientStore struct {
+	*zap.Logger
+	db  *gorm.DB
+	cfg *configs.OAuth2
+
+	mu    sync.Mutex
+	cache map[string]*cachedMetadata // 已校验的客户端元数据,键为客户端ID
+}
+
+// cachedMetadata 缓存的客户端元数据
+// 元数据不合法时 client 为空,在缓存有效期内同样视为客户端不存在,避免重复校验和记录日志
+type cachedMetadata struct {
+	client    *configs.Client
+	expiresAt time.Time
+}
+
+// NewGormClientStore 创建数据库客户端存储
+//
+// 创建数据表,导入配置文件中的客户端,并将自身设置为 cfg 的客户端元数据来源
+//
+// 参数:
+//
+//	cfg: OAuth2 配置
+//	db: 数据库连接
+//	logger: 日志对象
+//
+// 返回值:
+//
+//	Store: 客户端存储
+//	error: 错误信息,建表或导入失败时返回
+func NewGormClientStore(cfg *configs.OAuth2, db *gorm.DB, logger *zap.Logger) (Store, error) {
+
+	if err := db.AutoMigrate(&clientModel{}, &clientSecretModel{}); err != nil {
+		return nil, err
+	}
+
+	s := &GormClientStore{Logger: logger, db: db, cfg: cfg, cache: make(map[string]*cachedMetadata)}
+
+	if err := s.seed(context.Background()); err != nil {
+		return nil, err
+	}
+
+	cfg.SetClientSource(s)
+
+	return s, nil
+}
+
+// seed 导入配置文件中数据库尚不存在的客户端
+func (s *GormClientStore) seed(ctx context.Context) error {
+
+	for _, v := range s.cfg.Clients {
+
+		cli, err := FromConfig(v, s.Logger)
+		if err != nil {
+			return err
+		}
+
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+			m := toClientModel(v)
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Secrets").Create(m)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+
+			for _, secret := range cli.Secrets {
+				m := toSecretModel(v.ID, secret)
+				if err := tx.Create(&m).Error; err != nil {
+					return err
+				}
+			}
+
+			s.Info("client imported from configuration", zap.String("client_id", v.ID))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetByID 根据客户端ID获取客户端信息
+func (s *GormClientStore) GetByID(ctx context.Context, id string) (oauth2.ClientInfo, error) {
+	return s.Get(ctx, id)
+}
+
+// Get 获取客户端
+func (s *GormClientStore) Get(ctx context.Context, id string) (*Client, error) {
+
+	var m clientModel
+	err := s.db.WithContext(ctx).Preload("Secrets").Where("id = ?", id).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cli := &Client{
+		ID:           m.ID,
+		RedirectURIs: m.RedirectURIs,
+		Secrets:      make([]*Secret, 0, len(m.Secrets)),
+	}
+	for _, v := range m.Secrets {
+		secret := &Secret{ID: v.ID, Hash: v.Hash, CreatedAt: v.CreatedAt}
+		if v.ExpiresAt != nil {
+			secret.ExpiresAt = *v.ExpiresAt
+		}
+		cli.Secrets = append(cli.Secrets, secret)
+	}
+	cli.Public = m.TokenEndpointAuthMethod == configs.AuthMethodNone
+
+	return cli, nil
+}
+
+// ClientMetadata 获取客户端元数据,实现 configs.ClientSource
+// 数据库中的元数据未经配置校验,不合法时记录错误并视为客户端不存在;
+// 一次令牌请求会多次读取元数据,校验结果按 client_cache_ttl 缓存,本实例修改密钥时立即失效
+func (s *GormClientStore) ClientMetadata(id string) (*configs.Client, error) {
+
+	if c, ok := s.cached(id); ok {
+		if c == nil {
+			return nil, configs.ErrClientNotFound
+		}
+		return c, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metadataQueryTimeout)
+	defer cancel()
+
+	var m clientModel
+	err := s.db.WithContext(ctx).Where("id = ?", id).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, configs.ErrClientNotFound
+	}
+	if err != nil {
+		s.Error("load client metadata failed", zap.String("client_id", id), zap.Error(err))
+		return nil, err
+	}
+
+	c := m.toConfig()
+	if err := s.cfg.ValidateClient(c); err != nil {
+		s.Error("client metadata is invalid", zap.String("client_id", id), zap.Error(err))
+		s.store(id, nil)
+		return nil, configs.ErrClientNotFound
+	}
+
+	s.store(id, c)
+	return c, nil
+}
+
+// cached 读取未过期的缓存,第二个返回值表示是否命中
+func (s *GormClientStore) cached(id string) (*configs.Client, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.cache[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(v.expiresAt) {
+		delete(s.cache, id)
+		return nil, false
+	}
+	return v.client, true
+}
+
+// store 缓存客户端元数据,只缓存数据库中存在的客户端,缓存条目数不超过客户端数
+func (s *GormClientStore) store(id string, c *configs.Client) {
+	if s.cfg.ClientCacheTTL <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache[id] = &cachedMetadata{client: c, expiresAt: time.Now().Add(s.cfg.ClientCacheTTL)}
+}
+
+// invalidate 删除客户端元数据缓存
+func (s *GormClientStore) invalidate(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cache, id)
+}
+
+// AddSecret 为客户端添加密钥
+func (s *GormClientStore) AddSecret(ctx context.Context, clientID string, secret *Secret) error {
+
+	var cm clientModel
+	err := s.db.WithContext(ctx).Select("id", "token_endpoint_auth_method").Where("id = ?", clientID).Take(&cm).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrClientNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if cm.TokenEndpointAuthMethod == configs.AuthMethodNone {
+		return ErrPublicClient
+	}
+
+	defer s.invalidate(clientID)
+
+	m := toSecretModel(clientID, secret)
+	return s.db.WithContext(ctx).Create(&m).Error
+}
+
+// RetireSecret 设置密钥的过期时间
+func (s *GormClientStore) RetireSecret(ctx context.Context, clientID, secretID string, expiresAt time.Time) error {
+
+	if err := s.exists(ctx, clientID); err != nil {
+		return err
+	}
+
+	var secret clientSecretModel
+	err := s.db.WithContext(ctx).Where("client_id = ? AND id = ?", clientID, secretID).Take(&secret).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSecretNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	defer s.invalidate(clientID)
+
+	return s.db.WithContext(ctx).Model(&secret).Update("expires_at", expiresAt).Error
+}
+
+// exists 判断客户端是否存在
+func (s *GormClientStore) exists(ctx context.Context, clientID string) error {
+
+	var n int64
+	if err := s.db.WithContext(ctx).Model(&clientModel{}).Where("id = ?", clientID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrClientNotFound
+	}
+
+	return nil
+}
+
+// toClientModel 由配置创建客户端表记录,不含密钥
+func toClientModel(c *configs.Client) *clientModel {
+
+	m := &clientModel{
+		ID:                                    c.ID,
+		RedirectURIs:                          c.RedirectURIs,
+		PostLogoutRedirectURIs:                c.PostLogoutRedirectURIs,
+		Scopes:                                c.Scopes,
+		GrantTypes:                            c.GrantTypes,
+		TokenEndpointAuthMethod:               c.TokenEndpointAuthMethod,
+		AccessTokenFormat:                     c.AccessTokenFormat,
+		RefreshTokenMode:                      c.RefreshTokenMode,
+		AccessTokenLifetime:                   seconds(c.AccessTokenLifetime),
+		IDTokenLifetime:                       seconds(c.IDTokenLifetime),
+		AuthorizationCodeLifetime:             seconds(c.AuthorizationCodeLifetime),
+		RefreshTokenAbsoluteLifetime:          seconds(c.RefreshTokenAbsoluteLifetime),
+		RefreshTokenIdleLifetime:              seconds(c.RefreshTokenIdleLifetime),
+		JWKS:                                  c.JWKS,
+		JWKSURI:                               c.JWKSURI,
+		IDTokenEncryptedResponseAlg:           c.IDTokenEncryptedResponseAlg,
+		IDTokenEncryptedResponseEnc:           c.IDTokenEncryptedResponseEnc,
+		UserinfoEncryptedResponseAlg:          c.UserinfoEncryptedResponseAlg,
+		UserinfoEncryptedResponseEnc:          c.UserinfoEncryptedResponseEnc,
+		BackchannelTokenDeliveryMode:          c.BackchannelTokenDeliveryMode,
+		BackchannelClientNotificationEndpoint: c.BackchannelClientNotificationEndpoint,
+		RequireVerified:                       c.RequireVerified,
+		RequireMFA:                            c.RequireMFA,
+	}
+
+	if len(c.GrantLifetimes) > 0 {
+		m.GrantLifetimes = make(map[string]grantLifetimesModel, len(c.GrantLifetimes))
+		for gt, g := range c.GrantLifetimes {
+			if g == nil {
+				continue
+			}
+			m.GrantLifetimes[gt] = grantLifetimesModel{
+				AccessToken:          seconds(g.AccessToken),
+				IDToken:              seconds(g.IDToken),
+				RefreshTokenAbsolute: seconds(g.RefreshTokenAbsolute),
+			}
+		}
+	}
+
+	return m
+}
+
+// toConfig 转换为客户端配置
+func (m *clientModel) toConfig() *configs.Client {
+
+	c := &configs.Client{
+		ID:                                    m.ID,
+		RedirectURIs:                          m.RedirectURIs,
+		PostLogoutRedirectURIs:                m.PostLogoutRedirectURIs,
+		Scopes:                                m.Scopes,
+		GrantTypes:                            m.GrantTypes,
+		TokenEndpointAuthMethod:               m.TokenEndpointAuthMethod,
+		AccessTokenFormat:                     m.AccessTokenFormat,
+		RefreshTokenMode:                      m.RefreshTokenMode,
+		AccessTokenLifetime:                   duration(m.AccessTokenLifetime),
+		IDTokenLifetime:                       duration(m.IDTokenLifetime),
+		AuthorizationCodeLifetime:             duration(m.AuthorizationCodeLifetime),
+		RefreshTokenAbsoluteLifetime:          duration(m.RefreshTokenAbsoluteLifetime),
+		RefreshTokenIdleLifetime:              duration(m.RefreshTokenIdleLifetime),
+		JWKS:                                  m.JWKS,
+		JWKSURI:                               m.JWKSURI,
+		IDTokenEncryptedResponseAlg:           m.IDTokenEncryptedResponseAlg,
+		IDTokenEncryptedResponseEnc:           m.IDTokenEncryptedResponseEnc,
+		UserinfoEncryptedResponseAlg:          m.UserinfoEncryptedResponseAlg,
+		UserinfoEncryptedResponseEnc:          m.UserinfoEncryptedResponseEnc,
+		BackchannelTokenDeliveryMode:          m.BackchannelTokenDeliveryMode,
+		BackchannelClientNotificationEndpoint: m.BackchannelClientNotificationEndpoint,
+		RequireVerified:                       m.RequireVerified,
+		RequireMFA:                            m.RequireMFA,
+	}
+
+	if len(m.GrantLifetimes) > 0 {
+		c.GrantLifetimes = make(map[string]*configs.GrantLifetimes, len(m.GrantLifetimes))
+		for gt, g := range m.GrantLifetimes {
+			c.GrantLifetimes[gt] = &configs.GrantLifetimes{
+				AccessToken:          duration(g.AccessToken),
+				IDToken:              duration(g.IDToken),
+				RefreshTokenAbsolute: duration(g.RefreshTokenAbsolute),
+			}
+		}
+	}
+
+	return c
+}
+
+// toSecretModel 由密钥创建密钥表记录
+func toSecretModel(clientID string, secret *Secret) clientSecretModel {
+
+	m := clientSecretModel{
+		ClientID:  clientID,
+		ID:        secret.ID,
+		Hash:      secret.Hash,
+		CreatedAt: secret.CreatedAt,
+	}
+	if !secret.ExpiresAt.IsZero() {
+		expiresAt := secret.ExpiresAt
+		m.ExpiresAt = &expiresAt
+	}
+
+	return m
+}
+
+// seconds 有效期转换为秒
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
+
+// duration 秒转换为有效期
+func duration(s int64) time.Duration {
+	return time.Duration(s) * time.Second
+}
@@ -1,25 +1,140 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
 	"github.com/go-oauth2/oauth2/v4"
-	"github.com/go-oauth2/oauth2/v4/models"
-	"github.com/go-oauth2/oauth2/v4/store"
 	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"go.uber.org/zap"
 )
 
+// MemoryClientStore 内存客户端存储
+// 客户端来自配置文件,运行期间添加的密钥在重启后丢失
+type MemoryClientStore struct {
+	sync.RWMutex
+	clients map[string]*Client
+}
+
 // NewMemoryClientStore 创建内存客户端存储
-func NewMemoryClientStore(cfg *configs.OAuth2) oauth2.ClientStore {
-	// 内存client store
-	clientStore := store.NewClientStore()
+//
+// 参数:
+//
+//	cfg: OAuth2 配置
+//	logger: 日志对象
+//
+// 返回值:
+//
+//	Store: 客户端存储
+//	error: 错误信息,密钥不是哈希时返回
+func NewMemoryClientStore(cfg *configs.OAuth2, logger *zap.Logger) (Store, error) {
+
+	s := &MemoryClientStore{clients: make(map[string]*Client)}
 
-	// 设置客户端信息
 	for _, v := range cfg.Clients {
-		clientStore.Set(v.ID, &models.Client{
-			ID:     v.ID,
-			Secret: v.Secret,
-			Domain: v.RedirectURIs[0], // 假设第一个重定向URI是主域名
+		cli, err := FromConfig(v, logger)
+		if err != nil {
+			return nil, err
+		}
+		s.clients[v.ID] = cli
+	}
+
+	return s, nil
+}
+
+// FromConfig 由配置创建客户端
+// 配置文件中只保存密钥哈希,明文密钥已在配置校验时拒绝,这里再次检查以防绕过校验直接构造的配置;
+// 只有认证方式为 none 的客户端是公开客户端,未配置密钥的其他客户端无法通过认证
+func FromConfig(v *configs.Client, logger *zap.Logger) (*Client, error) {
+
+	cli := &Client{
+		ID:           v.ID,
+		RedirectURIs: v.RedirectURIs,
+		Public:       v.TokenEndpointAuthMethod == configs.AuthMethodNone,
+	}
+
+	if v.Secret != "" {
+		if !password.IsHash(v.Secret) {
+			return nil, fmt.Errorf("%w: client %s secret must be a bcrypt or argon2id hash", configs.ErrClientSecret, v.ID)
+		}
+		cli.Secrets = append(cli.Secrets, &Secret{ID: configs.DefaultSecretID, Hash: v.Secret})
+	}
+
+	for _, s := range v.Secrets {
+		cli.Secrets = append(cli.Secrets, &Secret{
+			ID:        s.ID,
+			Hash:      s.Hash,
+			ExpiresAt: s.ExpiresAt,
 		})
 	}
 
-	return clientStore
+	return cli, nil
+}
+
+// GetByID 根据客户端ID获取客户端信息
+func (s *MemoryClientStore) GetByID(ctx context.Context, id string) (oauth2.ClientInfo, error) {
+	return s.Get(ctx, id)
+}
+
+// Get 获取客户端,返回副本
+func (s *MemoryClientStore) Get(ctx context.Context, id string) (*Client, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	cli, ok := s.clients[id]
+	if !ok {
+		return nil, ErrClientNotFound
+	}
+
+	c := *cli
+	c.Secrets = make([]*Secret, 0, len(cli.Secrets))
+	for _, v := range cli.Secrets {
+		secret := *v
+		c.Secrets = append(c.Secrets, &secret)
+	}
+
+	return &c, nil
+}
+
+// AddSecret 为客户端添加密钥
+func (s *MemoryClientStore) AddSecret(ctx context.Context, clientID string, secret *Secret) error {
+	s.Lock()
+	defer s.Unlock()
+
+	cli, ok := s.clients[clientID]
+	if !ok {
+		return ErrClientNotFound
+	}
+
+	if cli.Public {
+		return ErrPublicClient
+	}
+
+	cli.Secrets = append(cli.Secrets, secret)
+
+	return nil
+}
+
+// RetireSecret 设置密钥的过期时间
+func (s *MemoryClientStore) RetireSecret(ctx context.Context, clientID, secretID string, expiresAt time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	cli, ok := s.clients[clientID]
+	if !ok {
+		return ErrClientNotFound
+	}
+
+	i := slices.IndexFunc(cli.Secrets, func(v *Secret) bool { return v.ID == secretID })
+	if i < 0 {
+		return ErrSecretNotFound
+	}
+
+	cli.Secrets[i].ExpiresAt = expiresAt
+
+	return nil
 }
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrClientNotFound = errors.New("client not found") // 客户端不存在
+	ErrSecretNotFound = errors.New("secret not found") // 密钥不存在
+	ErrPublicClient   = errors.New("public client")    // 公开客户端不使用密钥
+)
+
+// Store 客户端存储
+// 在 oauth2.ClientStore 的基础上支持密钥的添加与撤销
+type Store interface {
+	oauth2.ClientStore
+
+	// Get 获取客户端
+	//
+	// 错误信息:
+	//
+	//	ErrClientNotFound: 客户端不存在
+	Get(ctx context.Context, id string) (*Client, error)
+
+	// AddSecret 为客户端添加密钥
+	//
+	// 错误信息:
+	//
+	//	ErrClientNotFound: 客户端不存在
+	//	ErrPublicClient: 认证方式为 none 的公开客户端
+	AddSecret(ctx context.Context, clientID string, secret *Secret) error
+
+	// RetireSecret 设置密钥的过期时间,过期后不能再用于认证
+	//
+	// 错误信息:
+	//
+	//	ErrClientNotFound: 客户端不存在
+	//	ErrSecretNotFound: 密钥不存在
+	RetireSecret(ctx context.Context, clientID, secretID string, expiresAt time.Time) error
+}
+
+// StoreParams 创建客户端存储的依赖
+// 未配置 database.driver 时不提供数据库连接
+type StoreParams struct {
+	fx.In
+
+	Config *configs.OAuth2
+	DB     *gorm.DB `optional:"true"`
+	Logger *zap.Logger
+}
+
+// NewStore 按 oauth2.client_store 创建客户端存储
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	Store: 客户端存储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+func NewStore(p StoreParams) (Store, error) {
+
+	if p.Config.ClientStore == configs.ClientStoreDatabase {
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		return NewGormClientStore(p.Config, p.DB, p.Logger)
+	}
+
+	return NewMemoryClientStore(p.Config, p.Logger)
+}
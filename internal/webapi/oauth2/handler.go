@@ -3,10 +3,16 @@ package oauth2
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/xiaohangshuhub/xiaohangshu/configs"
 	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/sso"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
 	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
 
 	"github.com/go-oauth2/oauth2/v4"
@@ -16,18 +22,26 @@ import (
 )
 
 type OAuth2Handlers struct {
-	session *session.Session
+	session  *session.Session
+	sessions *sso.Service
 	*zap.Logger
-	cfg  *configs.OAuth2
-	repo user.UserRepository
+	cfg         *configs.OAuth2
+	users       *configs.User
+	repo        user.UserRepository
+	totps       user.TOTPRepository
+	credentials user.WebAuthnCredentialRepository
 }
 
-func NewOAuth2Handlers(session *session.Session, cfg *configs.OAuth2, repo user.UserRepository, logger *zap.Logger) *OAuth2Handlers {
+func NewOAuth2Handlers(session *session.Session, sessions *sso.Service, cfg *configs.OAuth2, users *configs.User, repo user.UserRepository, totps user.TOTPRepository, credentials user.WebAuthnCredentialRepository, logger *zap.Logger) *OAuth2Handlers {
 	return &OAuth2Handlers{
-		session: session,
-		Logger:  logger,
-		cfg:     cfg,
-		repo:    repo,
+		session:     session,
+		sessions:    sessions,
+		Logger:      logger,
+		cfg:         cfg,
+		users:       users,
+		repo:        repo,
+		totps:       totps,
+		credentials: credentials,
 	}
 }
 
@@ -41,42 +55,106 @@ func (h *OAuth2Handlers) passwordAuthorizationHandler(ctx context.Context, clien
 	}
 
 	// 这里可以添加对用户名和密码的验证逻辑
-	user, err := h.repo.GetUserInfoByPassword(ctx, username, password)
+	u, err := h.repo.GetUserInfoByPassword(ctx, username, password)
 
 	if err != nil {
 		h.Error("passwordAuthorizationHandler Error: username or password is invalid ", zap.String("username", username))
 		return "", errors.ErrInvalidGrant
 	}
 
+	// 客户端要求已验证的联系方式时,密码模式无法引导用户验证,直接拒绝
+	client, cerr := h.cfg.GetClient(clientID)
+	if cerr == nil {
+		if missing := u.Unverified(client.RequireVerified); len(missing) > 0 {
+			h.Error("passwordAuthorizationHandler Error: contact is not verified", zap.String("client_id", clientID), zap.String("user_id", u.ID), zap.Strings("unverified", missing))
+			return "", errors.ErrAccessDenied
+		}
+	}
+
+	// 密码模式无法输入一次性密码,须两步验证的用户或客户端直接拒绝,避免绕过两步验证
+	needMFA, err := user.RequiresMFA(ctx, h.totps, h.credentials, u)
+	if err != nil {
+		h.Error("passwordAuthorizationHandler Error: get mfa failed", zap.String("user_id", u.ID), zap.Error(err))
+		return "", errors.ErrServerError
+	}
+	if needMFA || (cerr == nil && client.RequireMFA) {
+		h.Error("passwordAuthorizationHandler Error: mfa is required", zap.String("client_id", clientID), zap.String("user_id", u.ID))
+		return "", errors.ErrAccessDenied
+	}
+
 	// 假设用户名和密码验证通过，返回一个用户ID
-	return user.ID, nil
+	return u.ID, nil
 }
 
 // userAuthorizeHandler 用户授权
 func (h *OAuth2Handlers) userAuthorizeHandler(w http.ResponseWriter, r *http.Request) (userID string, err error) {
 
+	// PKCE 方法须为配置允许的方法,未指定方法时按 plain 处理
+	if r.FormValue("code_challenge") != "" {
+		method := r.FormValue("code_challenge_method")
+		if method == "" {
+			method = oauth2.CodeChallengePlain.String()
+		}
+		if !slices.Contains(h.cfg.Authorize.CodeChallengeMethods, method) {
+			h.Error("userAuthorizeHandler Error: code_challenge_method is not allowed", zap.String("code_challenge_method", method))
+			return "", errors.ErrUnsupportedCodeChallengeMethod
+		}
+	}
+
 	// 读取会话中的用户ID
-	v, _ := h.session.Get(r, "user_id")
+	v, _ := h.session.Get(r, session.UserIDKey)
 
 	// 如果会话中没有用户ID，重定向到登录页面
 	if v == nil {
+		h.redirectToLogin(w, r)
+		return
+	}
 
-		// 如果请求的表单数据为空，解析表单,这一步是为了确保在登录页面可以获取到表单数据
-		if r.Form == nil {
-			r.ParseForm()
-		}
-
-		// 将请求的表单数据存入会话,这样在登录页面可以获取到用户之前的请求数据
-		h.session.Set(w, r, "authorize_form", r.Form)
+	// 登录会话已过期或已被撤销时清空会话,重新登录
+	sid, _ := h.session.Get(r, session.SIDKey)
+	sidValue, _ := sid.(string)
+	sess, err := h.sessions.Active(r.Context(), sidValue)
+	if err != nil {
+		h.Error("userAuthorizeHandler Error: get login session failed", zap.Error(err))
+		return "", errors.ErrServerError
+	}
+	if sess == nil {
+		h.session.Clear(w, r)
+		h.redirectToLogin(w, r)
+		return
+	}
 
-		// 登录页面最终会把userId写进session(user_id)
-		w.Header().Set("Location", h.cfg.LoginURL)
+	u, uerr := h.repo.GetUserInfoByID(r.Context(), sess.UserID)
+	if uerr != nil {
+		h.Error("userAuthorizeHandler Error: get user failed", zap.String("user_id", sess.UserID), zap.Error(uerr))
+		return "", errors.ErrServerError
+	}
+	client, cerr := h.cfg.GetClient(r.FormValue("client_id"))
 
-		w.WriteHeader(http.StatusFound)
+	// 客户端要求已验证的联系方式时,未验证的用户先跳转到验证页,验证后继续授权
+	if cerr == nil {
+		if missing := u.Unverified(client.RequireVerified); len(missing) > 0 {
+			h.redirectToVerify(w, r, missing)
+			return
+		}
+	}
 
+	// 用户或客户端要求两步验证而会话只通过了一种认证方式时,跳转到两步验证页绑定或验证,完成后继续授权
+	needMFA, merr := user.RequiresMFA(r.Context(), h.totps, h.credentials, u)
+	if merr != nil {
+		h.Error("userAuthorizeHandler Error: get mfa failed", zap.String("user_id", sess.UserID), zap.Error(merr))
+		return "", errors.ErrServerError
+	}
+	if (needMFA || (cerr == nil && client.RequireMFA)) && token.ACRForAMR(sess.AMR) != token.ACRMultiFactor {
+		h.redirectToMFA(w, r)
 		return
 	}
 
+	// 记录会话活动时间与获得授权的客户端
+	if err := h.sessions.Touch(r.Context(), sess, r.FormValue("client_id")); err != nil {
+		h.Error("userAuthorizeHandler Error: touch login session failed", zap.String("sid", sess.SID), zap.Error(err))
+	}
+
 	// 如果会话中有用户ID，直接返回
 	userID = v.(string)
 
@@ -86,6 +164,66 @@ func (h *OAuth2Handlers) userAuthorizeHandler(w http.ResponseWriter, r *http.Req
 	return
 }
 
+// redirectToLogin 保存授权请求并重定向到登录页面或注册页面
+func (h *OAuth2Handlers) redirectToLogin(w http.ResponseWriter, r *http.Request) {
+
+	h.saveAuthorizeForm(w, r)
+
+	// 登录页面最终会把userId写进session(user_id)
+	location := h.cfg.LoginURL
+
+	// 开放注册时 prompt=create 跳转到注册页,注册后同样自动登录并继续授权(OpenID Connect Prompt Create 1.0)
+	if reg := h.users.Registration; reg.Enabled && slices.Contains(strings.Fields(r.Form.Get("prompt")), "create") {
+		location = reg.URL
+	}
+
+	w.Header().Set("Location", location)
+
+	w.WriteHeader(http.StatusFound)
+}
+
+// redirectToVerify 保存授权请求并重定向到联系方式验证页面,require 参数为须验证的联系方式
+func (h *OAuth2Handlers) redirectToVerify(w http.ResponseWriter, r *http.Request, missing []string) {
+
+	h.saveAuthorizeForm(w, r)
+
+	location, err := url.Parse(h.users.Verification.URL)
+	if err != nil {
+		h.Error("redirectToVerify Error: verification url is invalid", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	q := location.Query()
+	q.Set("require", strings.Join(missing, ","))
+	location.RawQuery = q.Encode()
+
+	w.Header().Set("Location", location.String())
+
+	w.WriteHeader(http.StatusFound)
+}
+
+// redirectToMFA 保存授权请求并重定向到两步验证页面
+func (h *OAuth2Handlers) redirectToMFA(w http.ResponseWriter, r *http.Request) {
+
+	h.saveAuthorizeForm(w, r)
+
+	w.Header().Set("Location", h.users.MFA.URL)
+
+	w.WriteHeader(http.StatusFound)
+}
+
+// saveAuthorizeForm 将授权请求存入会话,登录、注册或验证完成后据此继续授权
+func (h *OAuth2Handlers) saveAuthorizeForm(w http.ResponseWriter, r *http.Request) {
+
+	// 如果请求的表单数据为空，解析表单,这一步是为了确保在登录页面可以获取到表单数据
+	if r.Form == nil {
+		r.ParseForm()
+	}
+
+	// 将请求的表单数据存入会话,这样在登录页面可以获取到用户之前的请求数据
+	h.session.Set(w, r, session.AuthorizeFormKey, r.Form)
+}
+
 // authorizeScopeHandler 授权域处理
 func (h *OAuth2Handlers) authorizeScopeHandler(w http.ResponseWriter, r *http.Request) (scope string, err error) {
 	if r.Form == nil {
@@ -156,6 +294,9 @@ func (h *OAuth2Handlers) clientAuthorizedHandler(clientID string, grant oauth2.G
 // internalErrorHandler 内部错误处理
 func (h *OAuth2Handlers) internalErrorHandler(err error) (re *errors.Response) {
 	h.Error("internalErrorHandler Error:", zap.Error(err))
+	if re = token.NewErrorResponse(err); re != nil {
+		return
+	}
 	re = errors.NewResponse(err, errors.StatusCodes[err])
 	re.Description = errors.Descriptions[err]
 	return
@@ -177,12 +318,78 @@ func (h *OAuth2Handlers) preRedirectErrorHandler(w http.ResponseWriter, req *ser
 	return err
 }
 
+// extractExtensionHandler 令牌扩展信息提取
+// 授权码模式下从会话中读取用户的认证时间与认证方式,随授权码一起保存,换取令牌时沿用
+func (h *OAuth2Handlers) extractExtensionHandler(tgr *oauth2.TokenGenerateRequest, ti oauth2.ExtendableTokenInfo) {
+
+	ext := ti.GetExtension()
+	if ext == nil {
+		ext = url.Values{}
+	}
+	defer ti.SetExtension(ext)
+
+	r := tgr.Request
+	if r == nil {
+		return
+	}
+
+	// 授权请求中的 resource 参数(RFC 8707)随授权码保存
+	if r.Form == nil {
+		r.ParseForm()
+	}
+	if rs := r.Form[token.ResourceExtension]; len(rs) > 0 && len(ext[token.ResourceExtension]) == 0 {
+		ext[token.ResourceExtension] = rs
+	}
+	if nonce := r.Form.Get(token.NonceExtension); nonce != "" && ext.Get(token.NonceExtension) == "" {
+		ext.Set(token.NonceExtension, nonce)
+	}
+
+	// 首次授权的授权类型,刷新令牌换取的令牌沿用其有效期配置
+	if ext.Get(token.GrantExtension) == "" {
+		if gt := r.Form.Get("grant_type"); gt != "" {
+			ext.Set(token.GrantExtension, gt)
+		} else if r.Form.Get("response_type") == oauth2.Token.String() {
+			ext.Set(token.GrantExtension, oauth2.Implicit.String())
+		}
+	}
+
+	// 授权码换取令牌时认证信息已从授权码继承
+	if ext.Get(token.AuthTimeExtension) != "" {
+		return
+	}
+
+	if r.Form.Get("grant_type") == oauth2.PasswordCredentials.String() {
+		ext.Set(token.AuthTimeExtension, strconv.FormatInt(time.Now().Unix(), 10))
+		ext.Set(token.AMRExtension, "pwd")
+		ext.Set(token.ACRExtension, token.ACRPassword)
+		return
+	}
+
+	if v, _ := h.session.Get(r, session.AuthTimeKey); v != nil {
+		if authTime, ok := v.(int64); ok {
+			ext.Set(token.AuthTimeExtension, strconv.FormatInt(authTime, 10))
+		}
+	}
+	if v, _ := h.session.Get(r, session.AMRKey); v != nil {
+		ext.Set(token.AMRExtension, v.(string))
+	}
+	if v, _ := h.session.Get(r, session.ACRKey); v != nil {
+		ext.Set(token.ACRExtension, v.(string))
+	}
+	if v, _ := h.session.Get(r, session.SIDKey); v != nil {
+		ext.Set(token.SessionExtension, v.(string))
+	}
+}
+
 // extensionFieldsHandler 扩展字段处理
+// 授权范围包含 openid 时在令牌响应中附带 ID Token,ID Token 由 Manager 在发放令牌时签发
 func (h *OAuth2Handlers) extensionFieldsHandler(ti oauth2.TokenInfo) (fieldsValue map[string]interface{}) {
 
 	fieldsValue = make(map[string]interface{})
 
-	fieldsValue["Issuer"] = h.cfg.Issuer
+	if v, ok := ti.(*issuedToken); ok {
+		fieldsValue["id_token"] = v.idToken
+	}
 
 	return fieldsValue
 }
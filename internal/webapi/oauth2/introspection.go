@@ -0,0 +1,177 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/client"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"go.uber.org/zap"
+)
+
+// 令牌类型提示(RFC 7009/7662 token_type_hint)
+const (
+	AccessTokenHint  = "access_token"
+	RefreshTokenHint = "refresh_token"
+)
+
+// clientInfoHandler 从请求中读取客户端凭证
+// 支持 client_secret_basic、client_secret_post 与公开客户端的 none,
+// 客户端注册了 token_endpoint_auth_method 时只接受该方式
+func (m *Manager) clientInfoHandler(r *http.Request) (clientID, clientSecret string, err error) {
+
+	clientID, clientSecret, method, err := client.Credentials(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	cli, err := m.GetClient(r.Context(), clientID)
+	if err != nil || cli == nil {
+		return "", "", errors.ErrInvalidClient
+	}
+
+	// 元数据读取失败时无法确认认证方式,按认证失败处理
+	meta, err := m.cfg.GetClient(clientID)
+	if err != nil {
+		m.Warn("load client metadata failed", zap.String("client_id", clientID), zap.Error(err))
+		return "", "", errors.ErrInvalidClient
+	}
+	if !meta.AllowsAuthMethod(method, cli.IsPublic()) {
+		m.Warn("client auth method not allowed", zap.String("client_id", clientID), zap.String("method", method))
+		return "", "", errors.ErrInvalidClient
+	}
+
+	return clientID, clientSecret, nil
+}
+
+// AuthenticateClient 认证请求中的客户端
+//
+// 参数:
+//
+//	r: HTTP 请求
+//
+// 返回值:
+//
+//	oauth2.ClientInfo: 客户端信息
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	errors.ErrInvalidClient: 客户端不存在或密钥错误
+func (m *Manager) AuthenticateClient(r *http.Request) (oauth2.ClientInfo, error) {
+
+	clientID, secret, err := m.clientInfoHandler(r)
+	if err != nil {
+		return nil, errors.ErrInvalidClient
+	}
+
+	cli, err := m.GetClient(r.Context(), clientID)
+	if err != nil || cli == nil {
+		return nil, errors.ErrInvalidClient
+	}
+
+	if !verifyClientSecret(cli, secret) {
+		return nil, errors.ErrInvalidClient
+	}
+
+	return cli, nil
+}
+
+// LoadToken 根据令牌值加载令牌信息,优先按 hint 指定的类型查找
+//
+// 参数:
+//
+//	ctx: 上下文
+//	value: 访问令牌或刷新令牌
+//	hint: 令牌类型提示,可为空
+//
+// 返回值:
+//
+//	oauth2.TokenInfo: 令牌信息,令牌无效或已过期时为 nil
+//	bool: 是否为刷新令牌
+func (m *Manager) LoadToken(ctx context.Context, value, hint string) (oauth2.TokenInfo, bool) {
+
+	if value == "" {
+		return nil, false
+	}
+
+	loadAccess := func() oauth2.TokenInfo {
+		ti, err := m.LoadAccessToken(ctx, value)
+		if err != nil {
+			return nil
+		}
+		return ti
+	}
+
+	loadRefresh := func() oauth2.TokenInfo {
+		ti, err := m.LoadRefreshToken(ctx, value)
+		if err != nil {
+			return nil
+		}
+		// 已撤销令牌族中的刷新令牌视为无效
+		if fam, _, err := m.families.FindByRefresh(ctx, value); err == nil && fam.Revoked {
+			return nil
+		}
+		return ti
+	}
+
+	if hint == RefreshTokenHint {
+		if ti := loadRefresh(); ti != nil {
+			return ti, true
+		}
+		return loadAccess(), false
+	}
+
+	if ti := loadAccess(); ti != nil {
+		return ti, false
+	}
+	if ti := loadRefresh(); ti != nil {
+		return ti, true
+	}
+
+	return nil, false
+}
+
+// RevokeToken 撤销令牌(RFC 7009)
+//
+// 令牌无效或不属于该客户端时静默忽略;
+// 撤销刷新令牌时同时撤销其令牌族与关联的访问令牌
+//
+// 参数:
+//
+//	ctx: 上下文
+//	clientID: 发起撤销的客户端ID
+//	value: 访问令牌或刷新令牌
+//	hint: 令牌类型提示,可为空
+func (m *Manager) RevokeToken(ctx context.Context, clientID, value, hint string) error {
+
+	ti, isRefresh := m.LoadToken(ctx, value, hint)
+	if ti == nil || ti.GetClientID() != clientID {
+		return nil
+	}
+
+	if !isRefresh {
+		return m.tokenStore.RemoveByAccess(ctx, value)
+	}
+
+	fam, _, err := m.families.FindByRefresh(ctx, value)
+	if err != nil && err != token.ErrFamilyNotFound {
+		return err
+	}
+	if fam != nil {
+		m.revokeFamily(ctx, fam)
+	}
+
+	if err := m.tokenStore.RemoveByRefresh(ctx, value); err != nil {
+		return err
+	}
+	if ti.GetAccess() != "" {
+		if err := m.tokenStore.RemoveByAccess(ctx, ti.GetAccess()); err != nil {
+			m.Error("remove access token failed", zap.String("client_id", clientID), zap.Error(err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	lockRetryInterval = 100 * time.Millisecond // 获取锁的重试间隔
+	lockStaleAfter    = 30 * time.Second       // 锁文件超过该时长视为持有者已退出
+)
+
+// 密钥文件错误
+var (
+	ErrKeyFileMode      = errors.New("signing key file is accessible by other users")          // 密钥文件权限不是 0600
+	ErrKeyFileEncrypted = errors.New("signing key file is encrypted but no kek is configured") // 密钥文件已加密但未配置密钥加密密钥
+	ErrKeyFileDecrypt   = errors.New("decrypt signing key file failed")                        // 密钥加密密钥错误或文件被篡改
+)
+
+// encryptedAlgorithm 密钥文件的加密算法
+const encryptedAlgorithm = "A256GCM"
+
+// encryptedFile 加密的密钥文件,ciphertext 为密钥列表 JSON 的 AES-256-GCM 密文
+type encryptedFile struct {
+	Algorithm  string `json:"alg"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// FileKeyStore 文件签名密钥存储
+// 密钥以 JSON 保存在共享卷上,通过同目录下的 .lock 文件实现跨副本互斥;
+// 配置了密钥加密密钥时整个文件加密保存,否则私钥为明文,只能依赖文件权限 0600 保护,
+// 能读取该文件的用户或备份均可伪造本服务签发的令牌
+type FileKeyStore struct {
+	path string
+	kek  []byte
+}
+
+// NewFileKeyStore 创建文件签名密钥存储
+//
+// 参数:
+//
+//	path: 密钥文件路径,须位于各副本共享的卷上
+//	kek: 32 字节的密钥加密密钥,为空时明文保存
+func NewFileKeyStore(path string, kek []byte) KeyStore {
+	return &FileKeyStore{path: path, kek: kek}
+}
+
+// Load 读取全部密钥,文件不存在时返回空
+// 文件可被其他用户访问时拒绝加载;配置了密钥加密密钥而文件仍为明文时,读取后立即加密改写。
+// 只在轮换锁内调用,改写不会与其他副本冲突
+func (s *FileKeyStore) Load(ctx context.Context) ([]*Key, error) {
+
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%w: %s mode %o, want 600", ErrKeyFileMode, s.path, fi.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+	if !plaintext {
+		if data, err = s.decrypt(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+
+	if plaintext && s.kek != nil {
+		if err := s.Save(ctx, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// Save 保存全部密钥
+// 先写权限为 0600 的临时文件再重命名,其他副本不会读到写了一半的文件
+func (s *FileKeyStore) Save(ctx context.Context, keys []*Key) error {
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if s.kek != nil {
+		if data, err = s.encrypt(data); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// encrypt 加密密钥列表 JSON
+func (s *FileKeyStore) encrypt(data []byte) ([]byte, error) {
+	return sealKeys(s.kek, data)
+}
+
+// decrypt 解密加密的密钥文件
+func (s *FileKeyStore) decrypt(data []byte) ([]byte, error) {
+	return openKeys(s.kek, data)
+}
+
+// sealKeys 使用密钥加密密钥以 AES-256-GCM 加密密钥列表 JSON
+func sealKeys(kek, data []byte) ([]byte, error) {
+
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(&encryptedFile{
+		Algorithm:  encryptedAlgorithm,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, data, []byte(encryptedAlgorithm)),
+	}, "", "  ")
+}
+
+// openKeys 解密 sealKeys 加密的密钥列表
+func openKeys(kek, data []byte) ([]byte, error) {
+
+	if kek == nil {
+		return nil, ErrKeyFileEncrypted
+	}
+
+	var f encryptedFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Algorithm != encryptedAlgorithm {
+		return nil, fmt.Errorf("%w: unsupported alg %q", ErrKeyFileDecrypt, f.Algorithm)
+	}
+
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, ErrKeyFileDecrypt
+	}
+
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, []byte(encryptedAlgorithm))
+	if err != nil {
+		return nil, ErrKeyFileDecrypt
+	}
+	return plain, nil
+}
+
+// newAEAD 由密钥加密密钥创建 AES-256-GCM
+func newAEAD(kek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Lock 创建锁文件获取轮换锁,锁已被持有时等待直到 ctx 结束
+func (s *FileKeyStore) Lock(ctx context.Context) (func(), error) {
+
+	lock := s.path + ".lock"
+
+	if err := os.MkdirAll(filepath.Dir(lock), 0o700); err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		// 持有者异常退出时清理残留的锁文件
+		if fi, err := os.Stat(lock); err == nil && time.Since(fi.ModTime()) > lockStaleAfter {
+			os.Remove(lock)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
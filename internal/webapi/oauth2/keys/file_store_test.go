@@ -0,0 +1,153 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKEK 生成随机的密钥加密密钥
+func testKEK(t *testing.T) []byte {
+	t.Helper()
+
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+	return kek
+}
+
+// testKeys 生成一个待保存的签名密钥
+func testKeys(t *testing.T) []*Key {
+	t.Helper()
+
+	k, err := GenerateKey("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.State = StateActive
+	return []*Key{k}
+}
+
+func TestFileKeyStoreEncrypted(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "signing_keys.json")
+	kek := testKEK(t)
+	keys := testKeys(t)
+
+	s := NewFileKeyStore(path, kek)
+	if err := s.Save(ctx, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("PRIVATE KEY")) || bytes.Contains(data, []byte(keys[0].ID)) {
+		t.Fatal("key file holds the private key in plaintext")
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Fatalf("key file mode %o, want 600", fi.Mode().Perm())
+	}
+
+	loaded, err := s.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0].ID != keys[0].ID || loaded[0].PrivateKey != keys[0].PrivateKey {
+		t.Fatalf("loaded keys do not match saved keys")
+	}
+
+	if _, err := NewFileKeyStore(path, testKEK(t)).Load(ctx); !errors.Is(err, ErrKeyFileDecrypt) {
+		t.Fatalf("load with another kek: %v, want %v", err, ErrKeyFileDecrypt)
+	}
+	if _, err := NewFileKeyStore(path, nil).Load(ctx); !errors.Is(err, ErrKeyFileEncrypted) {
+		t.Fatalf("load without kek: %v, want %v", err, ErrKeyFileEncrypted)
+	}
+}
+
+func TestFileKeyStoreTampered(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "signing_keys.json")
+	kek := testKEK(t)
+
+	s := NewFileKeyStore(path, kek)
+	if err := s.Save(ctx, testKeys(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 修改密文中的一个字符
+	i := bytes.Index(data, []byte(`"ciphertext": "`)) + len(`"ciphertext": "`) + 8
+	if data[i] == 'A' {
+		data[i] = 'B'
+	} else {
+		data[i] = 'A'
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Load(ctx); !errors.Is(err, ErrKeyFileDecrypt) {
+		t.Fatalf("load tampered file: %v, want %v", err, ErrKeyFileDecrypt)
+	}
+}
+
+func TestFileKeyStoreMigratesPlaintext(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "signing_keys.json")
+	keys := testKeys(t)
+
+	if err := NewFileKeyStore(path, nil).Save(ctx, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewFileKeyStore(path, testKEK(t))
+	loaded, err := s.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0].ID != keys[0].ID {
+		t.Fatal("plaintext keys not loaded")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("PRIVATE KEY")) {
+		t.Fatal("plaintext key file not encrypted after load")
+	}
+	if _, err := s.Load(ctx); err != nil {
+		t.Fatalf("load migrated file: %v", err)
+	}
+}
+
+func TestFileKeyStoreMode(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "signing_keys.json")
+
+	s := NewFileKeyStore(path, nil)
+	if err := s.Save(ctx, testKeys(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Load(ctx); !errors.Is(err, ErrKeyFileMode) {
+		t.Fatalf("load world-readable file: %v, want %v", err, ErrKeyFileMode)
+	}
+}
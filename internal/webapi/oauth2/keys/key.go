@@ -0,0 +1,208 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// State 密钥状态
+type State string
+
+const (
+	StateActive  State = "active"  // 当前用于签名
+	StateNext    State = "next"    // 已发布到 JWKS,下次轮换时启用
+	StateRetired State = "retired" // 不再签名,公钥保留到其签发的令牌全部过期
+)
+
+// ErrUnsupportedAlgorithm 不支持的签名算法
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+// Key 签名密钥
+type Key struct {
+	ID          string    `json:"kid"`          // 密钥ID,作为 JWT 头部的 kid
+	Algorithm   string    `json:"alg"`          // 签名算法,如 RS256
+	State       State     `json:"state"`        // 密钥状态
+	PrivateKey  string    `json:"private_key"`  // PKCS#8 PEM 格式私钥
+	CreatedAt   time.Time `json:"created_at"`   // 生成时间
+	ActivatedAt time.Time `json:"activated_at"` // 启用签名的时间
+	RetiredAt   time.Time `json:"retired_at"`   // 退役时间
+	ExpiresAt   time.Time `json:"expires_at"`   // 退役密钥从 JWKS 移除的时间
+
+	signer crypto.Signer
+}
+
+// Signer 私钥
+func (k *Key) Signer() crypto.Signer {
+	return k.signer
+}
+
+// PublicJWK 公钥的 JWK 表示
+func (k *Key) PublicJWK() (jwk.Key, error) {
+
+	key, err := jwk.FromRaw(k.signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := key.Set(jwk.KeyIDKey, k.ID); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.AlgorithmKey, k.Algorithm); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// parse 解析私钥
+func (k *Key) parse() error {
+
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return fmt.Errorf("key %s: invalid private key pem", k.ID)
+	}
+
+	v, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("key %s: %w", k.ID, err)
+	}
+
+	signer, ok := v.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("key %s: %w", k.ID, ErrUnsupportedAlgorithm)
+	}
+
+	k.signer = signer
+	return nil
+}
+
+// GenerateKey 按签名算法生成新的密钥,kid 取公钥的 JWK 指纹(RFC 7638)
+//
+// 参数:
+//
+//	alg: 签名算法,支持 RS256/RS384/RS512/PS256/PS384/PS512/ES256/ES384/ES512/EdDSA
+//
+// 返回值:
+//
+//	*Key: 新密钥,状态为空,由调用方设置
+//	error: 错误信息
+func GenerateKey(alg string) (*Key, error) {
+
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case alg == "ES256":
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case alg == "ES384":
+		signer, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case alg == "ES512":
+		signer, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case alg == "EdDSA":
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey("", alg, signer)
+}
+
+// ImportKey 导入已有的 PEM 私钥(PKCS#1/PKCS#8/SEC 1)
+//
+// 参数:
+//
+//	kid: 密钥ID,为空时取公钥的 JWK 指纹
+//	alg: 签名算法
+//	data: PEM 格式私钥
+func ImportKey(kid, alg string, data []byte) (*Key, error) {
+
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		signer, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case strings.HasPrefix(alg, "ES"):
+		signer, err = jwt.ParseECPrivateKeyFromPEM(data)
+	case alg == "EdDSA":
+		var v crypto.PrivateKey
+		v, err = jwt.ParseEdPrivateKeyFromPEM(data)
+		if err == nil {
+			signer, _ = v.(crypto.Signer)
+		}
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return newKey(kid, alg, signer)
+}
+
+// newKey 封装私钥
+func newKey(kid, alg string, signer crypto.Signer) (*Key, error) {
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Key{
+		ID:         kid,
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  time.Now(),
+		signer:     signer,
+	}
+
+	if k.ID == "" {
+		pub, err := jwk.FromRaw(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		tp, err := pub.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		k.ID = base64.RawURLEncoding.EncodeToString(tp)
+	}
+
+	return k, nil
+}
+
+// legacyKeyID 由配置的 kid 派生密钥ID,与单密钥时期签发的令牌保持一致
+func legacyKeyID(kid string) string {
+	hash := sha256.Sum256([]byte(kid))
+	return base64.RawURLEncoding.EncodeToString(hash[:8])
+}
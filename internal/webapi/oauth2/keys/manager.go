@@ -0,0 +1,251 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/zap"
+)
+
+// ErrNoActiveKey 没有可用于签名的密钥
+var ErrNoActiveKey = errors.New("no active signing key")
+
+// Manager 签名密钥管理
+//
+// 同时持有 active、next、retired 三种状态的密钥:
+// active 用于签名; next 提前发布到 JWKS,便于依赖方在启用前缓存;
+// retired 不再签名,公钥保留到其签发的令牌全部过期后移除。
+// 轮换周期到达时 next 升级为 active,active 转为 retired,并生成新的 next。
+type Manager struct {
+	*zap.Logger
+	cfg   *configs.OAuth2
+	store KeyStore
+
+	mu     sync.RWMutex
+	keys   []*Key
+	active *Key
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewManager 创建进程内签名密钥管理,创建时即加载密钥,保证开始处理请求前已有可用的签名密钥
+func NewManager(cfg *configs.OAuth2, store KeyStore, logger *zap.Logger) (*Manager, error) {
+
+	m := &Manager{
+		Logger: logger,
+		cfg:    cfg,
+		store:  store,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockStaleAfter)
+	defer cancel()
+	if err := m.Rotate(ctx); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Start 开始定时检查轮换
+func (m *Manager) Start() {
+	go m.run()
+}
+
+// Stop 停止定时检查轮换
+func (m *Manager) Stop(ctx context.Context) error {
+	close(m.stop)
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// Active 当前用于签名的密钥
+func (m *Manager) Active(ctx context.Context) (Signer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.active == nil {
+		return nil, ErrNoActiveKey
+	}
+	return m.active, nil
+}
+
+// PublicSet 需要发布到 JWKS 的公钥集合
+// 包含 active、next 以及尚未到期的 retired 密钥
+func (m *Manager) PublicSet(ctx context.Context) (jwk.Set, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	set := jwk.NewSet()
+	for _, k := range m.keys {
+		if k.State == StateRetired && now.After(k.ExpiresAt) {
+			continue
+		}
+
+		key, err := k.PublicJWK()
+		if err != nil {
+			return nil, err
+		}
+		if err := set.AddKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return set, nil
+}
+
+// Rotate 加载共享存储中的密钥,并在需要时完成轮换
+//
+// 首次启动且存储为空时,导入 manager.jwt_private_key 作为 active 密钥(沿用原有 kid,
+// 已签发的令牌仍可验证),未配置时生成新密钥
+func (m *Manager) Rotate(ctx context.Context) error {
+
+	unlock, err := m.store.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	keys, err := m.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := k.parse(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	changed := false
+
+	active, next := find(keys, StateActive), find(keys, StateNext)
+
+	if active == nil {
+		if active, err = m.initialKey(next); err != nil {
+			return err
+		}
+		if active == next {
+			next = nil
+		} else {
+			keys = append(keys, active)
+		}
+		active.State, active.ActivatedAt = StateActive, now
+		changed = true
+	}
+
+	interval := m.cfg.Keys.RotationInterval
+	if interval > 0 && next != nil && now.Sub(active.ActivatedAt) >= interval {
+		active.State, active.RetiredAt = StateRetired, now
+		active.ExpiresAt = now.Add(m.maxTokenLifetime())
+		next.State, next.ActivatedAt = StateActive, now
+		m.Info("signing key rotated", zap.String("retired", active.ID), zap.String("active", next.ID))
+		active, next = next, nil
+		changed = true
+	}
+
+	if interval > 0 && next == nil {
+		if next, err = GenerateKey(m.algorithm()); err != nil {
+			return err
+		}
+		next.State = StateNext
+		keys = append(keys, next)
+		changed = true
+	}
+
+	// 移除已到期的退役密钥
+	kept := keys[:0]
+	for _, k := range keys {
+		if k.State == StateRetired && now.After(k.ExpiresAt) {
+			changed = true
+			continue
+		}
+		kept = append(kept, k)
+	}
+	keys = kept
+
+	if changed {
+		if err := m.store.Save(ctx, keys); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.keys, m.active = keys, active
+	m.mu.Unlock()
+
+	return nil
+}
+
+// run 定时检查轮换,同时同步其他副本完成的轮换
+func (m *Manager) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.cfg.Keys.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Keys.CheckInterval)
+			if err := m.Rotate(ctx); err != nil {
+				m.Error("signing key rotation failed", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+// initialKey 没有 active 密钥时的替补: 优先使用 next,其次导入配置的私钥,最后生成新密钥
+func (m *Manager) initialKey(next *Key) (*Key, error) {
+
+	if next != nil {
+		return next, nil
+	}
+
+	if path := m.cfg.Manager.JWTPrivateKey; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ImportKey(legacyKeyID(m.cfg.Manager.Kid), m.algorithm(), data)
+	}
+
+	return GenerateKey(m.algorithm())
+}
+
+// algorithm 签名算法
+func (m *Manager) algorithm() string {
+	if m.cfg.Manager.SigningMethod != "" {
+		return m.cfg.Manager.SigningMethod
+	}
+	return "RS256"
+}
+
+// maxTokenLifetime 使用该服务签名的令牌的最长有效期,退役密钥至少保留这么久
+func (m *Manager) maxTokenLifetime() time.Duration {
+	return m.cfg.MaxSignedTokenLifetime()
+}
+
+// find 查找指定状态的密钥
+func find(keys []*Key, state State) *Key {
+	for _, k := range keys {
+		if k.State == state {
+			return k
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// unlockScript 只释放自己持有的轮换锁,锁过期后被其他副本获取时不误删
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisKeyStore Redis 签名密钥存储,多副本无需共享卷
+//
+// 键结构(均带前缀):
+//
+//	signing_keys        密钥列表 JSON,配置了密钥加密密钥时为 AES-256-GCM 密文
+//	signing_keys:lock   轮换锁,值为持有者的随机令牌,超过 lockStaleAfter 自动释放
+type RedisKeyStore struct {
+	cli    *redis.Client
+	prefix string
+	kek    []byte
+}
+
+// NewRedisKeyStore 创建 Redis 签名密钥存储
+//
+// 参数:
+//
+//	cli: Redis 连接
+//	prefix: 键前缀
+//	kek: 32 字节的密钥加密密钥,为空时明文保存
+//
+// 返回值:
+//
+//	KeyStore: 签名密钥存储
+func NewRedisKeyStore(cli *redis.Client, prefix string, kek []byte) KeyStore {
+	return &RedisKeyStore{cli: cli, prefix: prefix, kek: kek}
+}
+
+// Load 读取全部密钥,不存在时返回空
+// 配置了密钥加密密钥而保存的仍为明文时,读取后立即加密改写。只在轮换锁内调用
+func (s *RedisKeyStore) Load(ctx context.Context) ([]*Key, error) {
+
+	data, err := s.cli.Get(ctx, s.key()).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+	if !plaintext {
+		if data, err = openKeys(s.kek, data); err != nil {
+			return nil, err
+		}
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+
+	if plaintext && s.kek != nil {
+		if err := s.Save(ctx, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// Save 保存全部密钥
+func (s *RedisKeyStore) Save(ctx context.Context, keys []*Key) error {
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	if s.kek != nil {
+		if data, err = sealKeys(s.kek, data); err != nil {
+			return err
+		}
+	}
+
+	return s.cli.Set(ctx, s.key(), data, 0).Err()
+}
+
+// Lock 以 SET NX 获取轮换锁,锁已被持有时等待直到 ctx 结束
+func (s *RedisKeyStore) Lock(ctx context.Context) (func(), error) {
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(buf)
+	lock := s.key() + ":lock"
+
+	for {
+		ok, err := s.cli.SetNX(ctx, lock, token, lockStaleAfter).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				unlockScript.Run(ctx, s.cli, []string{lock}, token)
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// key 密钥列表的键
+func (s *RedisKeyStore) key() string {
+	return s.prefix + "signing_keys"
+}
@@ -0,0 +1,84 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/zap"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { cli.Close() })
+	return mr, cli
+}
+
+func TestRedisKeyStoreSharedBetweenReplicas(t *testing.T) {
+
+	ctx := context.Background()
+	mr, cli := newTestRedis(t)
+	kek := testKEK(t)
+
+	cfg, err := configs.NewOAuth2(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个副本使用同一 Redis,第二个副本加载第一个副本生成的密钥
+	a, err := NewManager(cfg, NewRedisKeyStore(cli, "oauth2:", kek), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewManager(cfg, NewRedisKeyStore(cli, "oauth2:", kek), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ka, _ := a.Active(ctx)
+	kb, _ := b.Active(ctx)
+	if ka.Kid() != kb.Kid() {
+		t.Fatalf("replicas use different active keys: %s, %s", ka.Kid(), kb.Kid())
+	}
+
+	data, err := mr.Get("oauth2:signing_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(data, "PRIVATE KEY") || strings.Contains(data, ka.Kid()) {
+		t.Fatal("redis holds the private key in plaintext")
+	}
+
+	if _, err := NewRedisKeyStore(cli, "oauth2:", testKEK(t)).Load(ctx); !errors.Is(err, ErrKeyFileDecrypt) {
+		t.Fatalf("load with another kek: %v, want %v", err, ErrKeyFileDecrypt)
+	}
+}
+
+func TestRedisKeyStoreLock(t *testing.T) {
+
+	_, cli := newTestRedis(t)
+	s := NewRedisKeyStore(cli, "oauth2:", nil)
+
+	unlock, err := s.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := s.Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lock held by another replica: %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	unlock()
+	again, err := s.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	again()
+}
@@ -0,0 +1,188 @@
+package keys
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ErrKeyNotActive 请求签名的密钥已不是当前密钥,通常发生在轮换之后
+var ErrKeyNotActive = errors.New("signing key is not active")
+
+// Signer 签名者
+// 私钥可以托管在进程外(KMS、PKCS#11 模块或本地签名服务),调用方只拿到签名结果
+type Signer interface {
+
+	// Kid 密钥ID,写入 JWT 头部
+	Kid() string
+
+	// Alg JWS 签名算法,如 RS256
+	Alg() string
+
+	// Sign 对 JWS 签名输入(header.payload)签名,返回 JWS 格式的签名值
+	Sign(ctx context.Context, signingInput []byte) ([]byte, error)
+}
+
+// Provider 签名密钥来源
+type Provider interface {
+
+	// Active 当前用于签名的签名者
+	Active(ctx context.Context) (Signer, error)
+
+	// PublicSet 需要发布到 JWKS 的公钥集合
+	PublicSet(ctx context.Context) (jwk.Set, error)
+}
+
+// NewProvider 按配置创建签名密钥来源
+//
+// local: 进程内持有私钥,由 Manager 生成并定时轮换;
+// socket: 通过 unix socket 委托本地签名服务(见 cmd/signerd),私钥不进入本进程
+func NewProvider(lc fx.Lifecycle, cfg *configs.OAuth2, store KeyStore, logger *zap.Logger) (Provider, error) {
+
+	if cfg.Keys.Signer == "socket" {
+		return NewSocketProvider(cfg.Keys.Socket, cfg.Keys.CheckInterval), nil
+	}
+
+	m, err := NewManager(cfg, store, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			m.Start()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return m.Stop(ctx)
+		},
+	})
+
+	return m, nil
+}
+
+// Kid 密钥ID
+func (k *Key) Kid() string {
+	return k.ID
+}
+
+// Alg 签名算法
+func (k *Key) Alg() string {
+	return k.Algorithm
+}
+
+// Sign 使用进程内私钥签名
+func (k *Key) Sign(ctx context.Context, signingInput []byte) ([]byte, error) {
+
+	method := jwt.GetSigningMethod(k.Algorithm)
+	if method == nil {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return method.Sign(string(signingInput), k.signer)
+}
+
+// SignJWT 使用当前签名者签发 JWT
+// 签名期间恰好发生轮换时,以新的当前密钥重签一次
+//
+// 参数:
+//
+//	ctx: 上下文
+//	provider: 签名密钥来源
+//	claims: JWT 声明
+//	header: 额外的 JWT 头部,如 typ
+//
+// 返回值:
+//
+//	string: 签名后的 JWT
+//	error: 错误信息
+func SignJWT(ctx context.Context, provider Provider, claims jwt.Claims, header map[string]any) (string, error) {
+
+	token, err := signJWT(ctx, provider, claims, header)
+	if errors.Is(err, ErrKeyNotActive) {
+		token, err = signJWT(ctx, provider, claims, header)
+	}
+	return token, err
+}
+
+// signJWT 使用当前签名者签发 JWT
+func signJWT(ctx context.Context, provider Provider, claims jwt.Claims, header map[string]any) (string, error) {
+
+	signer, err := provider.Active(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	method := jwt.GetSigningMethod(signer.Alg())
+	if method == nil {
+		return "", ErrUnsupportedAlgorithm
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	for k, v := range header {
+		token.Header[k] = v
+	}
+	token.Header["kid"] = signer.Kid()
+
+	signingInput, err := token.SigningString()
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := signer.Sign(ctx, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + token.EncodeSegment(sig), nil
+}
+
+// ErrKeyNotFound JWT 头部的 kid 不在已发布的公钥集合中
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// ParseJWT 使用已发布的公钥校验本服务签发的 JWT 并解析声明
+// 按头部 kid 查找公钥,已轮换但仍在发布期内的密钥同样可以校验
+//
+// 参数:
+//
+//	ctx: 上下文
+//	provider: 签名密钥来源
+//	tokenString: JWT
+//	claims: 解析目标
+//	opts: 解析选项,如 jwt.WithIssuer
+//
+// 返回值:
+//
+//	error: 错误信息,签名无效、kid 未知或声明校验失败时返回
+func ParseJWT(ctx context.Context, provider Provider, tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+
+	set, err := provider.PublicSet(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+
+		kid, _ := t.Header["kid"].(string)
+		key, ok := set.LookupKeyID(kid)
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+		if alg := key.Algorithm().String(); alg != "" && alg != t.Method.Alg() {
+			return nil, ErrUnsupportedAlgorithm
+		}
+
+		var raw any
+		if err := key.Raw(&raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}, opts...)
+
+	return err
+}
@@ -0,0 +1,270 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"go.uber.org/zap"
+)
+
+// 签名服务协议: 基于 unix socket 的 HTTP
+//
+//	GET  /keys  返回当前签名密钥与需要发布的公钥集合
+//	POST /sign  使用指定的当前密钥对签名输入签名,密钥已轮换时返回 409
+const (
+	socketKeysPath = "/keys"
+	socketSignPath = "/sign"
+)
+
+// socketKeysResponse /keys 响应
+type socketKeysResponse struct {
+	Kid  string          `json:"kid"`  // 当前签名密钥ID
+	Alg  string          `json:"alg"`  // 当前签名算法
+	Keys json.RawMessage `json:"keys"` // JWKS
+}
+
+// socketSignRequest /sign 请求
+type socketSignRequest struct {
+	Kid     string `json:"kid"`     // 签名密钥ID,须为当前密钥
+	Payload string `json:"payload"` // base64url 编码的签名输入
+}
+
+// socketSignResponse /sign 响应
+type socketSignResponse struct {
+	Signature string `json:"signature"` // base64url 编码的 JWS 签名值
+}
+
+// SocketProvider 通过 unix socket 委托本地签名服务签名
+// 私钥只存在于签名服务进程中,本进程只缓存公钥与当前密钥ID
+type SocketProvider struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	cached   *socketKeysResponse
+	cachedAt time.Time
+}
+
+// NewSocketProvider 创建 unix socket 签名密钥来源
+//
+// 参数:
+//
+//	path: 签名服务监听的 unix socket 路径
+//	ttl: 公钥与当前密钥ID的缓存时长
+func NewSocketProvider(path string, ttl time.Duration) Provider {
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+
+	return &SocketProvider{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+		ttl: ttl,
+	}
+}
+
+// Active 当前用于签名的签名者
+func (p *SocketProvider) Active(ctx context.Context) (Signer, error) {
+
+	keys, err := p.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &socketSigner{provider: p, kid: keys.Kid, alg: keys.Alg}, nil
+}
+
+// PublicSet 需要发布到 JWKS 的公钥集合
+func (p *SocketProvider) PublicSet(ctx context.Context) (jwk.Set, error) {
+
+	keys, err := p.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwk.Parse(keys.Keys)
+}
+
+// keys 读取签名服务的密钥信息,缓存 ttl 时长
+func (p *SocketProvider) keys(ctx context.Context) (*socketKeysResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cached != nil && time.Since(p.cachedAt) < p.ttl {
+		return p.cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://signer"+socketKeysPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("signer keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signer keys: unexpected status %d", resp.StatusCode)
+	}
+
+	keys := &socketKeysResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(keys); err != nil {
+		return nil, fmt.Errorf("signer keys: %w", err)
+	}
+
+	p.cached, p.cachedAt = keys, time.Now()
+	return keys, nil
+}
+
+// invalidate 清除缓存,下次重新读取当前密钥
+func (p *SocketProvider) invalidate() {
+	p.mu.Lock()
+	p.cached = nil
+	p.mu.Unlock()
+}
+
+// socketSigner 签名服务中的当前密钥
+type socketSigner struct {
+	provider *SocketProvider
+	kid      string
+	alg      string
+}
+
+func (s *socketSigner) Kid() string {
+	return s.kid
+}
+
+func (s *socketSigner) Alg() string {
+	return s.alg
+}
+
+// Sign 请求签名服务签名
+func (s *socketSigner) Sign(ctx context.Context, signingInput []byte) ([]byte, error) {
+
+	body, err := json.Marshal(&socketSignRequest{
+		Kid:     s.kid,
+		Payload: base64.RawURLEncoding.EncodeToString(signingInput),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://signer"+socketSignPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.provider.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("signer sign: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		s.provider.invalidate()
+		return nil, ErrKeyNotActive
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signer sign: unexpected status %d", resp.StatusCode)
+	}
+
+	data := &socketSignResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
+		return nil, fmt.Errorf("signer sign: %w", err)
+	}
+
+	return base64.RawURLEncoding.DecodeString(data.Signature)
+}
+
+// NewSocketHandler 创建签名服务的 HTTP 处理器,供签名服务进程监听 unix socket 使用
+//
+// 参数:
+//
+//	provider: 持有私钥的签名密钥来源,通常为 Manager
+//	logger: 日志
+func NewSocketHandler(provider Provider, logger *zap.Logger) http.Handler {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+socketKeysPath, func(w http.ResponseWriter, r *http.Request) {
+
+		signer, err := provider.Active(r.Context())
+		if err != nil {
+			logger.Error("signer keys: no active key", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		set, err := provider.PublicSet(r.Context())
+		if err != nil {
+			logger.Error("signer keys: build public set failed", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		raw, err := json.Marshal(set)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&socketKeysResponse{Kid: signer.Kid(), Alg: signer.Alg(), Keys: raw})
+	})
+
+	mux.HandleFunc("POST "+socketSignPath, func(w http.ResponseWriter, r *http.Request) {
+
+		req := &socketSignRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		input, err := base64.RawURLEncoding.DecodeString(req.Payload)
+		if err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		signer, err := provider.Active(r.Context())
+		if err != nil {
+			logger.Error("signer sign: no active key", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		// 只允许使用当前密钥签名,已轮换的密钥由调用方刷新后重试
+		if signer.Kid() != req.Kid {
+			http.Error(w, ErrKeyNotActive.Error(), http.StatusConflict)
+			return
+		}
+
+		sig, err := signer.Sign(r.Context(), input)
+		if err != nil {
+			logger.Error("signer sign failed", zap.String("kid", req.Kid), zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&socketSignResponse{Signature: base64.RawURLEncoding.EncodeToString(sig)})
+	})
+
+	return mux
+}
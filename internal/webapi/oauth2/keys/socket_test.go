@@ -0,0 +1,102 @@
+package keys
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/zap"
+)
+
+// newTestSocketProvider 在临时 unix socket 上启动签名服务,返回连接该服务的签名密钥来源
+func newTestSocketProvider(t *testing.T) *SocketProvider {
+	t.Helper()
+
+	cfg, err := configs.NewOAuth2(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Manager.SigningMethod = "ES256"
+	m, err := NewManager(cfg, NewMemoryKeyStore(), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unix socket 路径长度有限,不使用 t.TempDir 的长路径
+	dir, err := os.MkdirTemp("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "signer.sock")
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: NewSocketHandler(m, zap.NewNop())}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	return NewSocketProvider(path, time.Minute).(*SocketProvider)
+}
+
+func TestSocketSignerRoundTrip(t *testing.T) {
+
+	ctx := context.Background()
+	p := newTestSocketProvider(t)
+
+	signer, err := p.Active(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Alg() != "ES256" || signer.Kid() == "" {
+		t.Fatalf("active signer alg %q kid %q", signer.Alg(), signer.Kid())
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + signer.Alg() + `","kid":"` + signer.Kid() + `"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1"}`))
+	sig, err := signer.Sign(ctx, []byte(header+"."+payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact := header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	// 使用签名服务发布的公钥验证签名
+	set, err := p.PublicSet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jws.Verify([]byte(compact), jws.WithKeySet(set))
+	if err != nil {
+		t.Fatalf("verify with published keys: %v", err)
+	}
+	if string(got) != `{"sub":"1"}` {
+		t.Fatalf("payload %s", got)
+	}
+}
+
+func TestSocketSignerRotatedKey(t *testing.T) {
+
+	ctx := context.Background()
+	p := newTestSocketProvider(t)
+
+	active, err := p.Active(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 签名服务已轮换,调用方持有的密钥不再是当前密钥
+	stale := &socketSigner{provider: p, kid: "rotated", alg: active.Alg()}
+	if _, err := stale.Sign(ctx, []byte("header.payload")); !errors.Is(err, ErrKeyNotActive) {
+		t.Fatalf("sign with rotated key: %v, want %v", err, ErrKeyNotActive)
+	}
+}
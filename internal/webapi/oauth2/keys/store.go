@@ -0,0 +1,113 @@
+package keys
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/fx"
+)
+
+// KeyStore 签名密钥存储
+// 多副本部署时各副本通过共享的存储同步密钥,轮换在 Lock 保护下进行
+type KeyStore interface {
+
+	// Load 读取全部密钥
+	Load(ctx context.Context) ([]*Key, error)
+
+	// Save 保存全部密钥
+	Save(ctx context.Context, keys []*Key) error
+
+	// Lock 获取轮换锁,返回的函数用于释放锁
+	Lock(ctx context.Context) (unlock func(), err error)
+}
+
+// KeyStoreParams 创建签名密钥存储的依赖
+// 未配置 redis.addr 时不提供 Redis 连接
+type KeyStoreParams struct {
+	fx.In
+
+	Config *configs.OAuth2
+	Redis  *redis.Client `optional:"true"`
+}
+
+// NewKeyStore 按 oauth2.keys.store 创建签名密钥存储
+//
+// memory 只适用于单实例: 多副本时各副本各自生成密钥,互相无法验证对方签发的令牌;
+// 多副本部署须使用 file(各副本挂载同一共享卷)或 redis
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	KeyStore: 签名密钥存储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrKeysConfig: 密钥加密密钥格式错误
+//	configs.ErrRedisNotConfigured: 使用 Redis 存储但未配置 Redis
+func NewKeyStore(p KeyStoreParams) (KeyStore, error) {
+
+	cfg := p.Config
+	kek, err := cfg.Keys.KEKBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Keys.Store {
+	case configs.KeyStoreFile:
+		return NewFileKeyStore(cfg.Keys.Path, kek), nil
+	case configs.KeyStoreRedis:
+		if p.Redis == nil {
+			return nil, configs.ErrRedisNotConfigured
+		}
+		return NewRedisKeyStore(p.Redis, cfg.Keys.KeyPrefix, kek), nil
+	default:
+		return NewMemoryKeyStore(), nil
+	}
+}
+
+// MemoryKeyStore 内存签名密钥存储,仅适用于单实例
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	data []Key
+}
+
+// NewMemoryKeyStore 创建内存签名密钥存储
+func NewMemoryKeyStore() KeyStore {
+	return &MemoryKeyStore{}
+}
+
+// Load 读取全部密钥
+func (s *MemoryKeyStore) Load(ctx context.Context) ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]*Key, 0, len(s.data))
+	for _, v := range s.data {
+		k := v
+		keys = append(keys, &k)
+	}
+	return keys, nil
+}
+
+// Save 保存全部密钥
+func (s *MemoryKeyStore) Save(ctx context.Context, keys []*Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = make([]Key, 0, len(keys))
+	for _, k := range keys {
+		s.data = append(s.data, *k)
+	}
+	return nil
+}
+
+// Lock 单实例无需跨进程加锁
+func (s *MemoryKeyStore) Lock(ctx context.Context) (func(), error) {
+	return func() {}, nil
+}
@@ -1,24 +1,66 @@
 package oauth2
 
 import (
+	"context"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
 	"github.com/go-oauth2/oauth2/v4/manage"
+	"github.com/google/uuid"
 	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/client"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/oidc"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"go.uber.org/zap"
 )
 
-func NewManager(cfg *configs.OAuth2, clientStore oauth2.ClientStore, accessGenerate oauth2.AccessGenerate, tokenStore oauth2.TokenStore) *manage.Manager {
+// 刷新令牌模式
+const (
+	RefreshRotation = "rotation" // 每次刷新发放新的刷新令牌,旧令牌立即失效
+	RefreshSliding  = "sliding"  // 刷新令牌保持不变,有效期随使用顺延
+)
+
+// Manager 授权管理
+// 在 go-oauth2 默认实现的基础上接管刷新令牌的轮换与重放检测,
+// 并在发放令牌时签发 ID Token,签发失败时令牌请求失败
+type Manager struct {
+	*manage.Manager
+	*zap.Logger
+	cfg            *configs.OAuth2
+	families       token.FamilyStore
+	tokenStore     oauth2.TokenStore
+	accessGenerate oauth2.AccessGenerate
+	refreshPolicy  *token.RefreshPolicy
+	recorder       audit.Recorder
+	idTokens       *oidc.Service
+}
+
+func NewManager(cfg *configs.OAuth2, clientStore oauth2.ClientStore, authorizeGenerate oauth2.AuthorizeGenerate, accessGenerate oauth2.AccessGenerate, tokenStore oauth2.TokenStore, families token.FamilyStore, refreshPolicy *token.RefreshPolicy, recorder audit.Recorder, idTokens *oidc.Service, handler *OAuth2Handlers, logger *zap.Logger) *Manager {
 
 	// Initialize manager
 	mgr := manage.NewDefaultManager()
 
 	// Token config
+	// 访问令牌有效期按客户端与授权类型在生成时设置,见 GenerateAccessToken;
+	// 刷新令牌是否发放及其有效期由 token.RefreshPolicy 按客户端决定
 	mgr.SetAuthorizeCodeTokenCfg(&manage.Config{
-		AccessTokenExp:    time.Hour * time.Duration(cfg.Manager.AccessTokenExp),
-		RefreshTokenExp:   time.Hour * 24 * 3,
+		AccessTokenExp:    cfg.Manager.AccessTokenTTL(),
+		RefreshTokenExp:   cfg.Manager.RefreshTokenTTL(),
 		IsGenerateRefresh: true,
 	})
+	mgr.SetAuthorizeCodeExp(cfg.Manager.AuthorizationCodeTTL())
+
+	// 授权码有效期按客户端设置
+	mgr.MapAuthorizeGenerate(authorizeGenerate)
+
+	// go-oauth2 默认按第一个注册地址做域名后缀匹配,存在开放重定向风险
+	// 授权请求的跳转地址改由 GenerateAuthToken 按全部注册地址完全匹配;
+	// 换取令牌时 go-oauth2 仍要求与授权码中保存的跳转地址完全一致
+	mgr.SetValidateURIHandler(func(string, string) error { return nil })
 	// Token store
 	mgr.MapTokenStorage(tokenStore)
 
@@ -29,6 +71,340 @@ func NewManager(cfg *configs.OAuth2, clientStore oauth2.ClientStore, accessGener
 
 	mgr.MapClientStorage(clientStore)
 
-	
-	return mgr
+	// 令牌扩展信息(auth_time/amr/acr)
+	mgr.SetExtractExtensionHandler(handler.extractExtensionHandler)
+
+	return &Manager{
+		Manager:        mgr,
+		Logger:         logger,
+		cfg:            cfg,
+		families:       families,
+		tokenStore:     tokenStore,
+		accessGenerate: accessGenerate,
+		refreshPolicy:  refreshPolicy,
+		recorder:       recorder,
+		idTokens:       idTokens,
+	}
+}
+
+// GenerateAuthToken 生成授权码或隐式模式的访问令牌
+func (m *Manager) GenerateAuthToken(ctx context.Context, rt oauth2.ResponseType, tgr *oauth2.TokenGenerateRequest) (oauth2.TokenInfo, error) {
+
+	if err := m.ValidateRedirectURI(ctx, tgr.ClientID, tgr.RedirectURI); err != nil {
+		return nil, err
+	}
+
+	if rt != oauth2.Token {
+		return m.Manager.GenerateAuthToken(ctx, rt, tgr)
+	}
+
+	tgr.AccessTokenExp = m.cfg.AccessTokenLifetime(tgr.ClientID, oauth2.Implicit.String())
+
+	ti, err := m.Manager.GenerateAuthToken(ctx, rt, tgr)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.withIDToken(ctx, ti)
+}
+
+// ValidateRedirectURI 校验授权请求的跳转地址
+//
+// 跳转地址须与客户端注册的地址之一完全匹配(回环 IP 地址允许任意端口, RFC 8252 7.3);
+// 未携带跳转地址时客户端必须只注册了一个地址
+//
+// 参数:
+//
+//	ctx: 上下文
+//	clientID: 客户端ID
+//	uri: 请求中的跳转地址
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	errors.ErrInvalidClient: 客户端不存在
+//	errors.ErrInvalidRedirectURI: 跳转地址未注册
+func (m *Manager) ValidateRedirectURI(ctx context.Context, clientID, uri string) error {
+
+	cli, err := m.GetClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	if uri == "" {
+		if cli.GetDomain() == "" {
+			return errors.ErrInvalidRedirectURI
+		}
+		return nil
+	}
+
+	v, ok := cli.(client.RedirectURIValidator)
+	if !ok || !v.MatchRedirectURI(uri) {
+		m.Warn("redirect uri is not registered", zap.String("client_id", clientID), zap.String("redirect_uri", uri))
+		return errors.ErrInvalidRedirectURI
+	}
+
+	return nil
+}
+
+// GenerateAccessToken 生成访问令牌,发放刷新令牌时创建新的令牌族
+func (m *Manager) GenerateAccessToken(ctx context.Context, gt oauth2.GrantType, tgr *oauth2.TokenGenerateRequest) (oauth2.TokenInfo, error) {
+
+	// 访问令牌有效期按客户端与授权类型决定
+	tgr.AccessTokenExp = m.cfg.AccessTokenLifetime(tgr.ClientID, gt.String())
+
+	ti, err := m.Manager.GenerateAccessToken(ctx, gt, tgr)
+	if err != nil {
+		return nil, err
+	}
+
+	if ti.GetRefresh() != "" {
+		if err := m.families.Create(ctx, &token.Family{
+			ID:        uuid.NewString(),
+			ClientID:  ti.GetClientID(),
+			UserID:    ti.GetUserID(),
+			Access:    ti.GetAccess(),
+			Refresh:   ti.GetRefresh(),
+			CreatedAt: ti.GetRefreshCreateAt(),
+			ExpiresAt: refreshExpiresAt(ti),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.withIDToken(ctx, ti)
+}
+
+// RefreshAccessToken 使用刷新令牌换取新的访问令牌
+//
+// 刷新令牌一次性使用: 轮换后旧令牌被标记为已使用,
+// 已使用的刷新令牌再次出现时视为泄露,撤销整个令牌族并记录安全事件
+func (m *Manager) RefreshAccessToken(ctx context.Context, tgr *oauth2.TokenGenerateRequest) (oauth2.TokenInfo, error) {
+
+	fam, used, err := m.families.FindByRefresh(ctx, tgr.Refresh)
+	if err != nil && err != token.ErrFamilyNotFound {
+		return nil, err
+	}
+
+	if fam != nil && used {
+		m.refreshReused(ctx, fam)
+		return nil, errors.ErrInvalidGrant
+	}
+
+	if fam != nil && fam.Revoked {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	ti, err := m.LoadRefreshToken(ctx, tgr.Refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := m.GetClient(ctx, ti.GetClientID())
+	if err != nil {
+		return nil, err
+	}
+
+	// 刷新令牌只能由其所属客户端使用
+	if cli.GetID() != tgr.ClientID {
+		return nil, errors.ErrInvalidGrant
+	}
+	if !verifyClientSecret(cli, tgr.ClientSecret) {
+		return nil, errors.ErrInvalidClient
+	}
+
+	// 只允许缩小授权范围
+	if tgr.Scope != "" {
+		granted := strings.Fields(ti.GetScope())
+		for _, v := range strings.Fields(tgr.Scope) {
+			if !slices.Contains(granted, v) {
+				return nil, errors.ErrInvalidScope
+			}
+		}
+		ti.SetScope(tgr.Scope)
+	}
+
+	mode := RefreshRotation
+	if client, err := m.cfg.GetClient(cli.GetID()); err == nil && client.RefreshTokenMode == RefreshSliding {
+		mode = RefreshSliding
+	}
+
+	oldAccess, oldRefresh := ti.GetAccess(), ti.GetRefresh()
+
+	createAt := time.Now()
+
+	// 超过绝对有效期后必须重新授权
+	grantedAt := ti.GetRefreshCreateAt()
+	if fam != nil {
+		grantedAt = fam.CreatedAt
+	}
+	lifetime := m.refreshPolicy.Lifetime(cli.GetID(), token.GrantType(ti), grantedAt, createAt)
+	if lifetime <= 0 {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	ti.SetAccessCreateAt(createAt)
+	ti.SetAccessExpiresIn(m.cfg.AccessTokenLifetime(cli.GetID(), token.GrantType(ti)))
+
+	td := &oauth2.GenerateBasic{
+		Client:    cli,
+		UserID:    ti.GetUserID(),
+		CreateAt:  createAt,
+		TokenInfo: ti,
+		Request:   tgr.Request,
+	}
+
+	av, rv, err := m.accessGenerate.Token(ctx, td, mode == RefreshRotation)
+	if err != nil {
+		return nil, err
+	}
+
+	ti.SetAccess(av)
+	if mode == RefreshRotation {
+		ti.SetRefresh(rv)
+	}
+
+	// 空闲有效期自本次刷新起重新计算
+	ti.SetRefreshCreateAt(createAt)
+	ti.SetRefreshExpiresIn(lifetime)
+
+	// 当前策略不再发放刷新令牌时(如缩小授权范围后不含 offline_access)令牌族结束,
+	// 撤销令牌族使旧刷新令牌失效,不登记空的刷新令牌
+	if fam != nil && ti.GetRefresh() == "" {
+		if err := m.families.Revoke(ctx, fam.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 先在令牌族上占用旧刷新令牌,并发使用同一刷新令牌的请求只有一个能继续
+	if fam != nil && ti.GetRefresh() != "" {
+		err := m.families.Rotate(ctx, fam.ID, oldRefresh, ti.GetAccess(), ti.GetRefresh(), refreshExpiresAt(ti))
+		if err == token.ErrRefreshReused {
+			// 重新读取令牌族,撤销的是抢先轮换后产生的令牌
+			if cur, _, err := m.families.FindByRefresh(ctx, oldRefresh); err == nil {
+				fam = cur
+			}
+			m.refreshReused(ctx, fam)
+			return nil, errors.ErrInvalidGrant
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.tokenStore.RemoveByAccess(ctx, oldAccess); err != nil {
+		return nil, err
+	}
+	if mode == RefreshRotation {
+		if err := m.tokenStore.RemoveByRefresh(ctx, oldRefresh); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.tokenStore.Create(ctx, ti); err != nil {
+		return nil, err
+	}
+
+	if fam == nil && ti.GetRefresh() != "" {
+		err = m.families.Create(ctx, &token.Family{
+			ID:        uuid.NewString(),
+			ClientID:  ti.GetClientID(),
+			UserID:    ti.GetUserID(),
+			Access:    ti.GetAccess(),
+			Refresh:   ti.GetRefresh(),
+			CreatedAt: grantedAt,
+			ExpiresAt: refreshExpiresAt(ti),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m.withIDToken(ctx, ti)
+}
+
+// issuedToken 附带已签发 ID Token 的令牌信息,由 extensionFieldsHandler 写入令牌响应
+type issuedToken struct {
+	oauth2.TokenInfo
+	idToken string
+}
+
+// withIDToken 授权范围包含 openid 时签发 ID Token
+// 签发或加密失败时撤销刚发放的令牌并返回 server_error,不返回缺少 id_token 的成功响应
+func (m *Manager) withIDToken(ctx context.Context, ti oauth2.TokenInfo) (oauth2.TokenInfo, error) {
+
+	idToken, err := m.idTokens.IDToken(ctx, ti)
+	if err != nil {
+		m.Error("issue id token failed", zap.String("client_id", ti.GetClientID()), zap.Error(err))
+		m.revokeIssued(ctx, ti)
+		return nil, errors.ErrServerError
+	}
+	if idToken == "" {
+		return ti, nil
+	}
+
+	return &issuedToken{TokenInfo: ti, idToken: idToken}, nil
+}
+
+// revokeIssued 撤销刚发放的令牌,发放了刷新令牌时同时撤销其令牌族
+func (m *Manager) revokeIssued(ctx context.Context, ti oauth2.TokenInfo) {
+
+	value, hint := ti.GetAccess(), "access_token"
+	if ti.GetRefresh() != "" {
+		value, hint = ti.GetRefresh(), "refresh_token"
+	}
+
+	if err := m.RevokeToken(ctx, ti.GetClientID(), value, hint); err != nil {
+		m.Error("revoke issued token failed", zap.String("client_id", ti.GetClientID()), zap.Error(err))
+	}
+}
+
+// refreshReused 已使用的刷新令牌再次出现,撤销令牌族并记录安全事件
+func (m *Manager) refreshReused(ctx context.Context, fam *token.Family) {
+	m.revokeFamily(ctx, fam)
+	m.recorder.Record(ctx, &audit.Event{
+		Type:     audit.RefreshTokenReused,
+		UserID:   fam.UserID,
+		ClientID: fam.ClientID,
+		Detail:   map[string]string{"family_id": fam.ID},
+	})
+}
+
+// revokeFamily 撤销令牌族及其当前有效的令牌
+func (m *Manager) revokeFamily(ctx context.Context, fam *token.Family) {
+
+	if err := m.families.Revoke(ctx, fam.ID); err != nil {
+		m.Error("revoke token family failed", zap.String("family_id", fam.ID), zap.Error(err))
+	}
+
+	if fam.Access != "" {
+		if err := m.tokenStore.RemoveByAccess(ctx, fam.Access); err != nil {
+			m.Error("remove access token failed", zap.String("family_id", fam.ID), zap.Error(err))
+		}
+	}
+
+	if fam.Refresh != "" {
+		if err := m.tokenStore.RemoveByRefresh(ctx, fam.Refresh); err != nil {
+			m.Error("remove refresh token failed", zap.String("family_id", fam.ID), zap.Error(err))
+		}
+	}
+}
+
+// refreshExpiresAt 刷新令牌过期时间,不过期时返回零值
+func refreshExpiresAt(ti oauth2.TokenInfo) time.Time {
+	if ti.GetRefreshExpiresIn() == 0 {
+		return time.Time{}
+	}
+	return ti.GetRefreshCreateAt().Add(ti.GetRefreshExpiresIn())
+}
+
+// verifyClientSecret 校验客户端密钥
+// 密钥只保存哈希,只能通过 oauth2.ClientPasswordVerifier 校验,未实现的客户端一律拒绝;
+// 公开客户端是否免校验由 VerifyPassword 决定
+func verifyClientSecret(cli oauth2.ClientInfo, secret string) bool {
+	v, ok := cli.(oauth2.ClientPasswordVerifier)
+	return ok && v.VerifyPassword(secret)
 }
@@ -0,0 +1,140 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/infra/repoimpl"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/client"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/oidc"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/password"
+	"go.uber.org/zap"
+)
+
+const (
+	testClientID = "c1"
+	testSecret   = "c1-secret"
+	testUserID   = "1"
+)
+
+// newTestManager 创建使用内存存储的授权管理,客户端 c1 允许刷新令牌
+func newTestManager(t *testing.T) (*Manager, token.FamilyStore) {
+	t.Helper()
+
+	logger := zap.NewNop()
+
+	cfg, err := configs.NewOAuth2(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := password.Hash(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Clients = []*configs.Client{{
+		ID:         testClientID,
+		Secret:     hash,
+		Scopes:     []string{"openid", "profile", "offline_access"},
+		GrantTypes: []string{"authorization_code", "refresh_token"},
+	}}
+
+	ucfg, err := configs.NewUser(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ucfg.Users = []*configs.SeedUser{{ID: testUserID, Username: "alice", Password: "alice-password"}}
+	repo, err := repoimpl.NewUserRepository(repoimpl.UserRepositoryParams{Config: ucfg, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients, err := client.NewMemoryClientStore(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := keys.NewManager(cfg, keys.NewMemoryKeyStore(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := token.NewRefreshPolicy(cfg)
+	families := token.NewMemoryFamilyStore()
+	m := NewManager(cfg, clients, token.NewAuthorizeGenerate(cfg), token.NewCustomJWTAccessGenerate(cfg, provider, policy),
+		token.NewMemotyTokenStore(logger), families, policy, audit.NewLogRecorder(logger),
+		oidc.NewService(cfg, provider, repo, oidc.NewEncrypter(), logger), nil, logger)
+
+	return m, families
+}
+
+// refresh 使用刷新令牌换取令牌,scope 为空表示不缩小授权范围
+func refresh(m *Manager, rt, scope string) (oauth2.TokenInfo, error) {
+	return m.RefreshAccessToken(context.Background(), &oauth2.TokenGenerateRequest{
+		ClientID:     testClientID,
+		ClientSecret: testSecret,
+		Refresh:      rt,
+		Scope:        scope,
+		Request:      httptest.NewRequest(http.MethodPost, "/connect/token", nil),
+	})
+}
+
+func TestRefreshWithoutNewRefreshTokenEndsFamily(t *testing.T) {
+
+	m, families := newTestManager(t)
+	ctx := context.Background()
+
+	ti := models.NewToken()
+	ti.SetClientID(testClientID)
+	ti.SetUserID(testUserID)
+	ti.SetScope("openid profile offline_access")
+	ti.SetAccess("access-0")
+	ti.SetAccessCreateAt(time.Now())
+	ti.SetAccessExpiresIn(time.Hour)
+	ti.SetRefresh("refresh-0")
+	ti.SetRefreshCreateAt(time.Now())
+	ti.SetRefreshExpiresIn(time.Hour)
+	if err := m.tokenStore.Create(ctx, ti); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := refresh(m, "refresh-0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.GetRefresh() == "" || rotated.GetRefresh() == "refresh-0" {
+		t.Fatalf("refresh token not rotated: %q", rotated.GetRefresh())
+	}
+
+	// 缩小授权范围后不含 offline_access,不再发放刷新令牌
+	narrowed, err := refresh(m, rotated.GetRefresh(), "openid profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if narrowed.GetRefresh() != "" {
+		t.Fatalf("refresh token issued without offline_access: %q", narrowed.GetRefresh())
+	}
+
+	fam, _, err := families.FindByRefresh(ctx, rotated.GetRefresh())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fam.Revoked {
+		t.Fatal("family not ended when no refresh token was issued")
+	}
+	if _, _, err := families.FindByRefresh(ctx, ""); err != token.ErrFamilyNotFound {
+		t.Fatalf("empty refresh token registered in family: %v", err)
+	}
+
+	if _, err := refresh(m, rotated.GetRefresh(), ""); err != errors.ErrInvalidGrant {
+		t.Fatalf("reuse refresh token of ended family: %v, want %v", err, errors.ErrInvalidGrant)
+	}
+}
@@ -0,0 +1,172 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultContentEncryption 客户端只注册了密钥加密算法时的内容加密算法(OIDC Dynamic Client Registration)
+const DefaultContentEncryption = "A128CBC-HS256"
+
+// jwksCacheTTL jwks_uri 的缓存时长
+const jwksCacheTTL = 10 * time.Minute
+
+// 支持的 JWE 算法,发布在发现文档中;客户端注册的算法在配置校验时按同一列表检查
+var (
+	KeyEncryptionAlgorithms     = configs.KeyEncryptionAlgorithms
+	ContentEncryptionAlgorithms = configs.ContentEncryptionAlgorithms
+)
+
+var (
+	ErrUnsupportedEncryption = errors.New("unsupported encryption algorithm")          // 客户端注册的加密算法不受支持
+	ErrNoEncryptionKey       = errors.New("client has no key usable for encryption")   // 客户端公钥集合中没有可用于加密的密钥
+	ErrNoClientJWKS          = errors.New("client has no jwks or jwks_uri registered") // 客户端未注册公钥集合
+)
+
+// Encrypter 使用客户端公钥加密 JWT(JWE)
+// jwks_uri 的获取不持有缓存锁,同一地址的并发获取合并为一次,慢速的客户端地址不阻塞其他客户端
+type Encrypter struct {
+	mu    sync.Mutex
+	cache map[string]*cachedSet
+	fetch singleflight.Group
+}
+
+type cachedSet struct {
+	set       jwk.Set
+	fetchedAt time.Time
+}
+
+// NewEncrypter 创建 JWE 加密器
+func NewEncrypter() *Encrypter {
+	return &Encrypter{cache: make(map[string]*cachedSet)}
+}
+
+// Encrypt 将已签名的 JWT 加密为嵌套 JWT(cty: JWT)
+//
+// 参数:
+//
+//	ctx: 上下文
+//	client: 客户端配置,提供 jwks 或 jwks_uri
+//	alg: 密钥加密算法
+//	enc: 内容加密算法,为空时使用 A128CBC-HS256
+//	signed: 已签名的 JWT
+//
+// 返回值:
+//
+//	string: JWE 紧凑序列化
+//	error: 错误信息
+func (e *Encrypter) Encrypt(ctx context.Context, client *configs.Client, alg, enc, signed string) (string, error) {
+
+	if enc == "" {
+		enc = DefaultContentEncryption
+	}
+	if !slices.Contains(KeyEncryptionAlgorithms, alg) || !slices.Contains(ContentEncryptionAlgorithms, enc) {
+		return "", ErrUnsupportedEncryption
+	}
+
+	set, err := e.clientKeys(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := selectKey(set, alg)
+	if err != nil {
+		return "", err
+	}
+
+	headers := jwe.NewHeaders()
+	if err := headers.Set(jwe.ContentTypeKey, "JWT"); err != nil {
+		return "", err
+	}
+	if kid := key.KeyID(); kid != "" {
+		if err := headers.Set(jwe.KeyIDKey, kid); err != nil {
+			return "", err
+		}
+	}
+
+	out, err := jwe.Encrypt([]byte(signed),
+		jwe.WithKey(jwa.KeyEncryptionAlgorithm(alg), key),
+		jwe.WithContentEncryption(jwa.ContentEncryptionAlgorithm(enc)),
+		jwe.WithProtectedHeaders(headers),
+		jwe.WithCompact(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// clientKeys 客户端公钥集合,优先使用注册时提供的 jwks
+func (e *Encrypter) clientKeys(ctx context.Context, client *configs.Client) (jwk.Set, error) {
+
+	if client.JWKS != "" {
+		return jwk.Parse([]byte(client.JWKS))
+	}
+
+	if client.JWKSURI == "" {
+		return nil, ErrNoClientJWKS
+	}
+
+	e.mu.Lock()
+	c, ok := e.cache[client.JWKSURI]
+	e.mu.Unlock()
+	if ok && time.Since(c.fetchedAt) < jwksCacheTTL {
+		return c.set, nil
+	}
+
+	v, err, _ := e.fetch.Do(client.JWKSURI, func() (any, error) {
+		set, err := jwk.Fetch(ctx, client.JWKSURI)
+		if err != nil {
+			return nil, fmt.Errorf("fetch client jwks: %w", err)
+		}
+
+		e.mu.Lock()
+		e.cache[client.JWKSURI] = &cachedSet{set: set, fetchedAt: time.Now()}
+		e.mu.Unlock()
+		return set, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(jwk.Set), nil
+}
+
+// selectKey 选择与密钥加密算法匹配的加密公钥
+// 密钥须用于加密(use 为 enc 或未指定),指定了 alg 时须与之一致
+func selectKey(set jwk.Set, alg string) (jwk.Key, error) {
+
+	kty := jwa.RSA
+	if alg != "RSA-OAEP" && alg != "RSA-OAEP-256" {
+		kty = jwa.EC
+	}
+
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Key(i)
+
+		if key.KeyType() != kty {
+			continue
+		}
+		if use := key.KeyUsage(); use != "" && use != string(jwk.ForEncryption) {
+			continue
+		}
+		if a := key.Algorithm(); a != nil && a.String() != "" && a.String() != alg {
+			continue
+		}
+
+		return key, nil
+	}
+
+	return nil, ErrNoEncryptionKey
+}
@@ -0,0 +1,92 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+)
+
+// newJWKSServer 发布一个 RSA 加密公钥的 jwks_uri,每次请求前等待 delay
+func newJWKSServer(t *testing.T, delay time.Duration, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	set.AddKey(key)
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClientKeysFetchDoesNotBlockOtherClients(t *testing.T) {
+
+	var slowHits, fastHits atomic.Int32
+	slow := newJWKSServer(t, 500*time.Millisecond, &slowHits)
+	fast := newJWKSServer(t, 0, &fastHits)
+
+	e := NewEncrypter()
+	ctx := context.Background()
+	slowClient := &configs.Client{ID: "slow", JWKSURI: slow.URL}
+
+	// 同一地址的并发获取合并为一次
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := e.clientKeys(ctx, slowClient)
+			done <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// 慢速地址获取期间,其他客户端不被阻塞
+	start := time.Now()
+	if _, err := e.clientKeys(ctx, &configs.Client{ID: "fast", JWKSURI: fast.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("fetch of another client's jwks_uri blocked for %s", elapsed)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := slowHits.Load(); n != 1 {
+		t.Fatalf("jwks_uri fetched %d times, want 1", n)
+	}
+
+	// 缓存期内不再请求
+	if _, err := e.clientKeys(ctx, slowClient); err != nil {
+		t.Fatal(err)
+	}
+	if n := slowHits.Load(); n != 1 {
+		t.Fatalf("cached jwks_uri fetched again: %d", n)
+	}
+}
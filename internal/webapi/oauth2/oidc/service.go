@@ -0,0 +1,248 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "crypto/sha256" // at_hash 使用的哈希算法
+	_ "crypto/sha512"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/domain/user"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"go.uber.org/zap"
+)
+
+// OpenID Connect 定义的 scope
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
+// ClaimsSupported 发现文档中发布的声明
+var ClaimsSupported = []string{
+	"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr", "azp", "at_hash",
+	"preferred_username", "nickname", "picture",
+	"email", "email_verified", "phone_number", "phone_number_verified",
+}
+
+// IDTokenClaims ID Token 声明
+type IDTokenClaims struct {
+	Nonce    string           `json:"nonce,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	AZP      string           `json:"azp,omitempty"`
+	AtHash   string           `json:"at_hash,omitempty"`
+
+	Email               string `json:"email,omitempty"`
+	EmailVerified       *bool  `json:"email_verified,omitempty"`
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"`
+
+	jwt.RegisteredClaims
+}
+
+// Service OpenID Connect 身份层,签发 ID Token 并提供用户信息
+// 客户端注册了加密算法时,ID Token 与用户信息以先签名后加密的嵌套 JWT 返回
+type Service struct {
+	*zap.Logger
+	cfg       *configs.OAuth2
+	keys      keys.Provider
+	repo      user.UserRepository
+	encrypter *Encrypter
+}
+
+// NewService 创建 OpenID Connect 服务
+func NewService(cfg *configs.OAuth2, keyProvider keys.Provider, repo user.UserRepository, encrypter *Encrypter, logger *zap.Logger) *Service {
+	return &Service{
+		Logger:    logger,
+		cfg:       cfg,
+		keys:      keyProvider,
+		repo:      repo,
+		encrypter: encrypter,
+	}
+}
+
+// HasScope 判断授权范围是否包含指定 scope
+func HasScope(scope, v string) bool {
+	return slices.Contains(strings.Fields(scope), v)
+}
+
+// IDToken 为令牌签发 ID Token
+//
+// 授权范围不含 openid 或没有资源所有者(client_credentials)时不签发,返回空字符串
+//
+// 参数:
+//
+//	ctx: 上下文
+//	ti: 已签发的令牌
+//
+// 返回值:
+//
+//	string: ID Token,客户端注册了加密算法时为 JWE
+//	error: 错误信息
+func (s *Service) IDToken(ctx context.Context, ti oauth2.TokenInfo) (string, error) {
+
+	if ti.GetUserID() == "" || !HasScope(ti.GetScope(), ScopeOpenID) {
+		return "", nil
+	}
+
+	now := time.Now()
+	claims := &IDTokenClaims{
+		AZP: ti.GetClientID(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   ti.GetUserID(),
+			Audience:  jwt.ClaimStrings{ti.GetClientID()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.IDTokenLifetime(ti.GetClientID(), token.GrantType(ti)))),
+		},
+	}
+
+	if eti, ok := ti.(oauth2.ExtendableTokenInfo); ok {
+		ext := eti.GetExtension()
+		claims.Nonce = ext.Get(token.NonceExtension)
+		claims.ACR = ext.Get(token.ACRExtension)
+		claims.AMR = strings.Fields(ext.Get(token.AMRExtension))
+		if v, err := strconv.ParseInt(ext.Get(token.AuthTimeExtension), 10, 64); err == nil {
+			claims.AuthTime = jwt.NewNumericDate(time.Unix(v, 0))
+		}
+	}
+
+	// 授权范围包含 email 或 phone 时附带联系方式及其验证状态,与用户信息端点一致
+	email, phone := HasScope(ti.GetScope(), ScopeEmail), HasScope(ti.GetScope(), ScopePhone)
+	if email || phone {
+		u, err := s.repo.GetUserInfoByID(ctx, ti.GetUserID())
+		if err != nil {
+			return "", err
+		}
+		if email && u.Email != "" {
+			claims.Email, claims.EmailVerified = u.Email, &u.EmailVerified
+		}
+		if phone && u.Phone != "" {
+			claims.PhoneNumber, claims.PhoneNumberVerified = u.Phone, &u.PhoneVerified
+		}
+	}
+
+	if access := ti.GetAccess(); access != "" {
+		signer, err := s.keys.Active(ctx)
+		if err != nil {
+			return "", err
+		}
+		claims.AtHash = accessTokenHash(signer.Alg(), access)
+	}
+
+	signed, err := keys.SignJWT(ctx, s.keys, claims, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := s.cfg.GetClient(ti.GetClientID())
+	if err != nil || client.IDTokenEncryptedResponseAlg == "" {
+		return signed, nil
+	}
+
+	return s.encrypter.Encrypt(ctx, client, client.IDTokenEncryptedResponseAlg, client.IDTokenEncryptedResponseEnc, signed)
+}
+
+// Userinfo 用户信息
+//
+// 参数:
+//
+//	ctx: 上下文
+//	ti: 访问令牌
+//
+// 返回值:
+//
+//	map[string]any: 按授权范围返回的用户声明
+//	string: 客户端注册了用户信息加密算法时为嵌套 JWT,否则为空
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	user.ErrUserNotFound: 用户不存在
+func (s *Service) Userinfo(ctx context.Context, ti oauth2.TokenInfo) (map[string]any, string, error) {
+
+	u, err := s.repo.GetUserInfoByID(ctx, ti.GetUserID())
+	if err != nil {
+		return nil, "", err
+	}
+
+	claims := map[string]any{"sub": u.ID}
+	if HasScope(ti.GetScope(), ScopeProfile) {
+		claims["preferred_username"] = u.Loginname
+		claims["nickname"] = u.Nickname
+		claims["picture"] = u.Avatar
+	}
+	maps.Copy(claims, contactClaims(u, ti.GetScope()))
+
+	client, err := s.cfg.GetClient(ti.GetClientID())
+	if err != nil || client.UserinfoEncryptedResponseAlg == "" {
+		return claims, "", nil
+	}
+
+	// 以 JWT 返回时需带上 iss 与 aud
+	jwtClaims := jwt.MapClaims{"iss": s.cfg.Issuer, "aud": client.ID}
+	for k, v := range claims {
+		jwtClaims[k] = v
+	}
+
+	signed, err := keys.SignJWT(ctx, s.keys, jwtClaims, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	encrypted, err := s.encrypter.Encrypt(ctx, client, client.UserinfoEncryptedResponseAlg, client.UserinfoEncryptedResponseEnc, signed)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return claims, encrypted, nil
+}
+
+// contactClaims 按授权范围返回邮箱与手机号声明,未绑定的联系方式不返回
+func contactClaims(u *user.UserInfo, scope string) map[string]any {
+
+	claims := map[string]any{}
+	if HasScope(scope, ScopeEmail) && u.Email != "" {
+		claims["email"] = u.Email
+		claims["email_verified"] = u.EmailVerified
+	}
+	if HasScope(scope, ScopePhone) && u.Phone != "" {
+		claims["phone_number"] = u.Phone
+		claims["phone_number_verified"] = u.PhoneVerified
+	}
+
+	return claims
+}
+
+// accessTokenHash 计算 at_hash: 访问令牌哈希值左半部分的 base64url 编码
+// 哈希算法与 ID Token 签名算法一致
+func accessTokenHash(alg, access string) string {
+
+	hash := crypto.SHA256
+	switch {
+	case strings.HasSuffix(alg, "384"):
+		hash = crypto.SHA384
+	case strings.HasSuffix(alg, "512"), alg == "EdDSA":
+		hash = crypto.SHA512
+	}
+
+	h := hash.New()
+	h.Write([]byte(access))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -1,14 +1,26 @@
 package oauth2
 
 import (
-	"github.com/go-oauth2/oauth2/v4/manage"
+	"github.com/go-oauth2/oauth2/v4"
 	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
 )
 
-func NewOAuth2Service(mgr *manage.Manager, handler *OAuth2Handlers) *server.Server {
+func NewOAuth2Service(cfg *configs.OAuth2, mgr *Manager, handler *OAuth2Handlers) *server.Server {
+
+	// 授权端点允许的响应类型以配置为准,发现文档同样读取该配置
+	// go-oauth2 在未携带 code_challenge 时也按 plain 校验方法,库层面保留默认的 PKCE 方法,
+	// 实际允许的方法由 userAuthorizeHandler 按配置校验
+	srvCfg := server.NewConfig()
+	srvCfg.AllowedResponseTypes = nil
+	for _, v := range cfg.Authorize.ResponseTypes {
+		srvCfg.AllowedResponseTypes = append(srvCfg.AllowedResponseTypes, oauth2.ResponseType(v))
+	}
+	srvCfg.ForcePKCE = cfg.Authorize.ForcePKCE
 
 	// Create server
-	srv := server.NewServer(server.NewConfig(), mgr)
+	srv := server.NewServer(srvCfg, mgr)
+	srv.SetClientInfoHandler(mgr.clientInfoHandler)                           // 客户端凭证: client_secret_basic, client_secret_post, none
 	srv.SetInternalErrorHandler(handler.internalErrorHandler)                 // 内部错误处理
 	srv.SetResponseErrorHandler(handler.responseErrorHandler)                 // 响应错误处理
 	srv.SetAuthorizeScopeHandler(handler.authorizeScopeHandler)               // 作用域处理
@@ -16,6 +28,6 @@ func NewOAuth2Service(mgr *manage.Manager, handler *OAuth2Handlers) *server.Serv
 	srv.SetPasswordAuthorizationHandler(handler.passwordAuthorizationHandler) //密码授权处理
 	srv.SetClientAuthorizedHandler(handler.clientAuthorizedHandler)           // 客户端授权
 	srv.SetPreRedirectErrorHandler(handler.preRedirectErrorHandler)           // 重定向前的错误处理
-	//srv.SetExtensionFieldsHandler(handler.extensionFieldsHandler)             // 扩展字段
+	srv.SetExtensionFieldsHandler(handler.extensionFieldsHandler)             // 扩展字段: id_token
 	return srv
 }
@@ -0,0 +1,208 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sessionModel 登录会话表
+type sessionModel struct {
+	SID          string `gorm:"column:sid;primaryKey;size:64"`
+	UserID       string `gorm:"size:128;index"`
+	CreatedAt    time.Time
+	LastActiveAt time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+	IP           string    `gorm:"column:ip;size:64"`
+	UserAgent    string    `gorm:"size:512"`
+	AMR          string    `gorm:"column:amr;type:text"` // JSON 数组
+	Clients      string    `gorm:"type:text"`            // JSON 数组
+}
+
+// TableName 登录会话表名
+func (sessionModel) TableName() string {
+	return "sso_sessions"
+}
+
+// GormStore 数据库登录会话存储
+// 过期会话在读取时忽略,并在创建会话时按清理间隔批量删除
+type GormStore struct {
+	db            *gorm.DB
+	purgeInterval time.Duration
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewGormStore 创建数据库登录会话存储
+//
+// 参数:
+//
+//	db: 数据库连接
+//	purgeInterval: 清理过期会话的间隔
+//
+// 返回值:
+//
+//	Store: 登录会话存储
+//	error: 错误信息,建表失败时返回
+func NewGormStore(db *gorm.DB, purgeInterval time.Duration) (Store, error) {
+
+	if err := db.AutoMigrate(&sessionModel{}); err != nil {
+		return nil, err
+	}
+
+	return &GormStore{db: db, purgeInterval: purgeInterval, lastPurge: time.Now()}, nil
+}
+
+// Create 保存新的登录会话
+func (s *GormStore) Create(ctx context.Context, sess *Session) error {
+
+	m, err := toModel(sess)
+	if err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Create(m).Error; err != nil {
+		return err
+	}
+
+	s.purge()
+	return nil
+}
+
+// Get 根据 sid 获取登录会话
+func (s *GormStore) Get(ctx context.Context, sid string) (*Session, error) {
+
+	var m sessionModel
+	err := s.db.WithContext(ctx).Where("sid = ? AND expires_at > ?", sid, time.Now()).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return fromModel(&m)
+}
+
+// Update 更新登录会话
+func (s *GormStore) Update(ctx context.Context, sess *Session) error {
+
+	m, err := toModel(sess)
+	if err != nil {
+		return err
+	}
+
+	res := s.db.WithContext(ctx).Model(&sessionModel{}).Where("sid = ?", sess.SID).Updates(map[string]any{
+		"last_active_at": m.LastActiveAt,
+		"expires_at":     m.ExpiresAt,
+		"amr":            m.AMR,
+		"clients":        m.Clients,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// ListByUser 列出用户全部未过期的登录会话
+func (s *GormStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+
+	var ms []sessionModel
+	err := s.db.WithContext(ctx).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Find(&ms).Error
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Session, 0, len(ms))
+	for i := range ms {
+		sess, err := fromModel(&ms[i])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sess)
+	}
+
+	return list, nil
+}
+
+// Delete 删除登录会话
+func (s *GormStore) Delete(ctx context.Context, sid string) error {
+	return s.db.WithContext(ctx).Where("sid = ?", sid).Delete(&sessionModel{}).Error
+}
+
+// purge 距上次清理超过清理间隔时,在后台删除过期会话
+func (s *GormStore) purge() {
+
+	s.mu.Lock()
+	now := time.Now()
+	due := now.Sub(s.lastPurge) > s.purgeInterval
+	if due {
+		s.lastPurge = now
+	}
+	s.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&sessionModel{})
+	}()
+}
+
+// toModel 登录会话转换为表记录
+func toModel(s *Session) (*sessionModel, error) {
+
+	amr, err := json.Marshal(s.AMR)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := json.Marshal(s.Clients)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionModel{
+		SID:          s.SID,
+		UserID:       s.UserID,
+		CreatedAt:    s.CreatedAt,
+		LastActiveAt: s.LastActiveAt,
+		ExpiresAt:    s.ExpiresAt,
+		IP:           s.IP,
+		UserAgent:    s.UserAgent,
+		AMR:          string(amr),
+		Clients:      string(clients),
+	}, nil
+}
+
+// fromModel 表记录转换为登录会话
+func fromModel(m *sessionModel) (*Session, error) {
+
+	s := &Session{
+		SID:          m.SID,
+		UserID:       m.UserID,
+		CreatedAt:    m.CreatedAt,
+		LastActiveAt: m.LastActiveAt,
+		ExpiresAt:    m.ExpiresAt,
+		IP:           m.IP,
+		UserAgent:    m.UserAgent,
+	}
+	if err := json.Unmarshal([]byte(m.AMR), &s.AMR); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(m.Clients), &s.Clients); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
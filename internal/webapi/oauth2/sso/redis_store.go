@@ -0,0 +1,175 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore Redis 登录会话存储,会话随过期时间自动删除
+//
+// 键结构(均带 KeyPrefix):
+//
+//	sso:<sid>            登录会话 JSON
+//	sso_user:<user_id>   用户的 sid 集合,已过期的 sid 在列出时清理
+type RedisStore struct {
+	cli    *redis.Client
+	prefix string
+}
+
+// NewRedisStore 创建 Redis 登录会话存储
+//
+// 参数:
+//
+//	cli: Redis 连接
+//	prefix: 键前缀
+//
+// 返回值:
+//
+//	Store: 登录会话存储
+func NewRedisStore(cli *redis.Client, prefix string) Store {
+	return &RedisStore{cli: cli, prefix: prefix}
+}
+
+// Create 保存新的登录会话
+func (s *RedisStore) Create(ctx context.Context, sess *Session) error {
+
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(sess.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	userKey := s.userKey(sess.UserID)
+	current, err := s.cli.PTTL(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.sessionKey(sess.SID), data, ttl)
+		pipe.SAdd(ctx, userKey, sess.SID)
+		// 用户的 sid 集合保留到最晚过期的会话
+		if current < ttl {
+			pipe.PExpire(ctx, userKey, ttl)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Get 根据 sid 获取登录会话
+func (s *RedisStore) Get(ctx context.Context, sid string) (*Session, error) {
+
+	data, err := s.cli.Get(ctx, s.sessionKey(sid)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &Session{}
+	if err := json.Unmarshal(data, sess); err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// Update 更新登录会话,保留原有的过期时间
+func (s *RedisStore) Update(ctx context.Context, sess *Session) error {
+
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.cli.SetXX(ctx, s.sessionKey(sess.SID), data, redis.KeepTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// ListByUser 列出用户全部未过期的登录会话
+func (s *RedisStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+
+	userKey := s.userKey(userID)
+	sids, err := s.cli.SMembers(ctx, userKey).Result()
+	if err != nil || len(sids) == 0 {
+		return []*Session{}, err
+	}
+
+	keys := make([]string, 0, len(sids))
+	for _, sid := range sids {
+		keys = append(keys, s.sessionKey(sid))
+	}
+	values, err := s.cli.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Session, 0, len(sids))
+	stale := []any{}
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			stale = append(stale, sids[i])
+			continue
+		}
+		sess := &Session{}
+		if err := json.Unmarshal([]byte(data), sess); err != nil {
+			return nil, err
+		}
+		list = append(list, sess)
+	}
+
+	if len(stale) > 0 {
+		s.cli.SRem(ctx, userKey, stale...)
+	}
+
+	return list, nil
+}
+
+// Delete 删除登录会话
+func (s *RedisStore) Delete(ctx context.Context, sid string) error {
+
+	sess, err := s.Get(ctx, sid)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.sessionKey(sid))
+		pipe.SRem(ctx, s.userKey(sess.UserID), sid)
+		return nil
+	})
+
+	return err
+}
+
+// sessionKey 登录会话键
+func (s *RedisStore) sessionKey(sid string) string {
+	return s.prefix + "sso:" + sid
+}
+
+// userKey 用户 sid 集合键
+func (s *RedisStore) userKey(userID string) string {
+	return s.prefix + "sso_user:" + userID
+}
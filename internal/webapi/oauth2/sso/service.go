@@ -0,0 +1,269 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/session"
+	"go.uber.org/zap"
+)
+
+// Service 登录会话服务
+// 登录时登记会话,授权时记录活动时间与客户端,撤销会话时一并撤销会话期间签发的授权码与令牌
+type Service struct {
+	store    Store
+	tokens   token.IndexedStore
+	maxAge   time.Duration
+	recorder audit.Recorder
+	*zap.Logger
+}
+
+// NewService 创建登录会话服务
+//
+// 参数:
+//
+//	cfg: 登录会话配置,会话有效期与会话 Cookie 一致
+//	store: 登录会话存储
+//	tokens: 令牌存储
+//	recorder: 安全事件记录者
+//	logger: 日志对象
+//
+// 返回值:
+//
+//	*Service: 登录会话服务
+func NewService(cfg *configs.Session, store Store, tokens token.IndexedStore, recorder audit.Recorder, logger *zap.Logger) *Service {
+	return &Service{
+		store:    store,
+		tokens:   tokens,
+		maxAge:   cfg.MaxAge,
+		recorder: recorder,
+		Logger:   logger,
+	}
+}
+
+// Start 登记新的登录会话
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	ip: 客户端IP
+//	userAgent: User-Agent
+//	amr: 认证方式
+//
+// 返回值:
+//
+//	*Session: 登录会话
+//	error: 错误信息
+func (s *Service) Start(ctx context.Context, userID, ip, userAgent string, amr []string) (*Session, error) {
+
+	now := time.Now()
+	sess := &Session{
+		SID:          session.NewSID(),
+		UserID:       userID,
+		CreatedAt:    now,
+		LastActiveAt: now,
+		ExpiresAt:    now.Add(s.maxAge),
+		IP:           ip,
+		UserAgent:    userAgent,
+		AMR:          amr,
+		Clients:      []string{},
+	}
+
+	if err := s.store.Create(ctx, sess); err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// Active 获取有效的登录会话
+//
+// 参数:
+//
+//	ctx: 上下文
+//	sid: 登录会话ID
+//
+// 返回值:
+//
+//	*Session: 登录会话,不存在、已过期或已撤销时返回 nil
+//	error: 错误信息
+func (s *Service) Active(ctx context.Context, sid string) (*Session, error) {
+
+	if sid == "" {
+		return nil, nil
+	}
+
+	sess, err := s.store.Get(ctx, sid)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, nil
+	}
+
+	return sess, err
+}
+
+// Touch 记录登录会话的活动时间与获得授权的客户端
+//
+// 参数:
+//
+//	ctx: 上下文
+//	sess: 登录会话
+//	clientID: 获得授权的客户端ID,为空时只更新活动时间
+//
+// 返回值:
+//
+//	error: 错误信息
+func (s *Service) Touch(ctx context.Context, sess *Session, clientID string) error {
+	sess.LastActiveAt = time.Now()
+	sess.addClient(clientID)
+	return s.store.Update(ctx, sess)
+}
+
+// StepUp 登录会话补充认证后更新认证方式
+//
+// 参数:
+//
+//	ctx: 上下文
+//	sess: 登录会话
+//	amr: 补充认证后的全部认证方式
+//
+// 返回值:
+//
+//	error: 错误信息
+func (s *Service) StepUp(ctx context.Context, sess *Session, amr []string) error {
+	sess.AMR = amr
+	sess.LastActiveAt = time.Now()
+	return s.store.Update(ctx, sess)
+}
+
+// List 列出用户全部有效的登录会话,最近活动的在前
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//
+// 返回值:
+//
+//	[]*Session: 登录会话
+//	error: 错误信息
+func (s *Service) List(ctx context.Context, userID string) ([]*Session, error) {
+
+	list, err := s.store.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(list, func(a, b *Session) int {
+		return b.LastActiveAt.Compare(a.LastActiveAt)
+	})
+
+	return list, nil
+}
+
+// Revoke 撤销用户的登录会话,并删除会话期间签发的授权码与令牌
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID,会话不属于该用户时视为不存在
+//	sid: 登录会话ID
+//	operator: 操作者,用于安全事件记录
+//
+// 返回值:
+//
+//	int: 撤销的授权码与令牌记录数
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrSessionNotFound: 会话不存在、已过期或不属于该用户
+func (s *Service) Revoke(ctx context.Context, userID, sid, operator string) (int, error) {
+
+	sess, err := s.store.Get(ctx, sid)
+	if err != nil {
+		return 0, err
+	}
+	if sess.UserID != userID {
+		return 0, ErrSessionNotFound
+	}
+
+	if err := s.store.Delete(ctx, sid); err != nil {
+		return 0, err
+	}
+
+	n, err := s.tokens.RemoveAll(ctx, token.IndexSession, sid)
+	if err != nil {
+		return n, err
+	}
+
+	s.recorder.Record(ctx, &audit.Event{
+		Type:   audit.SessionRevoked,
+		UserID: userID,
+		Detail: map[string]string{"sid": sid, "operator": operator},
+	})
+
+	return n, nil
+}
+
+// RevokeAll 撤销用户全部登录会话,并删除用户全部的授权码与令牌,用于重置密码等场景
+//
+// 参数:
+//
+//	ctx: 上下文
+//	userID: 用户ID
+//	operator: 操作者,用于安全事件记录
+//
+// 返回值:
+//
+//	int: 撤销的授权码与令牌记录数
+//	error: 错误信息
+func (s *Service) RevokeAll(ctx context.Context, userID, operator string) (int, error) {
+
+	list, err := s.store.ListByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, v := range list {
+		if err := s.store.Delete(ctx, v.SID); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.tokens.RemoveAll(ctx, token.IndexUser, userID)
+	if err != nil {
+		return n, err
+	}
+
+	s.recorder.Record(ctx, &audit.Event{
+		Type:   audit.SessionRevoked,
+		UserID: userID,
+		Detail: map[string]string{"sid": "*", "sessions": strconv.Itoa(len(list)), "operator": operator},
+	})
+
+	return n, nil
+}
+
+// End 用户登出时结束登录会话,已签发的令牌保持有效直至过期或被撤销
+//
+// 参数:
+//
+//	ctx: 上下文
+//	sid: 登录会话ID
+//
+// 返回值:
+//
+//	error: 错误信息
+func (s *Service) End(ctx context.Context, sid string) error {
+	if sid == "" {
+		return nil
+	}
+	return s.store.Delete(ctx, sid)
+}
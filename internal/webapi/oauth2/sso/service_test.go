@@ -0,0 +1,107 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/token"
+	"github.com/xiaohangshuhub/xiaohangshu/pkg/audit"
+	"go.uber.org/zap"
+)
+
+// newTestService 创建使用内存存储的登录会话服务
+func newTestService(t *testing.T) (*Service, token.IndexedStore) {
+	t.Helper()
+
+	logger := zap.NewNop()
+	cfg, err := configs.NewSession(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := token.NewMemotyTokenStore(logger)
+	return NewService(cfg, NewMemoryStore(), tokens, audit.NewLogRecorder(logger), logger), tokens
+}
+
+// createToken 保存登录会话 sid 期间签发的令牌
+func createToken(t *testing.T, tokens token.IndexedStore, userID, sid, access string) {
+	t.Helper()
+
+	ti := models.NewToken()
+	ti.SetClientID("c1")
+	ti.SetUserID(userID)
+	ti.SetAccess(access)
+	ti.SetAccessCreateAt(time.Now())
+	ti.SetAccessExpiresIn(time.Hour)
+	ti.SetExtension(url.Values{token.SessionExtension: {sid}})
+	if err := tokens.Create(context.Background(), ti); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevokeRemovesSessionTokens(t *testing.T) {
+
+	s, tokens := newTestService(t)
+	ctx := context.Background()
+
+	phone, err := s.Start(ctx, "1", "192.0.2.1", "phone", []string{"pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	laptop, err := s.Start(ctx, "1", "192.0.2.2", "laptop", []string{"pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createToken(t, tokens, "1", phone.SID, "access-phone")
+	createToken(t, tokens, "1", laptop.SID, "access-laptop")
+
+	n, err := s.Revoke(ctx, "1", phone.SID, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("revoked %d tokens, want 1", n)
+	}
+
+	// 只撤销该会话的令牌,其他会话不受影响
+	if found, _ := tokens.Find(ctx, token.IndexSession, phone.SID); len(found) != 0 {
+		t.Fatalf("tokens of revoked session remain: %d", len(found))
+	}
+	if found, _ := tokens.Find(ctx, token.IndexSession, laptop.SID); len(found) != 1 {
+		t.Fatalf("tokens of other session: %d, want 1", len(found))
+	}
+	if sess, _ := s.Active(ctx, phone.SID); sess != nil {
+		t.Fatal("revoked session still active")
+	}
+	if sess, _ := s.Active(ctx, laptop.SID); sess == nil {
+		t.Fatal("other session ended")
+	}
+}
+
+func TestRevokeOtherUsersSession(t *testing.T) {
+
+	s, tokens := newTestService(t)
+	ctx := context.Background()
+
+	victim, err := s.Start(ctx, "2", "192.0.2.1", "test", []string{"pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createToken(t, tokens, "2", victim.SID, "access-victim")
+
+	// 用户1 不能撤销用户2 的会话,与会话不存在的结果相同
+	if _, err := s.Revoke(ctx, "1", victim.SID, "1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("revoke another user's session: %v, want %v", err, ErrSessionNotFound)
+	}
+	if sess, _ := s.Active(ctx, victim.SID); sess == nil {
+		t.Fatal("victim session ended")
+	}
+	if found, _ := tokens.Find(ctx, token.IndexSession, victim.SID); len(found) != 1 {
+		t.Fatalf("victim tokens: %d, want 1", len(found))
+	}
+}
@@ -0,0 +1,38 @@
+package sso
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrSessionNotFound 登录会话不存在、已过期或已撤销
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session 登录会话
+// 用户在授权服务登录一次产生一个登录会话,以 sid 标识;会话期间签发的令牌记录 sid,撤销会话时一并撤销
+type Session struct {
+	SID          string    `json:"sid"`            // 登录会话ID
+	UserID       string    `json:"user_id"`        // 用户ID
+	CreatedAt    time.Time `json:"created_at"`     // 登录时间
+	LastActiveAt time.Time `json:"last_active_at"` // 最近一次使用会话授权的时间
+	ExpiresAt    time.Time `json:"expires_at"`     // 过期时间,与会话 Cookie 的有效期一致
+	IP           string    `json:"ip"`             // 登录时的客户端IP
+	UserAgent    string    `json:"user_agent"`     // 登录时的 User-Agent
+	AMR          []string  `json:"amr"`            // 认证方式,如 pwd、otp
+	Clients      []string  `json:"clients"`        // 通过该会话获得授权的客户端
+}
+
+// Expired 会话是否已过期
+func (s *Session) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+// addClient 记录获得授权的客户端,返回是否新增
+func (s *Session) addClient(clientID string) bool {
+	if clientID == "" || slices.Contains(s.Clients, clientID) {
+		return false
+	}
+	s.Clients = append(s.Clients, clientID)
+	return true
+}
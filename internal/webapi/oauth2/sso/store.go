@@ -0,0 +1,163 @@
+package sso
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// Store 登录会话存储
+type Store interface {
+
+	// Create 保存新的登录会话
+	Create(ctx context.Context, s *Session) error
+
+	// Get 根据 sid 获取登录会话,不存在或已过期时返回 ErrSessionNotFound
+	Get(ctx context.Context, sid string) (*Session, error)
+
+	// Update 更新登录会话
+	Update(ctx context.Context, s *Session) error
+
+	// ListByUser 列出用户全部未过期的登录会话
+	ListByUser(ctx context.Context, userID string) ([]*Session, error)
+
+	// Delete 删除登录会话
+	Delete(ctx context.Context, sid string) error
+}
+
+// StoreParams 创建登录会话存储的依赖
+// 未配置 database.driver 时不提供数据库连接,未配置 redis.addr 时不提供 Redis 连接
+type StoreParams struct {
+	fx.In
+
+	Config *configs.Session
+	DB     *gorm.DB      `optional:"true"`
+	Redis  *redis.Client `optional:"true"`
+}
+
+// NewStore 按 session.store 创建登录会话存储,与会话数据使用同一后端
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	Store: 登录会话存储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+//	configs.ErrRedisNotConfigured: 使用 Redis 存储但未配置 Redis
+func NewStore(p StoreParams) (Store, error) {
+
+	switch p.Config.Store {
+	case configs.SessionStoreRedis:
+		if p.Redis == nil {
+			return nil, configs.ErrRedisNotConfigured
+		}
+		return NewRedisStore(p.Redis, p.Config.KeyPrefix), nil
+	case configs.SessionStoreDatabase:
+		if p.DB == nil {
+			return nil, configs.ErrDatabaseNotConfigured
+		}
+		return NewGormStore(p.DB, p.Config.PurgeInterval)
+	default:
+		return NewMemoryStore(), nil
+	}
+}
+
+// MemoryStore 内存登录会话存储
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewMemoryStore 创建内存登录会话存储
+func NewMemoryStore() Store {
+	return &MemoryStore{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Create 保存新的登录会话,同时清理已过期的会话
+func (s *MemoryStore) Create(ctx context.Context, sess *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for sid, v := range s.sessions {
+		if v.Expired(now) {
+			delete(s.sessions, sid)
+		}
+	}
+
+	s.sessions[sess.SID] = clone(sess)
+	return nil
+}
+
+// Get 根据 sid 获取登录会话
+func (s *MemoryStore) Get(ctx context.Context, sid string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.sessions[sid]
+	if !ok || v.Expired(time.Now()) {
+		return nil, ErrSessionNotFound
+	}
+
+	return clone(v), nil
+}
+
+// Update 更新登录会话
+func (s *MemoryStore) Update(ctx context.Context, sess *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[sess.SID]; !ok {
+		return ErrSessionNotFound
+	}
+
+	s.sessions[sess.SID] = clone(sess)
+	return nil
+}
+
+// ListByUser 列出用户全部未过期的登录会话
+func (s *MemoryStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	list := []*Session{}
+	for _, v := range s.sessions {
+		if v.UserID == userID && !v.Expired(now) {
+			list = append(list, clone(v))
+		}
+	}
+
+	return list, nil
+}
+
+// Delete 删除登录会话
+func (s *MemoryStore) Delete(ctx context.Context, sid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sid)
+	return nil
+}
+
+// clone 复制登录会话,避免调用方修改存储中的数据
+func clone(s *Session) *Session {
+	cp := *s
+	cp.AMR = slices.Clone(s.AMR)
+	cp.Clients = slices.Clone(s.Clients)
+	return &cp
+}
@@ -0,0 +1,30 @@
+package token
+
+import (
+	"context"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/generates"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+)
+
+// AuthorizeGenerate 授权码生成
+// 授权码沿用 go-oauth2 默认的生成方式,有效期按客户端配置
+type AuthorizeGenerate struct {
+	cfg *configs.OAuth2
+	oauth2.AuthorizeGenerate
+}
+
+// Token 生成授权码,并按客户端设置授权码有效期
+func (a *AuthorizeGenerate) Token(ctx context.Context, data *oauth2.GenerateBasic) (string, error) {
+	data.TokenInfo.SetCodeExpiresIn(a.cfg.AuthorizationCodeLifetime(data.Client.GetID()))
+	return a.AuthorizeGenerate.Token(ctx, data)
+}
+
+// NewAuthorizeGenerate 创建授权码生成器
+func NewAuthorizeGenerate(cfg *configs.OAuth2) oauth2.AuthorizeGenerate {
+	return &AuthorizeGenerate{
+		cfg:               cfg,
+		AuthorizeGenerate: generates.NewAuthorizeGenerate(),
+	}
+}
@@ -0,0 +1,38 @@
+package token
+
+import (
+	"errors"
+	"net/http"
+
+	oerrors "github.com/go-oauth2/oauth2/v4/errors"
+)
+
+// ErrInvalidTarget resource 参数指定的资源不存在(RFC 8707)
+var ErrInvalidTarget = errors.New("invalid_target")
+
+// descriptions 本包定义的 OAuth2 错误码说明
+// 不写入 go-oauth2 的全局错误表,由各端点的错误处理经 NewErrorResponse 转换
+var descriptions = map[error]string{
+	ErrInvalidTarget: "The requested resource is invalid, unknown, or malformed",
+}
+
+// NewErrorResponse 将本包定义的错误转换为错误响应
+//
+// 参数:
+//
+//	err: 错误
+//
+// 返回值:
+//
+//	*oerrors.Response: 错误响应,不是本包定义的错误时返回 nil
+func NewErrorResponse(err error) *oerrors.Response {
+
+	desc, ok := descriptions[err]
+	if !ok {
+		return nil
+	}
+
+	re := oerrors.NewResponse(err, http.StatusBadRequest)
+	re.Description = desc
+	return re
+}
@@ -0,0 +1,160 @@
+package token
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrFamilyNotFound 刷新令牌不属于任何令牌族
+var ErrFamilyNotFound = errors.New("token family not found")
+
+// ErrRefreshReused 刷新令牌已被轮换消费,并发的刷新请求中只有一个能成功轮换
+var ErrRefreshReused = errors.New("refresh token reused")
+
+// Family 刷新令牌族
+// 同一次授权产生的刷新令牌属于同一个族,轮换时族保持不变
+type Family struct {
+	ID        string    // 族ID
+	ClientID  string    // 客户端ID
+	UserID    string    // 用户ID
+	Access    string    // 当前有效的访问令牌
+	Refresh   string    // 当前有效的刷新令牌
+	CreatedAt time.Time // 族创建时间,即首次授权时间
+	ExpiresAt time.Time // 族过期时间,之后记录可被清理
+	Revoked   bool      // 是否已撤销
+}
+
+// FamilyStore 刷新令牌族存储
+type FamilyStore interface {
+
+	// Create 创建令牌族并登记当前刷新令牌
+	Create(ctx context.Context, f *Family) error
+
+	// FindByRefresh 根据刷新令牌查找令牌族
+	// used 表示该刷新令牌已被轮换消费,再次出现即为重放
+	FindByRefresh(ctx context.Context, refresh string) (f *Family, used bool, err error)
+
+	// Rotate 轮换令牌族的当前令牌,旧刷新令牌标记为已使用
+	// 旧刷新令牌的标记是比较并设置: 已被标记时返回 ErrRefreshReused,不做任何修改
+	// 新旧刷新令牌相同(滑动模式)时只更新访问令牌与过期时间
+	Rotate(ctx context.Context, id, oldRefresh, access, refresh string, expiresAt time.Time) error
+
+	// Revoke 撤销令牌族
+	Revoke(ctx context.Context, id string) error
+}
+
+type refreshEntry struct {
+	familyID string
+	used     bool
+}
+
+// MemoryFamilyStore 内存刷新令牌族存储
+// 刷新令牌以 SHA-256 摘要保存
+type MemoryFamilyStore struct {
+	mu        sync.Mutex
+	families  map[string]*Family
+	refreshes map[string]*refreshEntry
+}
+
+// NewMemoryFamilyStore 创建内存刷新令牌族存储
+func NewMemoryFamilyStore() FamilyStore {
+	return &MemoryFamilyStore{
+		families:  make(map[string]*Family),
+		refreshes: make(map[string]*refreshEntry),
+	}
+}
+
+// Create 创建令牌族
+func (s *MemoryFamilyStore) Create(ctx context.Context, f *Family) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(time.Now())
+
+	cp := *f
+	s.families[f.ID] = &cp
+	s.refreshes[hashToken(f.Refresh)] = &refreshEntry{familyID: f.ID}
+	return nil
+}
+
+// FindByRefresh 根据刷新令牌查找令牌族
+func (s *MemoryFamilyStore) FindByRefresh(ctx context.Context, refresh string) (*Family, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.refreshes[hashToken(refresh)]
+	if !ok {
+		return nil, false, ErrFamilyNotFound
+	}
+
+	f, ok := s.families[e.familyID]
+	if !ok {
+		return nil, false, ErrFamilyNotFound
+	}
+
+	cp := *f
+	return &cp, e.used, nil
+}
+
+// Rotate 轮换令牌族的当前令牌
+func (s *MemoryFamilyStore) Rotate(ctx context.Context, id, oldRefresh, access, refresh string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.families[id]
+	if !ok {
+		return ErrFamilyNotFound
+	}
+
+	if refresh != oldRefresh {
+		e, ok := s.refreshes[hashToken(oldRefresh)]
+		if !ok || e.familyID != id {
+			return ErrFamilyNotFound
+		}
+		if e.used {
+			return ErrRefreshReused
+		}
+		e.used = true
+		s.refreshes[hashToken(refresh)] = &refreshEntry{familyID: id}
+		f.Refresh = refresh
+	}
+	f.Access = access
+	f.ExpiresAt = expiresAt
+
+	return nil
+}
+
+// Revoke 撤销令牌族
+func (s *MemoryFamilyStore) Revoke(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.families[id]; ok {
+		f.Revoked = true
+	}
+	return nil
+}
+
+// purge 清理过期的令牌族
+func (s *MemoryFamilyStore) purge(now time.Time) {
+	for k, e := range s.refreshes {
+		if f, ok := s.families[e.familyID]; !ok || (!f.ExpiresAt.IsZero() && now.After(f.ExpiresAt)) {
+			delete(s.refreshes, k)
+		}
+	}
+	for id, f := range s.families {
+		if !f.ExpiresAt.IsZero() && now.After(f.ExpiresAt) {
+			delete(s.families, id)
+		}
+	}
+}
+
+// hashToken 令牌摘要
+func hashToken(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
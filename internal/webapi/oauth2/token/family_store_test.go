@@ -0,0 +1,82 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFamilyRotate 同一刷新令牌并发轮换时只有一个成功,其余返回 ErrRefreshReused
+func testFamilyRotate(t *testing.T, s FamilyStore) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+
+	err := s.Create(ctx, &Family{ID: "f1", ClientID: "c1", UserID: "u1", Access: "a0", Refresh: "r0", CreatedAt: time.Now(), ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.Rotate(ctx, "f1", "r0", fmt.Sprintf("a%d", i+1), fmt.Sprintf("r%d", i+1), expiresAt)
+		}(i)
+	}
+	wg.Wait()
+
+	won := -1
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if won >= 0 {
+				t.Fatalf("rotate succeeded twice: %d and %d", won, i)
+			}
+			won = i
+		case !errors.Is(err, ErrRefreshReused):
+			t.Fatalf("rotate %d: %v", i, err)
+		}
+	}
+	if won < 0 {
+		t.Fatal("no rotate succeeded")
+	}
+
+	f, used, err := s.FindByRefresh(ctx, "r0")
+	if err != nil || !used {
+		t.Fatalf("old refresh: used=%v err=%v", used, err)
+	}
+	// 数据库存储只保存摘要形式,按摘要比较
+	if digestRef(f.Refresh) != digestRef(fmt.Sprintf("r%d", won+1)) || digestRef(f.Access) != digestRef(fmt.Sprintf("a%d", won+1)) {
+		t.Fatalf("family holds %s/%s, winner was %d", f.Access, f.Refresh, won+1)
+	}
+
+	next := fmt.Sprintf("r%d", won+1)
+	if _, used, err := s.FindByRefresh(ctx, next); err != nil || used {
+		t.Fatalf("new refresh: used=%v err=%v", used, err)
+	}
+
+	// 滑动模式不消费刷新令牌
+	if err := s.Rotate(ctx, "f1", next, "a-slide", next, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, used, _ := s.FindByRefresh(ctx, next); used {
+		t.Fatal("sliding rotate marked refresh token used")
+	}
+
+	if err := s.Revoke(ctx, "f1"); err != nil {
+		t.Fatal(err)
+	}
+	if f, _, _ := s.FindByRefresh(ctx, next); !f.Revoked {
+		t.Fatal("family not revoked")
+	}
+}
+
+func TestMemoryFamilyStoreRotate(t *testing.T) {
+	testFamilyRotate(t, NewMemoryFamilyStore())
+}
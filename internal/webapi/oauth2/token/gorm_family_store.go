@@ -0,0 +1,192 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// familyModel 刷新令牌族表
+type familyModel struct {
+	ID        string     `gorm:"primaryKey;size:64"`
+	ClientID  string     `gorm:"size:128;index"`
+	UserID    string     `gorm:"size:128;index"`
+	Access    string     `gorm:"type:text"`
+	Refresh   string     `gorm:"type:text"`
+	CreatedAt time.Time  // 首次授权时间
+	ExpiresAt *time.Time `gorm:"index"` // 为空表示不过期
+	Revoked   bool
+}
+
+// TableName 刷新令牌族表名
+func (familyModel) TableName() string {
+	return "oauth2_token_families"
+}
+
+// refreshModel 刷新令牌登记表,以 SHA-256 摘要保存族内出现过的全部刷新令牌,用于重放检测
+type refreshModel struct {
+	Hash     string `gorm:"primaryKey;size:64"`
+	FamilyID string `gorm:"size:64;index;not null"`
+	Used     bool
+}
+
+// TableName 刷新令牌登记表名
+func (refreshModel) TableName() string {
+	return "oauth2_token_family_refreshes"
+}
+
+// GormFamilyStore 数据库刷新令牌族存储,重启后仍能识别已轮换的刷新令牌
+// 当前令牌以摘要形式保存,只能用于撤销,见 digestPrefix
+type GormFamilyStore struct {
+	db *gorm.DB
+}
+
+// NewGormFamilyStore 创建数据库刷新令牌族存储
+//
+// 参数:
+//
+//	db: 数据库连接
+//
+// 返回值:
+//
+//	*GormFamilyStore: 刷新令牌族存储
+//	error: 错误信息,建表失败时返回
+func NewGormFamilyStore(db *gorm.DB) (*GormFamilyStore, error) {
+
+	if err := db.AutoMigrate(&familyModel{}, &refreshModel{}); err != nil {
+		return nil, err
+	}
+
+	return &GormFamilyStore{db: db}, nil
+}
+
+// Create 创建令牌族
+func (s *GormFamilyStore) Create(ctx context.Context, f *Family) error {
+
+	m := &familyModel{
+		ID:        f.ID,
+		ClientID:  f.ClientID,
+		UserID:    f.UserID,
+		Access:    digestRef(f.Access),
+		Refresh:   digestRef(f.Refresh),
+		CreatedAt: f.CreatedAt,
+		ExpiresAt: timePtr(f.ExpiresAt),
+		Revoked:   f.Revoked,
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		return tx.Create(&refreshModel{Hash: hashToken(f.Refresh), FamilyID: f.ID}).Error
+	})
+}
+
+// FindByRefresh 根据刷新令牌查找令牌族
+func (s *GormFamilyStore) FindByRefresh(ctx context.Context, refresh string) (*Family, bool, error) {
+
+	var r refreshModel
+	err := s.db.WithContext(ctx).Where("hash = ?", hashToken(refresh)).Take(&r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrFamilyNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var m familyModel
+	err = s.db.WithContext(ctx).Where("id = ?", r.FamilyID).Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrFamilyNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	f := &Family{
+		ID:        m.ID,
+		ClientID:  m.ClientID,
+		UserID:    m.UserID,
+		Access:    m.Access,
+		Refresh:   m.Refresh,
+		CreatedAt: m.CreatedAt,
+		Revoked:   m.Revoked,
+	}
+	if m.ExpiresAt != nil {
+		f.ExpiresAt = *m.ExpiresAt
+	}
+
+	return f, r.Used, nil
+}
+
+// Rotate 轮换令牌族的当前令牌
+// 旧刷新令牌以 used = false 为条件标记,多副本并发轮换时只有一个成功,其余回滚并返回 ErrRefreshReused
+func (s *GormFamilyStore) Rotate(ctx context.Context, id, oldRefresh, access, refresh string, expiresAt time.Time) error {
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if refresh != oldRefresh {
+			res := tx.Model(&refreshModel{}).
+				Where("hash = ? AND family_id = ? AND used = ?", hashToken(oldRefresh), id, false).
+				Update("used", true)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected != 1 {
+				return ErrRefreshReused
+			}
+		}
+
+		updates := map[string]any{"access": digestRef(access), "expires_at": timePtr(expiresAt)}
+		if refresh != oldRefresh {
+			updates["refresh"] = digestRef(refresh)
+		}
+
+		res := tx.Model(&familyModel{}).Where("id = ?", id).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrFamilyNotFound
+		}
+
+		if refresh == oldRefresh {
+			return nil
+		}
+		return tx.Create(&refreshModel{Hash: hashToken(refresh), FamilyID: id}).Error
+	})
+}
+
+// Revoke 撤销令牌族
+func (s *GormFamilyStore) Revoke(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Model(&familyModel{}).Where("id = ?", id).Update("revoked", true).Error
+}
+
+// Purge 删除已过期的令牌族及其刷新令牌登记
+func (s *GormFamilyStore) Purge(ctx context.Context, now time.Time) (int64, error) {
+
+	var n int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		expired := tx.Model(&familyModel{}).Select("id").Where("expires_at < ?", now)
+		if err := tx.Where("family_id IN (?)", expired).Delete(&refreshModel{}).Error; err != nil {
+			return err
+		}
+
+		res := tx.Where("expires_at < ?", now).Delete(&familyModel{})
+		n = res.RowsAffected
+		return res.Error
+	})
+
+	return n, err
+}
+
+// timePtr 零值时间转换为空
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
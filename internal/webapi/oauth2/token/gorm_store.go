@@ -0,0 +1,324 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	oerrors "github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"gorm.io/gorm"
+)
+
+// ErrCodeConsumed 授权码不存在或已被兑换,授权码只能兑换一次
+// 与 go-oauth2 的 ErrInvalidAuthorizeCode 相同,令牌端点据此返回 invalid_grant
+var ErrCodeConsumed = oerrors.ErrInvalidAuthorizeCode
+
+// digestPrefix 数据库中不保存令牌明文,读出的令牌信息中除查询所用的令牌外,
+// 其余令牌以 digestPrefix 加摘要表示;这种形式只能用于删除,不能用于查询
+const digestPrefix = "sha256:"
+
+// digestRef 令牌的摘要形式,已是摘要形式时原样返回
+func digestRef(v string) string {
+	if v == "" || strings.HasPrefix(v, digestPrefix) {
+		return v
+	}
+	return digestPrefix + hashToken(v)
+}
+
+// tokenModel 令牌表
+// 授权码与令牌各占一行;授权码、访问令牌与刷新令牌以 SHA-256 摘要建立索引,
+// 令牌信息以 JSON 保存在 Data 中,其中不含授权码与令牌明文
+type tokenModel struct {
+	ID          uint64 `gorm:"primaryKey;autoIncrement"`
+	ClientID    string `gorm:"size:128;index"`
+	UserID      string `gorm:"size:128;index"`
+	SessionID   string `gorm:"size:64;index"` // 授权时的登录会话ID
+	CodeHash    string `gorm:"size:64;index"`
+	AccessHash  string `gorm:"size:64;index"`
+	RefreshHash string `gorm:"size:64;index"`
+	Data        string `gorm:"type:text;not null"`
+	CreatedAt   time.Time
+	ExpiresAt   *time.Time `gorm:"index"` // 授权码、访问令牌与刷新令牌中最晚的过期时间,为空表示不过期
+}
+
+// TableName 令牌表名
+func (tokenModel) TableName() string {
+	return "oauth2_tokens"
+}
+
+// indexColumns 索引对应的列
+var indexColumns = map[IndexKey]string{
+	IndexUser:    "user_id",
+	IndexClient:  "client_id",
+	IndexSession: "session_id",
+}
+
+// GormTokenStore 数据库令牌存储,多副本共享,重启后令牌仍然有效
+// 语义与 go-oauth2 的内存存储一致: 按访问令牌或刷新令牌删除时只使对应的令牌失效,两者都失效后删除记录
+type GormTokenStore struct {
+	db *gorm.DB
+}
+
+// NewGormTokenStore 创建数据库令牌存储
+//
+// 参数:
+//
+//	db: 数据库连接
+//
+// 返回值:
+//
+//	*GormTokenStore: 令牌存储
+//	error: 错误信息,建表失败时返回
+func NewGormTokenStore(db *gorm.DB) (*GormTokenStore, error) {
+
+	if err := db.AutoMigrate(&tokenModel{}); err != nil {
+		return nil, err
+	}
+
+	return &GormTokenStore{db: db}, nil
+}
+
+// Create 保存授权码或令牌
+func (s *GormTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+
+	// 明文只用于计算摘要,不写入 Data
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	stored := models.NewToken()
+	if err := json.Unmarshal(data, stored); err != nil {
+		return err
+	}
+	stored.SetCode("")
+	stored.SetAccess("")
+	stored.SetRefresh("")
+	if data, err = json.Marshal(stored); err != nil {
+		return err
+	}
+
+	m := &tokenModel{
+		ClientID:  info.GetClientID(),
+		UserID:    info.GetUserID(),
+		SessionID: SessionID(info),
+		Data:      string(data),
+		ExpiresAt: recordExpiresAt(info),
+	}
+
+	if code := info.GetCode(); code != "" {
+		m.CodeHash = hashToken(code)
+	} else {
+		m.AccessHash = hashToken(info.GetAccess())
+		if refresh := info.GetRefresh(); refresh != "" {
+			m.RefreshHash = hashToken(refresh)
+		}
+	}
+
+	return s.db.WithContext(ctx).Create(m).Error
+}
+
+// RemoveByCode 删除授权码,授权码不存在或已被删除时返回 ErrCodeConsumed,
+// 并发兑换同一授权码的请求只有一个能成功
+func (s *GormTokenStore) RemoveByCode(ctx context.Context, code string) error {
+
+	if code == "" {
+		return ErrCodeConsumed
+	}
+
+	res := s.db.WithContext(ctx).Where("code_hash = ?", hashToken(code)).Delete(&tokenModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCodeConsumed
+	}
+
+	return nil
+}
+
+// RemoveByAccess 使访问令牌失效,刷新令牌仍可使用
+func (s *GormTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	return s.remove(ctx, "access_hash", access)
+}
+
+// RemoveByRefresh 使刷新令牌失效,访问令牌仍可使用
+func (s *GormTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	return s.remove(ctx, "refresh_hash", refresh)
+}
+
+// GetByCode 根据授权码获取令牌信息,不存在或已过期时返回 nil
+func (s *GormTokenStore) GetByCode(ctx context.Context, code string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "code_hash", code)
+}
+
+// GetByAccess 根据访问令牌获取令牌信息,不存在或已过期时返回 nil
+func (s *GormTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "access_hash", access)
+}
+
+// GetByRefresh 根据刷新令牌获取令牌信息,不存在或已过期时返回 nil
+func (s *GormTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "refresh_hash", refresh)
+}
+
+// Purge 删除已过期的记录
+func (s *GormTokenStore) Purge(ctx context.Context, now time.Time) (int64, error) {
+	res := s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&tokenModel{})
+	return res.RowsAffected, res.Error
+}
+
+// Find 查找索引下全部未过期的授权码与令牌
+func (s *GormTokenStore) Find(ctx context.Context, key IndexKey, value string) ([]oauth2.TokenInfo, error) {
+
+	column, ok := indexColumns[key]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	var ms []tokenModel
+	err := s.db.WithContext(ctx).
+		Where(column+" = ?", value).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Find(&ms).Error
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]oauth2.TokenInfo, 0, len(ms))
+	for _, m := range ms {
+		ti, err := m.tokenInfo("", "")
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, ti)
+	}
+
+	return infos, nil
+}
+
+// RemoveAll 删除索引下全部授权码与令牌
+func (s *GormTokenStore) RemoveAll(ctx context.Context, key IndexKey, value string) (int, error) {
+
+	column, ok := indexColumns[key]
+	if !ok || value == "" {
+		return 0, nil
+	}
+
+	res := s.db.WithContext(ctx).Where(column+" = ?", value).Delete(&tokenModel{})
+	return int(res.RowsAffected), res.Error
+}
+
+// get 按摘要列查询未过期的记录,摘要形式的令牌不能用于查询
+func (s *GormTokenStore) get(ctx context.Context, column, value string) (oauth2.TokenInfo, error) {
+
+	if value == "" || strings.HasPrefix(value, digestPrefix) {
+		return nil, nil
+	}
+
+	var m tokenModel
+	err := s.db.WithContext(ctx).
+		Where(column+" = ?", hashToken(value)).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.tokenInfo(column, value)
+}
+
+// tokenInfo 解析令牌信息,查询所用的令牌恢复为明文,其余令牌为摘要形式
+func (m *tokenModel) tokenInfo(column, value string) (oauth2.TokenInfo, error) {
+
+	ti := models.NewToken()
+	if err := json.Unmarshal([]byte(m.Data), ti); err != nil {
+		return nil, err
+	}
+
+	if m.CodeHash != "" {
+		ti.SetCode(digestPrefix + m.CodeHash)
+	}
+	if m.AccessHash != "" {
+		ti.SetAccess(digestPrefix + m.AccessHash)
+	}
+	if m.RefreshHash != "" {
+		ti.SetRefresh(digestPrefix + m.RefreshHash)
+	}
+
+	switch column {
+	case "code_hash":
+		ti.SetCode(value)
+	case "access_hash":
+		ti.SetAccess(value)
+	case "refresh_hash":
+		ti.SetRefresh(value)
+	}
+
+	return ti, nil
+}
+
+// remove 清空摘要列,授权码、访问令牌与刷新令牌都已失效的记录随即删除
+// value 可以是令牌明文或摘要形式
+func (s *GormTokenStore) remove(ctx context.Context, column, value string) error {
+
+	if value == "" {
+		return nil
+	}
+
+	h := hashToken(value)
+	if v, ok := strings.CutPrefix(value, digestPrefix); ok {
+		h = v
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		var ids []uint64
+		if err := tx.Model(&tokenModel{}).Where(column+" = ?", h).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&tokenModel{}).Where("id IN ?", ids).Update(column, "").Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id IN ? AND code_hash = '' AND access_hash = '' AND refresh_hash = ''", ids).Delete(&tokenModel{}).Error
+	})
+}
+
+// recordExpiresAt 记录的过期时间,即授权码,或访问令牌与刷新令牌中较晚的过期时间;为空表示不过期
+func recordExpiresAt(info oauth2.TokenInfo) *time.Time {
+
+	if info.GetCode() != "" {
+		return expiresAt(info.GetCodeCreateAt(), info.GetCodeExpiresIn())
+	}
+
+	t := expiresAt(info.GetAccessCreateAt(), info.GetAccessExpiresIn())
+	if info.GetRefresh() != "" {
+		// 刷新令牌通常晚于访问令牌过期,记录保留到两者都过期
+		r := expiresAt(info.GetRefreshCreateAt(), info.GetRefreshExpiresIn())
+		if r == nil || (t != nil && r.After(*t)) {
+			t = r
+		}
+	}
+
+	return t
+}
+
+// expiresAt 过期时间,有效期为 0 表示不过期
+func expiresAt(createAt time.Time, expiresIn time.Duration) *time.Time {
+	if expiresIn <= 0 {
+		return nil
+	}
+	t := createAt.Add(expiresIn)
+	return &t
+}
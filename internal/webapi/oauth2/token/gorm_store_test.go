@@ -0,0 +1,118 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/test.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite 不支持并发写,事务按连接串行执行
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestGormFamilyStoreRotate(t *testing.T) {
+	s, err := NewGormFamilyStore(newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFamilyRotate(t, s)
+}
+
+func TestGormTokenStore(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	s, err := NewGormTokenStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := models.NewToken()
+	code.SetClientID("c1")
+	code.SetUserID("u1")
+	code.SetCode("the-code")
+	code.SetCodeCreateAt(time.Now())
+	code.SetCodeExpiresIn(time.Minute)
+	if err := s.Create(ctx, code); err != nil {
+		t.Fatal(err)
+	}
+
+	ti := models.NewToken()
+	ti.SetClientID("c1")
+	ti.SetUserID("u1")
+	ti.SetAccess("the-access")
+	ti.SetAccessCreateAt(time.Now())
+	ti.SetAccessExpiresIn(time.Hour)
+	ti.SetRefresh("the-refresh")
+	ti.SetRefreshCreateAt(time.Now())
+	ti.SetRefreshExpiresIn(time.Hour * 24)
+	if err := s.Create(ctx, ti); err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据库中不保存明文
+	var rows []tokenModel
+	if err := db.Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		for _, v := range []string{"the-code", "the-access", "the-refresh"} {
+			if strings.Contains(r.Data, v) {
+				t.Fatalf("row %d stores %s in plaintext: %s", r.ID, v, r.Data)
+			}
+		}
+	}
+
+	got, err := s.GetByRefresh(ctx, "the-refresh")
+	if err != nil || got == nil {
+		t.Fatalf("get by refresh: %v %v", got, err)
+	}
+	if got.GetRefresh() != "the-refresh" || got.GetClientID() != "c1" {
+		t.Fatalf("unexpected token info: %+v", got)
+	}
+	if !strings.HasPrefix(got.GetAccess(), digestPrefix) {
+		t.Fatalf("access should be a digest, got %q", got.GetAccess())
+	}
+
+	// 摘要形式不能用于查询,只能用于删除
+	if v, _ := s.GetByAccess(ctx, got.GetAccess()); v != nil {
+		t.Fatal("digest must not be usable as a token")
+	}
+	if err := s.RemoveByAccess(ctx, got.GetAccess()); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.GetByAccess(ctx, "the-access"); v != nil {
+		t.Fatal("access token still valid after removal by digest")
+	}
+	if v, _ := s.GetByRefresh(ctx, "the-refresh"); v == nil {
+		t.Fatal("refresh token removed together with access token")
+	}
+
+	// 授权码只能兑换一次
+	if v, _ := s.GetByCode(ctx, "the-code"); v == nil || v.GetCode() != "the-code" {
+		t.Fatalf("get by code: %v", v)
+	}
+	if err := s.RemoveByCode(ctx, "the-code"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveByCode(ctx, "the-code"); !errors.Is(err, ErrCodeConsumed) {
+		t.Fatalf("second exchange: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package token
+
+import (
+	"context"
+
+	"github.com/go-oauth2/oauth2/v4"
+)
+
+// IndexKey 令牌的二级索引
+type IndexKey string
+
+const (
+	IndexUser    IndexKey = "user"    // 按用户ID
+	IndexClient  IndexKey = "client"  // 按客户端ID
+	IndexSession IndexKey = "session" // 按登录会话ID,见 SessionExtension
+)
+
+// IndexedStore 支持按用户、客户端或登录会话查找与撤销令牌的令牌存储
+type IndexedStore interface {
+	oauth2.TokenStore
+
+	// Find 查找索引下全部未过期的授权码与令牌
+	Find(ctx context.Context, key IndexKey, value string) ([]oauth2.TokenInfo, error)
+
+	// RemoveAll 删除索引下全部授权码与令牌,返回删除的记录数
+	RemoveAll(ctx context.Context, key IndexKey, value string) (int, error)
+}
+
+// SessionID 令牌授权时的登录会话ID
+func SessionID(ti oauth2.TokenInfo) string {
+	if eti, ok := ti.(oauth2.ExtendableTokenInfo); ok && eti.GetExtension() != nil {
+		return eti.GetExtension().Get(SessionExtension)
+	}
+	return ""
+}
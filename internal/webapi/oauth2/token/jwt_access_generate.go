@@ -2,10 +2,12 @@ package token
 
 import (
 	"context"
-	"crypto/sha256"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
-	"os"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,11 +15,58 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+)
+
+// JWTAccessTokenType RFC 9068 访问令牌的 typ 头部
+const JWTAccessTokenType = "at+jwt"
+
+// 令牌扩展信息中保存的认证上下文
+const (
+	AuthTimeExtension = "auth_time" // 用户完成认证的时间(Unix秒)
+	AMRExtension      = "amr"       // 认证方式,多个以空格分隔
+	ACRExtension      = "acr"       // 认证上下文等级
+	ResourceExtension = "resource"  // 授权请求中的 resource 参数
+	NonceExtension    = "nonce"     // 授权请求中的 nonce 参数,写入 ID Token
+	AudienceExtension = "aud"       // 访问令牌的受众,供内省端点返回
+	TokenIDExtension  = "jti"       // 访问令牌ID,供内省端点返回
+	GrantExtension    = "grant"     // 首次授权的授权类型,刷新后沿用其有效期配置
+	SessionExtension  = "sid"       // 授权时的登录会话ID,用于按会话查找与撤销令牌
+)
+
+// 认证上下文等级
+const (
+	ACRPassword    = "1" // 单因素认证,如密码
+	ACRMultiFactor = "2" // 多因素认证,如密码加一次性密码
+)
+
+// ACRForAMR 按认证方式计算认证上下文等级,使用了两种及以上认证方式时为多因素认证
+func ACRForAMR(amr []string) string {
+	if len(amr) > 1 {
+		return ACRMultiFactor
+	}
+	return ACRPassword
+}
+
+// referenceTokenSize 引用令牌的随机字节数
+const referenceTokenSize = 32
+
+// 访问令牌可选声明,可按资源配置
+const (
+	ClaimScope    = "scope"
+	ClaimAuthTime = "auth_time"
+	ClaimACR      = "acr"
+	ClaimAMR      = "amr"
 )
 
 // CustomJWTAccessClaims 自定义JWT AccessClaims
+// 遵循 RFC 9068 JWT Profile for OAuth 2.0 Access Tokens
 type CustomJWTAccessClaims struct {
-	Roles []string
+	ClientID string           `json:"client_id"`
+	Scope    string           `json:"scope,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -30,122 +79,196 @@ func (a *CustomJWTAccessClaims) Valid() error {
 }
 
 // CustomJWTAccessGenerate 自定义JWT AccessGenerate
+// 由 keys.Provider 的当前签名者签名,kid 随密钥轮换变化
+// 客户端或目标资源配置为 reference 时改为发放不透明的引用令牌,声明仅保存在服务端
 type CustomJWTAccessGenerate struct {
-	SignedKeyID  string
-	SignedKey    []byte
-	SignedMethod jwt.SigningMethod
-	Issuer       string
+	Issuer string
+	cfg    *configs.OAuth2
+
+	keys          keys.Provider
+	refreshPolicy *RefreshPolicy
 }
 
 // Token 生成访问令牌和刷新令牌
 func (a *CustomJWTAccessGenerate) Token(ctx context.Context, data *oauth2.GenerateBasic, isGenRefresh bool) (string, string, error) {
+
+	ti := data.TokenInfo
+	createAt := ti.GetAccessCreateAt()
+
+	resources, err := a.resources(data)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 没有资源所有者时(client_credentials), sub 为客户端本身
+	sub := data.UserID
+	if sub == "" {
+		sub = data.Client.GetID()
+	}
+
 	claims := &CustomJWTAccessClaims{
-		Roles: []string{"admin"},
+		ClientID: data.Client.GetID(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			Audience:  jwt.ClaimStrings{data.Client.GetID()},
-			Subject:   data.UserID,
-			ExpiresAt: jwt.NewNumericDate(data.TokenInfo.GetAccessCreateAt().Add(data.TokenInfo.GetAccessExpiresIn())),
+			ID:        uuid.NewString(),
+			Subject:   sub,
+			IssuedAt:  jwt.NewNumericDate(createAt),
+			ExpiresAt: jwt.NewNumericDate(createAt.Add(ti.GetAccessExpiresIn())),
 			Issuer:    a.Issuer,
 		},
 	}
 
-	token := jwt.NewWithClaims(a.SignedMethod, claims)
-	if a.SignedKeyID != "" {
-		token.Header["kid"] = a.SignedKeyID
+	if len(resources) == 0 {
+		claims.Audience = jwt.ClaimStrings{data.Client.GetID()}
 	}
-	var key interface{}
-	if a.isEs() {
-		v, err := jwt.ParseECPrivateKeyFromPEM(a.SignedKey)
-		if err != nil {
-			return "", "", err
-		}
-		key = v
-	} else if a.isRsOrPS() {
-		v, err := jwt.ParseRSAPrivateKeyFromPEM(a.SignedKey)
-		if err != nil {
-			return "", "", err
-		}
-		key = v
-	} else if a.isHs() {
-		key = a.SignedKey
-	} else if a.isEd() {
-		v, err := jwt.ParseEdPrivateKeyFromPEM(a.SignedKey)
-		if err != nil {
-			return "", "", err
+	for _, v := range resources {
+		claims.Audience = append(claims.Audience, v.ID)
+	}
+
+	var ext url.Values
+	if eti, ok := ti.(oauth2.ExtendableTokenInfo); ok {
+		ext = eti.GetExtension()
+	}
+
+	if includeClaim(resources, ClaimScope) {
+		claims.Scope = ti.GetScope()
+	}
+	if includeClaim(resources, ClaimAuthTime) {
+		if v, err := strconv.ParseInt(ext.Get(AuthTimeExtension), 10, 64); err == nil {
+			claims.AuthTime = jwt.NewNumericDate(time.Unix(v, 0))
 		}
-		key = v
-	} else {
-		return "", "", errors.New("unsupported sign method")
+	}
+	if includeClaim(resources, ClaimACR) {
+		claims.ACR = ext.Get(ACRExtension)
+	}
+	if includeClaim(resources, ClaimAMR) {
+		claims.AMR = strings.Fields(ext.Get(AMRExtension))
+	}
+
+	// 内省端点按令牌扩展信息返回 aud 与 jti,两种格式保持一致
+	if ext != nil {
+		ext[AudienceExtension] = claims.Audience
+		ext.Set(TokenIDExtension, claims.ID)
 	}
 
-	access, err := token.SignedString(key)
+	var access string
+	if a.isReference(data.Client.GetID(), resources) {
+		access, err = referenceToken()
+	} else {
+		access, err = keys.SignJWT(ctx, a.keys, claims, map[string]any{"typ": JWTAccessTokenType})
+	}
 	if err != nil {
 		return "", "", err
 	}
 	refresh := ""
 
-	if isGenRefresh {
+	if isGenRefresh && a.refreshPolicy.Allow(data.Client.GetID(), ti.GetScope()) {
 		t := uuid.NewSHA1(uuid.Must(uuid.NewRandom()), []byte(access)).String()
 		refresh = base64.URLEncoding.EncodeToString([]byte(t))
 		refresh = strings.ToUpper(strings.TrimRight(refresh, "="))
+
+		grantedAt := ti.GetRefreshCreateAt()
+		ti.SetRefreshExpiresIn(a.refreshPolicy.Lifetime(data.Client.GetID(), GrantType(ti), grantedAt, grantedAt))
+	} else if isGenRefresh {
+		ti.SetRefreshCreateAt(time.Time{})
+		ti.SetRefreshExpiresIn(0)
 	}
 
 	return access, refresh, nil
 }
 
-// 签名算法判断
-func (a *CustomJWTAccessGenerate) isEs() bool {
-	return strings.HasPrefix(a.SignedMethod.Alg(), "ES")
+// GrantType 令牌首次授权的授权类型,未记录时返回空字符串
+func GrantType(ti oauth2.TokenInfo) string {
+	if eti, ok := ti.(oauth2.ExtendableTokenInfo); ok && eti.GetExtension() != nil {
+		return eti.GetExtension().Get(GrantExtension)
+	}
+	return ""
 }
 
-func (a *CustomJWTAccessGenerate) isRsOrPS() bool {
-	isRs := strings.HasPrefix(a.SignedMethod.Alg(), "RS")
-	isPs := strings.HasPrefix(a.SignedMethod.Alg(), "PS")
-	return isRs || isPs
-}
+// resources 确定访问令牌的目标资源
+// 优先使用请求(或授权请求)中的 resource 参数(RFC 8707),否则按 scope 匹配已配置的资源
+func (a *CustomJWTAccessGenerate) resources(data *oauth2.GenerateBasic) ([]*configs.Resource, error) {
 
-func (a *CustomJWTAccessGenerate) isHs() bool {
-	return strings.HasPrefix(a.SignedMethod.Alg(), "HS")
-}
+	var resources []*configs.Resource
 
-func (a *CustomJWTAccessGenerate) isEd() bool {
-	return strings.HasPrefix(a.SignedMethod.Alg(), "Ed")
-}
+	var ids []string
+	if data.Request != nil {
+		if err := data.Request.ParseForm(); err == nil {
+			ids = data.Request.Form[ResourceExtension]
+		}
+	}
+	if eti, ok := data.TokenInfo.(oauth2.ExtendableTokenInfo); ok && len(ids) == 0 {
+		ids = eti.GetExtension()[ResourceExtension]
+	}
 
-// NewConsumtJWTAccessGenerate 创建JWT AccessGenerate
-func NewCustomJWTAccessGenerate(cfg *configs.OAuth2) oauth2.AccessGenerate {
-	keyBytes, err := os.ReadFile(cfg.Manager.JWTPrivateKey)
-	if err != nil {
-		panic(err)
+	for _, id := range ids {
+		res, err := a.cfg.GetResource(id)
+		if err != nil {
+			return nil, ErrInvalidTarget
+		}
+		resources = append(resources, res)
+	}
+
+	if len(resources) > 0 {
+		return resources, nil
 	}
 
-	// 根据配置选择签名算法
-	var signingMethod jwt.SigningMethod
+	scopes := strings.Fields(data.TokenInfo.GetScope())
+	for _, res := range a.cfg.Resources {
+		for _, v := range scopes {
+			if slices.Contains(res.Scopes, v) {
+				resources = append(resources, res)
+				break
+			}
+		}
+	}
 
-	switch cfg.Manager.SigningMethod {
-	case "RS256":
-		signingMethod = jwt.SigningMethodRS256
-	case "ES256":
-		signingMethod = jwt.SigningMethodES256
-	case "RS512":
-		signingMethod = jwt.SigningMethodRS512
-	default:
-		signingMethod = jwt.SigningMethodRS256
+	return resources, nil
+}
+
+// isReference 判断是否发放引用令牌
+// 客户端配置为 reference,或任一目标资源配置为 reference 时成立
+func (a *CustomJWTAccessGenerate) isReference(clientID string, resources []*configs.Resource) bool {
+	if client, err := a.cfg.GetClient(clientID); err == nil && client.IsReferenceToken() {
+		return true
 	}
-	// 生成key ID
-	kid := generateKeyID([]byte(cfg.Manager.Kid))
+	for _, v := range resources {
+		if v.IsReferenceToken() {
+			return true
+		}
+	}
+	return false
+}
 
-	return &CustomJWTAccessGenerate{
-		SignedKeyID:  kid,
-		SignedKey:    keyBytes,
-		SignedMethod: signingMethod,
-		Issuer:       cfg.Issuer,
+// referenceToken 生成不透明的引用令牌
+func referenceToken() (string, error) {
+	b := make([]byte, referenceTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-// generateKeyID 生成健壮且唯一的key ID
-// 基于密钥内容生成 kid
-func generateKeyID(key []byte) string {
-	hash := sha256.Sum256(key)
-	return base64.RawURLEncoding.EncodeToString(hash[:8])
+// includeClaim 判断是否需要输出可选声明
+// 未匹配到资源时输出全部可选声明,多个资源时取并集
+func includeClaim(resources []*configs.Resource, claim string) bool {
+	if len(resources) == 0 {
+		return true
+	}
+	for _, v := range resources {
+		if v.ContainsClaim(claim) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewConsumtJWTAccessGenerate 创建JWT AccessGenerate
+func NewCustomJWTAccessGenerate(cfg *configs.OAuth2, keyProvider keys.Provider, refreshPolicy *RefreshPolicy) oauth2.AccessGenerate {
+	return &CustomJWTAccessGenerate{
+		Issuer: cfg.Issuer,
+		cfg:    cfg,
+
+		keys:          keyProvider,
+		refreshPolicy: refreshPolicy,
+	}
 }
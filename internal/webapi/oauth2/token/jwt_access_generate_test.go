@@ -0,0 +1,158 @@
+package token
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	oerrors "github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"github.com/xiaohangshuhub/xiaohangshu/internal/webapi/oauth2/keys"
+	"go.uber.org/zap"
+)
+
+// newTestAccessGenerate 创建使用内存签名密钥的访问令牌生成器
+func newTestAccessGenerate(t *testing.T) (oauth2.AccessGenerate, keys.Provider) {
+	t.Helper()
+
+	cfg, err := configs.NewOAuth2(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Resources = []*configs.Resource{{ID: "https://api.example.com", Scopes: []string{"api"}}}
+
+	provider, err := keys.NewManager(cfg, keys.NewMemoryKeyStore(), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewCustomJWTAccessGenerate(cfg, provider, NewRefreshPolicy(cfg)), provider
+}
+
+// generateBasic 创建令牌生成参数,resource 不为空时作为请求参数
+func generateBasic(userID, scope string, resource ...string) *oauth2.GenerateBasic {
+
+	ti := models.NewToken()
+	ti.SetClientID("c1")
+	ti.SetUserID(userID)
+	ti.SetScope(scope)
+	ti.SetAccessCreateAt(time.Now())
+	ti.SetAccessExpiresIn(time.Hour)
+	ti.SetExtension(url.Values{})
+
+	r := httptest.NewRequest(http.MethodPost, "/connect/token", strings.NewReader(url.Values{ResourceExtension: resource}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return &oauth2.GenerateBasic{
+		Client:    &models.Client{ID: "c1"},
+		UserID:    userID,
+		CreateAt:  ti.GetAccessCreateAt(),
+		TokenInfo: ti,
+		Request:   r,
+	}
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+
+	gen, provider := newTestAccessGenerate(t)
+	ctx := context.Background()
+
+	access, _, err := gen.Token(ctx, generateBasic("u1", "api"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.MapClaims{}
+	if err := keys.ParseJWT(ctx, provider, access, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有角色来源,不输出 roles 声明
+	if _, ok := claims["roles"]; ok {
+		t.Fatalf("access token carries roles: %v", claims["roles"])
+	}
+	if claims["sub"] != "u1" || claims["client_id"] != "c1" || claims["scope"] != "api" || claims["jti"] == nil {
+		t.Fatalf("claims = %v", claims)
+	}
+	if aud, _ := claims.GetAudience(); len(aud) != 1 || aud[0] != "https://api.example.com" {
+		t.Fatalf("aud = %v", aud)
+	}
+}
+
+func TestInvalidTarget(t *testing.T) {
+
+	gen, _ := newTestAccessGenerate(t)
+
+	_, _, err := gen.Token(context.Background(), generateBasic("u1", "api", "https://unknown.example.com"), false)
+	if err != ErrInvalidTarget {
+		t.Fatalf("unknown resource: %v, want %v", err, ErrInvalidTarget)
+	}
+
+	re := NewErrorResponse(err)
+	if re == nil || re.Error != ErrInvalidTarget || re.StatusCode != http.StatusBadRequest || re.Description == "" {
+		t.Fatalf("error response = %+v", re)
+	}
+
+	// 错误只在本包登记,不修改 go-oauth2 的全局错误表
+	if _, ok := oerrors.Descriptions[ErrInvalidTarget]; ok {
+		t.Fatal("invalid_target registered in go-oauth2 descriptions")
+	}
+	if NewErrorResponse(oerrors.ErrInvalidGrant) != nil {
+		t.Fatal("NewErrorResponse converted an error defined by go-oauth2")
+	}
+}
+
+func TestReferenceAccessToken(t *testing.T) {
+
+	cfg, err := configs.NewOAuth2(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Resources = []*configs.Resource{
+		{ID: "https://api.example.com", Scopes: []string{"api"}},
+		{ID: "https://internal.example.com", Scopes: []string{"internal"}, AccessTokenFormat: configs.AccessTokenFormatReference},
+	}
+	provider, err := keys.NewManager(cfg, keys.NewMemoryKeyStore(), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewCustomJWTAccessGenerate(cfg, provider, NewRefreshPolicy(cfg))
+	ctx := context.Background()
+
+	// 目标资源为 reference 时发放不透明令牌,声明只保存在令牌扩展信息中
+	data := generateBasic("u1", "internal", "https://internal.example.com")
+	access, _, err := gen.Token(ctx, data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(access, ".") != 0 || len(access) < referenceTokenSize {
+		t.Fatalf("reference token %q looks like a JWT or is too short", access)
+	}
+	if err := keys.ParseJWT(ctx, provider, access, jwt.MapClaims{}); err == nil {
+		t.Fatal("reference token parsed as a JWT")
+	}
+
+	ext := data.TokenInfo.(*models.Token).Extension
+	if aud := ext[AudienceExtension]; len(aud) != 1 || aud[0] != "https://internal.example.com" {
+		t.Fatalf("reference token audience %v", aud)
+	}
+	if ext.Get(TokenIDExtension) == "" {
+		t.Fatal("reference token has no jti for introspection")
+	}
+
+	// 其他资源仍发放 JWT
+	access, _, err = gen.Token(ctx, generateBasic("u1", "api", "https://api.example.com"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.ParseJWT(ctx, provider, access, jwt.MapClaims{}); err != nil {
+		t.Fatalf("jwt access token: %v", err)
+	}
+}
@@ -1,11 +1,33 @@
 package token
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/go-oauth2/oauth2/v4"
 	"github.com/go-oauth2/oauth2/v4/store"
 	"go.uber.org/zap"
 )
 
+// memoryRef 索引中的一条授权码或令牌记录
+type memoryRef struct {
+	code, access, refresh string
+	keys                  []string  // 所属索引
+	expiresAt             time.Time // 最晚的过期时间,零值表示不过期
+}
+
+// MemoryTokenStore 内存令牌存储,在 go-oauth2 内存存储之上维护用户、客户端与登录会话索引
+type MemoryTokenStore struct {
+	oauth2.TokenStore
+
+	mu        sync.Mutex
+	index     map[string]map[*memoryRef]struct{}
+	lastSweep time.Time
+
+	codeMu sync.Mutex // 授权码的查询与删除
+}
+
 // NewMemotyTokenStore 创建一个内存TokenStore
 //
 // 参数:
@@ -14,8 +36,8 @@ import (
 //
 // 返回值:
 //
-//	oauth2.TokenStore 内存TokenStore
-func NewMemotyTokenStore(logger *zap.Logger) oauth2.TokenStore {
+//	*MemoryTokenStore 内存TokenStore
+func NewMemotyTokenStore(logger *zap.Logger) *MemoryTokenStore {
 
 	tokenStore, err := store.NewMemoryTokenStore()
 
@@ -24,5 +46,173 @@ func NewMemotyTokenStore(logger *zap.Logger) oauth2.TokenStore {
 		panic(err)
 	}
 
-	return tokenStore
+	return &MemoryTokenStore{
+		TokenStore: tokenStore,
+		index:      map[string]map[*memoryRef]struct{}{},
+		lastSweep:  time.Now(),
+	}
+}
+
+// Create 保存授权码或令牌并加入索引,每分钟至多清理一次索引中已过期的记录
+func (s *MemoryTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+
+	if err := s.TokenStore.Create(ctx, info); err != nil {
+		return err
+	}
+
+	ref := &memoryRef{code: info.GetCode(), access: info.GetAccess(), refresh: info.GetRefresh()}
+	if t := recordExpiresAt(info); t != nil {
+		ref.expiresAt = *t
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range indexValues(info) {
+		if s.index[k] == nil {
+			s.index[k] = map[*memoryRef]struct{}{}
+		}
+		s.index[k][ref] = struct{}{}
+		ref.keys = append(ref.keys, k)
+	}
+
+	if now := time.Now(); now.Sub(s.lastSweep) > time.Minute {
+		for _, refs := range s.index {
+			for r := range refs {
+				if !r.expiresAt.IsZero() && now.After(r.expiresAt) {
+					s.drop(r)
+				}
+			}
+		}
+		s.lastSweep = now
+	}
+
+	return nil
+}
+
+// Find 查找索引下全部未过期的授权码与令牌
+func (s *MemoryTokenStore) Find(ctx context.Context, key IndexKey, value string) ([]oauth2.TokenInfo, error) {
+
+	infos := []oauth2.TokenInfo{}
+	for _, ref := range s.refs(key, value) {
+		ti, err := s.lookup(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if ti == nil {
+			s.mu.Lock()
+			s.drop(ref)
+			s.mu.Unlock()
+			continue
+		}
+		infos = append(infos, ti)
+	}
+
+	return infos, nil
+}
+
+// RemoveAll 删除索引下全部授权码与令牌
+func (s *MemoryTokenStore) RemoveAll(ctx context.Context, key IndexKey, value string) (int, error) {
+
+	n := 0
+	for _, ref := range s.refs(key, value) {
+		ti, err := s.lookup(ctx, ref)
+		if err != nil {
+			return n, err
+		}
+		if ti != nil {
+			if err := s.remove(ctx, ref); err != nil {
+				return n, err
+			}
+			n++
+		}
+		s.mu.Lock()
+		s.drop(ref)
+		s.mu.Unlock()
+	}
+
+	return n, nil
+}
+
+// refs 索引下的记录快照
+func (s *MemoryTokenStore) refs(key IndexKey, value string) []*memoryRef {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs := []*memoryRef{}
+	for r := range s.index[string(key)+":"+value] {
+		refs = append(refs, r)
+	}
+	return refs
+}
+
+// lookup 读取记录,授权码与令牌均已失效时返回 nil
+func (s *MemoryTokenStore) lookup(ctx context.Context, ref *memoryRef) (oauth2.TokenInfo, error) {
+	if ref.code != "" {
+		return s.GetByCode(ctx, ref.code)
+	}
+	if ti, err := s.GetByAccess(ctx, ref.access); ti != nil || err != nil {
+		return ti, err
+	}
+	if ref.refresh != "" {
+		return s.GetByRefresh(ctx, ref.refresh)
+	}
+	return nil, nil
+}
+
+// RemoveByCode 删除授权码,授权码不存在或已被删除时返回 ErrCodeConsumed,
+// 并发兑换同一授权码的请求只有一个能成功
+func (s *MemoryTokenStore) RemoveByCode(ctx context.Context, code string) error {
+	s.codeMu.Lock()
+	defer s.codeMu.Unlock()
+
+	ti, err := s.TokenStore.GetByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	if ti == nil {
+		return ErrCodeConsumed
+	}
+
+	return s.TokenStore.RemoveByCode(ctx, code)
+}
+
+// remove 删除记录的授权码与令牌
+func (s *MemoryTokenStore) remove(ctx context.Context, ref *memoryRef) error {
+	if ref.code != "" {
+		return s.TokenStore.RemoveByCode(ctx, ref.code)
+	}
+	if err := s.RemoveByAccess(ctx, ref.access); err != nil {
+		return err
+	}
+	if ref.refresh != "" {
+		return s.RemoveByRefresh(ctx, ref.refresh)
+	}
+	return nil
+}
+
+// drop 从全部索引中移除记录,调用方持有锁
+func (s *MemoryTokenStore) drop(ref *memoryRef) {
+	for _, k := range ref.keys {
+		delete(s.index[k], ref)
+		if len(s.index[k]) == 0 {
+			delete(s.index, k)
+		}
+	}
+}
+
+// indexValues 记录所属的索引,格式为 <索引>:<值>
+func indexValues(ti oauth2.TokenInfo) []string {
+
+	values := []string{}
+	if v := ti.GetUserID(); v != "" {
+		values = append(values, string(IndexUser)+":"+v)
+	}
+	if v := ti.GetClientID(); v != "" {
+		values = append(values, string(IndexClient)+":"+v)
+	}
+	if v := SessionID(ti); v != "" {
+		values = append(values, string(IndexSession)+":"+v)
+	}
+	return values
 }
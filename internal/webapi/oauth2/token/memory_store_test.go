@@ -0,0 +1,32 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/models"
+	"go.uber.org/zap"
+)
+
+func TestMemoryTokenStoreCode(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemotyTokenStore(zap.NewNop())
+
+	code := models.NewToken()
+	code.SetClientID("c1")
+	code.SetCode("the-code")
+	code.SetCodeCreateAt(time.Now())
+	code.SetCodeExpiresIn(time.Minute)
+	if err := s.Create(ctx, code); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RemoveByCode(ctx, "the-code"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveByCode(ctx, "the-code"); !errors.Is(err, ErrCodeConsumed) {
+		t.Fatalf("second exchange: %v", err)
+	}
+}
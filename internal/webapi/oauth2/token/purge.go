@@ -0,0 +1,82 @@
+package token
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// purgeFunc 删除指定时间之前过期的记录,返回删除的记录数
+type purgeFunc func(ctx context.Context, now time.Time) (int64, error)
+
+// purger 定时清理过期记录
+type purger struct {
+	*zap.Logger
+	name     string
+	interval time.Duration
+	purge    purgeFunc
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startPurger 随应用启动定时清理,应用停止时退出
+//
+// 参数:
+//
+//	lc: 应用生命周期
+//	name: 清理对象名称,用于日志
+//	interval: 清理间隔
+//	purge: 清理函数
+//	logger: 日志对象
+func startPurger(lc fx.Lifecycle, name string, interval time.Duration, purge purgeFunc, logger *zap.Logger) {
+
+	p := &purger{
+		Logger:   logger,
+		name:     name,
+		interval: interval,
+		purge:    purge,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go p.run()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(p.stop)
+			select {
+			case <-p.done:
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	})
+}
+
+// run 按间隔清理过期记录
+func (p *purger) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+			n, err := p.purge(ctx, time.Now())
+			cancel()
+			if err != nil {
+				p.Error("purge expired records failed", zap.String("store", p.name), zap.Error(err))
+			} else if n > 0 {
+				p.Info("expired records purged", zap.String("store", p.name), zap.Int64("count", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// rotateScript 轮换令牌族,旧刷新令牌以比较并设置的方式标记为已使用
+// KEYS: 令牌族、旧刷新令牌登记、新刷新令牌登记;ARGV: 族ID、访问令牌、刷新令牌、过期时间、剩余有效期(毫秒,0 表示不过期)
+// 返回 1 成功,0 旧刷新令牌已被使用,-1 令牌族或旧刷新令牌不存在
+var rotateScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return -1
+end
+if KEYS[2] ~= KEYS[3] then
+	if redis.call('HGET', KEYS[2], 'id') ~= ARGV[1] then
+		return -1
+	end
+	if redis.call('HGET', KEYS[2], 'used') == '1' then
+		return 0
+	end
+	redis.call('HSET', KEYS[2], 'used', '1')
+	redis.call('HMSET', KEYS[3], 'id', ARGV[1], 'used', '0')
+end
+local f = cjson.decode(data)
+f['Access'] = ARGV[2]
+f['Refresh'] = ARGV[3]
+f['ExpiresAt'] = ARGV[4]
+local ttl = tonumber(ARGV[5])
+if ttl == 0 then
+	redis.call('SET', KEYS[1], cjson.encode(f))
+	redis.call('PERSIST', KEYS[3])
+else
+	redis.call('SET', KEYS[1], cjson.encode(f), 'PX', ttl)
+	redis.call('PEXPIRE', KEYS[3], ttl)
+end
+return 1
+`)
+
+// RedisFamilyStore Redis 刷新令牌族存储,令牌族随过期时间自动删除
+//
+// 键结构(均带 KeyPrefix):
+//
+//	family:<id>                令牌族 JSON
+//	family_refresh:<sha256>    族内出现过的刷新令牌,哈希字段 id 为族ID,used 为是否已轮换
+type RedisFamilyStore struct {
+	cli    *redis.Client
+	prefix string
+}
+
+// NewRedisFamilyStore 创建 Redis 刷新令牌族存储
+//
+// 参数:
+//
+//	cli: Redis 连接
+//	prefix: 键前缀
+//
+// 返回值:
+//
+//	*RedisFamilyStore: 刷新令牌族存储
+func NewRedisFamilyStore(cli *redis.Client, prefix string) *RedisFamilyStore {
+	return &RedisFamilyStore{cli: cli, prefix: prefix}
+}
+
+// Create 创建令牌族
+func (s *RedisFamilyStore) Create(ctx context.Context, f *Family) error {
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	ttl := untilExpiry(f.ExpiresAt)
+	_, err = s.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.familyKey(f.ID), data, ttl)
+		s.addRefresh(ctx, pipe, f.Refresh, f.ID, ttl)
+		return nil
+	})
+
+	return err
+}
+
+// FindByRefresh 根据刷新令牌查找令牌族
+func (s *RedisFamilyStore) FindByRefresh(ctx context.Context, refresh string) (*Family, bool, error) {
+
+	entry, err := s.cli.HGetAll(ctx, s.refreshKey(refresh)).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if entry["id"] == "" {
+		return nil, false, ErrFamilyNotFound
+	}
+
+	f, err := s.load(ctx, entry["id"])
+	if err != nil {
+		return nil, false, err
+	}
+
+	return f, entry["used"] == "1", nil
+}
+
+// Rotate 轮换令牌族的当前令牌,在脚本中完成比较并设置,多副本并发轮换时只有一个成功
+func (s *RedisFamilyStore) Rotate(ctx context.Context, id, oldRefresh, access, refresh string, expiresAt time.Time) error {
+
+	keys := []string{s.familyKey(id), s.refreshKey(oldRefresh), s.refreshKey(refresh)}
+	ttl := untilExpiry(expiresAt)
+
+	n, err := rotateScript.Run(ctx, s.cli, keys, id, access, refresh, expiresAt.Format(time.RFC3339Nano), ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+
+	switch n {
+	case 0:
+		return ErrRefreshReused
+	case -1:
+		return ErrFamilyNotFound
+	}
+	return nil
+}
+
+// Revoke 撤销令牌族
+func (s *RedisFamilyStore) Revoke(ctx context.Context, id string) error {
+
+	f, err := s.load(ctx, id)
+	if errors.Is(err, ErrFamilyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	f.Revoked = true
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	return s.cli.Set(ctx, s.familyKey(id), data, redis.KeepTTL).Err()
+}
+
+// load 读取令牌族
+func (s *RedisFamilyStore) load(ctx context.Context, id string) (*Family, error) {
+
+	data, err := s.cli.Get(ctx, s.familyKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrFamilyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Family{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// addRefresh 登记刷新令牌
+func (s *RedisFamilyStore) addRefresh(ctx context.Context, pipe redis.Pipeliner, refresh, id string, ttl time.Duration) {
+	key := s.refreshKey(refresh)
+	pipe.HSet(ctx, key, "id", id, "used", "0")
+	s.expire(ctx, pipe, key, ttl)
+}
+
+// expire 设置过期时间,0 表示不过期
+func (s *RedisFamilyStore) expire(ctx context.Context, pipe redis.Pipeliner, key string, ttl time.Duration) {
+	if ttl == 0 {
+		pipe.Persist(ctx, key)
+		return
+	}
+	pipe.PExpire(ctx, key, ttl)
+}
+
+// familyKey 令牌族键
+func (s *RedisFamilyStore) familyKey(id string) string {
+	return s.prefix + "family:" + id
+}
+
+// refreshKey 刷新令牌登记键
+func (s *RedisFamilyStore) refreshKey(refresh string) string {
+	return s.prefix + "family_refresh:" + hashToken(refresh)
+}
+
+// untilExpiry 距过期时间的剩余时长,零值时间表示不过期
+func untilExpiry(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	if d := time.Until(t); d > time.Millisecond {
+		return d
+	}
+	return time.Millisecond
+}
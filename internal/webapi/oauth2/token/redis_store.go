@@ -0,0 +1,348 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// 令牌查找键的类型
+const (
+	redisCode    = "code"
+	redisAccess  = "access"
+	redisRefresh = "refresh"
+)
+
+// indexAddScript 将记录加入索引集合,集合的过期时间延长到不早于记录的过期时间
+// ARGV[2] 为记录的剩余有效期(毫秒),0 表示不过期;在事务中以 EVAL 执行,脚本未缓存时 EVALSHA 无法回退
+var indexAddScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call('PERSIST', KEYS[1])
+	return 1
+end
+local current = redis.call('PTTL', KEYS[1])
+if existed == 0 or (current >= 0 and current < ttl) then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// takeScript 读取并删除查找键,并发删除同一查找键时只有一个能取得记录ID
+// 兼容不支持 GETDEL 的 Redis 版本
+var takeScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v then
+	redis.call('DEL', KEYS[1])
+end
+return v
+`)
+
+// RedisTokenStore Redis 令牌存储,多副本共享,按 TTL 过期
+//
+// 键结构(均带 KeyPrefix):
+//
+//	token:<id>             令牌信息 JSON,随最晚过期的令牌过期
+//	code|access|refresh:<sha256>  授权码、访问令牌、刷新令牌的摘要,值为记录ID,各自按有效期过期
+//	user|client|session:<value>   二级索引,值为记录ID集合
+//
+// 语义与 go-oauth2 的内存存储一致: 按访问令牌或刷新令牌删除时只使对应的令牌失效,两者都失效后删除记录
+type RedisTokenStore struct {
+	cli    *redis.Client
+	prefix string
+}
+
+// NewRedisTokenStore 创建 Redis 令牌存储
+//
+// 参数:
+//
+//	cli: Redis 连接
+//	prefix: 键前缀
+//
+// 返回值:
+//
+//	*RedisTokenStore: 令牌存储
+func NewRedisTokenStore(cli *redis.Client, prefix string) *RedisTokenStore {
+	return &RedisTokenStore{cli: cli, prefix: prefix}
+}
+
+// Create 保存授权码或令牌
+func (s *RedisTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	id := uuid.NewString()
+	now := time.Now()
+
+	lookups := map[string]time.Duration{}
+	var ttl time.Duration
+
+	if code := info.GetCode(); code != "" {
+		ttl = remaining(now, info.GetCodeCreateAt(), info.GetCodeExpiresIn())
+		lookups[s.key(redisCode, hashToken(code))] = ttl
+	} else {
+		ttl = remaining(now, info.GetAccessCreateAt(), info.GetAccessExpiresIn())
+		lookups[s.key(redisAccess, hashToken(info.GetAccess()))] = ttl
+
+		if refresh := info.GetRefresh(); refresh != "" {
+			r := remaining(now, info.GetRefreshCreateAt(), info.GetRefreshExpiresIn())
+			lookups[s.key(redisRefresh, hashToken(refresh))] = r
+			if r == 0 || (ttl != 0 && r > ttl) {
+				ttl = r
+			}
+		}
+	}
+
+	_, err = s.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.key("token", id), data, ttl)
+		for k, v := range lookups {
+			pipe.Set(ctx, k, id, v)
+		}
+		for _, k := range s.indexKeys(info) {
+			indexAddScript.Eval(ctx, pipe, []string{k}, id, ttl.Milliseconds())
+		}
+		return nil
+	})
+
+	return err
+}
+
+// RemoveByCode 删除授权码,授权码不存在或已被删除时返回 ErrCodeConsumed,
+// 并发兑换同一授权码的请求只有一个能成功
+func (s *RedisTokenStore) RemoveByCode(ctx context.Context, code string) error {
+	ok, err := s.remove(ctx, redisCode, code)
+	if err == nil && !ok {
+		return ErrCodeConsumed
+	}
+	return err
+}
+
+// RemoveByAccess 使访问令牌失效,刷新令牌仍可使用
+func (s *RedisTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	_, err := s.remove(ctx, redisAccess, access)
+	return err
+}
+
+// RemoveByRefresh 使刷新令牌失效,访问令牌仍可使用
+func (s *RedisTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	_, err := s.remove(ctx, redisRefresh, refresh)
+	return err
+}
+
+// GetByCode 根据授权码获取令牌信息,不存在或已过期时返回 nil
+func (s *RedisTokenStore) GetByCode(ctx context.Context, code string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, redisCode, code)
+}
+
+// GetByAccess 根据访问令牌获取令牌信息,不存在或已过期时返回 nil
+func (s *RedisTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, redisAccess, access)
+}
+
+// GetByRefresh 根据刷新令牌获取令牌信息,不存在或已过期时返回 nil
+func (s *RedisTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, redisRefresh, refresh)
+}
+
+// Find 查找索引下全部未过期的授权码与令牌,顺带清理索引中已过期的记录ID
+func (s *RedisTokenStore) Find(ctx context.Context, key IndexKey, value string) ([]oauth2.TokenInfo, error) {
+
+	_, infos, err := s.find(ctx, key, value)
+	return infos, err
+}
+
+// RemoveAll 删除索引下全部授权码与令牌
+func (s *RedisTokenStore) RemoveAll(ctx context.Context, key IndexKey, value string) (int, error) {
+
+	ids, infos, err := s.find(ctx, key, value)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := s.removeRecord(ctx, id, infos[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(ids), nil
+}
+
+// find 读取索引下的记录ID与令牌信息
+func (s *RedisTokenStore) find(ctx context.Context, key IndexKey, value string) ([]string, []oauth2.TokenInfo, error) {
+
+	if value == "" {
+		return nil, nil, nil
+	}
+
+	index := s.key(string(key), value)
+	ids, err := s.cli.SMembers(ctx, index).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, nil, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, s.key("token", id))
+	}
+	values, err := s.cli.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := make([]string, 0, len(ids))
+	infos := make([]oauth2.TokenInfo, 0, len(ids))
+	stale := []any{}
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			stale = append(stale, ids[i])
+			continue
+		}
+		ti := models.NewToken()
+		if err := json.Unmarshal([]byte(data), ti); err != nil {
+			return nil, nil, err
+		}
+		found = append(found, ids[i])
+		infos = append(infos, ti)
+	}
+
+	if len(stale) > 0 {
+		s.cli.SRem(ctx, index, stale...)
+	}
+
+	return found, infos, nil
+}
+
+// get 按摘要查找记录
+func (s *RedisTokenStore) get(ctx context.Context, kind, value string) (oauth2.TokenInfo, error) {
+
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := s.cli.Get(ctx, s.key(kind, hashToken(value))).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.load(ctx, id)
+}
+
+// load 读取记录,不存在时返回 nil
+func (s *RedisTokenStore) load(ctx context.Context, id string) (oauth2.TokenInfo, error) {
+
+	data, err := s.cli.Get(ctx, s.key("token", id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ti := models.NewToken()
+	if err := json.Unmarshal(data, ti); err != nil {
+		return nil, err
+	}
+
+	return ti, nil
+}
+
+// remove 删除一个查找键,记录中已没有有效的查找键时删除记录
+// 查找键的读取与删除是原子的,返回值表示本次调用是否删除了查找键
+func (s *RedisTokenStore) remove(ctx context.Context, kind, value string) (bool, error) {
+
+	if value == "" {
+		return false, nil
+	}
+
+	id, err := takeScript.Run(ctx, s.cli, []string{s.key(kind, hashToken(value))}).Text()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ti, err := s.load(ctx, id)
+	if err != nil || ti == nil {
+		return true, err
+	}
+
+	n, err := s.cli.Exists(ctx, s.lookupKeys(ti)...).Result()
+	if err != nil || n > 0 {
+		return true, err
+	}
+
+	return true, s.removeRecord(ctx, id, ti)
+}
+
+// removeRecord 删除记录、全部查找键及其在索引中的记录ID
+func (s *RedisTokenStore) removeRecord(ctx context.Context, id string, ti oauth2.TokenInfo) error {
+
+	_, err := s.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, append(s.lookupKeys(ti), s.key("token", id))...)
+		for _, k := range s.indexKeys(ti) {
+			pipe.SRem(ctx, k, id)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// lookupKeys 记录的查找键
+func (s *RedisTokenStore) lookupKeys(ti oauth2.TokenInfo) []string {
+
+	keys := []string{}
+	if v := ti.GetCode(); v != "" {
+		keys = append(keys, s.key(redisCode, hashToken(v)))
+	}
+	if v := ti.GetAccess(); v != "" {
+		keys = append(keys, s.key(redisAccess, hashToken(v)))
+	}
+	if v := ti.GetRefresh(); v != "" {
+		keys = append(keys, s.key(redisRefresh, hashToken(v)))
+	}
+	return keys
+}
+
+// indexKeys 记录所属的索引
+func (s *RedisTokenStore) indexKeys(ti oauth2.TokenInfo) []string {
+
+	keys := []string{}
+	for _, v := range indexValues(ti) {
+		keys = append(keys, s.prefix+v)
+	}
+	return keys
+}
+
+// key 带前缀的键
+func (s *RedisTokenStore) key(kind, value string) string {
+	return s.prefix + kind + ":" + value
+}
+
+// remaining 剩余有效期,有效期为 0 表示不过期,返回 0;已过期时返回 1 毫秒
+func remaining(now, createAt time.Time, expiresIn time.Duration) time.Duration {
+	if expiresIn <= 0 {
+		return 0
+	}
+	if d := createAt.Add(expiresIn).Sub(now); d > time.Millisecond {
+		return d
+	}
+	return time.Millisecond
+}
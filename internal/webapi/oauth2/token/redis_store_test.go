@@ -0,0 +1,211 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { cli.Close() })
+	return mr, cli
+}
+
+func newTestToken(access, refresh string) *models.Token {
+	ti := models.NewToken()
+	ti.SetClientID("c1")
+	ti.SetUserID("u1")
+	ti.SetAccess(access)
+	ti.SetAccessCreateAt(time.Now())
+	ti.SetAccessExpiresIn(time.Hour)
+	if refresh != "" {
+		ti.SetRefresh(refresh)
+		ti.SetRefreshCreateAt(time.Now())
+		ti.SetRefreshExpiresIn(time.Hour * 24)
+	}
+	return ti
+}
+
+func TestRedisTokenStore(t *testing.T) {
+	ctx := context.Background()
+	mr, cli := newTestRedis(t)
+	s := NewRedisTokenStore(cli, "test:")
+
+	if err := s.Create(ctx, newTestToken("a1", "r1")); err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err := s.GetByAccess(ctx, "a1")
+	if err != nil || ti == nil || ti.GetRefresh() != "r1" {
+		t.Fatalf("get by access: %v %v", ti, err)
+	}
+	if ti, _ := s.GetByRefresh(ctx, "r1"); ti == nil || ti.GetAccess() != "a1" {
+		t.Fatalf("get by refresh: %v", ti)
+	}
+
+	// 查找键按各自的有效期过期
+	if ttl := mr.TTL("test:" + redisAccess + ":" + hashToken("a1")); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("access ttl %v", ttl)
+	}
+	if ttl := mr.TTL("test:token:" + mustGet(t, mr, "test:"+redisRefresh+":"+hashToken("r1"))); ttl <= time.Hour {
+		t.Fatalf("record should live as long as the refresh token, ttl %v", ttl)
+	}
+
+	// 访问令牌失效后刷新令牌仍可使用
+	if err := s.RemoveByAccess(ctx, "a1"); err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := s.GetByAccess(ctx, "a1"); ti != nil {
+		t.Fatal("access token still valid")
+	}
+	if ti, _ := s.GetByRefresh(ctx, "r1"); ti == nil {
+		t.Fatal("refresh token removed together with access token")
+	}
+	// 重复删除不报错
+	if err := s.RemoveByAccess(ctx, "a1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两者都失效后删除记录与索引
+	if err := s.RemoveByRefresh(ctx, "r1"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Fatalf("keys left after removal: %v", keys)
+	}
+}
+
+func TestRedisTokenStoreCode(t *testing.T) {
+	ctx := context.Background()
+	_, cli := newTestRedis(t)
+	s := NewRedisTokenStore(cli, "test:")
+
+	code := models.NewToken()
+	code.SetClientID("c1")
+	code.SetUserID("u1")
+	code.SetCode("the-code")
+	code.SetCodeCreateAt(time.Now())
+	code.SetCodeExpiresIn(time.Minute)
+	if err := s.Create(ctx, code); err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发兑换同一授权码只有一个成功
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.RemoveByCode(ctx, "the-code")
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, ErrCodeConsumed):
+			t.Fatal(err)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("code exchanged %d times", ok)
+	}
+
+	if ti, _ := s.GetByCode(ctx, "the-code"); ti != nil {
+		t.Fatal("code still valid")
+	}
+}
+
+func TestRedisTokenStoreRemoveAll(t *testing.T) {
+	ctx := context.Background()
+	mr, cli := newTestRedis(t)
+	s := NewRedisTokenStore(cli, "test:")
+
+	for _, v := range []string{"a1", "a2"} {
+		if err := s.Create(ctx, newTestToken(v, "r"+v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := s.Find(ctx, IndexUser, "u1")
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("find: %d %v", len(infos), err)
+	}
+
+	n, err := s.RemoveAll(ctx, IndexUser, "u1")
+	if err != nil || n != 2 {
+		t.Fatalf("remove all: %d %v", n, err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Fatalf("keys left after removal: %v", keys)
+	}
+}
+
+func TestRedisFamilyStoreRotate(t *testing.T) {
+	_, cli := newTestRedis(t)
+	testFamilyRotate(t, NewRedisFamilyStore(cli, "test:"))
+}
+
+func TestRedisFamilyStoreRotateExpiry(t *testing.T) {
+	ctx := context.Background()
+	mr, cli := newTestRedis(t)
+	s := NewRedisFamilyStore(cli, "test:")
+
+	created := time.Now().Truncate(time.Second)
+	err := s.Create(ctx, &Family{ID: "f1", ClientID: "c1", UserID: "u1", Access: "a0", Refresh: "r0", CreatedAt: created, ExpiresAt: created.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := created.Add(time.Hour * 2)
+	if err := s.Rotate(ctx, "f1", "r0", "a1", "r1", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+
+	f, used, err := s.FindByRefresh(ctx, "r1")
+	if err != nil || used {
+		t.Fatalf("find: used=%v err=%v", used, err)
+	}
+	if !f.ExpiresAt.Equal(expiresAt) || !f.CreatedAt.Equal(created) || f.ClientID != "c1" {
+		t.Fatalf("family fields not kept: %+v", f)
+	}
+	if ttl := mr.TTL("test:family:f1"); ttl <= time.Hour {
+		t.Fatalf("family ttl %v", ttl)
+	}
+
+	// 重放已轮换的刷新令牌
+	if err := s.Rotate(ctx, "f1", "r0", "a2", "r2", expiresAt); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("replay: %v", err)
+	}
+	if f, _, _ := s.FindByRefresh(ctx, "r1"); f.Refresh != "r1" {
+		t.Fatalf("replay modified the family: %+v", f)
+	}
+	if _, _, err := s.FindByRefresh(ctx, "r2"); !errors.Is(err, ErrFamilyNotFound) {
+		t.Fatalf("replay registered a refresh token: %v", err)
+	}
+
+	if err := s.Rotate(ctx, "missing", "r1", "a3", "r3", expiresAt); !errors.Is(err, ErrFamilyNotFound) {
+		t.Fatalf("missing family: %v", err)
+	}
+}
+
+func mustGet(t *testing.T, mr *miniredis.Miniredis, key string) string {
+	v, err := mr.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
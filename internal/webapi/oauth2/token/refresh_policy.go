@@ -0,0 +1,70 @@
+package token
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+)
+
+// RefreshPolicy 刷新令牌发放策略
+type RefreshPolicy struct {
+	cfg *configs.OAuth2
+}
+
+// NewRefreshPolicy 创建刷新令牌发放策略
+func NewRefreshPolicy(cfg *configs.OAuth2) *RefreshPolicy {
+	return &RefreshPolicy{cfg: cfg}
+}
+
+// Allow 判断是否允许发放刷新令牌
+//
+// 客户端必须注册 refresh_token 授权类型;
+// OIDC 请求(scope 含 openid)还必须请求并获得 offline_access
+func (p *RefreshPolicy) Allow(clientID, scope string) bool {
+
+	client, err := p.cfg.GetClient(clientID)
+	if err != nil {
+		return false
+	}
+
+	if !client.ContainsGrantType("refresh_token") {
+		return false
+	}
+
+	scopes := strings.Fields(scope)
+	if slices.Contains(scopes, "openid") && !slices.Contains(scopes, "offline_access") {
+		return false
+	}
+
+	return true
+}
+
+// Lifetime 计算刷新令牌本次的有效期
+//
+// 有效期取空闲有效期与绝对有效期剩余时间中的较小值,
+// 返回值小于等于 0 表示已超过绝对有效期
+//
+// 参数:
+//
+//	clientID: 客户端ID
+//	grantType: 首次授权的授权类型
+//	grantedAt: 首次授权时间(令牌族创建时间)
+//	now: 当前时间
+func (p *RefreshPolicy) Lifetime(clientID, grantType string, grantedAt, now time.Time) time.Duration {
+
+	absolute := p.cfg.RefreshTokenLifetime(clientID, grantType)
+	var idle time.Duration
+
+	if client, err := p.cfg.GetClient(clientID); err == nil {
+		idle = client.RefreshTokenIdleLifetime
+	}
+
+	remaining := grantedAt.Add(absolute).Sub(now)
+	if idle > 0 && idle < remaining {
+		return idle
+	}
+
+	return remaining
+}
@@ -0,0 +1,77 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/zap"
+)
+
+// newTestPolicy 创建刷新令牌发放策略,客户端 refresh 允许刷新令牌,客户端 norefresh 不允许
+func newTestPolicy(t *testing.T) *RefreshPolicy {
+	t.Helper()
+
+	cfg, err := configs.NewOAuth2(nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Clients = []*configs.Client{
+		{
+			ID:                           "refresh",
+			GrantTypes:                   []string{"authorization_code", "refresh_token"},
+			RefreshTokenAbsoluteLifetime: 24 * time.Hour,
+			RefreshTokenIdleLifetime:     time.Hour,
+		},
+		{ID: "norefresh", GrantTypes: []string{"authorization_code"}},
+	}
+
+	return NewRefreshPolicy(cfg)
+}
+
+func TestRefreshPolicyAllow(t *testing.T) {
+
+	p := newTestPolicy(t)
+
+	tests := []struct {
+		name     string
+		clientID string
+		scope    string
+		want     bool
+	}{
+		{"oauth2 request", "refresh", "api", true},
+		{"openid with offline_access", "refresh", "openid offline_access", true},
+		{"openid without offline_access", "refresh", "openid profile", false},
+		{"client without refresh_token grant", "norefresh", "openid offline_access", false},
+		{"unknown client", "unknown", "api", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allow(tt.clientID, tt.scope); got != tt.want {
+				t.Fatalf("Allow(%q, %q) = %v, want %v", tt.clientID, tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshPolicyLifetime(t *testing.T) {
+
+	p := newTestPolicy(t)
+	now := time.Now()
+
+	// 空闲有效期小于绝对有效期剩余时间
+	if got := p.Lifetime("refresh", "authorization_code", now, now); got != time.Hour {
+		t.Fatalf("lifetime = %v, want idle lifetime 1h", got)
+	}
+
+	// 绝对有效期剩余时间小于空闲有效期
+	if got := p.Lifetime("refresh", "authorization_code", now.Add(-23*time.Hour-30*time.Minute), now); got != 30*time.Minute {
+		t.Fatalf("lifetime = %v, want remaining 30m", got)
+	}
+
+	// 超过绝对有效期
+	if got := p.Lifetime("refresh", "authorization_code", now.Add(-25*time.Hour), now); got > 0 {
+		t.Fatalf("lifetime = %v after absolute lifetime, want <= 0", got)
+	}
+}
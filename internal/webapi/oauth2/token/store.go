@@ -0,0 +1,102 @@
+package token
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaohangshuhub/xiaohangshu/configs"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// StoreParams 创建令牌存储的依赖
+// 未配置 database.driver 时不提供数据库连接,未配置 redis.addr 时不提供 Redis 连接
+type StoreParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Config    *configs.OAuth2
+	DB        *gorm.DB      `optional:"true"`
+	Redis     *redis.Client `optional:"true"`
+	Logger    *zap.Logger
+}
+
+// NewTokenStore 按 oauth2.tokens.store 创建令牌存储
+// 数据库存储随应用启动定时清理过期记录,Redis 存储按 TTL 自动过期
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	IndexedStore: 令牌存储,支持按用户、客户端与登录会话查找和撤销
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+//	configs.ErrRedisNotConfigured: 使用 Redis 存储但未配置 Redis
+func NewTokenStore(p StoreParams) (IndexedStore, error) {
+
+	switch p.Config.Tokens.Store {
+	case configs.TokenStoreRedis:
+		if p.Redis == nil {
+			return nil, configs.ErrRedisNotConfigured
+		}
+		return NewRedisTokenStore(p.Redis, p.Config.Tokens.KeyPrefix), nil
+	case configs.TokenStoreDatabase:
+	default:
+		return NewMemotyTokenStore(p.Logger), nil
+	}
+	if p.DB == nil {
+		return nil, configs.ErrDatabaseNotConfigured
+	}
+
+	s, err := NewGormTokenStore(p.DB)
+	if err != nil {
+		return nil, err
+	}
+	startPurger(p.Lifecycle, "tokens", p.Config.Tokens.PurgeInterval, s.Purge, p.Logger)
+
+	return s, nil
+}
+
+// NewFamilyStore 按 oauth2.tokens.store 创建刷新令牌族存储,与令牌存储使用同一后端
+//
+// 参数:
+//
+//	p: 依赖
+//
+// 返回值:
+//
+//	FamilyStore: 刷新令牌族存储
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	configs.ErrDatabaseNotConfigured: 使用数据库存储但未配置数据库
+//	configs.ErrRedisNotConfigured: 使用 Redis 存储但未配置 Redis
+func NewFamilyStore(p StoreParams) (FamilyStore, error) {
+
+	switch p.Config.Tokens.Store {
+	case configs.TokenStoreRedis:
+		if p.Redis == nil {
+			return nil, configs.ErrRedisNotConfigured
+		}
+		return NewRedisFamilyStore(p.Redis, p.Config.Tokens.KeyPrefix), nil
+	case configs.TokenStoreDatabase:
+	default:
+		return NewMemoryFamilyStore(), nil
+	}
+	if p.DB == nil {
+		return nil, configs.ErrDatabaseNotConfigured
+	}
+
+	s, err := NewGormFamilyStore(p.DB)
+	if err != nil {
+		return nil, err
+	}
+	startPurger(p.Lifecycle, "token_families", p.Config.Tokens.PurgeInterval, s.Purge, p.Logger)
+
+	return s, nil
+}
@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EventType 安全事件类型
+type EventType string
+
+const (
+	RefreshTokenReused  EventType = "refresh_token_reused"  // 已使用的刷新令牌被再次提交,整个令牌族被撤销
+	ClientSecretAdded   EventType = "client_secret_added"   // 客户端密钥已添加
+	ClientSecretRetired EventType = "client_secret_retired" // 客户端密钥已撤销或设置过期
+	SessionRevoked      EventType = "session_revoked"       // 登录会话被撤销,会话期间签发的令牌一并撤销
+	PasswordResetIssued EventType = "password_reset_issued" // 找回密码邮件已发送
+	PasswordReset       EventType = "password_reset"        // 密码已通过找回密码令牌重置
+	MFAEnrolled         EventType = "mfa_enrolled"          // 用户已绑定两步验证
+	MFADisabled         EventType = "mfa_disabled"          // 用户已解除两步验证
+	WebAuthnCloned      EventType = "webauthn_cloned"       // WebAuthn 凭据的签名计数未增加,认证器可能被复制,登录被拒绝
+	RecoveryCodesIssued EventType = "recovery_codes_issued" // 用户已生成新的恢复码,之前的恢复码失效
+	RecoveryCodeUsed    EventType = "recovery_code_used"    // 用户已使用恢复码代替第二步验证
+	MFAReset            EventType = "mfa_reset"             // 管理员已重置用户的两步验证,全部验证方式与恢复码被删除
+)
+
+// Event 安全事件
+type Event struct {
+	Type     EventType         // 事件类型
+	UserID   string            // 相关用户ID
+	ClientID string            // 相关客户端ID
+	Time     time.Time         // 发生时间
+	Detail   map[string]string // 附加信息
+}
+
+// Recorder 安全事件记录者
+type Recorder interface {
+	Record(ctx context.Context, event *Event)
+}
+
+// LogRecorder 将安全事件写入日志
+type LogRecorder struct {
+	*zap.Logger
+}
+
+// NewLogRecorder 创建日志安全事件记录者
+func NewLogRecorder(logger *zap.Logger) Recorder {
+	return &LogRecorder{Logger: logger}
+}
+
+// Record 记录安全事件
+func (l *LogRecorder) Record(ctx context.Context, event *Event) {
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	fields := []zap.Field{
+		zap.String("event", string(event.Type)),
+		zap.String("user_id", event.UserID),
+		zap.String("client_id", event.ClientID),
+		zap.Time("time", event.Time),
+	}
+	for k, v := range event.Detail {
+		fields = append(fields, zap.String(k, v))
+	}
+
+	l.Warn("security event", fields...)
+}
@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message 邮件
+type Message struct {
+	To      []string // 收件人
+	Subject string   // 主题
+	Text    string   // 纯文本正文
+}
+
+// Sender 邮件发送者
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// encode 按 RFC 5322 编码邮件,正文使用 quoted-printable 编码的 UTF-8 纯文本
+func encode(from string, msg *Message) ([]byte, error) {
+
+	if len(msg.To) == 0 {
+		return nil, fmt.Errorf("mail: no recipient")
+	}
+	for _, v := range append([]string{from}, msg.To...) {
+		if _, err := mail.ParseAddress(v); err != nil {
+			return nil, fmt.Errorf("mail: invalid address %q: %w", v, err)
+		}
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	_, domain, _ := strings.Cut(from, "@")
+	domain = strings.TrimSuffix(domain, ">")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(msg.Text)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FileSender 把邮件写入目录,每封邮件一个 .eml 文件,用于测试与本地联调
+type FileSender struct {
+	dir  string
+	from string
+}
+
+// NewFileSender 创建文件邮件发送者
+//
+// 参数:
+//
+//	dir: 邮件保存目录,不存在时创建
+//	from: 发件人
+//
+// 返回值:
+//
+//	Sender: 邮件发送者
+//	error: 错误信息,创建目录失败时返回
+func NewFileSender(dir, from string) (Sender, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileSender{dir: dir, from: from}, nil
+}
+
+// Send 写入邮件文件
+func (s *FileSender) Send(ctx context.Context, msg *Message) error {
+
+	data, err := encode(s.from, msg)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000"), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(s.dir, name), data, 0o600)
+}
+
+// MemorySender 把邮件保存在内存中并写入日志,不实际发送
+// 日志中包含正文,只能用于测试与本地联调
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []*Message
+	*zap.Logger
+}
+
+// NewMemorySender 创建内存邮件发送者
+func NewMemorySender(logger *zap.Logger) *MemorySender {
+	return &MemorySender{Logger: logger}
+}
+
+// Send 保存邮件
+func (s *MemorySender) Send(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *msg
+	cp.To = slices.Clone(msg.To)
+	s.messages = append(s.messages, &cp)
+
+	s.Info("mail captured", zap.Strings("to", msg.To), zap.String("subject", msg.Subject), zap.String("text", msg.Text))
+	return nil
+}
+
+// Messages 已保存的邮件
+func (s *MemorySender) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.messages)
+}
@@ -0,0 +1,129 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTP 连接加密方式
+const (
+	TLSStartTLS = "starttls" // 明文连接后升级,通常为 587 端口
+	TLSImplicit = "tls"      // 直接建立 TLS 连接,通常为 465 端口
+	TLSNone     = "none"     // 不加密,仅用于本地测试
+)
+
+// SMTPOptions SMTP 发送配置
+type SMTPOptions struct {
+	Host     string        // 服务器地址
+	Port     int           // 端口
+	Username string        // 用户名,为空时不认证
+	Password string        // 密码
+	From     string        // 发件人
+	TLS      string        // 加密方式: starttls, tls, none
+	Timeout  time.Duration // 连接与发送超时
+}
+
+// SMTPSender 通过 SMTP 服务器发送邮件,每封邮件使用一个连接
+type SMTPSender struct {
+	opts SMTPOptions
+}
+
+// NewSMTPSender 创建 SMTP 邮件发送者
+//
+// 参数:
+//
+//	opts: SMTP 发送配置
+//
+// 返回值:
+//
+//	Sender: 邮件发送者
+func NewSMTPSender(opts SMTPOptions) Sender {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second * 10
+	}
+	return &SMTPSender{opts: opts}
+}
+
+// Send 发送邮件
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+
+	data, err := encode(s.opts.From, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.opts.Host, strconv.Itoa(s.opts.Port))
+	tlsConfig := &tls.Config{ServerName: s.opts.Host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	if s.opts.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.opts.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.opts.TLS == TLSStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("mail: starttls: %w", err)
+		}
+	}
+
+	if s.opts.Username != "" {
+		// PlainAuth 拒绝在未加密的连接上发送密码(localhost 除外)
+		if err := c.Auth(smtp.PlainAuth("", s.opts.Username, s.opts.Password, s.opts.Host)); err != nil {
+			return fmt.Errorf("mail: auth: %w", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(s.opts.From)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, v := range msg.To {
+		to, err := mail.ParseAddress(v)
+		if err != nil {
+			return err
+		}
+		if err := c.Rcpt(to.Address); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
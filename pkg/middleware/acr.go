@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+)
+
+// ACRExtension 令牌扩展信息中保存认证上下文等级的键
+const ACRExtension = "acr"
+
+// RequireUserACR 要求代表用户的访问令牌达到指定的认证上下文等级,须在 JWTBearer 之后使用
+//
+// 不代表用户的令牌(client_credentials)不受限制;未达到时返回 401
+// insufficient_user_authentication(RFC 9470),客户端应让用户重新认证后再次请求
+//
+// 参数:
+//
+//	acr: 要求的认证上下文等级
+//
+// 返回值:
+//
+//	gin.HandlerFunc: 中间件
+func RequireUserACR(acr string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ti := TokenInfo(c)
+		if ti == nil || ti.GetUserID() == "" {
+			c.Next()
+			return
+		}
+
+		if eti, ok := ti.(oauth2.ExtendableTokenInfo); ok && eti.GetExtension() != nil && eti.GetExtension().Get(ACRExtension) == acr {
+			c.Next()
+			return
+		}
+
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication", acr_values="`+acr+`"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "insufficient_user_authentication", "acr_values": acr})
+	}
+}
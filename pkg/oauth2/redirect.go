@@ -0,0 +1,119 @@
+package oauth2
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrRedirectURINotAbsolute    = errors.New("redirect uri must be absolute")                        // 跳转地址必须是绝对地址
+	ErrRedirectURIFragment       = errors.New("redirect uri must not contain a fragment")             // 跳转地址不能包含片段
+	ErrRedirectURIMissingHost    = errors.New("redirect uri must contain a host")                     // http(s) 跳转地址必须包含主机
+	ErrRedirectURIPrivateUseName = errors.New("private-use uri scheme must be a reverse domain name") // 私有 scheme 须为反向域名
+)
+
+// ValidateRedirectURI 校验客户端注册的跳转地址
+//
+// 跳转地址须为不含片段的绝对地址(RFC 6749 3.1.2);
+// 非 http(s) 的私有 scheme 须为反向域名形式,如 com.example.app(RFC 8252 7.1)
+//
+// 参数:
+//
+//	uri: 注册的跳转地址
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrRedirectURINotAbsolute: 不是绝对地址
+//	ErrRedirectURIFragment: 包含片段
+//	ErrRedirectURIMissingHost: http(s) 地址缺少主机
+//	ErrRedirectURIPrivateUseName: 私有 scheme 不是反向域名
+func ValidateRedirectURI(uri string) error {
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+
+	if !u.IsAbs() {
+		return ErrRedirectURINotAbsolute
+	}
+	if u.Fragment != "" || strings.Contains(uri, "#") {
+		return ErrRedirectURIFragment
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return ErrRedirectURIMissingHost
+		}
+	default:
+		if !strings.Contains(u.Scheme, ".") {
+			return ErrRedirectURIPrivateUseName
+		}
+	}
+
+	return nil
+}
+
+// MatchRedirectURI 判断请求中的跳转地址是否与注册的跳转地址之一匹配
+//
+// 按字符串完全匹配,不做前缀或域名匹配;
+// 唯一的例外是回环 IP 地址(RFC 8252 7.3): 注册为 http://127.0.0.1 或 http://[::1] 的地址,
+// 请求时允许使用任意端口,其余部分仍须完全一致
+//
+// 参数:
+//
+//	registered: 客户端注册的跳转地址
+//	uri: 请求中的跳转地址
+//
+// 返回值:
+//
+//	bool: 匹配返回true
+func MatchRedirectURI(registered []string, uri string) bool {
+
+	if slices.Contains(registered, uri) {
+		return true
+	}
+
+	req, ok := loopbackURI(uri)
+	if !ok {
+		return false
+	}
+
+	for _, v := range registered {
+		if reg, ok := loopbackURI(v); ok && reg == req {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loopbackURI 回环 IP 地址去掉端口后的形式,非回环 IP 地址返回 false
+// localhost 不视为回环地址,只能完全匹配(RFC 8252 8.3)
+func loopbackURI(uri string) (string, bool) {
+
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "http" || u.Fragment != "" || u.User != nil {
+		return "", false
+	}
+
+	ip := net.ParseIP(u.Hostname())
+	if ip == nil || !ip.IsLoopback() {
+		return "", false
+	}
+
+	host := u.Hostname()
+	if ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+
+	return u.Scheme + "://" + host + u.EscapedPath() + "?" + u.RawQuery, true
+}
@@ -0,0 +1,76 @@
+package oauth2
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRedirectURI(t *testing.T) {
+
+	tests := []struct {
+		uri string
+		err error
+	}{
+		{"https://rp.example.com/callback", nil},
+		{"http://127.0.0.1/callback", nil},
+		{"com.example.app:/oauth2/callback", nil},
+		{"/callback", ErrRedirectURINotAbsolute},
+		{"https://rp.example.com/callback#frag", ErrRedirectURIFragment},
+		{"https://rp.example.com/callback#", ErrRedirectURIFragment},
+		{"https:///callback", ErrRedirectURIMissingHost},
+		{"myapp:/callback", ErrRedirectURIPrivateUseName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if err := ValidateRedirectURI(tt.uri); !errors.Is(err, tt.err) {
+				t.Fatalf("ValidateRedirectURI(%q) = %v, want %v", tt.uri, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMatchRedirectURI(t *testing.T) {
+
+	registered := []string{
+		"https://rp.example.com/callback?tenant=1",
+		"http://127.0.0.1/native/callback",
+		"http://[::1]/native/callback",
+		"http://localhost:8080/callback",
+		"com.example.app:/oauth2/callback",
+	}
+
+	tests := []struct {
+		name string
+		uri  string
+		want bool
+	}{
+		{"exact", "https://rp.example.com/callback?tenant=1", true},
+		{"prefix", "https://rp.example.com/callback", false},
+		{"suffix", "https://rp.example.com/callback?tenant=1&x=2", false},
+		{"extra path", "https://rp.example.com/callback/evil?tenant=1", false},
+		{"changed query", "https://rp.example.com/callback?tenant=2", false},
+		{"host suffix", "https://rp.example.com.evil.com/callback?tenant=1", false},
+		{"fragment", "https://rp.example.com/callback?tenant=1#x", false},
+		{"loopback ipv4 any port", "http://127.0.0.1:51234/native/callback", true},
+		{"loopback ipv4 no port", "http://127.0.0.1/native/callback", true},
+		{"loopback ipv6 any port", "http://[::1]:51234/native/callback", true},
+		{"loopback other path", "http://127.0.0.1:51234/native/other", false},
+		{"loopback query", "http://127.0.0.1:51234/native/callback?x=1", false},
+		{"loopback fragment", "http://127.0.0.1:51234/native/callback#x", false},
+		{"loopback https", "https://127.0.0.1:51234/native/callback", false},
+		{"loopback userinfo", "http://user@127.0.0.1:51234/native/callback", false},
+		{"localhost exact", "http://localhost:8080/callback", true},
+		{"localhost other port", "http://localhost:9090/callback", false},
+		{"private-use scheme", "com.example.app:/oauth2/callback", true},
+		{"private-use other path", "com.example.app:/oauth2/other", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchRedirectURI(registered, tt.uri); got != tt.want {
+				t.Fatalf("MatchRedirectURI(%q) = %v, want %v", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
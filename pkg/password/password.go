@@ -0,0 +1,173 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2id 参数(OWASP 推荐的最低配置: m=19MiB, t=2, p=1)
+const (
+	argon2Memory  = 19 * 1024
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// 校验时接受的 argon2id 参数上限,防止伪造的哈希以超大参数耗尽内存与 CPU
+const (
+	argon2MaxMemory = 256 * 1024 // 256MiB
+	argon2MaxTime   = 10
+	argon2MaxKeyLen = 64
+)
+
+var (
+	ErrUnsupportedHash = errors.New("unsupported password hash") // 不支持的哈希格式
+	ErrInvalidHash     = errors.New("invalid password hash")     // 哈希格式错误
+)
+
+// Hash 使用 argon2id 计算密码哈希
+//
+// 参数:
+//
+//	plain: 明文密码
+//
+// 返回值:
+//
+//	string: PHC 格式的哈希,如 $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+//	error: 错误信息
+func Hash(plain string) (string, error) {
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(plain), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify 校验明文密码与哈希是否匹配,支持 argon2id 与 bcrypt
+//
+// 参数:
+//
+//	encoded: 密码哈希
+//	plain: 明文密码
+//
+// 返回值:
+//
+//	bool: 匹配返回true
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrUnsupportedHash: 不支持的哈希格式
+//	ErrInvalidHash: 哈希格式错误
+func Verify(encoded, plain string) (bool, error) {
+
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return verifyArgon2id(encoded, plain)
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plain))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	return false, ErrUnsupportedHash
+}
+
+// IsHash 判断字符串是否为支持的密码哈希格式
+func IsHash(s string) bool {
+	return strings.HasPrefix(s, "$argon2id$") || isBcrypt(s)
+}
+
+// isBcrypt 判断是否为 bcrypt 哈希
+func isBcrypt(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+// verifyArgon2id 按哈希中记录的参数重新计算并比较
+func verifyArgon2id(encoded, plain string) (bool, error) {
+
+	// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidHash
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, ErrInvalidHash
+	}
+	if time < 1 || time > argon2MaxTime || threads < 1 || memory > argon2MaxMemory {
+		return false, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 || len(key) > argon2MaxKeyLen {
+		return false, ErrInvalidHash
+	}
+
+	actual := argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+// NeedsRehash 判断哈希是否需要按当前参数重新计算
+// bcrypt 哈希或参数低于当前配置的 argon2id 哈希在用户下次验证成功后应升级
+//
+// 参数:
+//
+//	encoded: 密码哈希
+//
+// 返回值:
+//
+//	bool: 需要升级返回true
+func NeedsRehash(encoded string) bool {
+
+	if !strings.HasPrefix(encoded, "$argon2id$") {
+		return true
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return true
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return true
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return true
+	}
+
+	return memory < argon2Memory || time < argon2Time || threads < argon2Threads
+}
@@ -0,0 +1,116 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashVerify(t *testing.T) {
+
+	encoded, err := Hash("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("unexpected hash format: %s", encoded)
+	}
+	if !IsHash(encoded) {
+		t.Fatal("IsHash = false for argon2id hash")
+	}
+
+	if ok, err := Verify(encoded, "s3cret"); err != nil || !ok {
+		t.Fatalf("Verify(correct) = %v, %v", ok, err)
+	}
+	if ok, err := Verify(encoded, "wrong"); err != nil || ok {
+		t.Fatalf("Verify(wrong) = %v, %v", ok, err)
+	}
+
+	// 相同密码每次使用不同的盐
+	again, _ := Hash("s3cret")
+	if again == encoded {
+		t.Fatal("hash reused salt")
+	}
+}
+
+func TestVerifyBcrypt(t *testing.T) {
+
+	b, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := string(b)
+
+	if !IsHash(encoded) {
+		t.Fatal("IsHash = false for bcrypt hash")
+	}
+	if ok, err := Verify(encoded, "s3cret"); err != nil || !ok {
+		t.Fatalf("Verify(correct) = %v, %v", ok, err)
+	}
+	if ok, err := Verify(encoded, "wrong"); err != nil || ok {
+		t.Fatalf("Verify(wrong) = %v, %v", ok, err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+
+	const salt = "c29tZXNhbHRzb21lc2FsdA"
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    error
+	}{
+		{"plaintext", "s3cret", ErrUnsupportedHash},
+		{"unknown algorithm", "$argon2i$v=19$m=19456,t=2,p=1$" + salt + "$" + key, ErrUnsupportedHash},
+		{"missing parts", "$argon2id$v=19$m=19456,t=2,p=1$" + salt, ErrInvalidHash},
+		{"wrong version", "$argon2id$v=16$m=19456,t=2,p=1$" + salt + "$" + key, ErrInvalidHash},
+		{"bad params", "$argon2id$v=19$m=x,t=2,p=1$" + salt + "$" + key, ErrInvalidHash},
+		{"zero time", "$argon2id$v=19$m=19456,t=0,p=1$" + salt + "$" + key, ErrInvalidHash},
+		{"zero threads", "$argon2id$v=19$m=19456,t=2,p=0$" + salt + "$" + key, ErrInvalidHash},
+		{"huge memory", "$argon2id$v=19$m=4194304,t=2,p=1$" + salt + "$" + key, ErrInvalidHash},
+		{"huge time", "$argon2id$v=19$m=19456,t=1000,p=1$" + salt + "$" + key, ErrInvalidHash},
+		{"bad salt", "$argon2id$v=19$m=19456,t=2,p=1$!!$" + key, ErrInvalidHash},
+		{"empty key", "$argon2id$v=19$m=19456,t=2,p=1$" + salt + "$", ErrInvalidHash},
+		{"huge key", "$argon2id$v=19$m=19456,t=2,p=1$" + salt + "$" + strings.Repeat("a", 200), ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := Verify(tt.encoded, "s3cret")
+			if ok || !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, %v, want %v", ok, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+
+	current, _ := Hash("s3cret")
+	b, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"current params", current, false},
+		{"bcrypt", string(b), true},
+		{"lower memory", "$argon2id$v=19$m=4096,t=2,p=1$salt$key", true},
+		{"lower time", "$argon2id$v=19$m=19456,t=1,p=1$salt$key", true},
+		{"stronger params", "$argon2id$v=19$m=65536,t=3,p=2$salt$key", false},
+		{"malformed", "$argon2id$v=19$salt$key", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsRehash(tt.encoded); got != tt.want {
+				t.Fatalf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
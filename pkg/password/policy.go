@@ -0,0 +1,80 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrPolicy 密码不符合策略
+var ErrPolicy = errors.New("password does not meet policy")
+
+// Policy 密码策略
+type Policy struct {
+	MinLength     int  `yaml:"min_length" mapstructure:"min_length"`         // 最小长度(字符数)
+	MaxLength     int  `yaml:"max_length" mapstructure:"max_length"`         // 最大长度(字符数),限制哈希计算的开销
+	RequireUpper  bool `yaml:"require_upper" mapstructure:"require_upper"`   // 须包含大写字母
+	RequireLower  bool `yaml:"require_lower" mapstructure:"require_lower"`   // 须包含小写字母
+	RequireDigit  bool `yaml:"require_digit" mapstructure:"require_digit"`   // 须包含数字
+	RequireSymbol bool `yaml:"require_symbol" mapstructure:"require_symbol"` // 须包含字母数字以外的字符
+}
+
+// Validate 校验明文密码是否符合策略
+//
+// 参数:
+//
+//	plain: 明文密码
+//	forbidden: 不能与密码相同的值(不区分大小写),如用户名、邮箱
+//
+// 返回值:
+//
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrPolicy: 不符合策略,错误信息中包含具体原因
+func (p *Policy) Validate(plain string, forbidden ...string) error {
+
+	n := utf8.RuneCountInString(plain)
+	if n < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters", ErrPolicy, p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return fmt.Errorf("%w: at most %d characters", ErrPolicy, p.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range plain {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	switch {
+	case p.RequireUpper && !upper:
+		return fmt.Errorf("%w: must contain an uppercase letter", ErrPolicy)
+	case p.RequireLower && !lower:
+		return fmt.Errorf("%w: must contain a lowercase letter", ErrPolicy)
+	case p.RequireDigit && !digit:
+		return fmt.Errorf("%w: must contain a digit", ErrPolicy)
+	case p.RequireSymbol && !symbol:
+		return fmt.Errorf("%w: must contain a symbol", ErrPolicy)
+	}
+
+	for _, v := range forbidden {
+		if v != "" && strings.EqualFold(plain, v) {
+			return fmt.Errorf("%w: must not be the same as the account", ErrPolicy)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Limiter 固定窗口限流器
+type Limiter interface {
+
+	// Allow 记录一次请求并判断是否允许
+	//
+	// 参数:
+	//
+	//	ctx: 上下文
+	//	key: 限流对象,如 "password_reset:ip:127.0.0.1"
+	//	limit: 窗口内允许的次数
+	//	window: 窗口长度,从该对象的第一次请求开始计算
+	//
+	// 返回值:
+	//
+	//	bool: 未超过限制返回true
+	//	error: 错误信息
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error)
+}
+
+// MemoryLimiter 内存限流器,仅对单实例有效
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+	sweepAt time.Time
+}
+
+// memoryWindow 限流窗口
+type memoryWindow struct {
+	count     int
+	expiresAt time.Time
+}
+
+// NewMemoryLimiter 创建内存限流器
+func NewMemoryLimiter() Limiter {
+	return &MemoryLimiter{windows: make(map[string]*memoryWindow)}
+}
+
+// Allow 记录一次请求并判断是否允许,顺带清理已结束的窗口
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.After(l.sweepAt) {
+		for k, v := range l.windows {
+			if now.After(v.expiresAt) {
+				delete(l.windows, k)
+			}
+		}
+		l.sweepAt = now.Add(time.Minute)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.After(w.expiresAt) {
+		w = &memoryWindow{expiresAt: now.Add(window)}
+		l.windows[key] = w
+	}
+	w.count++
+
+	return w.count <= limit, nil
+}
+
+// RedisLimiter Redis 限流器,多实例共享计数
+type RedisLimiter struct {
+	cli    *redis.Client
+	prefix string
+}
+
+// incrScript 计数加一,第一次计数时设置窗口过期时间
+var incrScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// NewRedisLimiter 创建 Redis 限流器
+//
+// 参数:
+//
+//	cli: Redis 连接
+//	prefix: 键前缀
+//
+// 返回值:
+//
+//	Limiter: 限流器
+func NewRedisLimiter(cli *redis.Client, prefix string) Limiter {
+	return &RedisLimiter{cli: cli, prefix: prefix}
+}
+
+// Allow 记录一次请求并判断是否允许
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+
+	n, err := incrScript.Run(ctx, l.cli, []string{l.prefix + key}, window.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return n <= limit, nil
+}
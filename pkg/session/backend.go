@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Backend 会话数据的服务端存储
+// 会话ID为随机值,只以签名 Cookie 的形式交给浏览器
+type Backend interface {
+
+	// Load 读取会话数据,不存在或已过期时返回 nil
+	Load(ctx context.Context, id string) ([]byte, error)
+
+	// Save 保存会话数据,ttl 为 0 表示不过期
+	Save(ctx context.Context, id string, data []byte, ttl time.Duration) error
+
+	// Delete 删除会话数据
+	Delete(ctx context.Context, id string) error
+}
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// MemoryBackend 内存会话存储,仅适用于单实例,重启后会话失效
+type MemoryBackend struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+// NewMemoryBackend 创建内存会话存储
+//
+// 返回值:
+//
+//	*MemoryBackend: 会话存储
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: map[string]*memoryEntry{}, lastSweep: time.Now()}
+}
+
+// Load 读取会话数据
+func (b *MemoryBackend) Load(ctx context.Context, id string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[id]
+	if !ok {
+		return nil, nil
+	}
+	if !e.expiresAt.IsZero() && time.Now().After(e.expiresAt) {
+		delete(b.entries, id)
+		return nil, nil
+	}
+	return e.data, nil
+}
+
+// Save 保存会话数据,每分钟至多清理一次过期会话
+func (b *MemoryBackend) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	e := &memoryEntry{data: data}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl)
+	}
+	b.entries[id] = e
+
+	if now.Sub(b.lastSweep) > time.Minute {
+		for k, v := range b.entries {
+			if !v.expiresAt.IsZero() && now.After(v.expiresAt) {
+				delete(b.entries, k)
+			}
+		}
+		b.lastSweep = now
+	}
+
+	return nil
+}
+
+// Delete 删除会话数据
+func (b *MemoryBackend) Delete(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.entries, id)
+	return nil
+}
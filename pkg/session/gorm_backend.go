@@ -0,0 +1,128 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sessionModel 会话表,会话ID以 SHA-256 摘要保存,数据库泄露时无法冒用会话
+type sessionModel struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	Data      []byte
+	UpdatedAt time.Time
+	ExpiresAt *time.Time `gorm:"index"` // 为空表示不过期
+}
+
+// TableName 会话表名
+func (sessionModel) TableName() string {
+	return "sessions"
+}
+
+// GormBackend 数据库会话存储,多副本共享
+// 过期会话在读取时忽略,并在保存时按清理间隔批量删除
+type GormBackend struct {
+	db            *gorm.DB
+	purgeInterval time.Duration
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewGormBackend 创建数据库会话存储
+//
+// 参数:
+//
+//	db: 数据库连接
+//	purgeInterval: 清理过期会话的间隔
+//
+// 返回值:
+//
+//	*GormBackend: 会话存储
+//	error: 错误信息,建表失败时返回
+func NewGormBackend(db *gorm.DB, purgeInterval time.Duration) (*GormBackend, error) {
+
+	if err := db.AutoMigrate(&sessionModel{}); err != nil {
+		return nil, err
+	}
+
+	return &GormBackend{db: db, purgeInterval: purgeInterval, lastPurge: time.Now()}, nil
+}
+
+// Load 读取会话数据
+func (b *GormBackend) Load(ctx context.Context, id string) ([]byte, error) {
+
+	var m sessionModel
+	err := b.db.WithContext(ctx).
+		Where("id = ?", hashID(id)).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Data, nil
+}
+
+// Save 保存会话数据
+func (b *GormBackend) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+
+	m := &sessionModel{ID: hashID(id), Data: data}
+	if ttl > 0 {
+		t := time.Now().Add(ttl)
+		m.ExpiresAt = &t
+	}
+
+	err := b.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data", "updated_at", "expires_at"}),
+	}).Create(m).Error
+	if err != nil {
+		return err
+	}
+
+	b.purge()
+	return nil
+}
+
+// Delete 删除会话数据
+func (b *GormBackend) Delete(ctx context.Context, id string) error {
+	return b.db.WithContext(ctx).Where("id = ?", hashID(id)).Delete(&sessionModel{}).Error
+}
+
+// purge 距上次清理超过清理间隔时,在后台删除过期会话
+func (b *GormBackend) purge() {
+
+	b.mu.Lock()
+	now := time.Now()
+	due := now.Sub(b.lastPurge) > b.purgeInterval
+	if due {
+		b.lastPurge = now
+	}
+	b.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		b.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&sessionModel{})
+	}()
+}
+
+// hashID 会话ID的 SHA-256 摘要
+func hashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,48 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisBackend Redis 会话存储,多副本共享,按 TTL 过期
+type RedisBackend struct {
+	cli    *redis.Client
+	prefix string
+}
+
+// NewRedisBackend 创建 Redis 会话存储
+//
+// 参数:
+//
+//	cli: Redis 连接
+//	prefix: 键前缀
+//
+// 返回值:
+//
+//	*RedisBackend: 会话存储
+func NewRedisBackend(cli *redis.Client, prefix string) *RedisBackend {
+	return &RedisBackend{cli: cli, prefix: prefix}
+}
+
+// Load 读取会话数据
+func (b *RedisBackend) Load(ctx context.Context, id string) ([]byte, error) {
+	data, err := b.cli.Get(ctx, b.prefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Save 保存会话数据
+func (b *RedisBackend) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	return b.cli.Set(ctx, b.prefix+id, data, ttl).Err()
+}
+
+// Delete 删除会话数据
+func (b *RedisBackend) Delete(ctx context.Context, id string) error {
+	return b.cli.Del(ctx, b.prefix+id).Err()
+}
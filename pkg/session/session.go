@@ -1,54 +1,148 @@
 package session
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"go.uber.org/zap"
 )
 
+const sessionName string = "xiaohangshu_session"
+
+// 会话中保存的用户认证信息
 const (
-	secrekey    string = "xiaohangshu-secret-key"
-	sessionName string = "xiaohangshu_session"
+	UserIDKey   = "user_id"   // 已登录的用户ID
+	AuthTimeKey = "auth_time" // 用户完成认证的时间(Unix秒)
+	AMRKey      = "amr"       // 认证方式,多个以空格分隔,如 "pwd otp"
+	ACRKey      = "acr"       // 认证上下文等级
+	SIDKey      = "sid"       // 登录会话ID,登录时生成,随令牌记录以便按会话撤销
+
+	AuthorizeFormKey = "authorize_form" // 未登录时保存的授权请求参数,登录或注册后继续授权
+
+	MFAUserIDKey      = "mfa_user_id"      // 已通过第一步验证、等待完成第二步的用户ID,完成第二步后才写入 UserIDKey
+	MFADeadlineKey    = "mfa_deadline"     // 须完成第二步的截止时间(Unix秒)
+	MFAFirstFactorKey = "mfa_first_factor" // 第一步的认证方式: pwd(密码), sms(短信验证码),与第二步合并为 AMRKey
+
+	WebAuthnRegistrationKey = "webauthn_registration" // 注册 WebAuthn 凭据的挑战状态,完成或失败后删除
+	WebAuthnLoginKey        = "webauthn_login"        // WebAuthn 登录或补充验证的挑战状态,完成或失败后删除
 )
 
+// ErrInvalidKey 会话签名或加密密钥不合法
+var ErrInvalidKey = errors.New("invalid session key")
+
+// 签名密钥的最小长度(字节)
+const minHashKeyLength = 32
+
 type (
 	Session struct {
-		store *sessions.CookieStore
+		store *serverStore
+		name  string
 		*zap.Logger
 	}
+
+	// Options 会话配置
+	Options struct {
+		Name      string        // Cookie 名称,默认 xiaohangshu_session
+		MaxAge    time.Duration // 会话有效期,同时用于 Cookie 的 Max-Age 与服务端数据的过期时间,默认 1 小时
+		Path      string        // Cookie 路径,默认 /
+		Domain    string        // Cookie 域名,为空表示仅当前主机
+		Secure    bool          // 仅通过 HTTPS 发送 Cookie
+		SameSite  http.SameSite // Cookie 的 SameSite 属性
+		HashKeys  [][]byte      // 签名密钥,第一个用于签发,其余仅用于验证,便于轮换
+		BlockKeys [][]byte      // 加密密钥(可选),与 HashKeys 按位置配对,长度为 16、24 或 32 字节
+	}
 )
 
 // NewSession 创建一个 session 对象
+// 会话数据保存在 backend 中,Cookie 中只有签名的会话ID;未配置签名密钥时随机生成,重启后会话失效
 //
 // 参数:
 //
+//	opts Options: 会话配置
+//	backend Backend: 会话数据存储
 //	log *zap.Logger: 日志对象
 //
 // 返回值:
 //
 //	*Session: session 对象
-func NewSession(log *zap.Logger) *Session {
+//	error: 错误信息
+//
+// 错误信息:
+//
+//	ErrInvalidKey: 签名密钥不足 32 字节,或加密密钥长度不是 16、24、32 字节
+func NewSession(opts Options, backend Backend, log *zap.Logger) (*Session, error) {
 
 	// 注册 url.Values 类型
 	gob.Register(url.Values{})
 
-	store := sessions.NewCookieStore([]byte(secrekey))
+	if opts.Name == "" {
+		opts.Name = sessionName
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = time.Hour
+	}
 
-	store.Options = &sessions.Options{
-		Path: "/",
-		// session 有效期
-		// 单位秒
-		MaxAge:   3600, // 1 hour
-		HttpOnly: true,
+	hashKeys := opts.HashKeys
+	if len(hashKeys) == 0 {
+		log.Warn("session hash keys are not configured, using a random key; sessions will not survive a restart or be shared between replicas")
+		hashKeys = [][]byte{securecookie.GenerateRandomKey(64)}
+	}
+	if len(opts.BlockKeys) > len(hashKeys) {
+		return nil, fmt.Errorf("%w: %d block keys for %d hash keys", ErrInvalidKey, len(opts.BlockKeys), len(hashKeys))
+	}
+
+	pairs := make([][]byte, 0, len(hashKeys)*2)
+	for i, hk := range hashKeys {
+		if len(hk) < minHashKeyLength {
+			return nil, fmt.Errorf("%w: hash key #%d is shorter than %d bytes", ErrInvalidKey, i+1, minHashKeyLength)
+		}
+		var bk []byte
+		if i < len(opts.BlockKeys) && len(opts.BlockKeys[i]) > 0 {
+			bk = opts.BlockKeys[i]
+			if n := len(bk); n != 16 && n != 24 && n != 32 {
+				return nil, fmt.Errorf("%w: block key #%d must be 16, 24 or 32 bytes", ErrInvalidKey, i+1)
+			}
+		}
+		pairs = append(pairs, hk, bk)
+	}
+
+	codecs := securecookie.CodecsFromPairs(pairs...)
+	for _, c := range codecs {
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(int(opts.MaxAge.Seconds()))
+		}
+	}
+
+	store := &serverStore{
+		codecs: codecs,
+		options: sessions.Options{
+			Path:     opts.Path,
+			Domain:   opts.Domain,
+			MaxAge:   int(opts.MaxAge.Seconds()),
+			Secure:   opts.Secure,
+			HttpOnly: true,
+			SameSite: opts.SameSite,
+		},
+		maxAge:  opts.MaxAge,
+		backend: backend,
 	}
 
 	return &Session{
 		store:  store,
 		Logger: log,
-	}
+		name:   opts.Name,
+	}, nil
 }
 
 // Get 获取 session 中指定 key 的值
@@ -65,7 +159,7 @@ func NewSession(log *zap.Logger) *Session {
 func (s *Session) Get(r *http.Request, name string) (val interface{}, err error) {
 
 	// Get a session.
-	session, err := s.store.Get(r, sessionName)
+	session, err := s.store.Get(r, s.name)
 	if err != nil {
 		return
 	}
@@ -89,7 +183,7 @@ func (s *Session) Get(r *http.Request, name string) (val interface{}, err error)
 //	error: 错误信息
 func (s *Session) Set(w http.ResponseWriter, r *http.Request, name string, val interface{}) (err error) {
 	// Get a session.
-	session, err := s.store.Get(r, sessionName)
+	session, err := s.store.Get(r, s.name)
 	if err != nil {
 		return
 	}
@@ -113,7 +207,7 @@ func (s *Session) Set(w http.ResponseWriter, r *http.Request, name string, val i
 //	error: 错误信息
 func (s *Session) Delete(w http.ResponseWriter, r *http.Request, name string) (err error) {
 	// Get a session.
-	session, err := s.store.Get(r, sessionName)
+	session, err := s.store.Get(r, s.name)
 	if err != nil {
 		return
 	}
@@ -122,3 +216,75 @@ func (s *Session) Delete(w http.ResponseWriter, r *http.Request, name string) (e
 
 	return session.Save(r, w)
 }
+
+// Clear 清空 session 中的全部值,删除服务端会话并使 Cookie 过期
+//
+// 参数:
+//
+//	w http.ResponseWriter: 响应对象
+//	r *http.Request: 请求对象
+//
+// 返回值:
+//
+//	error: 错误信息
+func (s *Session) Clear(w http.ResponseWriter, r *http.Request) (err error) {
+	// Get a session.
+	session, err := s.store.Get(r, s.name)
+	if err != nil {
+		return
+	}
+
+	for k := range session.Values {
+		delete(session.Values, k)
+	}
+	session.Options.MaxAge = -1
+
+	if err = session.Save(r, w); err != nil {
+		return
+	}
+
+	// 同一请求内之后的写入使用新的会话
+	session.ID = ""
+	session.Options.MaxAge = int(s.store.maxAge.Seconds())
+
+	return
+}
+
+// Regenerate 更换会话ID并保留会话中的值,旧会话ID随即失效
+// 登录成功后调用,防止会话固定攻击
+//
+// 参数:
+//
+//	w http.ResponseWriter: 响应对象
+//	r *http.Request: 请求对象
+//
+// 返回值:
+//
+//	error: 错误信息
+func (s *Session) Regenerate(w http.ResponseWriter, r *http.Request) (err error) {
+	// Get a session.
+	session, err := s.store.Get(r, s.name)
+	if err != nil {
+		return
+	}
+
+	if session.ID != "" {
+		if err = s.store.backend.Delete(r.Context(), session.ID); err != nil {
+			return
+		}
+	}
+	session.ID = ""
+
+	return session.Save(r, w)
+}
+
+// NewSID 生成登录会话ID
+//
+// 返回值:
+//
+//	string: 128 位随机值的 base64url 编码
+func NewSID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
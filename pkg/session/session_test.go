@@ -0,0 +1,91 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// newTestSession 创建使用内存存储与固定签名密钥的会话
+func newTestSession(t *testing.T) *Session {
+	t.Helper()
+
+	s, err := NewSession(Options{HashKeys: [][]byte{[]byte("0123456789abcdef0123456789abcdef")}}, NewMemoryBackend(), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// request 创建携带会话 Cookie 的请求,cookie 为空时不携带
+func request(cookie *http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+// sessionCookie 响应中设置的会话 Cookie
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionName {
+			return c
+		}
+	}
+	t.Fatal("no session cookie set")
+	return nil
+}
+
+func TestRegenerateChangesSessionID(t *testing.T) {
+
+	s := newTestSession(t)
+
+	// 登录前的会话中保存了授权请求
+	w := httptest.NewRecorder()
+	if err := s.Set(w, request(nil), AuthorizeFormKey, "client_id=c1"); err != nil {
+		t.Fatal(err)
+	}
+	before := sessionCookie(t, w)
+
+	// 登录成功后更换会话ID
+	w = httptest.NewRecorder()
+	if err := s.Regenerate(w, request(before)); err != nil {
+		t.Fatal(err)
+	}
+	after := sessionCookie(t, w)
+	if after.Value == before.Value {
+		t.Fatal("session id not regenerated")
+	}
+
+	// 新会话保留登录前的值
+	v, err := s.Get(request(after), AuthorizeFormKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "client_id=c1" {
+		t.Fatalf("value after regenerate = %v", v)
+	}
+
+	// 攻击者预先植入的旧会话ID随即失效
+	v, err = s.Get(request(before), AuthorizeFormKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		t.Fatalf("old session id still resolves: %v", v)
+	}
+}
+
+func TestNewSessionRejectsShortKey(t *testing.T) {
+
+	_, err := NewSession(Options{HashKeys: [][]byte{[]byte("short")}}, NewMemoryBackend(), zap.NewNop())
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("short hash key: %v, want %v", err, ErrInvalidKey)
+	}
+}
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// serverStore 服务端会话存储
+// Cookie 中只保存签名(配置加密密钥时同时加密)的会话ID,会话数据保存在 Backend 中
+type serverStore struct {
+	codecs  []securecookie.Codec
+	options sessions.Options
+	maxAge  time.Duration
+	backend Backend
+}
+
+// Get 获取会话,同一请求内多次获取返回同一对象
+func (s *serverStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New 读取 Cookie 中的会话ID并加载会话数据
+// Cookie 缺失、签名无效或会话已过期时返回新会话
+func (s *serverStore) New(r *http.Request, name string) (*sessions.Session, error) {
+
+	session := sessions.NewSession(s, name)
+	opts := s.options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &id, s.codecs...); err != nil {
+		return session, nil
+	}
+
+	data, err := s.backend.Load(r.Context(), id)
+	if err != nil || data == nil {
+		return session, err
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Save 保存会话数据并写入 Cookie
+// MaxAge 小于 0 时删除会话并使 Cookie 过期;会话ID为空时生成新的会话ID
+func (s *serverStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.backend.Delete(r.Context(), session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = newSessionID()
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return err
+	}
+	if err := s.backend.Save(r.Context(), session.ID, buf.Bytes(), s.maxAge); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+
+	return nil
+}
+
+// newSessionID 生成会话ID
+//
+// 返回值:
+//
+//	string: 256 位随机值的 base64url 编码
+func newSessionID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
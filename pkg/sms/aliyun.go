@@ -0,0 +1,151 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AliyunOptions 阿里云短信发送配置
+type AliyunOptions struct {
+	AccessKeyID     string            // AccessKey ID
+	AccessKeySecret string            // AccessKey Secret
+	SignName        string            // 短信签名
+	Templates       map[string]string // 模板到阿里云模板 CODE 的映射
+	RegionID        string            // 地域,默认 cn-hangzhou
+	Endpoint        string            // 接口地址,默认 https://dysmsapi.aliyuncs.com/
+	Timeout         time.Duration     // 请求超时
+}
+
+// AliyunSender 通过阿里云短信服务(dysmsapi 2017-05-25 SendSms)发送短信
+type AliyunSender struct {
+	opts   AliyunOptions
+	client *http.Client
+}
+
+// NewAliyunSender 创建阿里云短信发送者
+//
+// 参数:
+//
+//	opts: 阿里云短信发送配置
+//
+// 返回值:
+//
+//	Sender: 短信发送者
+func NewAliyunSender(opts AliyunOptions) Sender {
+	if opts.RegionID == "" {
+		opts.RegionID = "cn-hangzhou"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://dysmsapi.aliyuncs.com/"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second * 10
+	}
+	return &AliyunSender{opts: opts, client: &http.Client{Timeout: opts.Timeout}}
+}
+
+// Send 发送短信
+func (s *AliyunSender) Send(ctx context.Context, msg *Message) error {
+
+	code, ok := s.opts.Templates[msg.Template]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTemplateNotConfigured, msg.Template)
+	}
+
+	params, err := json.Marshal(msg.Params)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	q.Set("AccessKeyId", s.opts.AccessKeyID)
+	q.Set("Action", "SendSms")
+	q.Set("Format", "JSON")
+	q.Set("RegionId", s.opts.RegionID)
+	q.Set("SignatureMethod", "HMAC-SHA1")
+	q.Set("SignatureNonce", hex.EncodeToString(nonce))
+	q.Set("SignatureVersion", "1.0")
+	q.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	q.Set("Version", "2017-05-25")
+	q.Set("PhoneNumbers", aliyunPhone(msg.To))
+	q.Set("SignName", s.opts.SignName)
+	q.Set("TemplateCode", code)
+	q.Set("TemplateParam", string(params))
+	q.Set("Signature", aliyunSign(http.MethodPost, q, s.opts.AccessKeySecret))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.Endpoint, strings.NewReader(q.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code      string `json:"Code"`
+		Message   string `json:"Message"`
+		RequestID string `json:"RequestId"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("aliyun sms: status %d: %w", resp.StatusCode, err)
+	}
+	if result.Code != "OK" {
+		return fmt.Errorf("aliyun sms: %s: %s (request %s)", result.Code, result.Message, result.RequestID)
+	}
+
+	return nil
+}
+
+// aliyunSign 计算 RPC 风格接口的签名(HMAC-SHA1),参数按名称排序后编码
+func aliyunSign(method string, q url.Values, secret string) string {
+
+	keys := slices.Sorted(maps.Keys(q))
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, aliyunEscape(k)+"="+aliyunEscape(q.Get(k)))
+	}
+
+	stringToSign := method + "&" + aliyunEscape("/") + "&" + aliyunEscape(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// aliyunEscape 按阿里云签名要求编码:空格为 %20,* 为 %2A,~ 不编码
+func aliyunEscape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+// aliyunPhone 阿里云国内短信的手机号不带国家码,国际短信为不带 + 的国家码加号码
+func aliyunPhone(to string) string {
+	if n, ok := strings.CutPrefix(to, "+86"); ok {
+		return n
+	}
+	return strings.TrimPrefix(to, "+")
+}
@@ -0,0 +1,73 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// 短信模板,由各短信服务商的配置映射为服务商的模板ID
+const (
+	TemplateVerify = "verify" // 手机号验证码,参数 code
+	TemplateLogin  = "login"  // 短信登录验证码,参数 code
+)
+
+// TemplateParams 各模板的参数及顺序,按位置传参的服务商(如腾讯云)依此顺序填充
+var TemplateParams = map[string][]string{
+	TemplateVerify: {"code"},
+	TemplateLogin:  {"code"},
+}
+
+// ErrTemplateNotConfigured 未配置模板对应的服务商模板ID
+var ErrTemplateNotConfigured = errors.New("sms template is not configured")
+
+// Message 短信
+// 国内短信服务商只能发送已审核的模板,因此以模板与参数而不是正文描述短信
+type Message struct {
+	To       string            // 手机号,E.164 格式
+	Template string            // 模板
+	Params   map[string]string // 模板参数
+}
+
+// Sender 短信发送者
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// MemorySender 把短信保存在内存中并写入日志,不实际发送
+// 日志中包含验证码,只能用于测试与本地联调
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []*Message
+	*zap.Logger
+}
+
+// NewMemorySender 创建内存短信发送者
+func NewMemorySender(logger *zap.Logger) *MemorySender {
+	return &MemorySender{Logger: logger}
+}
+
+// Send 保存短信
+func (s *MemorySender) Send(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *msg
+	cp.Params = maps.Clone(msg.Params)
+	s.messages = append(s.messages, &cp)
+
+	s.Info("sms captured", zap.String("to", msg.To), zap.String("template", msg.Template), zap.Any("params", msg.Params))
+	return nil
+}
+
+// Messages 已保存的短信
+func (s *MemorySender) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.messages)
+}
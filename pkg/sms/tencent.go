@@ -0,0 +1,166 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// TencentOptions 腾讯云短信发送配置
+type TencentOptions struct {
+	SecretID  string            // SecretId
+	SecretKey string            // SecretKey
+	SDKAppID  string            // 短信应用 SdkAppId
+	SignName  string            // 短信签名
+	Templates map[string]string // 模板到腾讯云模板ID的映射
+	Region    string            // 地域,默认 ap-guangzhou
+	Endpoint  string            // 接口地址,默认 https://sms.tencentcloudapi.com/
+	Timeout   time.Duration     // 请求超时
+}
+
+// TencentSender 通过腾讯云短信服务(2021-01-11 SendSms)发送短信
+type TencentSender struct {
+	opts   TencentOptions
+	client *http.Client
+}
+
+// NewTencentSender 创建腾讯云短信发送者
+//
+// 参数:
+//
+//	opts: 腾讯云短信发送配置
+//
+// 返回值:
+//
+//	Sender: 短信发送者
+func NewTencentSender(opts TencentOptions) Sender {
+	if opts.Region == "" {
+		opts.Region = "ap-guangzhou"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://sms.tencentcloudapi.com/"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second * 10
+	}
+	return &TencentSender{opts: opts, client: &http.Client{Timeout: opts.Timeout}}
+}
+
+// Send 发送短信,腾讯云模板参数按位置传递,顺序见 TemplateParams
+func (s *TencentSender) Send(ctx context.Context, msg *Message) error {
+
+	id, ok := s.opts.Templates[msg.Template]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTemplateNotConfigured, msg.Template)
+	}
+
+	params := make([]string, 0, len(TemplateParams[msg.Template]))
+	for _, name := range TemplateParams[msg.Template] {
+		params = append(params, msg.Params[name])
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"PhoneNumberSet":   []string{msg.To},
+		"SmsSdkAppId":      s.opts.SDKAppID,
+		"SignName":         s.opts.SignName,
+		"TemplateId":       id,
+		"TemplateParamSet": params,
+	})
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(s.opts.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-TC-Action", "SendSms")
+	req.Header.Set("X-TC-Version", "2021-01-11")
+	req.Header.Set("X-TC-Region", s.opts.Region)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("Authorization", tencentAuthorization(s.opts.SecretID, s.opts.SecretKey, u.Host, payload, now))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Response struct {
+			Error *struct {
+				Code    string `json:"Code"`
+				Message string `json:"Message"`
+			} `json:"Error"`
+			SendStatusSet []struct {
+				Code    string `json:"Code"`
+				Message string `json:"Message"`
+			} `json:"SendStatusSet"`
+			RequestID string `json:"RequestId"`
+		} `json:"Response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("tencent sms: status %d: %w", resp.StatusCode, err)
+	}
+
+	r := result.Response
+	if r.Error != nil {
+		return fmt.Errorf("tencent sms: %s: %s (request %s)", r.Error.Code, r.Error.Message, r.RequestID)
+	}
+	// 接口调用成功时仍须检查每个号码的发送状态
+	for _, st := range r.SendStatusSet {
+		if st.Code != "Ok" {
+			return fmt.Errorf("tencent sms: %s: %s (request %s)", st.Code, st.Message, r.RequestID)
+		}
+	}
+
+	return nil
+}
+
+// tencentAuthorization 计算 TC3-HMAC-SHA256 签名,签名头为 content-type 与 host
+func tencentAuthorization(secretID, secretKey, host string, payload []byte, now time.Time) string {
+
+	const service = "sms"
+
+	canonical := "POST\n/\n\n" +
+		"content-type:application/json; charset=utf-8\nhost:" + host + "\n\n" +
+		"content-type;host\n" + sha256Hex(payload)
+
+	date := now.Format("2006-01-02")
+	scope := date + "/" + service + "/tc3_request"
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(now.Unix(), 10) + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("TC3"+secretKey), date)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return "TC3-HMAC-SHA256 Credential=" + secretID + "/" + scope + ", SignedHeaders=content-type;host, Signature=" + signature
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
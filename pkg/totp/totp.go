@@ -0,0 +1,139 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 与主流认证器应用(Google Authenticator、Microsoft Authenticator 等)兼容的参数
+const (
+	Digits = 6                // 验证码位数
+	Period = 30 * time.Second // 时间步长
+)
+
+// secretEncoding 密钥的 base32 编码,不带填充
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret 生成 160 位随机密钥(RFC 4226 推荐长度)
+//
+// 返回值:
+//
+//	string: base32 编码的密钥,可直接由用户手动输入到认证器应用
+//	error: 错误信息
+func GenerateSecret() (string, error) {
+
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return secretEncoding.EncodeToString(b), nil
+}
+
+// URI 生成认证器应用扫码绑定使用的 otpauth URI
+//
+// 参数:
+//
+//	issuer: 服务名称,显示在认证器应用中
+//	account: 账号名称,显示在认证器应用中
+//	secret: base32 编码的密钥
+//
+// 返回值:
+//
+//	string: otpauth://totp/<issuer>:<account>?secret=...&issuer=...
+func URI(issuer, account, secret string) string {
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+
+	return u.String()
+}
+
+// Validate 校验验证码
+//
+// 允许前后 skew 个时间步长的时钟偏差;返回匹配的时间步,调用方应记录已使用的时间步,
+// 拒绝不大于该值的验证码,防止同一验证码被重复使用
+//
+// 参数:
+//
+//	secret: base32 编码的密钥
+//	code: 用户输入的验证码
+//	now: 当前时间
+//	skew: 允许偏差的时间步数
+//
+// 返回值:
+//
+//	int64: 匹配的时间步
+//	bool: 验证码是否正确
+func Validate(secret, code string, now time.Time, skew int) (int64, bool) {
+
+	key, err := secretEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	step := now.Unix() / int64(Period/time.Second)
+	for i := -skew; i <= skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(generate(key, step+int64(i))), []byte(code)) == 1 {
+			return step + int64(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// Generate 计算指定时间的验证码,与认证器应用显示的一致
+//
+// 参数:
+//
+//	secret: base32 编码的密钥
+//	now: 时间
+//
+// 返回值:
+//
+//	string: 验证码
+//	error: 错误信息
+func Generate(secret string, now time.Time) (string, error) {
+
+	key, err := secretEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", err
+	}
+
+	return generate(key, now.Unix()/int64(Period/time.Second)), nil
+}
+
+// generate 计算指定时间步的验证码(RFC 4226 HOTP)
+func generate(key []byte, step int64) string {
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
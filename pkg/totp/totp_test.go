@@ -0,0 +1,125 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录 B 中 SHA1 的密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestRFC6238Vectors RFC 6238 附录 B 的测试向量,验证码为 8 位结果的后 6 位
+func TestRFC6238Vectors(t *testing.T) {
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+
+		code, err := Generate(rfcSecret, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Fatalf("Generate(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+
+		step, ok := Validate(rfcSecret, tt.code, now, 0)
+		if !ok || step != tt.unix/30 {
+			t.Fatalf("Validate(%d) = %d, %v, want %d, true", tt.unix, step, ok, tt.unix/30)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / 30
+
+	code := func(offset int64) string {
+		c, err := Generate(rfcSecret, now.Add(time.Duration(offset)*Period))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		skew   int
+		ok     bool
+	}{
+		{"current step", 0, 0, true},
+		{"previous step without skew", -1, 0, false},
+		{"previous step within skew", -1, 1, true},
+		{"next step within skew", 1, 1, true},
+		{"two steps behind skew 1", -2, 1, false},
+		{"two steps ahead skew 1", 2, 1, false},
+		{"two steps behind skew 2", -2, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(rfcSecret, code(tt.offset), now, tt.skew)
+			if ok != tt.ok {
+				t.Fatalf("Validate = %v, want %v", ok, tt.ok)
+			}
+			// 返回匹配的时间步而不是当前时间步,调用方据此拒绝重复使用
+			if ok && got != step+tt.offset {
+				t.Fatalf("step = %d, want %d", got, step+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+
+	now := time.Unix(59, 0)
+
+	for _, tt := range []struct{ name, secret, code string }{
+		{"short code", rfcSecret, "28708"},
+		{"long code", rfcSecret, "94287082"},
+		{"invalid secret", "not base32!", "287082"},
+	} {
+		if _, ok := Validate(tt.secret, tt.code, now, 1); ok {
+			t.Fatalf("%s: Validate = true", tt.name)
+		}
+	}
+
+	// 密钥不区分大小写并忽略首尾空白,便于用户手动输入
+	if _, ok := Validate(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", "287082", now, 0); !ok {
+		t.Fatal("Validate rejected lowercase secret")
+	}
+}
+
+func TestURI(t *testing.T) {
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(URI("xiaohangshu", "alice", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/xiaohangshu:alice" {
+		t.Fatalf("unexpected uri: %s", u)
+	}
+	if q.Get("secret") != secret || q.Get("issuer") != "xiaohangshu" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Fatalf("unexpected query: %v", q)
+	}
+}
@@ -16,6 +16,198 @@ export const accountApi = createApi({
                 body,
             }),
         }),
+        loginMfa: builder.mutation<ResponseData, { code: string }>({
+            query: (body) => ({
+                url: "v1/user/login/mfa",
+                method: 'POST',
+                body,
+            }),
+        }),
+        loginRecovery: builder.mutation<ResponseData, { code: string }>({
+            query: (body) => ({
+                url: "v1/user/login/recovery",
+                method: 'POST',
+                body,
+            }),
+        }),
+        beginWebAuthnLogin: builder.mutation<ResponseData, void>({
+            query: () => ({
+                url: "v1/user/login/webauthn/options",
+                method: 'POST',
+            }),
+        }),
+        finishWebAuthnLogin: builder.mutation<ResponseData, { credential: any }>({
+            query: (body) => ({
+                url: "v1/user/login/webauthn",
+                method: 'POST',
+                body,
+            }),
+        }),
+        sendSmsLoginCode: builder.mutation<ResponseData, { phone: string }>({
+            query: (body) => ({
+                url: "v1/user/login/sms/code",
+                method: 'POST',
+                body,
+            }),
+        }),
+        loginSms: builder.mutation<ResponseData, { phone: string, code: string }>({
+            query: (body) => ({
+                url: "v1/user/login/sms",
+                method: 'POST',
+                body,
+            }),
+        }),
+        register: builder.mutation<ResponseData, { username: string, password: string, email?: string, phone?: string, nickname?: string, invite_code?: string }>({
+            query: (body) => ({
+                url: "v1/user/register",
+                method: 'POST',
+                body,
+            }),
+        }),
+        forgotPassword: builder.mutation<ResponseData, { account: string }>({
+            query: (body) => ({
+                url: "v1/user/password/forgot",
+                method: 'POST',
+                body,
+            }),
+        }),
+        resetPassword: builder.mutation<ResponseData, { token: string, password: string }>({
+            query: (body) => ({
+                url: "v1/user/password/reset",
+                method: 'POST',
+                body,
+            }),
+        }),
+        getVerification: builder.query<ResponseData, void>({
+            query: () => "v1/user/verification",
+        }),
+        sendEmailVerification: builder.mutation<ResponseData, void>({
+            query: () => ({
+                url: "v1/user/verification/email",
+                method: 'POST',
+            }),
+        }),
+        confirmEmailVerification: builder.mutation<ResponseData, { token: string }>({
+            query: (body) => ({
+                url: "v1/user/verification/email/confirm",
+                method: 'POST',
+                body,
+            }),
+        }),
+        sendPhoneVerification: builder.mutation<ResponseData, void>({
+            query: () => ({
+                url: "v1/user/verification/phone",
+                method: 'POST',
+            }),
+        }),
+        confirmPhoneVerification: builder.mutation<ResponseData, { code: string }>({
+            query: (body) => ({
+                url: "v1/user/verification/phone/confirm",
+                method: 'POST',
+                body,
+            }),
+        }),
+        getMfa: builder.query<ResponseData, void>({
+            query: () => "v1/user/mfa",
+        }),
+        verifyMfa: builder.mutation<ResponseData, { code: string }>({
+            query: (body) => ({
+                url: "v1/user/mfa/verify",
+                method: 'POST',
+                body,
+            }),
+        }),
+        beginTotp: builder.mutation<ResponseData, void>({
+            query: () => ({
+                url: "v1/user/mfa/totp",
+                method: 'POST',
+            }),
+        }),
+        confirmTotp: builder.mutation<ResponseData, { code: string }>({
+            query: (body) => ({
+                url: "v1/user/mfa/totp/confirm",
+                method: 'POST',
+                body,
+            }),
+        }),
+        disableTotp: builder.mutation<ResponseData, { code: string }>({
+            query: (body) => ({
+                url: "v1/user/mfa/totp",
+                method: 'DELETE',
+                body,
+            }),
+        }),
+        verifyRecovery: builder.mutation<ResponseData, { code: string }>({
+            query: (body) => ({
+                url: "v1/user/mfa/recovery",
+                method: 'POST',
+                body,
+            }),
+        }),
+        generateRecoveryCodes: builder.mutation<ResponseData, void>({
+            query: () => ({
+                url: "v1/user/mfa/recovery-codes",
+                method: 'POST',
+            }),
+        }),
+        getMfaFactors: builder.query<ResponseData, void>({
+            query: () => "v1/user/mfa/factors",
+        }),
+        renameMfaFactor: builder.mutation<ResponseData, { id: string, name: string }>({
+            query: ({id, name}) => ({
+                url: `v1/user/mfa/factors/${id}`,
+                method: 'PATCH',
+                body: {name},
+            }),
+        }),
+        removeMfaFactor: builder.mutation<ResponseData, { id: string }>({
+            query: ({id}) => ({
+                url: `v1/user/mfa/factors/${id}`,
+                method: 'DELETE',
+            }),
+        }),
+        beginWebAuthnStepUp: builder.mutation<ResponseData, void>({
+            query: () => ({
+                url: "v1/user/mfa/webauthn/options",
+                method: 'POST',
+            }),
+        }),
+        finishWebAuthnStepUp: builder.mutation<ResponseData, { credential: any }>({
+            query: (body) => ({
+                url: "v1/user/mfa/webauthn",
+                method: 'POST',
+                body,
+            }),
+        }),
+        getWebAuthnCredentials: builder.query<ResponseData, void>({
+            query: () => "v1/user/webauthn/credentials",
+        }),
+        beginWebAuthnRegistration: builder.mutation<ResponseData, void>({
+            query: () => ({
+                url: "v1/user/webauthn/credentials/options",
+                method: 'POST',
+            }),
+        }),
+        finishWebAuthnRegistration: builder.mutation<ResponseData, { name?: string, credential: any }>({
+            query: (body) => ({
+                url: "v1/user/webauthn/credentials",
+                method: 'POST',
+                body,
+            }),
+        }),
+        renameWebAuthnCredential: builder.mutation<ResponseData, { id: string, name: string }>({
+            query: ({id, name}) => ({
+                url: `v1/user/webauthn/credentials/${id}`,
+                method: 'PATCH',
+                body: {name},
+            }),
+        }),
+        deleteWebAuthnCredential: builder.mutation<ResponseData, { id: string }>({
+            query: ({id}) => ({
+                url: `v1/user/webauthn/credentials/${id}`,
+                method: 'DELETE',
+            }),
+        }),
         getAccountById: builder.query<ResponseData,void>({
             query: (n) => `account/1`,
         }),
@@ -27,4 +219,4 @@ export const accountApi = createApi({
 })
 
 // Export hooks for usage in functional components
-export const {useLoginMutation, useGetAccountByIdQuery, useGetAccountPermissionsQuery} = accountApi
+export const {useLoginMutation, useLoginMfaMutation, useLoginRecoveryMutation, useBeginWebAuthnLoginMutation, useFinishWebAuthnLoginMutation, useSendSmsLoginCodeMutation, useLoginSmsMutation, useRegisterMutation, useForgotPasswordMutation, useResetPasswordMutation, useGetVerificationQuery, useSendEmailVerificationMutation, useConfirmEmailVerificationMutation, useSendPhoneVerificationMutation, useConfirmPhoneVerificationMutation, useGetMfaQuery, useVerifyMfaMutation, useBeginTotpMutation, useConfirmTotpMutation, useDisableTotpMutation, useVerifyRecoveryMutation, useGenerateRecoveryCodesMutation, useGetMfaFactorsQuery, useRenameMfaFactorMutation, useRemoveMfaFactorMutation, useBeginWebAuthnStepUpMutation, useFinishWebAuthnStepUpMutation, useGetWebAuthnCredentialsQuery, useBeginWebAuthnRegistrationMutation, useFinishWebAuthnRegistrationMutation, useRenameWebAuthnCredentialMutation, useDeleteWebAuthnCredentialMutation, useGetAccountByIdQuery, useGetAccountPermissionsQuery} = accountApi
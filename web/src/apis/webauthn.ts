@@ -0,0 +1,75 @@
+// WebAuthn 选项与凭据中的二进制字段以 base64url 编码传输,调用浏览器 API 前后须转换
+
+const toBuffer = (value: string): ArrayBuffer => {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/').padEnd(Math.ceil(value.length / 4) * 4, '=');
+    const binary = atob(base64);
+    const bytes = new Uint8Array(binary.length);
+    for (let i = 0; i < binary.length; i++) {
+        bytes[i] = binary.charCodeAt(i);
+    }
+    return bytes.buffer;
+}
+
+const toBase64url = (buffer: ArrayBuffer | null): string | undefined => {
+    if (!buffer) {
+        return undefined;
+    }
+    let binary = '';
+    new Uint8Array(buffer).forEach(b => binary += String.fromCharCode(b));
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+// webAuthnSupported 当前浏览器是否支持 WebAuthn
+export const webAuthnSupported = () => typeof window !== 'undefined' && !!window.PublicKeyCredential;
+
+// createCredential 按服务端返回的注册选项创建凭据,返回可直接提交的 JSON
+export const createCredential = async (options: any) => {
+    const publicKey = options.publicKey;
+    const credential = await navigator.credentials.create({
+        publicKey: {
+            ...publicKey,
+            challenge: toBuffer(publicKey.challenge),
+            user: {...publicKey.user, id: toBuffer(publicKey.user.id)},
+            excludeCredentials: (publicKey.excludeCredentials ?? []).map((c: any) => ({...c, id: toBuffer(c.id)})),
+        }
+    }) as PublicKeyCredential;
+
+    const response = credential.response as AuthenticatorAttestationResponse;
+    return {
+        id: credential.id,
+        rawId: toBase64url(credential.rawId),
+        type: credential.type,
+        response: {
+            clientDataJSON: toBase64url(response.clientDataJSON),
+            attestationObject: toBase64url(response.attestationObject),
+            transports: response.getTransports?.() ?? [],
+        },
+        clientExtensionResults: credential.getClientExtensionResults(),
+    };
+}
+
+// getCredential 按服务端返回的登录选项获取断言,返回可直接提交的 JSON
+export const getCredential = async (options: any) => {
+    const publicKey = options.publicKey;
+    const credential = await navigator.credentials.get({
+        publicKey: {
+            ...publicKey,
+            challenge: toBuffer(publicKey.challenge),
+            allowCredentials: (publicKey.allowCredentials ?? []).map((c: any) => ({...c, id: toBuffer(c.id)})),
+        }
+    }) as PublicKeyCredential;
+
+    const response = credential.response as AuthenticatorAssertionResponse;
+    return {
+        id: credential.id,
+        rawId: toBase64url(credential.rawId),
+        type: credential.type,
+        response: {
+            clientDataJSON: toBase64url(response.clientDataJSON),
+            authenticatorData: toBase64url(response.authenticatorData),
+            signature: toBase64url(response.signature),
+            userHandle: toBase64url(response.userHandle),
+        },
+        clientExtensionResults: credential.getClientExtensionResults(),
+    };
+}
@@ -0,0 +1,77 @@
+import React, {useState} from "react";
+import {App as AntdApp, Button, Form, Input, Result} from "antd";
+import styles from "../Login/login.module.scss";
+import {useNavigate} from "react-router-dom";
+import {useForgotPasswordMutation} from "../../apis/accountApi";
+import {UserOutlined} from "@ant-design/icons";
+
+const ForgotPassword: React.FC = () => {
+
+    const navigate = useNavigate();
+
+    const [sent, setSent] = useState(false);
+    const [forgotFn, {isLoading}] = useForgotPasswordMutation();
+    const {notification} = AntdApp.useApp();
+    const handlerSubmit = async (values: any) => {
+        forgotFn({
+            account: values.account,
+        }).unwrap().then(() => {
+            setSent(true)
+        }).catch(err => {
+            notification.error({
+                description: err?.status == 429 ? "请求过于频繁，请稍后再试" : (err?.data?.message ?? "发送失败"),
+                message: '出错了'
+            });
+        })
+    };
+
+    if (sent) {
+        return (
+            <div className={styles.container}>
+                <Result
+                    status="success"
+                    title="请查收邮件"
+                    subTitle="如果该账号存在并绑定了邮箱，我们已发送重置密码链接，请在 30 分钟内完成重置。"
+                    extra={<Button type="primary" onClick={() => navigate("/login")}>返回登录</Button>}
+                />
+            </div>
+        )
+    }
+
+    return (
+        <div className={styles.container}>
+
+            <Form
+                name="forgot-password"
+                onFinish={handlerSubmit}
+                style={{
+                    width: "400px",
+                    marginTop: "10%",
+                    marginBottom: "auto",
+                    background: "#fff",
+                    padding: 50,
+                    borderRadius: "6px"
+                }}
+            >
+
+                <h1 style={{marginBottom: '30px'}}>找回密码</h1>
+
+                <Form.Item
+                    name="account"
+                    rules={[{required: true, message: '账号不能为空'}]}
+                    extra="用户名、邮箱或手机号，重置链接将发送到账号绑定的邮箱"
+                >
+                    <Input prefix={<UserOutlined/>} placeholder="账号"/>
+                </Form.Item>
+
+                <Form.Item>
+                    <Button type="primary" htmlType="submit" block loading={isLoading}>
+                        发送重置链接
+                    </Button>
+                    <Button type={"link"} onClick={() => navigate("/login")}>返回登录</Button>
+                </Form.Item>
+            </Form>
+        </div>
+    )
+}
+export default ForgotPassword;
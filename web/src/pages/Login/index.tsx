@@ -1,11 +1,20 @@
-import React from "react";
+import React, {useEffect, useState} from "react";
 import {App as AntdApp, Button, Checkbox, Form, Input} from "antd";
 import styles from "./login.module.scss";
 import {useDispatch} from "react-redux";
 import {login} from "../../store/slices/authSlice";
 import {useNavigate} from "react-router-dom";
-import {useLoginMutation} from "../../apis/accountApi";
-import {LockOutlined, UserOutlined} from "@ant-design/icons";
+import {
+    useBeginWebAuthnLoginMutation,
+    useFinishWebAuthnLoginMutation,
+    useLoginMfaMutation,
+    useLoginMutation,
+    useLoginRecoveryMutation,
+    useLoginSmsMutation,
+    useSendSmsLoginCodeMutation
+} from "../../apis/accountApi";
+import {getCredential, webAuthnSupported} from "../../apis/webauthn";
+import {KeyOutlined, LockOutlined, MobileOutlined, SafetyOutlined, UserOutlined} from "@ant-design/icons";
 
 const Login: React.FC = () => {
 
@@ -14,16 +23,129 @@ const Login: React.FC = () => {
 
     const [form] = Form.useForm();
     const [loginFn, {isLoading}] = useLoginMutation();
-    const {message, notification, modal} = AntdApp.useApp();
+    const [loginMfaFn, {isLoading: verifying}] = useLoginMfaMutation();
+    const [loginRecoveryFn, {isLoading: recovering}] = useLoginRecoveryMutation();
+    const [beginWebAuthnFn] = useBeginWebAuthnLoginMutation();
+    const [finishWebAuthnFn] = useFinishWebAuthnLoginMutation();
+    const [sendSmsCodeFn, {isLoading: sending}] = useSendSmsLoginCodeMutation();
+    const [loginSmsFn, {isLoading: smsLoading}] = useLoginSmsMutation();
+    const [passkeyLoading, setPasskeyLoading] = useState(false);
+    const {message, notification} = AntdApp.useApp();
+
+    // 已绑定认证器应用或安全密钥的账号,密码正确后还须完成第二步验证
+    const [mfaRequired, setMfaRequired] = useState(false);
+    const [methods, setMethods] = useState<string[]>([]);
+    // 丢失认证器应用或安全密钥时使用恢复码
+    const [useRecovery, setUseRecovery] = useState(false);
+
+    // 短信验证码登录,发送后须等待一段时间才能重新发送
+    const [smsMode, setSmsMode] = useState(false);
+    const [smsForm] = Form.useForm();
+    const [countdown, setCountdown] = useState(0);
+
+    useEffect(() => {
+        if (countdown <= 0) {
+            return
+        }
+        const timer = setTimeout(() => setCountdown(countdown - 1), 1000)
+        return () => clearTimeout(timer)
+    }, [countdown]);
+
+    // 使用通行密钥或安全密钥登录,未输入密码时为免密码登录,否则为密码登录的第二步
+    const handlerWebAuthn = async () => {
+        setPasskeyLoading(true)
+        try {
+            const options = await beginWebAuthnFn().unwrap()
+            const credential = await getCredential(options.data)
+            await finishWebAuthnFn({credential}).unwrap()
+            message.success("登录成功")
+            window.location.href="http://localhost:8090/connect/authorize"
+        } catch (err: any) {
+            // 用户取消或超时
+            if (err?.name === "NotAllowedError") {
+                return
+            }
+            notification.error({
+                description: err?.data?.message ?? "验证失败",
+                message: '出错了'
+            });
+            if (err?.status === 401 && mfaRequired) {
+                setMfaRequired(false)
+            }
+        } finally {
+            setPasskeyLoading(false)
+        }
+    };
+
+    const handlerMfaSubmit = async (values: any) => {
+        const submit = useRecovery ? loginRecoveryFn : loginMfaFn;
+        submit({code: values.code}).unwrap().then(() => {
+            message.success("登录成功")
+            window.location.href="http://localhost:8090/connect/authorize"
+        }).catch(err => {
+            notification.error({
+                description: err?.data?.message ?? "验证失败",
+                message: '出错了'
+            });
+            // 待验证状态过期后须重新输入密码
+            if (err?.status === 401) {
+                setMfaRequired(false)
+            }
+        })
+    };
+
+    // 第一步(密码或短信验证码)通过后,已绑定两步验证的账号进入第二步
+    const handlerFirstFactor = (data: any) => {
+        if (data.code == 0 && data.data?.mfa_required) {
+            setMethods(data.data.methods ?? [])
+            setUseRecovery(false)
+            setMfaRequired(true)
+            return true
+        }
+        if (data.code == 0) {
+            message.success("登录成功")
+            window.location.href="http://localhost:8090/connect/authorize"
+            return true
+        }
+        return false
+    };
+
+    const handlerSendSmsCode = async () => {
+        const {phone} = await smsForm.validateFields(["phone"])
+        sendSmsCodeFn({phone}).unwrap().then(() => {
+            message.success("验证码已发送")
+            setCountdown(60)
+        }).catch(err => {
+            notification.error({
+                description: err?.status === 429 ? "发送过于频繁，请稍后再试" : err?.data?.message ?? "发送失败",
+                message: '出错了'
+            });
+        })
+    };
+
+    const handlerSmsSubmit = async (values: any) => {
+        loginSmsFn({phone: values.phone, code: values.code}).unwrap().then(data => {
+            if (!handlerFirstFactor(data)) {
+                notification.error({
+                    description: data.message,
+                    message: '出错了'
+                });
+            }
+        }).catch(err => {
+            notification.error({
+                description: err?.data?.message ?? "登录失败",
+                message: '出错了'
+            });
+            smsForm.resetFields(["code"])
+        })
+    };
+
     const handlerSubmit = async (values: any) => {
         loginFn({
             account: values.username,
             password: values.password
         }).unwrap().then(data => {
-            if (data.code == 0) {
-                message.success("登录成功")
-                window.location.href="http://localhost:8090/connect/authorize"
-            } else {
+            if (!handlerFirstFactor(data)) {
                 notification.error({
                     description: data.message,
                     message: '出错了'
@@ -34,11 +156,106 @@ const Login: React.FC = () => {
         })
     };
 
-    const showModal = () => {
-        modal.success({
-            title: '诶呀',
-            content: '这个只是一个示例而已，需自己实现一下...',
-        })
+    if (mfaRequired) {
+        return (
+            <div className={styles.container}>
+                <Form
+                    name="login_mfa"
+                    onFinish={handlerMfaSubmit}
+                    style={{
+                        width: "400px",
+                        marginTop: "15%",
+                        marginBottom: "auto",
+                        background: "#fff",
+                        padding: 50,
+                        borderRadius: "6px"
+                    }}
+                >
+                    <h1 style={{marginBottom: '30px'}}>两步验证</h1>
+                    {methods.includes("webauthn") && (
+                        <Form.Item>
+                            <Button icon={<KeyOutlined/>} block loading={passkeyLoading} onClick={handlerWebAuthn}>
+                                使用安全密钥验证
+                            </Button>
+                        </Form.Item>
+                    )}
+                    {(methods.includes("totp") || useRecovery) && <>
+                        {useRecovery ? (
+                            <Form.Item
+                                name="code"
+                                rules={[{required: true, message: '请输入恢复码'}]}
+                                extra="每个恢复码只能使用一次"
+                            >
+                                <Input prefix={<SafetyOutlined/>} placeholder="恢复码，如 abcd-efgh-ijkl-mnop" autoComplete="off"/>
+                            </Form.Item>
+                        ) : (
+                            <Form.Item
+                                name="code"
+                                rules={[{required: true, message: '请输入一次性密码'}]}
+                                extra="请输入认证器应用中显示的 6 位数字"
+                            >
+                                <Input prefix={<SafetyOutlined/>} placeholder="一次性密码" maxLength={6} autoComplete="one-time-code"/>
+                            </Form.Item>
+                        )}
+                        <Form.Item>
+                            <Button type="primary" htmlType="submit" block loading={verifying || recovering}>
+                                验 证
+                            </Button>
+                        </Form.Item>
+                    </>}
+                    {methods.includes("recovery") && (
+                        <Button type={"link"} onClick={() => setUseRecovery(!useRecovery)}>
+                            {useRecovery ? "使用其他方式验证" : "无法验证？使用恢复码"}
+                        </Button>
+                    )}
+                    <Button type={"link"} onClick={() => setMfaRequired(false)}>返回</Button>
+                </Form>
+            </div>
+        )
+    }
+
+    if (smsMode) {
+        return (
+            <div className={styles.container}>
+                <Form
+                    form={smsForm}
+                    name="login_sms"
+                    onFinish={handlerSmsSubmit}
+                    style={{
+                        width: "400px",
+                        marginTop: "15%",
+                        marginBottom: "auto",
+                        background: "#fff",
+                        padding: 50,
+                        borderRadius: "6px"
+                    }}
+                >
+                    <h1 style={{marginBottom: '30px'}}>短信验证码登录</h1>
+                    <Form.Item
+                        name="phone"
+                        rules={[{required: true, message: '请输入手机号'}, {pattern: /^\+[1-9][0-9]{6,14}$/, message: '请输入带国家码的手机号'}]}
+                    >
+                        <Input prefix={<MobileOutlined/>} placeholder="手机号，如 +8613800000000" autoComplete="tel"/>
+                    </Form.Item>
+                    <Form.Item>
+                        <div style={{display: "flex", gap: 8}}>
+                            <Form.Item name="code" noStyle rules={[{required: true, message: '请输入验证码'}]}>
+                                <Input prefix={<SafetyOutlined/>} placeholder="验证码" maxLength={6} autoComplete="one-time-code"/>
+                            </Form.Item>
+                            <Button loading={sending} disabled={countdown > 0} onClick={handlerSendSmsCode}>
+                                {countdown > 0 ? `${countdown} 秒后重发` : "获取验证码"}
+                            </Button>
+                        </div>
+                    </Form.Item>
+                    <Form.Item>
+                        <Button type="primary" htmlType="submit" block loading={smsLoading}>
+                            登 录
+                        </Button>
+                    </Form.Item>
+                    <Button type={"link"} onClick={() => setSmsMode(false)}>账号密码登录</Button>
+                </Form>
+            </div>
+        )
     }
 
     return (
@@ -52,7 +269,6 @@ const Login: React.FC = () => {
                 onFinish={handlerSubmit}
                 style={{
                     width: "400px",
-                    height: "400px",
                     marginTop: "15%",
                     background: "#fff",
                     padding: 50,
@@ -86,7 +302,7 @@ const Login: React.FC = () => {
                     </Form.Item>
 
                     <Button type={"link"} className="login-form-forgot" style={{float: "right"}}
-                            onClick={showModal}>
+                            onClick={() => navigate("/forgot-password")}>
                         忘记密码
                     </Button>
                 </Form.Item>
@@ -95,8 +311,20 @@ const Login: React.FC = () => {
                     <Button type="primary" htmlType="submit" className="login-form-button" block loading={isLoading}>
                         登 录
                     </Button>
-                    或者 <Button type={"link"} onClick={showModal}>注册</Button>
+                    或者 <Button type={"link"} onClick={() => navigate("/register")}>注册</Button>
                 </Form.Item>
+
+                <Form.Item>
+                    <Button icon={<MobileOutlined/>} block onClick={() => setSmsMode(true)}>
+                        短信验证码登录
+                    </Button>
+                </Form.Item>
+
+                {webAuthnSupported() && (
+                    <Button icon={<KeyOutlined/>} block loading={passkeyLoading} onClick={handlerWebAuthn}>
+                        通行密钥登录
+                    </Button>
+                )}
             </Form>
         </div>
     )
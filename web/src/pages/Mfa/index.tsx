@@ -0,0 +1,358 @@
+import React, {useState} from "react";
+import {
+    App as AntdApp,
+    Button,
+    Descriptions,
+    Form,
+    Input,
+    List,
+    Popconfirm,
+    QRCode,
+    Result,
+    Space,
+    Spin,
+    Tag,
+    Typography
+} from "antd";
+import styles from "../Login/login.module.scss";
+import {useNavigate} from "react-router-dom";
+import {
+    useBeginTotpMutation,
+    useBeginWebAuthnRegistrationMutation,
+    useBeginWebAuthnStepUpMutation,
+    useConfirmTotpMutation,
+    useDisableTotpMutation,
+    useFinishWebAuthnRegistrationMutation,
+    useFinishWebAuthnStepUpMutation,
+    useGenerateRecoveryCodesMutation,
+    useGetMfaFactorsQuery,
+    useGetMfaQuery,
+    useRemoveMfaFactorMutation,
+    useRenameMfaFactorMutation,
+    useVerifyMfaMutation,
+    useVerifyRecoveryMutation
+} from "../../apis/accountApi";
+import {createCredential, getCredential, webAuthnSupported} from "../../apis/webauthn";
+import {KeyOutlined, SafetyOutlined} from "@ant-design/icons";
+
+// 完成两步验证后继续授权
+const continueTo = (url: string) => {
+    window.location.href = `${import.meta.env.VITE_APP_SERVER_ENDPOINT}${url}`
+}
+
+// CodeForm 输入认证器应用中的一次性密码,recovery 为 true 时输入恢复码
+const CodeForm: React.FC<{ name: string, label: string, loading: boolean, recovery?: boolean, onSubmit: (code: string) => Promise<any> }> = ({name, label, loading, recovery, onSubmit}) => {
+
+    const [form] = Form.useForm();
+
+    return (
+        <Form form={form} name={name} layout="inline" style={{marginTop: 20}}
+              onFinish={(values: any) => onSubmit(values.code).finally(() => form.resetFields())}>
+            <Form.Item name="code" rules={[{required: true, message: recovery ? '请输入恢复码' : '请输入一次性密码'}]}>
+                {recovery
+                    ? <Input prefix={<SafetyOutlined/>} placeholder="恢复码" autoComplete="off"/>
+                    : <Input prefix={<SafetyOutlined/>} placeholder="一次性密码" maxLength={6} autoComplete="one-time-code"/>}
+            </Form.Item>
+            <Form.Item>
+                <Button type="primary" htmlType="submit" loading={loading}>{label}</Button>
+            </Form.Item>
+        </Form>
+    )
+}
+
+// Factors 管理已绑定的验证方式(认证器应用、安全密钥与通行密钥),移除须近期完成过两步验证
+const Factors: React.FC<{ onError: (fallback: string) => (err: any) => void, onChange: () => void }> = ({onError, onChange}) => {
+
+    const {message} = AntdApp.useApp();
+    const [form] = Form.useForm();
+
+    const {data, refetch} = useGetMfaFactorsQuery();
+    const [beginFn] = useBeginWebAuthnRegistrationMutation();
+    const [finishFn] = useFinishWebAuthnRegistrationMutation();
+    const [renameFn] = useRenameMfaFactorMutation();
+    const [removeFn] = useRemoveMfaFactorMutation();
+    const [adding, setAdding] = useState(false);
+    const [editing, setEditing] = useState<string>();
+
+    const add = async (values: any) => {
+        setAdding(true)
+        try {
+            const options = await beginFn().unwrap()
+            const credential = await createCredential(options.data)
+            await finishFn({name: values.name, credential}).unwrap()
+            message.success("安全密钥已添加")
+            form.resetFields()
+            refetch()
+            onChange()
+        } catch (err: any) {
+            // 用户取消或超时
+            if (err?.name !== "NotAllowedError") {
+                onError(err?.name === "InvalidStateError" ? "该安全密钥已添加" : "添加失败")(err)
+            }
+        } finally {
+            setAdding(false)
+        }
+    }
+
+    const rename = (id: string, name: string) => renameFn({id, name}).unwrap().then(() => {
+        setEditing(undefined)
+        refetch()
+    }).catch(onError("修改失败"))
+
+    const remove = (id: string) => removeFn({id}).unwrap().then(() => {
+        message.success("验证方式已移除")
+        refetch()
+        onChange()
+    }).catch(onError("移除失败"))
+
+    return (
+        <div style={{marginTop: 20}}>
+            <List
+                size="small"
+                bordered
+                header="验证方式"
+                dataSource={data?.data ?? []}
+                renderItem={(item: any) => (
+                    <List.Item actions={[
+                        <Button key="rename" type="link" size="small" onClick={() => setEditing(item.id)}>重命名</Button>,
+                        <Popconfirm key="remove" title="确定移除该验证方式？" onConfirm={() => remove(item.id)}>
+                            <Button type="link" size="small" danger>移除</Button>
+                        </Popconfirm>
+                    ]}>
+                        {editing === item.id ? (
+                            <Input.Search size="small" defaultValue={item.name} maxLength={64} enterButton="保存"
+                                          onSearch={(name) => name && rename(item.id, name)}/>
+                        ) : (
+                            <List.Item.Meta
+                                title={<Space>
+                                    {item.name}
+                                    {item.type === "totp" ? <Tag>认证器应用</Tag> : <Tag>安全密钥</Tag>}
+                                    {item.passkey && <Tag color="blue">通行密钥</Tag>}
+                                </Space>}
+                                description={`添加于 ${new Date(item.created_at).toLocaleString()}` +
+                                    (item.last_used_at ? `，最近使用 ${new Date(item.last_used_at).toLocaleString()}` : "")}
+                            />
+                        )}
+                    </List.Item>
+                )}
+            />
+            {webAuthnSupported() && (
+                <Form form={form} name="add-webauthn" layout="inline" style={{marginTop: 10}} onFinish={add}>
+                    <Form.Item name="name">
+                        <Input prefix={<KeyOutlined/>} placeholder="名称（可选）" maxLength={64}/>
+                    </Form.Item>
+                    <Form.Item>
+                        <Button htmlType="submit" loading={adding}>添加安全密钥</Button>
+                    </Form.Item>
+                </Form>
+            )}
+        </div>
+    )
+}
+
+// RecoveryCodes 生成恢复码,恢复码只在生成后展示一次
+const RecoveryCodes: React.FC<{ remaining: number, onError: (fallback: string) => (err: any) => void, onChange: () => void }> = ({remaining, onError, onChange}) => {
+
+    const [generateFn, {data, isLoading, reset}] = useGenerateRecoveryCodesMutation();
+
+    const generate = () => generateFn().unwrap().then(onChange).catch(onError("生成失败"))
+
+    const codes: string[] = data?.data?.codes ?? [];
+
+    return (
+        <div style={{marginTop: 20}}>
+            <Space>
+                <span>恢复码：剩余 {remaining} 个</span>
+                {remaining > 0 ? (
+                    <Popconfirm title="重新生成后之前的恢复码全部失效，确定继续？" onConfirm={generate}>
+                        <Button size="small" loading={isLoading}>重新生成</Button>
+                    </Popconfirm>
+                ) : (
+                    <Button size="small" loading={isLoading} onClick={generate}>生成恢复码</Button>
+                )}
+            </Space>
+            {codes.length > 0 && (
+                <div style={{marginTop: 10}}>
+                    <p>请妥善保存以下恢复码。丢失认证器应用或安全密钥时，每个恢复码可代替一次两步验证。关闭后将无法再次查看。</p>
+                    <Typography.Paragraph copyable code style={{whiteSpace: "pre-line"}}>
+                        {codes.join("\n")}
+                    </Typography.Paragraph>
+                    <Button size="small" onClick={reset}>我已保存</Button>
+                </div>
+            )}
+        </div>
+    )
+}
+
+const Mfa: React.FC = () => {
+
+    const navigate = useNavigate();
+    const {message, notification} = AntdApp.useApp();
+
+    const {data, error, isLoading, refetch} = useGetMfaQuery();
+    const [beginFn, {data: enrollment, isLoading: beginning, reset: resetEnrollment}] = useBeginTotpMutation();
+    const [confirmFn, {isLoading: confirming}] = useConfirmTotpMutation();
+    const [verifyFn, {isLoading: verifying}] = useVerifyMfaMutation();
+    const [disableFn, {isLoading: disabling}] = useDisableTotpMutation();
+    const [recoverFn, {isLoading: recovering}] = useVerifyRecoveryMutation();
+    const [beginStepUpFn] = useBeginWebAuthnStepUpMutation();
+    const [finishStepUpFn] = useFinishWebAuthnStepUpMutation();
+    const [stepping, setStepping] = useState(false);
+    const [showDisable, setShowDisable] = useState(false);
+    // 敏感操作超出重新验证时限,须再次完成两步验证
+    const [reauth, setReauth] = useState(false);
+
+    const onError = (fallback: string) => (err: any) => {
+        if (err?.status === 403) {
+            setReauth(true)
+        }
+        notification.error({
+            description: err?.data?.message ?? fallback,
+            message: '出错了'
+        });
+    }
+
+    if (isLoading) {
+        return <div className={styles.container}><Spin/></div>
+    }
+
+    if (error || !data?.data) {
+        return (
+            <div className={styles.container}>
+                <Result
+                    status="warning"
+                    title="请先登录"
+                    extra={<Button type="primary" onClick={() => navigate("/login")}>登录</Button>}
+                />
+            </div>
+        )
+    }
+
+    const status = data.data;
+
+    const begin = () => beginFn().unwrap().catch(onError("获取密钥失败"))
+
+    const confirm = (code: string) => confirmFn({code}).unwrap().then(() => {
+        message.success("认证器应用已绑定")
+        resetEnrollment()
+        refetch()
+    }).catch(onError("验证失败"))
+
+    const verified = () => {
+        message.success("两步验证已完成")
+        setReauth(false)
+        refetch()
+    }
+
+    const verify = (code: string) => verifyFn({code}).unwrap().then(verified).catch(onError("验证失败"))
+
+    const recover = (code: string) => recoverFn({code}).unwrap().then(verified).catch(onError("验证失败"))
+
+    const verifyWebAuthn = async () => {
+        setStepping(true)
+        try {
+            const options = await beginStepUpFn().unwrap()
+            const credential = await getCredential(options.data)
+            await finishStepUpFn({credential}).unwrap()
+            verified()
+        } catch (err: any) {
+            // 用户取消或超时
+            if (err?.name !== "NotAllowedError") {
+                onError("验证失败")(err)
+            }
+        } finally {
+            setStepping(false)
+        }
+    }
+
+    const disable = (code: string) => disableFn({code}).unwrap().then(() => {
+        message.success("认证器应用已解除绑定")
+        setShowDisable(false)
+        refetch()
+    }).catch(onError("解除失败"))
+
+    const uri = enrollment?.data?.otpauth_uri;
+
+    return (
+        <div className={styles.container}>
+            <div
+                style={{
+                    width: "480px",
+                    marginTop: "10%",
+                    marginBottom: "auto",
+                    background: "#fff",
+                    padding: 50,
+                    borderRadius: "6px"
+                }}
+            >
+                <h1 style={{marginBottom: '30px'}}>两步验证</h1>
+                {status.continue_url && !status.satisfied && <p>继续访问前，请先完成两步验证。</p>}
+
+                <Descriptions column={1} bordered size="small">
+                    <Descriptions.Item label="认证器应用">
+                        <Space>
+                            {status.totp ? <Tag color="success">已绑定</Tag> : <Tag>未绑定</Tag>}
+                            {status.required && <Tag color="warning">账号须两步验证</Tag>}
+                        </Space>
+                    </Descriptions.Item>
+                    <Descriptions.Item label="安全密钥">
+                        {status.webauthn ? <Tag color="success">已注册</Tag> : <Tag>未注册</Tag>}
+                    </Descriptions.Item>
+                    <Descriptions.Item label="当前会话">
+                        {status.satisfied ? <Tag color="success">已验证</Tag> : <Tag>未验证</Tag>}
+                    </Descriptions.Item>
+                </Descriptions>
+
+                {!status.totp && !uri && (
+                    <Button type="primary" style={{marginTop: 20}} loading={beginning} onClick={begin}>绑定认证器应用</Button>
+                )}
+
+                {!status.totp && uri && (
+                    <div style={{marginTop: 20}}>
+                        <p>使用认证器应用扫描二维码，或手动输入密钥，然后输入应用中显示的一次性密码。</p>
+                        <QRCode value={uri}/>
+                        <Typography.Paragraph copyable code style={{marginTop: 10}}>
+                            {enrollment.data.secret}
+                        </Typography.Paragraph>
+                        <CodeForm name="confirm-totp" label="绑定" loading={confirming} onSubmit={confirm}/>
+                    </div>
+                )}
+
+                {reauth && status.satisfied && <p style={{marginTop: 20}}>该操作须重新完成两步验证。</p>}
+
+                {status.totp && (!status.satisfied || reauth) && (
+                    <CodeForm name="verify-mfa" label="验证" loading={verifying} onSubmit={verify}/>
+                )}
+
+                {status.webauthn && (!status.satisfied || reauth) && webAuthnSupported() && (
+                    <Button icon={<KeyOutlined/>} style={{marginTop: 20}} loading={stepping} onClick={verifyWebAuthn}>
+                        使用安全密钥验证
+                    </Button>
+                )}
+
+                {status.recovery_codes > 0 && (!status.satisfied || reauth) && (
+                    <CodeForm name="verify-recovery" label="使用恢复码" loading={recovering} recovery onSubmit={recover}/>
+                )}
+
+                {status.totp && showDisable && (
+                    <CodeForm name="disable-totp" label="解除绑定" loading={disabling} onSubmit={disable}/>
+                )}
+
+                {(status.satisfied || (!status.totp && !status.webauthn)) &&
+                    <Factors onError={onError} onChange={refetch}/>}
+
+                {status.satisfied && (status.totp || status.webauthn) &&
+                    <RecoveryCodes remaining={status.recovery_codes} onError={onError} onChange={refetch}/>}
+
+                <Space style={{marginTop: 30}}>
+                    {status.continue_url && status.satisfied &&
+                        <Button type="primary" onClick={() => continueTo(status.continue_url)}>继续</Button>}
+                    {status.totp && !status.required && !showDisable &&
+                        <Button danger onClick={() => setShowDisable(true)}>解除绑定</Button>}
+                    <Button onClick={() => refetch()}>刷新状态</Button>
+                </Space>
+            </div>
+        </div>
+    )
+}
+export default Mfa;
@@ -0,0 +1,105 @@
+import React from "react";
+import {App as AntdApp, Button, Form, Input} from "antd";
+import styles from "../Login/login.module.scss";
+import {useNavigate} from "react-router-dom";
+import {useRegisterMutation} from "../../apis/accountApi";
+import {LockOutlined, MailOutlined, MobileOutlined, UserOutlined} from "@ant-design/icons";
+
+const Register: React.FC = () => {
+
+    const navigate = useNavigate();
+
+    const [form] = Form.useForm();
+    const [registerFn, {isLoading}] = useRegisterMutation();
+    const {message, notification} = AntdApp.useApp();
+    const handlerSubmit = async (values: any) => {
+        registerFn({
+            username: values.username,
+            password: values.password,
+            email: values.email || undefined,
+            phone: values.phone || undefined,
+            invite_code: values.invite_code || undefined,
+        }).unwrap().then(data => {
+            message.success("注册成功")
+            // 注册前有待完成的授权请求时继续授权
+            window.location.href = `${import.meta.env.VITE_APP_SERVER_ENDPOINT}${data.data.continue_url || "/"}`
+        }).catch(err => {
+            notification.error({
+                description: err?.data?.message ?? "注册失败",
+                message: '出错了'
+            });
+        })
+    };
+
+    return (
+        <div className={styles.container}>
+
+            <Form
+                form={form}
+                name="register"
+                onFinish={handlerSubmit}
+                style={{
+                    width: "400px",
+                    marginTop: "10%",
+                    marginBottom: "auto",
+                    background: "#fff",
+                    padding: 50,
+                    borderRadius: "6px"
+                }}
+            >
+
+                <h1 style={{marginBottom: '30px'}}>注册</h1>
+
+                <Form.Item
+                    name="username"
+                    rules={[{required: true, message: '用户名不能为空'}]}
+                    extra="以字母开头，3-32 位字母、数字、_ . -"
+                >
+                    <Input prefix={<UserOutlined/>} placeholder="用户名"/>
+                </Form.Item>
+
+                <Form.Item name="email" rules={[{type: "email", message: '邮箱格式错误'}]}>
+                    <Input prefix={<MailOutlined/>} placeholder="邮箱"/>
+                </Form.Item>
+
+                <Form.Item name="phone" extra="带国家码，如 +8613800000000">
+                    <Input prefix={<MobileOutlined/>} placeholder="手机号"/>
+                </Form.Item>
+
+                <Form.Item
+                    name="password"
+                    rules={[{required: true, message: '密码不能为空'}]}
+                >
+                    <Input.Password prefix={<LockOutlined/>} placeholder="密码"/>
+                </Form.Item>
+
+                <Form.Item
+                    name="confirm"
+                    dependencies={["password"]}
+                    rules={[
+                        {required: true, message: '请再次输入密码'},
+                        ({getFieldValue}) => ({
+                            validator: (_, value) => !value || getFieldValue("password") === value
+                                ? Promise.resolve()
+                                : Promise.reject(new Error("两次输入的密码不一致")),
+                        }),
+                    ]}
+                >
+                    <Input.Password prefix={<LockOutlined/>} placeholder="确认密码"/>
+                </Form.Item>
+
+                <Form.Item name="invite_code">
+                    <Input placeholder="邀请码（如需要）"/>
+                </Form.Item>
+
+                <Form.Item>
+                    <Button type="primary" htmlType="submit" block loading={isLoading}>
+                        注 册
+                    </Button>
+                    已有账号？<Button type={"link"} onClick={() => navigate("/login")}>登录</Button>
+                </Form.Item>
+            </Form>
+        </div>
+    )
+}
+export default Register;
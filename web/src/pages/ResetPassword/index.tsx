@@ -0,0 +1,94 @@
+import React from "react";
+import {App as AntdApp, Button, Form, Input, Result} from "antd";
+import styles from "../Login/login.module.scss";
+import {useNavigate, useSearchParams} from "react-router-dom";
+import {useResetPasswordMutation} from "../../apis/accountApi";
+import {LockOutlined} from "@ant-design/icons";
+
+const ResetPassword: React.FC = () => {
+
+    const navigate = useNavigate();
+    const [params] = useSearchParams();
+    const token = params.get("token") ?? "";
+
+    const [resetFn, {isLoading}] = useResetPasswordMutation();
+    const {message, notification} = AntdApp.useApp();
+    const handlerSubmit = async (values: any) => {
+        resetFn({
+            token,
+            password: values.password,
+        }).unwrap().then(() => {
+            message.success("密码已重置，请重新登录")
+            navigate("/login")
+        }).catch(err => {
+            notification.error({
+                description: err?.data?.message ?? "重置失败",
+                message: '出错了'
+            });
+        })
+    };
+
+    if (!token) {
+        return (
+            <div className={styles.container}>
+                <Result
+                    status="warning"
+                    title="链接无效"
+                    subTitle="请从找回密码邮件中打开链接，或重新申请。"
+                    extra={<Button type="primary" onClick={() => navigate("/forgot-password")}>找回密码</Button>}
+                />
+            </div>
+        )
+    }
+
+    return (
+        <div className={styles.container}>
+
+            <Form
+                name="reset-password"
+                onFinish={handlerSubmit}
+                style={{
+                    width: "400px",
+                    marginTop: "10%",
+                    marginBottom: "auto",
+                    background: "#fff",
+                    padding: 50,
+                    borderRadius: "6px"
+                }}
+            >
+
+                <h1 style={{marginBottom: '30px'}}>设置新密码</h1>
+
+                <Form.Item
+                    name="password"
+                    rules={[{required: true, message: '密码不能为空'}]}
+                >
+                    <Input.Password prefix={<LockOutlined/>} placeholder="新密码"/>
+                </Form.Item>
+
+                <Form.Item
+                    name="confirm"
+                    dependencies={["password"]}
+                    rules={[
+                        {required: true, message: '请再次输入密码'},
+                        ({getFieldValue}) => ({
+                            validator: (_, value) => !value || getFieldValue("password") === value
+                                ? Promise.resolve()
+                                : Promise.reject(new Error("两次输入的密码不一致")),
+                        }),
+                    ]}
+                >
+                    <Input.Password prefix={<LockOutlined/>} placeholder="确认新密码"/>
+                </Form.Item>
+
+                <Form.Item>
+                    <Button type="primary" htmlType="submit" block loading={isLoading}>
+                        重置密码
+                    </Button>
+                    <Button type={"link"} onClick={() => navigate("/login")}>返回登录</Button>
+                </Form.Item>
+            </Form>
+        </div>
+    )
+}
+export default ResetPassword;
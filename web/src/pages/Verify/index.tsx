@@ -0,0 +1,175 @@
+import React, {useEffect, useRef} from "react";
+import {App as AntdApp, Button, Descriptions, Form, Input, Result, Space, Spin, Tag} from "antd";
+import styles from "../Login/login.module.scss";
+import {useNavigate, useSearchParams} from "react-router-dom";
+import {
+    useConfirmEmailVerificationMutation,
+    useConfirmPhoneVerificationMutation,
+    useGetVerificationQuery,
+    useSendEmailVerificationMutation,
+    useSendPhoneVerificationMutation
+} from "../../apis/accountApi";
+import {SafetyOutlined} from "@ant-design/icons";
+
+// 验证完成后继续授权
+const continueTo = (url: string) => {
+    window.location.href = `${import.meta.env.VITE_APP_SERVER_ENDPOINT}${url}`
+}
+
+// ConfirmEmail 打开验证邮件中的链接
+const ConfirmEmail: React.FC<{ token: string }> = ({token}) => {
+
+    const navigate = useNavigate();
+    const [confirmFn, {data, error, isLoading, isUninitialized}] = useConfirmEmailVerificationMutation();
+
+    // 令牌只能使用一次,避免重复提交
+    const submitted = useRef(false);
+    useEffect(() => {
+        if (!submitted.current) {
+            submitted.current = true
+            confirmFn({token})
+        }
+    }, [confirmFn, token]);
+
+    if (isUninitialized || isLoading) {
+        return <Spin/>
+    }
+
+    if (error) {
+        return (
+            <Result
+                status="warning"
+                title="链接无效"
+                subTitle="验证链接无效或已过期，请登录后重新发送验证邮件。"
+                extra={<Button type="primary" onClick={() => navigate("/verify")}>重新发送</Button>}
+            />
+        )
+    }
+
+    const continueURL = data?.data?.continue_url;
+    return (
+        <Result
+            status="success"
+            title="邮箱已验证"
+            extra={continueURL
+                ? <Button type="primary" onClick={() => continueTo(continueURL)}>继续</Button>
+                : <Button type="primary" onClick={() => navigate("/login")}>返回登录</Button>}
+        />
+    )
+}
+
+// VerifyContacts 查看验证状态并发送验证邮件或短信验证码
+const VerifyContacts: React.FC<{ require: string[] }> = ({require}) => {
+
+    const navigate = useNavigate();
+    const {message, notification} = AntdApp.useApp();
+
+    const {data, error, isLoading, refetch} = useGetVerificationQuery();
+    const [sendEmailFn, {isLoading: sendingEmail}] = useSendEmailVerificationMutation();
+    const [sendPhoneFn, {isLoading: sendingPhone}] = useSendPhoneVerificationMutation();
+    const [confirmPhoneFn, {isLoading: confirming}] = useConfirmPhoneVerificationMutation();
+
+    const onError = (fallback: string) => (err: any) => {
+        notification.error({
+            description: err?.data?.message ?? fallback,
+            message: '出错了'
+        });
+    }
+
+    if (isLoading) {
+        return <Spin/>
+    }
+
+    if (error || !data?.data) {
+        return (
+            <Result
+                status="warning"
+                title="请先登录"
+                extra={<Button type="primary" onClick={() => navigate("/login")}>登录</Button>}
+            />
+        )
+    }
+
+    const status = data.data;
+    const verified = (channel: string) => channel === "email" ? status.email_verified : status.phone_verified;
+    const done = require.length > 0 && require.every(verified);
+
+    const sendEmail = () => sendEmailFn().unwrap().then(() => {
+        message.success("验证邮件已发送，请查收")
+    }).catch(onError("发送失败"))
+
+    const sendPhone = () => sendPhoneFn().unwrap().then(() => {
+        message.success("验证码已发送")
+    }).catch(onError("发送失败"))
+
+    const confirmPhone = (values: any) => confirmPhoneFn({code: values.code}).unwrap().then(() => {
+        message.success("手机号已验证")
+        refetch()
+    }).catch(onError("验证失败"))
+
+    return (
+        <div
+            style={{
+                width: "480px",
+                marginTop: "10%",
+                marginBottom: "auto",
+                background: "#fff",
+                padding: 50,
+                borderRadius: "6px"
+            }}
+        >
+            <h1 style={{marginBottom: '30px'}}>验证联系方式</h1>
+            {require.length > 0 && !done && <p>继续访问前，请先完成以下验证。</p>}
+
+            <Descriptions column={1} bordered size="small">
+                <Descriptions.Item label="邮箱">
+                    <Space>
+                        {status.email || "未绑定"}
+                        {status.email && (status.email_verified
+                            ? <Tag color="success">已验证</Tag>
+                            : <Button size="small" loading={sendingEmail} onClick={sendEmail}>发送验证邮件</Button>)}
+                    </Space>
+                </Descriptions.Item>
+                <Descriptions.Item label="手机号">
+                    <Space>
+                        {status.phone || "未绑定"}
+                        {status.phone && (status.phone_verified
+                            ? <Tag color="success">已验证</Tag>
+                            : <Button size="small" loading={sendingPhone} onClick={sendPhone}>发送验证码</Button>)}
+                    </Space>
+                </Descriptions.Item>
+            </Descriptions>
+
+            {status.phone && !status.phone_verified && (
+                <Form name="verify-phone" layout="inline" onFinish={confirmPhone} style={{marginTop: 20}}>
+                    <Form.Item name="code" rules={[{required: true, message: '请输入验证码'}]}>
+                        <Input prefix={<SafetyOutlined/>} placeholder="短信验证码" maxLength={6}/>
+                    </Form.Item>
+                    <Form.Item>
+                        <Button type="primary" htmlType="submit" loading={confirming}>验证</Button>
+                    </Form.Item>
+                </Form>
+            )}
+
+            <Space style={{marginTop: 30}}>
+                {status.continue_url && (require.length === 0 || done) &&
+                    <Button type="primary" onClick={() => continueTo(status.continue_url)}>继续</Button>}
+                <Button onClick={() => refetch()}>刷新状态</Button>
+            </Space>
+        </div>
+    )
+}
+
+const Verify: React.FC = () => {
+
+    const [params] = useSearchParams();
+    const token = params.get("token");
+    const require = (params.get("require") ?? "").split(",").filter(Boolean);
+
+    return (
+        <div className={styles.container}>
+            {token ? <ConfirmEmail token={token}/> : <VerifyContacts require={require}/>}
+        </div>
+    )
+}
+export default Verify;
@@ -1,11 +1,36 @@
 import React from "react";
 import {MenuRouteObject} from "../router";
 import Login from "../../pages/Login";
+import Register from "../../pages/Register";
+import ForgotPassword from "../../pages/ForgotPassword";
+import ResetPassword from "../../pages/ResetPassword";
+import Verify from "../../pages/Verify";
+import Mfa from "../../pages/Mfa";
 
 const front: MenuRouteObject[] =[
     {
         path: "/login",
         element: <Login/>,
+    },
+    {
+        path: "/register",
+        element: <Register/>,
+    },
+    {
+        path: "/forgot-password",
+        element: <ForgotPassword/>,
+    },
+    {
+        path: "/reset-password",
+        element: <ResetPassword/>,
+    },
+    {
+        path: "/verify",
+        element: <Verify/>,
+    },
+    {
+        path: "/mfa",
+        element: <Mfa/>,
     }
 ]
 